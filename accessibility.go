@@ -0,0 +1,170 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Сведения о доступности гостиницы для людей с ограниченной подвижностью.
+//
+// В отличие от произвольных атрибутов (attributes.go) набор полей здесь фиксирован:
+// его требует регулятор, и поля должны одинаково называться и проверяться у всех
+// гостиниц. Хранится в hotels.accessibility (JSONB). Каждый признак — *bool:
+// nil значит «не известно», и это не то же самое, что false — гостиница без
+// сведений не должна выглядеть недоступной.
+//
+// В публичном списке и на карте работает фильтр ?accessible=step_free_access,elevator:
+// остаются гостиницы, у которых все перечисленные признаки подтверждены (true).
+
+// Accessibility — сведения о доступности гостиницы.
+type Accessibility struct {
+	StepFreeAccess    *bool  `json:"step_free_access,omitempty"`
+	Elevator          *bool  `json:"elevator,omitempty"`
+	RollInShower      *bool  `json:"roll_in_shower,omitempty"`
+	AccessibleParking *bool  `json:"accessible_parking,omitempty"`
+	AccessibleRooms   *int   `json:"accessible_rooms,omitempty"`
+	DoorWidthCm       *int   `json:"door_width_cm,omitempty"`
+	Notes             string `json:"notes,omitempty"`
+	// UpdatedAt проставляет сервер при каждом изменении.
+	UpdatedAt *time.Time `json:"updated_at,omitempty"`
+}
+
+// accessibilityNotesLimit — максимальная длина свободного описания.
+const accessibilityNotesLimit = 1000
+
+// accessibilityFeatures — признаки, по которым работает фильтр ?accessible=.
+var accessibilityFeatures = map[string]func(a *Accessibility) *bool{
+	"step_free_access":   func(a *Accessibility) *bool { return a.StepFreeAccess },
+	"elevator":           func(a *Accessibility) *bool { return a.Elevator },
+	"roll_in_shower":     func(a *Accessibility) *bool { return a.RollInShower },
+	"accessible_parking": func(a *Accessibility) *bool { return a.AccessibleParking },
+}
+
+// validate проверяет значения.
+func (a *Accessibility) validate() error {
+	if a.AccessibleRooms != nil && *a.AccessibleRooms < 0 {
+		return fmt.Errorf("accessible_rooms must not be negative")
+	}
+	if a.DoorWidthCm != nil && (*a.DoorWidthCm < 40 || *a.DoorWidthCm > 300) {
+		return fmt.Errorf("door_width_cm must be between 40 and 300")
+	}
+	if len([]rune(a.Notes)) > accessibilityNotesLimit {
+		return fmt.Errorf("notes must be at most %d characters", accessibilityNotesLimit)
+	}
+	if a.RollInShower != nil && *a.RollInShower && (a.AccessibleRooms == nil || *a.AccessibleRooms == 0) {
+		return fmt.Errorf("roll_in_shower requires at least one accessible room")
+	}
+	return nil
+}
+
+// parseAccessibility разбирает фильтр ?accessible=<признак>[,<признак>...] в список
+// признаков (пустой — фильтра нет). При ошибке сам отвечает клиенту и возвращает false.
+func parseAccessibility(c *gin.Context) ([]string, bool) {
+	param := c.Query("accessible")
+	if param == "" {
+		return nil, true
+	}
+	var features []string
+	for _, name := range strings.Split(param, ",") {
+		name = strings.TrimSpace(name)
+		if _, ok := accessibilityFeatures[name]; !ok {
+			c.JSON(http.StatusBadRequest, Response{
+				Success: false,
+				Error:   fmt.Sprintf("unknown accessibility feature %q", name),
+				Hint:    "supported: step_free_access, elevator, roll_in_shower, accessible_parking",
+			})
+			return nil, false
+		}
+		features = append(features, name)
+	}
+	return features, true
+}
+
+// accessibilityWhere добавляет фильтр в условия запроса: каждый признак в
+// hotels.accessibility должен быть подтверждён (true). Имена признаков совпадают
+// с JSON-ключами Accessibility.
+func accessibilityWhere(q *sqlConditions, features []string) {
+	if len(features) == 0 {
+		return
+	}
+	doc := map[string]bool{}
+	for _, name := range features {
+		doc[name] = true
+	}
+	raw, _ := json.Marshal(doc)
+	q.and("h.accessibility @> " + q.arg(string(raw)) + "::jsonb")
+}
+
+// applyAccessibility применяет к списку фильтр ?accessible=<признак>[,<признак>...].
+// При ошибке сам отвечает клиенту и возвращает false.
+func applyAccessibility(c *gin.Context, hotels []Hotel) ([]Hotel, bool) {
+	features, ok := parseAccessibility(c)
+	if !ok || len(features) == 0 {
+		return hotels, ok
+	}
+
+	result := make([]Hotel, 0, len(hotels))
+	for _, h := range hotels {
+		if h.Accessibility == nil {
+			continue
+		}
+		keep := true
+		for _, name := range features {
+			if v := accessibilityFeatures[name](h.Accessibility); v == nil || !*v {
+				keep = false
+				break
+			}
+		}
+		if keep {
+			result = append(result, h)
+		}
+	}
+	return result, true
+}
+
+// setHotelAccessibility — HTTP-обработчик, заменяющий сведения о доступности гостиницы.
+// Реагирует на PUT /api/admin/hotels/:id/accessibility с телом
+// {"step_free_access": true, "elevator": true, "roll_in_shower": false, "accessible_rooms": 2};
+// неизвестные поля отклоняются, чтобы опечатка не превратилась в «не известно».
+func setHotelAccessibility(c *gin.Context) {
+	id, ok := hotelIDParam(c)
+	if !ok {
+		return
+	}
+	var a Accessibility
+	dec := json.NewDecoder(c.Request.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&a); err != nil {
+		c.JSON(http.StatusBadRequest, Response{Success: false, Error: err.Error()})
+		return
+	}
+	if err := a.validate(); err != nil {
+		c.JSON(http.StatusBadRequest, Response{Success: false, Error: err.Error()})
+		return
+	}
+	now := time.Now().UTC()
+	a.UpdatedAt = &now
+	a.Notes = strings.TrimSpace(a.Notes)
+
+	raw, err := json.Marshal(a)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	res, err := db.ExecContext(c.Request.Context(), "UPDATE hotels SET accessibility = $2 WHERE id = $1", id, string(raw))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		c.JSON(http.StatusNotFound, Response{Success: false, Error: "hotel not found"})
+		return
+	}
+	cache.flush("hotels")
+	c.JSON(http.StatusOK, Response{Success: true, Data: gin.H{"id": id, "accessibility": a}, Count: 1})
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// requireAdmin — middleware для служебных эндпоинтов под /api/admin.
+// Токен администратора берётся из переменной окружения ADMIN_TOKEN и передаётся
+// клиентом в заголовке "Authorization: Bearer <token>".
+// Если переменная не задана, админские эндпоинты полностью отключены.
+func requireAdmin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := os.Getenv("ADMIN_TOKEN")
+		if token == "" {
+			c.AbortWithStatusJSON(http.StatusForbidden, Response{
+				Success: false,
+				Error:   "admin API is disabled: ADMIN_TOKEN is not set",
+			})
+			return
+		}
+
+		got := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		// Сравнение за постоянное время, чтобы токен нельзя было подобрать по таймингам.
+		if subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, Response{
+				Success: false,
+				Error:   "invalid admin token",
+			})
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Жизненный цикл приложения.
+//
+// Подсистемы запускаются по порядку зависимостей (конфигурация → настройки →
+// секреты → БД → хранилище файлов и внешние источники → фоновые задачи → HTTP) и
+// останавливаются в обратном порядке. Если подсистема не стартовала, уже
+// запущенные останавливаются, а ошибка называет подсистему, на которой запуск
+// прервался. Команды собирают из компонентов только то, что им нужно: export —
+// ядро (coreComponents), serve — ещё фоновые задачи и серверы; так же можно
+// поднять часть приложения в тестах.
+
+// component — подсистема приложения. stop может быть nil, если останавливать нечего.
+type component struct {
+	name  string
+	start func(ctx context.Context) error
+	stop  func(ctx context.Context) error
+}
+
+// App — упорядоченный набор подсистем.
+type App struct {
+	components []component
+	started    []component
+}
+
+// newApp создаёт приложение из компонентов в порядке запуска.
+func newApp(components ...component) *App {
+	return &App{components: components}
+}
+
+// add добавляет компоненты в конец порядка запуска.
+func (a *App) add(components ...component) {
+	a.components = append(a.components, components...)
+}
+
+// start запускает компоненты по порядку. При ошибке останавливает уже запущенные
+// и возвращает ошибку с именем компонента, на котором запуск прервался.
+func (a *App) start(ctx context.Context) error {
+	for _, c := range a.components {
+		begin := time.Now()
+		if err := c.start(ctx); err != nil {
+			if stopErr := a.stop(ctx); stopErr != nil {
+				log.Printf("Error stopping after failed start: %v", stopErr)
+			}
+			return fmt.Errorf("starting %s: %w", c.name, err)
+		}
+		log.Printf("Started %s in %s", c.name, time.Since(begin).Round(time.Millisecond))
+		a.started = append(a.started, c)
+	}
+	return nil
+}
+
+// stop останавливает запущенные компоненты в обратном порядке. Ошибка одного
+// компонента не мешает остановить остальные; возвращаются все ошибки сразу.
+func (a *App) stop(ctx context.Context) error {
+	var errs []error
+	for i := len(a.started) - 1; i >= 0; i-- {
+		c := a.started[i]
+		if c.stop == nil {
+			continue
+		}
+		if err := c.stop(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("stopping %s: %w", c.name, err))
+			continue
+		}
+		log.Printf("Stopped %s", c.name)
+	}
+	a.started = nil
+	return errors.Join(errs...)
+}
+
+// coreComponents — окружение, общее для всех команд: настройки, секреты, БД,
+// хранилище файлов, GeoIP и внешние источники данных.
+func coreComponents() []component {
+	return append(databaseComponents(), serviceComponents()...)
+}
+
+// databaseComponents — подсистемы до подключения к БД включительно: всё, что нужно
+// командам, работающим только со схемой (см. migrate.go).
+func databaseComponents() []component {
+	return []component{
+		// С ошибкой в конфигурации не стартуем.
+		{name: "config", start: func(context.Context) error { return initConfig() }},
+		{name: "settings", start: func(context.Context) error {
+			_, err := reloadSettings()
+			return err
+		}},
+		// Провайдер секретов нужен до подключения к БД: из него берётся пароль.
+		{name: "secrets", start: func(context.Context) error { return initSecrets() }},
+		// Без БД ни одна команда работать не может.
+		{name: "database", start: initDB,
+			stop: func(context.Context) error { return db.Close() }},
+	}
+}
+
+// serviceComponents — остальные подсистемы ядра, запускаемые после подключения к БД.
+func serviceComponents() []component {
+	return []component{
+		// Ключ подписи ссылок тоже берётся из провайдера секретов.
+		{name: "blob store", start: func(context.Context) error { return initBlobStore() }},
+		// И ключ подписи токенов доступа пользователей.
+		{name: "auth", start: func(context.Context) error { return initAuth() }},
+		// База GeoIP для определения страны клиента (необязательна).
+		{name: "geoip", start: func(context.Context) error { return initGeoIP() }},
+		// Внешние источники погоды и событий для страниц городов.
+		{name: "enrichment", start: func(context.Context) error { return initEnrichment() }},
+	}
+}
+
+// workersComponent запускает фоновые задачи. При остановке им отменяется контекст,
+// и компонент дожидается их выхода (в пределах ctx), чтобы пул соединений с БД
+// закрывался уже после них.
+func workersComponent() component {
+	var cancel context.CancelFunc
+	var wg sync.WaitGroup
+	return component{
+		name: "background workers",
+		start: func(context.Context) error {
+			var ctx context.Context
+			ctx, cancel = context.WithCancel(context.Background())
+			for _, worker := range []func(context.Context){
+				// Повторное чтение настроек по SIGHUP.
+				watchSettingsReload,
+				// Отслеживаем ротацию пароля БД в хранилище секретов.
+				watchDBPasswordRotation,
+				// Фоновая запись счётчиков использования API в БД.
+				runUsageFlusher,
+				// Фоновый сбор отчёта советника по индексам.
+				runIndexAdvisor,
+				// Проверка восстановимости резервных копий по расписанию (если включена).
+				runDRCheckScheduler,
+				// Ежедневные снимки открытых данных.
+				runOpenDataSnapshots,
+				// Очистка осиротевших объектов хранилища файлов.
+				runBlobCleanupScheduler,
+				// Проверка подписок на снижение цены.
+				runPriceAlertScheduler,
+			} {
+				wg.Add(1)
+				go func(worker func(context.Context)) {
+					defer wg.Done()
+					worker(ctx)
+				}(worker)
+			}
+			return nil
+		},
+		stop: func(ctx context.Context) error {
+			cancel()
+			return waitContext(ctx, &wg)
+		},
+	}
+}
+
+// jobsComponent при остановке дожидается начатых административных задач (см. jobs.go):
+// прервать их нельзя, но и закрывать БД у них из-под ног не стоит.
+func jobsComponent() component {
+	return component{
+		name:  "admin jobs",
+		start: func(context.Context) error { return nil },
+		stop:  jobs.wait,
+	}
+}
+
+// waitContext дожидается wg, но не дольше ctx.
+func waitContext(ctx context.Context, wg *sync.WaitGroup) error {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// sleepContext ждёт d и возвращает false, если раньше отменили ctx.
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-t.C:
+		return true
+	}
+}
+
+// httpServers — HTTP-серверы приложения как компонент.
+// Ошибки работающих серверов приходят в errs.
+type httpServers struct {
+	servers []namedServer
+	running []*http.Server
+	errs    chan error
+}
+
+// component возвращает компонент, открывающий сокеты и запускающий серверы.
+func (h *httpServers) component() component {
+	return component{name: "http servers", start: h.start, stop: h.stop}
+}
+
+// start сначала открывает все сокеты, чтобы ошибка в любом адресе остановила запуск целиком,
+// и только потом начинает обслуживать запросы.
+func (h *httpServers) start(context.Context) error {
+	listeners := make([]net.Listener, len(h.servers))
+	for i, srv := range h.servers {
+		ln, err := listen(srv.addr)
+		if err != nil {
+			for _, opened := range listeners[:i] {
+				opened.Close()
+			}
+			return fmt.Errorf("failed to listen on %s (%s): %w", srv.addr, srv.name, err)
+		}
+		listeners[i] = ln
+	}
+
+	// Serve блокирует горутину, пока сервер работает; первая же ошибка любого сервера завершает процесс.
+	h.errs = make(chan error, len(h.servers))
+	for i, srv := range h.servers {
+		hs := &http.Server{Handler: srv.handler}
+		h.running = append(h.running, hs)
+		log.Printf("Server %s starting on %s", srv.name, listeners[i].Addr())
+		go func(srv namedServer, hs *http.Server, ln net.Listener) {
+			if err := hs.Serve(ln); err != http.ErrServerClosed {
+				h.errs <- fmt.Errorf("%s server: %w", srv.name, err)
+			}
+		}(srv, hs, listeners[i])
+	}
+	return nil
+}
+
+// stop перестаёт принимать соединения и дожидается начатых запросов (в пределах ctx).
+func (h *httpServers) stop(ctx context.Context) error {
+	var errs []error
+	for _, hs := range h.running {
+		if err := hs.Shutdown(ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// manageSocketComponent открывает локальный управляющий сокет (см. manage.go).
+func manageSocketComponent(path string) component {
+	var ln net.Listener
+	return component{
+		name: "management socket",
+		start: func(context.Context) error {
+			var err error
+			if ln, err = listenManageSocket(path); err != nil {
+				return err
+			}
+			log.Printf("Management socket listening on %s", path)
+			go serveManageSocket(ln)
+			return nil
+		},
+		stop: func(context.Context) error { return ln.Close() },
+	}
+}
@@ -0,0 +1,544 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+// Произвольные атрибуты гостиниц (хранение лыж, халяльная кухня, зарядка электромобилей…).
+//
+// Значения хранятся в hotels.attributes (JSONB-объект ключ → значение), а допустимые
+// ключи и их типы — в реестре:
+//
+//	attribute_definitions(key, tenant_id NULL, type, allowed_values text[], label, created_at)
+//
+// Атрибут без tenant_id общий и виден всем; атрибут тенанта виден только запросам
+// с его API-ключами — разным рынкам нужны разные поля, и чужие в выдаче мешают.
+// Ключ уникален глобально: у одного ключа не может быть двух разных типов.
+//
+// Значение при записи проверяется по типу: bool, number, string или enum (одно из
+// allowed_values). В публичном списке гостиниц работают фильтры ?attr.<key>=<value>,
+// а GET /api/hotels/facets считает, сколько гостиниц с каждым значением атрибута.
+
+// Типы атрибутов.
+const (
+	attrBool   = "bool"
+	attrNumber = "number"
+	attrString = "string"
+	attrEnum   = "enum"
+)
+
+// attrStringLimit — максимальная длина строкового значения атрибута.
+const attrStringLimit = 200
+
+// attributeDefsCacheKey — ключ реестра атрибутов в кэше: он нужен на каждый листинг.
+const attributeDefsCacheKey = "attribute-definitions"
+
+// attrKeyRe — допустимый ключ атрибута.
+var attrKeyRe = regexp.MustCompile(`^[a-z][a-z0-9_]{0,63}$`)
+
+// attrFilterPrefix — префикс параметров-фильтров по атрибутам.
+const attrFilterPrefix = "attr."
+
+// HotelAttributes — атрибуты гостиницы; читается из JSONB-колонки.
+type HotelAttributes map[string]interface{}
+
+// Scan реализует sql.Scanner: NULL и пустой объект дают nil.
+func (a *HotelAttributes) Scan(src interface{}) error {
+	var raw []byte
+	switch v := src.(type) {
+	case nil:
+		*a = nil
+		return nil
+	case []byte:
+		raw = v
+	case string:
+		raw = []byte(v)
+	default:
+		return fmt.Errorf("cannot scan %T into hotel attributes", src)
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal(raw, &m); err != nil {
+		return err
+	}
+	if len(m) == 0 {
+		m = nil
+	}
+	*a = m
+	return nil
+}
+
+// AttributeDefinition — описание атрибута в реестре.
+type AttributeDefinition struct {
+	Key           string    `json:"key"`
+	TenantID      *int      `json:"tenant_id"`
+	Type          string    `json:"type"`
+	AllowedValues []string  `json:"allowed_values,omitempty"`
+	Label         string    `json:"label"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// loadAttributeDefinitions читает реестр атрибутов, упорядоченный по ключу.
+func loadAttributeDefinitions(ctx context.Context) ([]AttributeDefinition, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT key, tenant_id, type, allowed_values, label, created_at
+		FROM attribute_definitions
+		ORDER BY key
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	defs := []AttributeDefinition{}
+	for rows.Next() {
+		var d AttributeDefinition
+		if err := rows.Scan(&d.Key, &d.TenantID, &d.Type, pq.Array(&d.AllowedValues), &d.Label, &d.CreatedAt); err != nil {
+			return nil, err
+		}
+		defs = append(defs, d)
+	}
+	// Неполный реестр отклонил бы корректные значения, поэтому его не отдаём.
+	return defs, rows.Err()
+}
+
+// cachedAttributeDefinitions возвращает реестр атрибутов из кэша.
+func cachedAttributeDefinitions(ctx context.Context) ([]AttributeDefinition, error) {
+	defs, _, err := cache.get(ctx, attributeDefsCacheKey, settings().HotelsCache, func(ctx context.Context) (interface{}, error) {
+		return loadAttributeDefinitions(ctx)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return defs.([]AttributeDefinition), nil
+}
+
+// visibleAttributes возвращает атрибуты, видимые запросу: общие и атрибуты тенанта его API-ключа.
+func visibleAttributes(c *gin.Context, defs []AttributeDefinition) map[string]AttributeDefinition {
+	tenantID := 0
+	if v, ok := c.Get("api_key"); ok {
+		tenantID = v.(APIKey).TenantID
+	}
+	visible := map[string]AttributeDefinition{}
+	for _, d := range defs {
+		if d.TenantID == nil || *d.TenantID == tenantID {
+			visible[d.Key] = d
+		}
+	}
+	return visible
+}
+
+// validate проверяет значение атрибута по его типу.
+func (d AttributeDefinition) validate(value interface{}) error {
+	switch d.Type {
+	case attrBool:
+		if _, ok := value.(bool); !ok {
+			return fmt.Errorf("attribute %s must be a boolean", d.Key)
+		}
+	case attrNumber:
+		if _, ok := value.(float64); !ok {
+			return fmt.Errorf("attribute %s must be a number", d.Key)
+		}
+	case attrString:
+		s, ok := value.(string)
+		if !ok || len(s) > attrStringLimit {
+			return fmt.Errorf("attribute %s must be a string of at most %d bytes", d.Key, attrStringLimit)
+		}
+	case attrEnum:
+		s, _ := value.(string)
+		for _, allowed := range d.AllowedValues {
+			if s == allowed {
+				return nil
+			}
+		}
+		return fmt.Errorf("attribute %s must be one of %v", d.Key, d.AllowedValues)
+	}
+	return nil
+}
+
+// matches сообщает, совпадает ли значение атрибута со значением фильтра из строки запроса.
+func (d AttributeDefinition) matches(value interface{}, filter string) bool {
+	switch v := value.(type) {
+	case bool:
+		return strconv.FormatBool(v) == filter
+	case float64:
+		f, err := strconv.ParseFloat(filter, 64)
+		return err == nil && f == v
+	case string:
+		return v == filter
+	}
+	return false
+}
+
+// facetValue — значение атрибута в виде ключа фасета.
+func facetValue(value interface{}) string {
+	switch v := value.(type) {
+	case bool:
+		return strconv.FormatBool(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case string:
+		return v
+	}
+	return fmt.Sprint(value)
+}
+
+// sqlValue — значение фильтра ?attr.<key>= в виде JSON-значения атрибута этого типа,
+// для условия в SQL; false — под фильтр не подходит ни одна гостиница (как и в matches:
+// например, ?attr.ski_storage=yes у булева атрибута).
+func (d AttributeDefinition) sqlValue(filter string) (interface{}, bool) {
+	switch d.Type {
+	case attrBool:
+		if filter != "true" && filter != "false" {
+			return nil, false
+		}
+		return filter == "true", true
+	case attrNumber:
+		f, err := strconv.ParseFloat(filter, 64)
+		if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+			return nil, false
+		}
+		return f, true
+	}
+	return filter, true
+}
+
+// attributeFilter — фильтры ?attr.<key>=<value> запроса и атрибуты, видимые клиенту.
+type attributeFilter struct {
+	visible map[string]AttributeDefinition
+	values  map[string]string
+}
+
+// parseAttributeFilter разбирает фильтры по атрибутам. При ошибке сам отвечает клиенту
+// и возвращает false.
+func parseAttributeFilter(c *gin.Context) (attributeFilter, bool) {
+	defs, err := cachedAttributeDefinitions(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return attributeFilter{}, false
+	}
+	f := attributeFilter{visible: visibleAttributes(c, defs), values: map[string]string{}}
+	for param, values := range c.Request.URL.Query() {
+		if !strings.HasPrefix(param, attrFilterPrefix) {
+			continue
+		}
+		key := strings.TrimPrefix(param, attrFilterPrefix)
+		if _, ok := f.visible[key]; !ok {
+			c.JSON(http.StatusBadRequest, Response{
+				Success: false,
+				Error:   fmt.Sprintf("unknown attribute %q", key),
+				Hint:    "GET /api/hotels/facets lists the attributes available to you",
+			})
+			return attributeFilter{}, false
+		}
+		f.values[key] = values[0]
+	}
+	return f, true
+}
+
+// matches сообщает, подходит ли гостиница под все фильтры.
+func (f attributeFilter) matches(h Hotel) bool {
+	for key, filter := range f.values {
+		if !f.visible[key].matches(h.Attributes[key], filter) {
+			return false
+		}
+	}
+	return true
+}
+
+// where добавляет фильтры в условия запроса: hotels.attributes должен содержать
+// {"<key>": значение} (сравнение JSONB по типу значения, числа — как числа).
+func (f attributeFilter) where(q *sqlConditions) {
+	keys := make([]string, 0, len(f.values))
+	for key := range f.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		value, ok := f.visible[key].sqlValue(f.values[key])
+		if !ok {
+			q.and("false")
+			continue
+		}
+		doc, _ := json.Marshal(map[string]interface{}{key: value})
+		q.and("h.attributes @> " + q.arg(string(doc)) + "::jsonb")
+	}
+}
+
+// strip возвращает гостиницу только с видимыми клиенту атрибутами.
+func (f attributeFilter) strip(h Hotel) Hotel {
+	if len(h.Attributes) == 0 {
+		return h
+	}
+	attrs := HotelAttributes{}
+	for key, value := range h.Attributes {
+		if _, ok := f.visible[key]; ok {
+			attrs[key] = value
+		}
+	}
+	h.Attributes = attrs
+	if len(attrs) == 0 {
+		h.Attributes = nil
+	}
+	return h
+}
+
+// applyAttributes применяет к списку гостиниц фильтры ?attr.<key>=<value> и оставляет
+// в атрибутах только видимые запросу. Исходный список (он может лежать в кэше) не меняется.
+// При ошибке сам отвечает клиенту и возвращает false.
+func applyAttributes(c *gin.Context, hotels []Hotel) ([]Hotel, bool) {
+	f, ok := parseAttributeFilter(c)
+	if !ok {
+		return nil, false
+	}
+	result := make([]Hotel, 0, len(hotels))
+	for _, h := range hotels {
+		if f.matches(h) {
+			result = append(result, f.strip(h))
+		}
+	}
+	return result, true
+}
+
+// Facet — распределение гостиниц по значениям одного атрибута.
+type Facet struct {
+	Key    string         `json:"key"`
+	Label  string         `json:"label"`
+	Type   string         `json:"type"`
+	Values map[string]int `json:"values"`
+}
+
+// hotelFacets считает фасеты по видимым клиенту атрибутам гостиниц списка.
+func hotelFacets(c *gin.Context, list []Hotel) ([]Facet, error) {
+	defs, err := cachedAttributeDefinitions(c.Request.Context())
+	if err != nil {
+		return nil, err
+	}
+	visible := visibleAttributes(c, defs)
+
+	facets := make([]Facet, 0, len(visible))
+	for _, d := range defs {
+		if _, ok := visible[d.Key]; !ok {
+			continue
+		}
+		f := Facet{Key: d.Key, Label: d.Label, Type: d.Type, Values: map[string]int{}}
+		for _, h := range list {
+			if value, ok := h.Attributes[d.Key]; ok {
+				f.Values[facetValue(value)]++
+			}
+		}
+		facets = append(facets, f)
+	}
+	return facets, nil
+}
+
+// getHotelFacets — HTTP-обработчик фасетов по атрибутам опубликованных гостиниц.
+// Реагирует на GET /api/hotels/facets; учитывает те же фильтры ?attr.<key>=<value>, что и список.
+func getHotelFacets(c *gin.Context) {
+	strict := strictScan(c)
+	hotels, status, err := cache.get(c.Request.Context(), "hotels", settings().HotelsCache, func(ctx context.Context) (interface{}, error) {
+		return loadHotels(ctx, strict)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	c.Header("X-Cache", status)
+
+	set := hotels.(rowSet[Hotel])
+	list, ok := applyAttributes(c, set.Items)
+	if !ok {
+		return
+	}
+	list = applyMarket(c, list)
+	facets, err := hotelFacets(c, list)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, Response{
+		Success: true,
+		Data:    gin.H{"total": len(list), "facets": facets},
+		Count:   len(facets),
+		Partial: set.Partial,
+	})
+}
+
+// getAttributeDefinitions — HTTP-обработчик реестра атрибутов.
+// Реагирует на GET /api/admin/attributes
+func getAttributeDefinitions(c *gin.Context) {
+	defs, err := loadAttributeDefinitions(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, Response{Success: true, Data: defs, Count: len(defs)})
+}
+
+// createAttributeDefinition — HTTP-обработчик добавления атрибута в реестр.
+// Реагирует на POST /api/admin/attributes с телом
+// {"key": "ski_storage", "type": "bool", "label": "Ski storage", "tenant_id": 1}
+// (tenant_id необязателен; для enum нужен "allowed_values": [...]).
+func createAttributeDefinition(c *gin.Context) {
+	var d AttributeDefinition
+	if err := c.ShouldBindJSON(&d); err != nil {
+		c.JSON(http.StatusBadRequest, Response{Success: false, Error: err.Error()})
+		return
+	}
+	if !attrKeyRe.MatchString(d.Key) {
+		c.JSON(http.StatusBadRequest, Response{Success: false, Error: "key must be lowercase latin letters, digits and underscores"})
+		return
+	}
+	switch d.Type {
+	case attrBool, attrNumber, attrString:
+		d.AllowedValues = nil
+	case attrEnum:
+		if len(d.AllowedValues) == 0 {
+			c.JSON(http.StatusBadRequest, Response{Success: false, Error: "enum attributes need allowed_values"})
+			return
+		}
+	default:
+		c.JSON(http.StatusBadRequest, Response{Success: false, Error: "type must be bool, number, string or enum"})
+		return
+	}
+	if d.Label == "" {
+		d.Label = d.Key
+	}
+
+	err := db.QueryRowContext(c.Request.Context(), `
+		INSERT INTO attribute_definitions (key, tenant_id, type, allowed_values, label)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (key) DO NOTHING
+		RETURNING created_at
+	`, d.Key, d.TenantID, d.Type, pq.Array(d.AllowedValues), d.Label).Scan(&d.CreatedAt)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusConflict, Response{Success: false, Error: fmt.Sprintf("attribute %s already exists", d.Key)})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	cache.flush(attributeDefsCacheKey)
+	c.JSON(http.StatusCreated, Response{Success: true, Data: d, Count: 1})
+}
+
+// deleteAttributeDefinition — HTTP-обработчик удаления атрибута из реестра вместе
+// с его значениями у всех гостиниц.
+// Реагирует на DELETE /api/admin/attributes/:key
+func deleteAttributeDefinition(c *gin.Context) {
+	key := c.Param("key")
+	tx, err := db.BeginTx(c.Request.Context(), nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(c.Request.Context(), "DELETE FROM attribute_definitions WHERE key = $1", key)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		c.JSON(http.StatusNotFound, Response{Success: false, Error: "attribute not found"})
+		return
+	}
+	// Значения удалённого атрибута больше нечем проверять — убираем их.
+	res, err = tx.ExecContext(c.Request.Context(), "UPDATE hotels SET attributes = attributes - $1 WHERE attributes ? $1", key)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	cache.flush(attributeDefsCacheKey, "hotels")
+	hotels, _ := res.RowsAffected()
+	c.JSON(http.StatusOK, Response{Success: true, Data: gin.H{"key": key, "hotels_updated": hotels}, Count: 1})
+}
+
+// setHotelAttributes — HTTP-обработчик, заменяющий атрибуты гостиницы целиком.
+// Реагирует на PUT /api/admin/hotels/:id/attributes с телом
+// {"attributes": {"ski_storage": true, "kitchen": "halal"}} ({} — убрать все).
+func setHotelAttributes(c *gin.Context) {
+	id, ok := hotelIDParam(c)
+	if !ok {
+		return
+	}
+	var body struct {
+		Attributes map[string]interface{} `json:"attributes"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, Response{Success: false, Error: err.Error()})
+		return
+	}
+	defs, err := loadAttributeDefinitions(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	byKey := make(map[string]AttributeDefinition, len(defs))
+	for _, d := range defs {
+		byKey[d.Key] = d
+	}
+
+	keys := make([]string, 0, len(body.Attributes))
+	for key := range body.Attributes {
+		keys = append(keys, key)
+	}
+	// Сортируем, чтобы при нескольких ошибках сообщение было стабильным.
+	sort.Strings(keys)
+	for _, key := range keys {
+		d, ok := byKey[key]
+		if !ok {
+			c.JSON(http.StatusBadRequest, Response{
+				Success: false,
+				Error:   fmt.Sprintf("unknown attribute %q", key),
+				Hint:    "register it first with POST /api/admin/attributes",
+			})
+			return
+		}
+		if err := d.validate(body.Attributes[key]); err != nil {
+			c.JSON(http.StatusBadRequest, Response{Success: false, Error: err.Error()})
+			return
+		}
+	}
+
+	if body.Attributes == nil {
+		body.Attributes = map[string]interface{}{}
+	}
+	raw, err := json.Marshal(body.Attributes)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, Response{Success: false, Error: err.Error()})
+		return
+	}
+	res, err := db.ExecContext(c.Request.Context(), "UPDATE hotels SET attributes = $2 WHERE id = $1", id, raw)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		c.JSON(http.StatusNotFound, Response{Success: false, Error: "hotel not found"})
+		return
+	}
+	cache.flush("hotels")
+	c.JSON(http.StatusOK, Response{
+		Success: true,
+		Data:    gin.H{"id": id, "attributes": body.Attributes},
+		Count:   1,
+	})
+}
@@ -0,0 +1,322 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/mail"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Учётные записи пользователей.
+//
+// Пользователь регистрируется по email и паролю (POST /api/auth/register) и
+// получает токен доступа — JWT с подписью HS256 — и токен обновления (см. refresh.go)
+// при регистрации и при входе (POST /api/auth/login). Токен доступа передаётся в заголовке Authorization: Bearer <token>;
+// его проверяет userMiddleware и кладёт пользователя в контекст запроса. Пароли
+// хранятся только в виде bcrypt-хэшей:
+//
+//	users(id, email UNIQUE, name, password_hash, role, created_at)
+//
+// Ключ подписи берётся из секрета jwt_signing_key (см. secrets.go). Без него ключ
+// генерируется при запуске, и после перезапуска все выданные токены перестают
+// действовать. Токен доступа живёт недолго — AUTH_TOKEN_TTL (см. settings.go), и
+// отозвать его нельзя: отзыв токена обновления вступает в силу, когда истечёт срок
+// уже выданного токена доступа.
+
+// Ограничения на поля учётной записи. bcrypt учитывает только первые 72 байта пароля,
+// поэтому более длинные пароли не принимаются, а не обрезаются молча.
+const (
+	minPasswordLength = 8
+	maxPasswordBytes  = 72
+	maxEmailLength    = 254
+	maxUserNameLength = maxGuestNameLength
+)
+
+// bearerPrefix — префикс токена доступа в заголовке Authorization.
+const bearerPrefix = "Bearer "
+
+// errCodeInvalidCredentials — код ошибки: неверный email или пароль.
+const errCodeInvalidCredentials = "invalid_credentials"
+
+// dummyPasswordHash — bcrypt-хэш с той же стоимостью, что и у паролей пользователей
+// (bcrypt.DefaultCost), которому не соответствует ни один пароль из формы входа.
+// С ним сравнивается пароль при входе с неизвестным email: иначе ответ для
+// несуществующей учётной записи приходил бы заметно быстрее и выдавал, зарегистрирован
+// ли email.
+const dummyPasswordHash = "$2a$10$MFu2YRLMKCHYYzXdrh7UyOz5W9Wif2IJZkU0qJMeh6qg4PBDkm7lK"
+
+// User — учётная запись пользователя.
+type User struct {
+	ID        int       `json:"id"`
+	Email     string    `json:"email"`
+	Name      string    `json:"name"`
+	Role      string    `json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// AuthToken — ответ регистрации, входа и обновления токена.
+type AuthToken struct {
+	Token            string    `json:"token"`
+	ExpiresAt        time.Time `json:"expires_at"`
+	RefreshToken     string    `json:"refresh_token"`
+	RefreshExpiresAt time.Time `json:"refresh_expires_at"`
+	User             User      `json:"user"`
+}
+
+// jwtClaims — полезная нагрузка токена доступа.
+type jwtClaims struct {
+	Subject   string `json:"sub"`
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+// jwtHeader — заголовок токена; других алгоритмов не выдаём и не принимаем.
+var jwtHeader = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+
+// jwtSigningKey — ключ подписи токенов; инициализируется в initAuth.
+var jwtSigningKey []byte
+
+// initAuth загружает ключ подписи токенов (секрет jwt_signing_key). Вызывается после initSecrets.
+func initAuth() error {
+	key, err := secrets.GetSecret(context.Background(), "jwt_signing_key")
+	if err == nil {
+		jwtSigningKey = []byte(key)
+		return nil
+	}
+	if !errors.Is(err, errSecretNotFound) {
+		return fmt.Errorf("failed to read JWT signing key: %w", err)
+	}
+	log.Printf("jwt_signing_key is not set, issued tokens will not survive a restart")
+	jwtSigningKey = make([]byte, 32)
+	_, err = rand.Read(jwtSigningKey)
+	return err
+}
+
+// signJWT выдаёт токен доступа пользователю.
+func signJWT(userID int, now time.Time) (string, time.Time, error) {
+	expires := now.Add(settings().AuthTokenTTL)
+	payload, err := json.Marshal(jwtClaims{Subject: strconv.Itoa(userID), IssuedAt: now.Unix(), ExpiresAt: expires.Unix()})
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	unsigned := jwtHeader + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return unsigned + "." + jwtSignature(unsigned), expires, nil
+}
+
+// jwtSignature — подпись HS256 заголовка и нагрузки токена.
+func jwtSignature(unsigned string) string {
+	mac := hmac.New(sha256.New, jwtSigningKey)
+	mac.Write([]byte(unsigned))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// parseJWT проверяет подпись и срок токена и возвращает id пользователя.
+func parseJWT(token string, now time.Time) (int, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 || parts[0] != jwtHeader {
+		return 0, fmt.Errorf("malformed token")
+	}
+	if !hmac.Equal([]byte(parts[2]), []byte(jwtSignature(parts[0]+"."+parts[1]))) {
+		return 0, fmt.Errorf("invalid token signature")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return 0, fmt.Errorf("malformed token")
+	}
+	var claims jwtClaims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return 0, fmt.Errorf("malformed token")
+	}
+	if now.Unix() >= claims.ExpiresAt {
+		return 0, fmt.Errorf("token has expired")
+	}
+	id, err := strconv.Atoi(claims.Subject)
+	if err != nil {
+		return 0, fmt.Errorf("malformed token")
+	}
+	return id, nil
+}
+
+// userMiddleware проверяет токен доступа, если он передан, и кладёт пользователя в контекст.
+// Запросы без заголовка Authorization проходят дальше анонимно.
+func userMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		header := c.GetHeader("Authorization")
+		if header == "" {
+			c.Next()
+			return
+		}
+		token, ok := strings.CutPrefix(header, bearerPrefix)
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, Response{Success: false, Error: "Authorization header must be a Bearer token"})
+			return
+		}
+		id, err := parseJWT(token, time.Now())
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, Response{Success: false, Error: err.Error()})
+			return
+		}
+		var u User
+		err = db.QueryRowContext(c.Request.Context(), "SELECT id, email, name, role, created_at FROM users WHERE id = $1", id).
+			Scan(&u.ID, &u.Email, &u.Name, &u.Role, &u.CreatedAt)
+		if err == sql.ErrNoRows {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, Response{Success: false, Error: "user no longer exists"})
+			return
+		}
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+			return
+		}
+		c.Set("user", u)
+		c.Next()
+	}
+}
+
+// currentUser возвращает пользователя запроса, если передан его токен (см. userMiddleware).
+func currentUser(c *gin.Context) (User, bool) {
+	u, ok := c.Get("user")
+	if !ok {
+		return User{}, false
+	}
+	return u.(User), true
+}
+
+// normalizeEmail приводит email к виду, в котором он хранится, и проверяет его.
+func normalizeEmail(email string) (string, error) {
+	email = strings.ToLower(strings.TrimSpace(email))
+	if email == "" {
+		return "", fmt.Errorf("email is required")
+	}
+	if len(email) > maxEmailLength {
+		return "", fmt.Errorf("email must be at most %d characters", maxEmailLength)
+	}
+	if addr, err := mail.ParseAddress(email); err != nil || addr.Address != email {
+		return "", fmt.Errorf("email is not a valid address")
+	}
+	return email, nil
+}
+
+// validateNewUser проверяет имя и пароль новой учётной записи и возвращает имя без
+// крайних пробелов.
+func validateNewUser(name, password string) (string, error) {
+	name = strings.TrimSpace(name)
+	switch {
+	case name == "":
+		return "", fmt.Errorf("name is required")
+	case len([]rune(name)) > maxUserNameLength:
+		return "", fmt.Errorf("name must be at most %d characters", maxUserNameLength)
+	case len([]rune(password)) < minPasswordLength:
+		return "", fmt.Errorf("password must be at least %d characters", minPasswordLength)
+	case len(password) > maxPasswordBytes:
+		return "", fmt.Errorf("password must be at most %d bytes", maxPasswordBytes)
+	}
+	return name, nil
+}
+
+// respondToken выдаёт пользователю токен доступа и токен обновления.
+func respondToken(c *gin.Context, status int, u User) {
+	t, err := issueTokens(c.Request.Context(), db, u)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	c.JSON(status, Response{Success: true, Data: t, Count: 1})
+}
+
+// register — HTTP-обработчик регистрации.
+// Реагирует на POST /api/auth/register с телом
+// {"email": "ivan@example.com", "password": "correct horse", "name": "Ivan Petrov"}.
+func register(c *gin.Context) {
+	var body struct {
+		Email    string `json:"email"`
+		Password string `json:"password"`
+		Name     string `json:"name"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, Response{Success: false, Error: err.Error()})
+		return
+	}
+	email, err := normalizeEmail(body.Email)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, Response{Success: false, Error: err.Error()})
+		return
+	}
+	name, err := validateNewUser(body.Name, body.Password)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, Response{Success: false, Error: err.Error()})
+		return
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(body.Password), bcrypt.DefaultCost)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+
+	// Роль выше user назначает только администратор (см. roles.go).
+	u := User{Email: email, Name: name, Role: roleUser}
+	err = db.QueryRowContext(c.Request.Context(), `
+		INSERT INTO users (email, name, password_hash, role)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (email) DO NOTHING
+		RETURNING id, created_at
+	`, email, name, string(hash), u.Role).Scan(&u.ID, &u.CreatedAt)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusConflict, Response{
+			Success: false,
+			Error:   "a user with this email already exists",
+			Hint:    "log in with POST /api/auth/login",
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	respondToken(c, http.StatusCreated, u)
+}
+
+// login — HTTP-обработчик входа.
+// Реагирует на POST /api/auth/login с телом {"email": "ivan@example.com", "password": "correct horse"}.
+// Неизвестный email и неверный пароль неразличимы для клиента.
+func login(c *gin.Context) {
+	var body struct {
+		Email    string `json:"email"`
+		Password string `json:"password"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, Response{Success: false, Error: err.Error()})
+		return
+	}
+	var u User
+	var hash string
+	err := db.QueryRowContext(c.Request.Context(), "SELECT id, email, name, role, created_at, password_hash FROM users WHERE email = $1",
+		strings.ToLower(strings.TrimSpace(body.Email))).Scan(&u.ID, &u.Email, &u.Name, &u.Role, &u.CreatedAt, &hash)
+	if err != nil && err != sql.ErrNoRows {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	found := err == nil
+	if !found {
+		hash = dummyPasswordHash
+	}
+	// Хэш сравнивается всегда, в том числе для неизвестного email (см. dummyPasswordHash).
+	if bcrypt.CompareHashAndPassword([]byte(hash), []byte(body.Password)) != nil || !found {
+		c.JSON(http.StatusUnauthorized, Response{Success: false, Code: errCodeInvalidCredentials, Error: "invalid email or password"})
+		return
+	}
+	respondToken(c, http.StatusOK, u)
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Сравнение с подставным хэшем должно стоить столько же, сколько с хэшем настоящего пароля.
+func TestDummyPasswordHash(t *testing.T) {
+	cost, err := bcrypt.Cost([]byte(dummyPasswordHash))
+	if err != nil {
+		t.Fatalf("dummy hash is not a bcrypt hash: %v", err)
+	}
+	if cost != bcrypt.DefaultCost {
+		t.Errorf("dummy hash cost %d, passwords are hashed with %d", cost, bcrypt.DefaultCost)
+	}
+	for _, password := range []string{"", "password", "correct horse"} {
+		if bcrypt.CompareHashAndPassword([]byte(dummyPasswordHash), []byte(password)) == nil {
+			t.Errorf("dummy hash matches %q", password)
+		}
+	}
+}
+
+// Вход с неизвестным email неотличим от входа с неверным паролем ни по ответу, ни по времени.
+func TestLoginUnknownEmail(t *testing.T) {
+	testDB(t)
+	router := newPublicRouter()
+	w := serve(router, "POST", "/api/auth/register", `{"email": "known@example.com", "password": "correct horse", "name": "Known"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("register: status %d: %s", w.Code, w.Body)
+	}
+
+	login := func(body string) (*http.Response, string, time.Duration) {
+		start := time.Now()
+		w := serve(router, "POST", "/api/auth/login", body)
+		return w.Result(), w.Body.String(), time.Since(start)
+	}
+	// Самое быстрое из нескольких измерений меньше всего зависит от посторонней нагрузки.
+	fastest := func(body string) (int, string, time.Duration) {
+		var (
+			code int
+			resp string
+			best time.Duration
+		)
+		for i := 0; i < 3; i++ {
+			r, b, d := login(body)
+			if i == 0 || d < best {
+				best = d
+			}
+			code, resp = r.StatusCode, b
+		}
+		return code, resp, best
+	}
+
+	wrongCode, wrongBody, wrongTime := fastest(`{"email": "known@example.com", "password": "wrong password"}`)
+	unknownCode, unknownBody, unknownTime := fastest(`{"email": "nobody@example.com", "password": "wrong password"}`)
+	if wrongCode != http.StatusUnauthorized || unknownCode != http.StatusUnauthorized {
+		t.Fatalf("status: wrong password %d, unknown email %d; want 401", wrongCode, unknownCode)
+	}
+	if wrongBody != unknownBody {
+		t.Errorf("responses differ:\nwrong password: %s\nunknown email:  %s", wrongBody, unknownBody)
+	}
+	if unknownTime < wrongTime/2 {
+		t.Errorf("unknown email answered in %v, wrong password in %v", unknownTime, wrongTime)
+	}
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Свободные места в гостинице по ночам.
+//
+// hotels.capacity — сколько гостей гостиница принимает за ночь. На каждую ночь
+// диапазона из неё вычитаются гости подтверждённых бронирований, в которые эта
+// ночь входит (check_in <= ночь < check_out). Гостиница доступна, если в каждую
+// ночь осталось не меньше мест, чем гостей в запросе. Та же проверка выполняется
+// при создании бронирования внутри его транзакции (см. bookings.go), так что
+// ответ этого эндпоинта — подсказка, а не резерв: место может занять другой клиент.
+// Гостиница без capacity считается неограниченной.
+//
+// Перебронирование исключено блокировкой строки гостиницы (SELECT ... FOR UPDATE):
+// её берут и создание бронирования, и изменение гостиницы (см. hotels.go), поэтому
+// проверка мест и запись бронирования не перемежаются с другими такими же, а
+// вместимость нельзя уменьшить ниже уже забронированного.
+//
+// Занятость по ночам кэшируется по гостинице и диапазону (политика AvailabilityCache),
+// вместимость берётся из кэша списка гостиниц. Создание и отмена бронирования сбрасывают
+// записи своей гостиницы (forgetAvailability), поэтому кэш не отдаёт уже занятые места.
+// Перед кампаниями кэш прогревается заранее (см. priming.go).
+
+// maxAvailabilityNights — самый длинный диапазон, который можно запросить за раз.
+const maxAvailabilityNights = 90
+
+// NightAvailability — занятость одной ночи; Remaining == nil — вместимость не ограничена.
+type NightAvailability struct {
+	Date      string `json:"date"`
+	Booked    int    `json:"booked"`
+	Remaining *int   `json:"remaining"`
+}
+
+// Availability — ответ GET /api/hotels/:id/availability.
+type Availability struct {
+	HotelID  int  `json:"hotel_id"`
+	Capacity *int `json:"capacity"`
+	Guests   int  `json:"guests"`
+	// Available — в каждую ночь хватает мест на Guests гостей.
+	Available bool `json:"available"`
+	// MinRemaining — наименьшее число свободных мест за диапазон.
+	MinRemaining *int                `json:"min_remaining"`
+	Nights       []NightAvailability `json:"nights"`
+}
+
+// nightlyBookedGuests возвращает число гостей подтверждённых бронирований гостиницы
+// на каждую ночь из [from, to), по порядку дат.
+func nightlyBookedGuests(ctx context.Context, q interface {
+	QueryContext(context.Context, string, ...interface{}) (*sql.Rows, error)
+}, hotelID int, from, to time.Time) ([]NightAvailability, error) {
+	rows, err := q.QueryContext(ctx, `
+		SELECT d::date::text, COALESCE(SUM(b.guests), 0)
+		FROM generate_series($2::date, $3::date - 1, interval '1 day') d
+		LEFT JOIN bookings b ON b.hotel_id = $1 AND b.status = $4 AND b.check_in <= d AND b.check_out > d
+		GROUP BY d
+		ORDER BY d
+	`, hotelID, from, to, bookingConfirmed)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	nights := []NightAvailability{}
+	for rows.Next() {
+		var n NightAvailability
+		if err := rows.Scan(&n.Date, &n.Booked); err != nil {
+			return nil, err
+		}
+		nights = append(nights, n)
+	}
+	return nights, rows.Err()
+}
+
+// peakBookedGuests возвращает наибольшее число гостей подтверждённых бронирований
+// гостиницы за одну ночь, начиная с from; 0 — бронирований нет.
+func peakBookedGuests(ctx context.Context, q interface {
+	QueryRowContext(context.Context, string, ...interface{}) *sql.Row
+}, hotelID int, from time.Time) (int, error) {
+	var peak int
+	err := q.QueryRowContext(ctx, `
+		SELECT COALESCE(MAX(guests), 0) FROM (
+			SELECT SUM(b.guests) AS guests
+			FROM bookings b,
+			     generate_series(GREATEST(b.check_in, $2::date), b.check_out - 1, interval '1 day') d
+			WHERE b.hotel_id = $1 AND b.status = $3 AND b.check_out > $2::date
+			GROUP BY d
+		) nights
+	`, hotelID, from, bookingConfirmed).Scan(&peak)
+	return peak, err
+}
+
+// availabilityCacheKey — ключ кэша занятости гостиницы по ночам из [from, to).
+func availabilityCacheKey(hotelID int, from, to time.Time) string {
+	return fmt.Sprintf("availability:%d:%s:%s", hotelID, from.Format(bookingDateLayout), to.Format(bookingDateLayout))
+}
+
+// forgetAvailability сбрасывает закэшированную занятость гостиницы по всем диапазонам.
+// Вызывается после фиксации транзакции, изменившей её бронирования.
+func forgetAvailability(hotelID int) {
+	cache.flushPrefix(fmt.Sprintf("availability:%d:", hotelID))
+}
+
+// cachedBookedGuests — nightlyBookedGuests через кэш. Возвращает копию: availabilityFor
+// дописывает в ночи остаток мест, а закэшированный срез делят параллельные запросы.
+func cachedBookedGuests(ctx context.Context, hotelID int, from, to time.Time) ([]NightAvailability, string, error) {
+	value, status, err := cache.get(ctx, availabilityCacheKey(hotelID, from, to), settings().AvailabilityCache, func(ctx context.Context) (interface{}, error) {
+		return nightlyBookedGuests(ctx, db, hotelID, from, to)
+	})
+	if err != nil {
+		return nil, status, err
+	}
+	return append([]NightAvailability(nil), value.([]NightAvailability)...), status, nil
+}
+
+// cachedHotel возвращает опубликованную гостиницу из кэша списка гостиниц (см. loadHotels);
+// false — такой нет.
+func cachedHotel(ctx context.Context, strict bool, id int) (Hotel, bool, error) {
+	hotels, _, err := cache.get(ctx, "hotels", settings().HotelsCache, func(ctx context.Context) (interface{}, error) {
+		return loadHotels(ctx, strict)
+	})
+	if err != nil {
+		return Hotel{}, false, err
+	}
+	for _, h := range hotels.(rowSet[Hotel]).Items {
+		if h.ID == id {
+			return h, true, nil
+		}
+	}
+	return Hotel{}, false, nil
+}
+
+// availabilityFor считает свободные места по ночам для guests гостей.
+func availabilityFor(hotelID int, capacity *int, guests int, nights []NightAvailability) Availability {
+	a := Availability{HotelID: hotelID, Capacity: capacity, Guests: guests, Available: true, Nights: nights}
+	if capacity == nil {
+		return a
+	}
+	for i := range a.Nights {
+		remaining := *capacity - a.Nights[i].Booked
+		if remaining < 0 {
+			remaining = 0
+		}
+		a.Nights[i].Remaining = &remaining
+		if a.MinRemaining == nil || remaining < *a.MinRemaining {
+			a.MinRemaining = &remaining
+		}
+		if remaining < guests {
+			a.Available = false
+		}
+	}
+	return a
+}
+
+// getHotelAvailability — HTTP-обработчик свободных мест в гостинице.
+// Реагирует на GET /api/hotels/:id/availability?from=2026-07-01&to=2026-07-04&guests=2:
+// to — дата выезда (последняя ночь — накануне), guests по умолчанию 1.
+func getHotelAvailability(c *gin.Context) {
+	id, ok := hotelIDParam(c)
+	if !ok {
+		return
+	}
+	from, err := time.Parse(bookingDateLayout, c.Query("from"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, Response{Success: false, Error: "from must be a date in YYYY-MM-DD format"})
+		return
+	}
+	to, err := time.Parse(bookingDateLayout, c.Query("to"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, Response{Success: false, Error: "to must be a date in YYYY-MM-DD format"})
+		return
+	}
+	if n := bookingNights(from, to); n < 1 || n > maxAvailabilityNights {
+		c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Error:   fmt.Sprintf("to must be 1 to %d days after from", maxAvailabilityNights),
+		})
+		return
+	}
+	guests := 1
+	if v := c.Query("guests"); v != "" {
+		if guests, err = strconv.Atoi(v); err != nil || guests < 1 {
+			c.JSON(http.StatusBadRequest, Response{Success: false, Error: "guests must be a positive integer"})
+			return
+		}
+	}
+
+	hotel, found, err := cachedHotel(c.Request.Context(), strictScan(c), id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	if !found {
+		c.JSON(http.StatusNotFound, Response{Success: false, Error: "hotel not found"})
+		return
+	}
+	nights, status, err := cachedBookedGuests(c.Request.Context(), id, from, to)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	c.Header("X-Cache", status)
+	a := availabilityFor(id, hotel.Capacity, guests, nights)
+	c.JSON(http.StatusOK, Response{Success: true, Data: a, Count: len(a.Nights)})
+}
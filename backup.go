@@ -0,0 +1,382 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+// Логическое резервное копирование и восстановление в отдельную схему.
+//
+// Резервная копия — каталог BACKUP_DIR/<имя>, где имя — время создания в UTC
+// (20261015T120000Z). В нём по файлу <таблица>.jsonl на каждую таблицу из
+// backupTables (одна строка — row_to_json одной записи) и manifest.json с числом
+// строк и SHA-256 каждого файла. Все таблицы читаются в одной транзакции
+// REPEATABLE READ, поэтому копия согласована. Строки выгружаются отсортированными,
+// чтобы контрольную сумму можно было пересчитать в самой БД (см. drcheck.go).
+//
+// Копия сначала пишется в каталог с суффиксом .partial и переименовывается только
+// после записи манифеста: недописанные копии не видны ни в списке, ни для восстановления.
+//
+// Восстановление никогда не трогает рабочие таблицы: данные загружаются в указанную
+// схему (по умолчанию staging), которая пересоздаётся целиком. Структура таблиц
+// берётся из текущих public-таблиц (CREATE TABLE ... (LIKE public.t)); колонки,
+// которых не было на момент копии, остаются NULL. Дальше администратор сверяет
+// данные и переносит то, что нужно, вручную.
+
+// backupTables — таблицы, попадающие в резервную копию.
+var backupTables = []string{
+	"cities", "city_aliases", "city_audit", "hotels", "hotel_prices", "price_audit", "hotel_revisions",
+	"slug_history", "short_links", "pois", "hotel_poi_distances", "bookings", "booking_shares", "booking_guests", "checkin_audit", "price_alerts",
+	"users", "refresh_tokens", "tenants", "api_keys", "quota_usage", "tenant_quota_usage", "usage_rollups",
+	"promotions", "promotion_stats", "events", "widget_tokens", "partner_mappings", "blobs",
+	"hotel_questions", "hotel_answers", "qa_votes", "attribute_definitions",
+}
+
+// defaultRestoreSchema — схема, в которую восстанавливается копия по умолчанию.
+const defaultRestoreSchema = "staging"
+
+// backupNameRe — допустимые имена копий; заодно не даёт выйти за пределы BACKUP_DIR.
+var backupNameRe = regexp.MustCompile(`^[0-9A-Za-z_-]+$`)
+
+// restoreSchemaRe — допустимые имена схем для восстановления.
+var restoreSchemaRe = regexp.MustCompile(`^[a-z_][a-z0-9_]{0,62}$`)
+
+// BackupTable — сведения об одной таблице в резервной копии.
+type BackupTable struct {
+	Table    string `json:"table"`
+	Rows     int64  `json:"rows"`
+	Checksum string `json:"checksum"`
+}
+
+// BackupManifest — содержимое manifest.json резервной копии.
+type BackupManifest struct {
+	Name      string        `json:"name"`
+	CreatedAt time.Time     `json:"created_at"`
+	Tables    []BackupTable `json:"tables"`
+}
+
+// RestoreResult — итог восстановления копии в схему.
+type RestoreResult struct {
+	Backup string        `json:"backup"`
+	Schema string        `json:"schema"`
+	Tables []BackupTable `json:"tables"`
+}
+
+// backupDir возвращает каталог резервных копий (BACKUP_DIR, по умолчанию ./backups).
+func backupDir() string {
+	if dir := os.Getenv("BACKUP_DIR"); dir != "" {
+		return dir
+	}
+	return "backups"
+}
+
+// rowsAsJSONQuery — выгрузка таблицы построчно в JSON в детерминированном порядке.
+// COLLATE "C" сравнивает строки побайтово — так же, как сортировка в Go.
+func rowsAsJSONQuery(schema, table string) string {
+	return fmt.Sprintf(`SELECT row_to_json(t)::text FROM %s.%s t ORDER BY row_to_json(t)::text COLLATE "C"`,
+		pq.QuoteIdentifier(schema), pq.QuoteIdentifier(table))
+}
+
+// createBackup выгружает все backupTables в новый каталог и возвращает манифест.
+func createBackup(ctx context.Context) (*BackupManifest, error) {
+	now := time.Now().UTC()
+	m := &BackupManifest{Name: now.Format("20060102T150405Z"), CreatedAt: now, Tables: []BackupTable{}}
+	final := filepath.Join(backupDir(), m.Name)
+	partial := final + ".partial"
+	if err := os.MkdirAll(partial, 0o750); err != nil {
+		return nil, err
+	}
+	// При любой ошибке недописанный каталог удаляется.
+	defer os.RemoveAll(partial)
+
+	tx, err := db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	for _, table := range backupTables {
+		t, err := exportTable(ctx, tx, table, filepath.Join(partial, table+".jsonl"))
+		if err != nil {
+			return nil, fmt.Errorf("export %s: %w", table, err)
+		}
+		m.Tables = append(m.Tables, t)
+	}
+
+	manifest, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(filepath.Join(partial, "manifest.json"), manifest, 0o640); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(partial, final); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// exportTable записывает строки таблицы в файл и считает их число и контрольную сумму.
+func exportTable(ctx context.Context, tx *sql.Tx, table, path string) (BackupTable, error) {
+	t := BackupTable{Table: table}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o640)
+	if err != nil {
+		return t, err
+	}
+	defer f.Close()
+
+	rows, err := tx.QueryContext(ctx, rowsAsJSONQuery("public", table))
+	if err != nil {
+		return t, err
+	}
+	defer rows.Close()
+
+	hash := sha256.New()
+	w := bufio.NewWriter(f)
+	for rows.Next() {
+		var line string
+		if err := rows.Scan(&line); err != nil {
+			return t, err
+		}
+		w.WriteString(line)
+		w.WriteByte('\n')
+		hash.Write([]byte(line + "\n"))
+		t.Rows++
+	}
+	if err := rows.Err(); err != nil {
+		return t, err
+	}
+	if err := w.Flush(); err != nil {
+		return t, err
+	}
+	t.Checksum = hex.EncodeToString(hash.Sum(nil))
+	return t, f.Sync()
+}
+
+// readBackupManifest читает манифест копии по имени.
+func readBackupManifest(name string) (*BackupManifest, error) {
+	if !backupNameRe.MatchString(name) {
+		return nil, fmt.Errorf("invalid backup name %q", name)
+	}
+	data, err := os.ReadFile(filepath.Join(backupDir(), name, "manifest.json"))
+	if err != nil {
+		return nil, err
+	}
+	var m BackupManifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// listBackups возвращает манифесты всех готовых копий, от новых к старым.
+func listBackups() ([]BackupManifest, error) {
+	entries, err := os.ReadDir(backupDir())
+	if os.IsNotExist(err) {
+		return []BackupManifest{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	backups := []BackupManifest{}
+	for _, e := range entries {
+		if !e.IsDir() || strings.HasSuffix(e.Name(), ".partial") {
+			continue
+		}
+		m, err := readBackupManifest(e.Name())
+		if err != nil {
+			// Посторонний каталог или повреждённая копия — в списке её не показываем.
+			continue
+		}
+		backups = append(backups, *m)
+	}
+	sort.Slice(backups, func(i, j int) bool { return backups[i].CreatedAt.After(backups[j].CreatedAt) })
+	return backups, nil
+}
+
+// validateRestoreSchema не даёт восстановить копию поверх рабочих или системных схем.
+func validateRestoreSchema(schema string) error {
+	if !restoreSchemaRe.MatchString(schema) || schema == "public" ||
+		schema == "information_schema" || strings.HasPrefix(schema, "pg_") {
+		return fmt.Errorf("schema %q cannot be used for restore", schema)
+	}
+	return nil
+}
+
+// restoreBackup пересоздаёт схему schema и загружает в неё копию name.
+// Всё выполняется в одной транзакции: при ошибке схема остаётся в прежнем виде.
+func restoreBackup(ctx context.Context, name, schema string) (*RestoreResult, error) {
+	if err := validateRestoreSchema(schema); err != nil {
+		return nil, err
+	}
+	m, err := readBackupManifest(name)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	qschema := pq.QuoteIdentifier(schema)
+	for _, stmt := range []string{
+		"DROP SCHEMA IF EXISTS " + qschema + " CASCADE",
+		"CREATE SCHEMA " + qschema,
+		// Промежуточная таблица: строки копии сначала попадают сюда через COPY,
+		// а затем одним INSERT раскладываются по колонкам целевой таблицы.
+		"CREATE TEMP TABLE restore_rows (doc jsonb) ON COMMIT DROP",
+	} {
+		if _, err := tx.ExecContext(ctx, stmt); err != nil {
+			return nil, err
+		}
+	}
+
+	result := &RestoreResult{Backup: name, Schema: schema, Tables: []BackupTable{}}
+	for _, t := range m.Tables {
+		n, err := restoreTable(ctx, tx, schema, t.Table, filepath.Join(backupDir(), name, t.Table+".jsonl"))
+		if err != nil {
+			return nil, fmt.Errorf("restore %s: %w", t.Table, err)
+		}
+		if n != t.Rows {
+			return nil, fmt.Errorf("restore %s: manifest lists %d rows, file has %d", t.Table, t.Rows, n)
+		}
+		result.Tables = append(result.Tables, BackupTable{Table: t.Table, Rows: n, Checksum: t.Checksum})
+	}
+	return result, tx.Commit()
+}
+
+// restoreTable создаёт таблицу schema.table по образцу public.table и загружает в неё файл копии.
+func restoreTable(ctx context.Context, tx *sql.Tx, schema, table, path string) (int64, error) {
+	target := pq.QuoteIdentifier(schema) + "." + pq.QuoteIdentifier(table)
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf("CREATE TABLE %s (LIKE public.%s)", target, pq.QuoteIdentifier(table))); err != nil {
+		return 0, err
+	}
+	if _, err := tx.ExecContext(ctx, "TRUNCATE restore_rows"); err != nil {
+		return 0, err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	stmt, err := tx.PrepareContext(ctx, pq.CopyIn("restore_rows", "doc"))
+	if err != nil {
+		return 0, err
+	}
+	var n int64
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64<<10), 64<<20)
+	for scanner.Scan() {
+		if _, err := stmt.ExecContext(ctx, scanner.Text()); err != nil {
+			stmt.Close()
+			return 0, err
+		}
+		n++
+	}
+	if err := scanner.Err(); err != nil {
+		stmt.Close()
+		return 0, err
+	}
+	if _, err := stmt.ExecContext(ctx); err != nil {
+		stmt.Close()
+		return 0, err
+	}
+	if err := stmt.Close(); err != nil {
+		return 0, err
+	}
+
+	_, err = tx.ExecContext(ctx, fmt.Sprintf(
+		"INSERT INTO %[1]s SELECT r.* FROM restore_rows, jsonb_populate_record(NULL::%[1]s, doc) r", target))
+	return n, err
+}
+
+// startBackup — HTTP-обработчик, запускающий резервное копирование фоновой задачей.
+// Реагирует на POST /api/admin/backups; отвечает 202 с описанием задачи.
+func startBackup(c *gin.Context) {
+	job := jobs.start("backup", func(func(interface{})) (interface{}, error) {
+		return createBackup(context.Background())
+	})
+	c.JSON(http.StatusAccepted, Response{
+		Success: true,
+		Data:    job,
+		Count:   1,
+	})
+}
+
+// getBackups — HTTP-обработчик, возвращающий список готовых резервных копий.
+// Реагирует на GET /api/admin/backups
+func getBackups(c *gin.Context) {
+	backups, err := listBackups()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, Response{
+		Success: true,
+		Data:    backups,
+		Count:   len(backups),
+	})
+}
+
+// startRestore — HTTP-обработчик, запускающий восстановление копии фоновой задачей.
+// Реагирует на POST /api/admin/backups/:name/restore с необязательным телом {"schema": "staging"}.
+func startRestore(c *gin.Context) {
+	var body struct {
+		Schema string `json:"schema"`
+	}
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, Response{Success: false, Error: err.Error()})
+			return
+		}
+	}
+	if body.Schema == "" {
+		body.Schema = defaultRestoreSchema
+	}
+
+	// Ошибки, которые видны сразу, возвращаем синхронно, а не через задачу.
+	name := c.Param("name")
+	if err := validateRestoreSchema(body.Schema); err != nil {
+		c.JSON(http.StatusBadRequest, Response{Success: false, Error: err.Error()})
+		return
+	}
+	if _, err := readBackupManifest(name); err != nil {
+		c.JSON(http.StatusNotFound, Response{
+			Success: false,
+			Error:   "backup not found",
+			Hint:    "GET /api/admin/backups lists available backups",
+		})
+		return
+	}
+
+	job := jobs.start("restore", func(func(interface{})) (interface{}, error) {
+		return restoreBackup(context.Background(), name, body.Schema)
+	})
+	c.JSON(http.StatusAccepted, Response{
+		Success: true,
+		Data:    job,
+		Count:   1,
+	})
+}
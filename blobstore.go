@@ -0,0 +1,491 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Хранилище файлов (снимки открытых данных, выгрузки и прочие бинарные объекты).
+//
+// Код работает с файлами через интерфейс BlobStore, а реализация выбирается
+// переменной BLOB_STORE:
+//   - disk — каталог BLOB_DIR (по умолчанию ./blobs); годится для одного экземпляра
+//     сервиса и локальной разработки;
+//   - s3   — бакет BLOB_BUCKET в Amazon S3 или совместимом хранилище (BLOB_ENDPOINT,
+//     BLOB_REGION, BLOB_ACCESS_KEY_ID, BLOB_SECRET_ACCESS_KEY; без них — AWS_*);
+//   - gcs  — Google Cloud Storage через его S3-совместимый API с HMAC-ключами
+//     (BLOB_BUCKET, BLOB_ACCESS_KEY_ID, BLOB_SECRET_ACCESS_KEY).
+//
+// Каждый сохранённый через putBlob объект регистрируется в таблице
+//
+//	blobs(key, kind, content_type, size, created_at)
+//
+// Владелец объекта (например, снимки открытых данных) удаляет его через deleteBlob.
+// Объекты без строки в blobs — осиротевшие: загрузка оборвалась до записи в таблицу
+// или удаление из хранилища не удалось. Их раз в BLOB_CLEANUP_INTERVAL убирает
+// cleanupBlobs (не трогая объекты моложе blobOrphanGrace — их могут дописывать прямо сейчас).
+//
+// Резервные копии (backup.go) в хранилище не переносятся: восстановление читает их
+// построчно с локального диска через COPY.
+
+// errBlobNotFound — в хранилище нет объекта с таким ключом.
+var errBlobNotFound = errors.New("blob not found")
+
+// blobOrphanGrace — сколько ждать, прежде чем считать незарегистрированный объект осиротевшим.
+const blobOrphanGrace = time.Hour
+
+// blobSniffLen — сколько первых байт читать для определения типа содержимого.
+const blobSniffLen = 512
+
+// blobKeyRe — допустимый ключ: сегменты из латиницы, цифр, точки, дефиса и подчёркивания через "/".
+var blobKeyRe = regexp.MustCompile(`^[A-Za-z0-9_-][A-Za-z0-9._-]*(/[A-Za-z0-9_-][A-Za-z0-9._-]*)*$`)
+
+// BlobInfo — сведения об объекте хранилища.
+type BlobInfo struct {
+	Key         string    `json:"key"`
+	Kind        string    `json:"kind,omitempty"`
+	ContentType string    `json:"content_type,omitempty"`
+	Size        int64     `json:"size"`
+	ModTime     time.Time `json:"mod_time"`
+}
+
+// BlobStore — хранилище файлов.
+type BlobStore interface {
+	// Put сохраняет объект, заменяя существующий с тем же ключом.
+	Put(ctx context.Context, key string, r io.Reader, contentType string) error
+	// Open открывает объект на чтение; errBlobNotFound, если его нет.
+	Open(ctx context.Context, key string) (io.ReadCloser, BlobInfo, error)
+	// Delete удаляет объект; отсутствие объекта ошибкой не считается.
+	Delete(ctx context.Context, key string) error
+	// List перечисляет объекты с ключами, начинающимися с prefix.
+	List(ctx context.Context, prefix string) ([]BlobInfo, error)
+	// SignedURL возвращает адрес, по которому объект можно скачать без авторизации до истечения ttl.
+	SignedURL(key string, ttl time.Duration) (string, error)
+}
+
+var blobs BlobStore
+
+// initBlobStore создаёт хранилище по переменной BLOB_STORE. Вызывается после initSecrets.
+func initBlobStore() error {
+	switch name := os.Getenv("BLOB_STORE"); name {
+	case "", "disk":
+		dir := os.Getenv("BLOB_DIR")
+		if dir == "" {
+			dir = "blobs"
+		}
+		key, err := blobSigningKey()
+		if err != nil {
+			return err
+		}
+		blobs = &diskBlobs{dir: dir, signingKey: key}
+	case "s3", "gcs":
+		s := &s3Blobs{
+			endpoint:     os.Getenv("BLOB_ENDPOINT"),
+			bucket:       os.Getenv("BLOB_BUCKET"),
+			region:       os.Getenv("BLOB_REGION"),
+			accessKey:    os.Getenv("BLOB_ACCESS_KEY_ID"),
+			secretKey:    os.Getenv("BLOB_SECRET_ACCESS_KEY"),
+			sessionToken: os.Getenv("BLOB_SESSION_TOKEN"),
+		}
+		if name == "gcs" {
+			if s.endpoint == "" {
+				s.endpoint = "https://storage.googleapis.com"
+			}
+			if s.region == "" {
+				s.region = "auto"
+			}
+		} else {
+			if s.region == "" {
+				s.region = os.Getenv("AWS_REGION")
+			}
+			if s.accessKey == "" {
+				s.accessKey, s.secretKey, s.sessionToken =
+					os.Getenv("AWS_ACCESS_KEY_ID"), os.Getenv("AWS_SECRET_ACCESS_KEY"), os.Getenv("AWS_SESSION_TOKEN")
+			}
+			if s.endpoint == "" && s.region != "" {
+				s.endpoint = "https://s3." + s.region + ".amazonaws.com"
+			}
+		}
+		if s.bucket == "" || s.endpoint == "" || s.region == "" || s.accessKey == "" || s.secretKey == "" {
+			return fmt.Errorf("%s blob store requires BLOB_BUCKET, a region or endpoint and access keys", name)
+		}
+		s.endpoint = strings.TrimRight(s.endpoint, "/")
+		blobs = s
+	default:
+		return fmt.Errorf("unknown BLOB_STORE %q", name)
+	}
+	return nil
+}
+
+// blobSigningKey возвращает ключ подписи ссылок на локальные файлы (секрет blob_signing_key).
+// Без него ключ генерируется при запуске — выданные ссылки перестанут работать после перезапуска.
+func blobSigningKey() ([]byte, error) {
+	key, err := secrets.GetSecret(context.Background(), "blob_signing_key")
+	if err == nil {
+		return []byte(key), nil
+	}
+	if !errors.Is(err, errSecretNotFound) {
+		return nil, fmt.Errorf("failed to read blob signing key: %w", err)
+	}
+	log.Printf("blob_signing_key is not set, signed blob URLs will not survive a restart")
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// validBlobKey сообщает, допустим ли ключ объекта (в том числе не выходит ли он за пределы каталога).
+func validBlobKey(key string) bool {
+	return len(key) <= 512 && blobKeyRe.MatchString(key) && !strings.Contains(key, "..")
+}
+
+// sniffContentType определяет тип содержимого по первым байтам потока.
+// Возвращает тип и поток, из которого прочитанные байты не потеряны.
+func sniffContentType(r io.Reader) (string, io.Reader) {
+	br := bufio.NewReaderSize(r, blobSniffLen)
+	head, _ := br.Peek(blobSniffLen)
+	return http.DetectContentType(head), br
+}
+
+// putBlob сохраняет объект вида kind и регистрирует его в таблице blobs.
+// Пустой contentType определяется по содержимому.
+func putBlob(ctx context.Context, kind, key string, r io.Reader, contentType string) (BlobInfo, error) {
+	if !validBlobKey(key) {
+		return BlobInfo{}, fmt.Errorf("invalid blob key %q", key)
+	}
+	if contentType == "" {
+		contentType, r = sniffContentType(r)
+	}
+	counter := &countingReader{r: r}
+	if err := blobs.Put(ctx, key, counter, contentType); err != nil {
+		return BlobInfo{}, err
+	}
+
+	info := BlobInfo{Key: key, Kind: kind, ContentType: contentType, Size: counter.n}
+	// Запись в таблицу — после загрузки: если процесс упадёт между ними, объект
+	// останется осиротевшим и его уберёт cleanupBlobs, а не наоборот (строка без файла).
+	err := db.QueryRowContext(ctx, `
+		INSERT INTO blobs (key, kind, content_type, size)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (key) DO UPDATE
+			SET kind = EXCLUDED.kind, content_type = EXCLUDED.content_type, size = EXCLUDED.size, created_at = now()
+		RETURNING created_at
+	`, key, kind, contentType, info.Size).Scan(&info.ModTime)
+	return info, err
+}
+
+// deleteBlob удаляет объект и его регистрацию. Сначала удаляется строка: если
+// удаление из хранилища не удастся, объект станет осиротевшим и будет убран позже.
+func deleteBlob(ctx context.Context, key string) error {
+	if _, err := db.ExecContext(ctx, "DELETE FROM blobs WHERE key = $1", key); err != nil {
+		return err
+	}
+	return blobs.Delete(ctx, key)
+}
+
+// countingReader считает прочитанные байты.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// BlobCleanupResult — итог очистки осиротевших объектов.
+type BlobCleanupResult struct {
+	Scanned int      `json:"scanned"`
+	Deleted []string `json:"deleted"`
+}
+
+// cleanupBlobs удаляет из хранилища объекты, не зарегистрированные в таблице blobs.
+func cleanupBlobs(ctx context.Context) (*BlobCleanupResult, error) {
+	objects, err := blobs.List(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+	rows, err := db.QueryContext(ctx, "SELECT key FROM blobs")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	known := map[string]bool{}
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, err
+		}
+		known[key] = true
+	}
+	// Неполный список зарегистрированных ключей привёл бы к удалению нужных файлов.
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	result := &BlobCleanupResult{Scanned: len(objects), Deleted: []string{}}
+	cutoff := time.Now().Add(-blobOrphanGrace)
+	for _, o := range objects {
+		if known[o.Key] || o.ModTime.After(cutoff) {
+			continue
+		}
+		if err := blobs.Delete(ctx, o.Key); err != nil {
+			return result, fmt.Errorf("delete orphaned blob %s: %w", o.Key, err)
+		}
+		result.Deleted = append(result.Deleted, o.Key)
+	}
+	if len(result.Deleted) > 0 {
+		log.Printf("Blob cleanup removed %d orphaned objects", len(result.Deleted))
+	}
+	return result, nil
+}
+
+// runBlobCleanupScheduler периодически убирает осиротевшие объекты (BLOB_CLEANUP_INTERVAL, 0 — выключено).
+func runBlobCleanupScheduler(ctx context.Context) {
+	for {
+		interval := settings().BlobCleanupInterval
+		if interval <= 0 {
+			if !sleepContext(ctx, time.Minute) {
+				return
+			}
+			continue
+		}
+		if !sleepContext(ctx, interval) {
+			return
+		}
+		if _, err := cleanupBlobs(ctx); err != nil {
+			log.Printf("Blob cleanup failed: %v", err)
+		}
+	}
+}
+
+// diskBlobs — хранилище в локальном каталоге. Подписанные ссылки ведут на GET /api/blobs/*key.
+type diskBlobs struct {
+	dir        string
+	signingKey []byte
+}
+
+func (d *diskBlobs) path(key string) string {
+	return filepath.Join(d.dir, filepath.FromSlash(key))
+}
+
+func (d *diskBlobs) Put(_ context.Context, key string, r io.Reader, _ string) error {
+	path := d.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	// Пишем во временный файл и переименовываем: читатель не увидит недописанный объект.
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (d *diskBlobs) Open(_ context.Context, key string) (io.ReadCloser, BlobInfo, error) {
+	f, err := os.Open(d.path(key))
+	if os.IsNotExist(err) {
+		return nil, BlobInfo{}, errBlobNotFound
+	}
+	if err != nil {
+		return nil, BlobInfo{}, err
+	}
+	st, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, BlobInfo{}, err
+	}
+	// Тип на диске не хранится: определяем по расширению, а без него — по содержимому.
+	contentType := mime.TypeByExtension(filepath.Ext(key))
+	var r io.Reader = f
+	if contentType == "" {
+		contentType, r = sniffContentType(f)
+	}
+	info := BlobInfo{Key: key, ContentType: contentType, Size: st.Size(), ModTime: st.ModTime()}
+	return struct {
+		io.Reader
+		io.Closer
+	}{r, f}, info, nil
+}
+
+func (d *diskBlobs) Delete(_ context.Context, key string) error {
+	err := os.Remove(d.path(key))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+func (d *diskBlobs) List(_ context.Context, prefix string) ([]BlobInfo, error) {
+	list := []BlobInfo{}
+	err := filepath.WalkDir(d.dir, func(path string, e fs.DirEntry, err error) error {
+		if os.IsNotExist(err) && path == d.dir {
+			return filepath.SkipDir
+		}
+		if err != nil || e.IsDir() || strings.HasPrefix(e.Name(), ".upload-") {
+			return err
+		}
+		rel, err := filepath.Rel(d.dir, path)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+		st, err := e.Info()
+		if err != nil {
+			return err
+		}
+		list = append(list, BlobInfo{Key: key, Size: st.Size(), ModTime: st.ModTime()})
+		return nil
+	})
+	return list, err
+}
+
+func (d *diskBlobs) SignedURL(key string, ttl time.Duration) (string, error) {
+	expires := strconv.FormatInt(time.Now().Add(ttl).Unix(), 10)
+	return "/api/blobs/" + key + "?expires=" + expires + "&sig=" + d.signature(key, expires), nil
+}
+
+// signature — подпись ссылки на объект key, действующей до expires (Unix-время).
+func (d *diskBlobs) signature(key, expires string) string {
+	return hex.EncodeToString(hmacSHA256(d.signingKey, key+"\n"+expires))
+}
+
+// serveSignedBlob — HTTP-обработчик скачивания локального объекта по подписанной ссылке.
+// Реагирует на GET /api/blobs/*key?expires=...&sig=... (ссылки выдаёт SignedURL).
+func serveSignedBlob(c *gin.Context) {
+	d, ok := blobs.(*diskBlobs)
+	if !ok {
+		// Для S3/GCS подписанные ссылки ведут прямо в хранилище.
+		c.JSON(http.StatusNotFound, Response{Success: false, Error: "blob downloads are served by the object store"})
+		return
+	}
+	key := strings.TrimPrefix(c.Param("key"), "/")
+	expires := c.Query("expires")
+	unix, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || !validBlobKey(key) ||
+		!hmac.Equal([]byte(c.Query("sig")), []byte(d.signature(key, expires))) {
+		c.JSON(http.StatusForbidden, Response{Success: false, Error: "invalid blob signature"})
+		return
+	}
+	if time.Now().Unix() > unix {
+		c.JSON(http.StatusForbidden, Response{Success: false, Error: "blob link has expired"})
+		return
+	}
+
+	r, info, err := d.Open(c.Request.Context(), key)
+	if err == errBlobNotFound {
+		c.JSON(http.StatusNotFound, Response{Success: false, Error: err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	defer r.Close()
+	c.DataFromReader(http.StatusOK, info.Size, info.ContentType, r, nil)
+}
+
+// getBlobs — HTTP-обработчик списка зарегистрированных объектов.
+// Реагирует на GET /api/admin/blobs?kind=open-data (без kind — все объекты).
+func getBlobs(c *gin.Context) {
+	rows, err := db.QueryContext(c.Request.Context(), `
+		SELECT key, kind, content_type, size, created_at
+		FROM blobs
+		WHERE $1 = '' OR kind = $1
+		ORDER BY key
+	`, c.Query("kind"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	list := []BlobInfo{}
+	for rows.Next() {
+		var b BlobInfo
+		if err := rows.Scan(&b.Key, &b.Kind, &b.ContentType, &b.Size, &b.ModTime); err != nil {
+			c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+			return
+		}
+		list = append(list, b)
+	}
+	if err := rows.Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	respondList(c, list, len(list), false)
+}
+
+// getBlobURL — HTTP-обработчик, выдающий подписанную ссылку на объект.
+// Реагирует на GET /api/admin/blobs/url?key=open-data/2026-01-01.json&ttl=1h (ttl по умолчанию 15m, не больше 7 суток).
+func getBlobURL(c *gin.Context) {
+	key := c.Query("key")
+	if !validBlobKey(key) {
+		c.JSON(http.StatusBadRequest, Response{Success: false, Error: "invalid blob key"})
+		return
+	}
+	ttl := 15 * time.Minute
+	if v := c.Query("ttl"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 || d > 7*24*time.Hour {
+			c.JSON(http.StatusBadRequest, Response{Success: false, Error: "ttl must be a duration up to 168h"})
+			return
+		}
+		ttl = d
+	}
+	signed, err := blobs.SignedURL(key, ttl)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, Response{
+		Success: true,
+		Data:    gin.H{"key": key, "url": signed, "expires_at": time.Now().Add(ttl).UTC()},
+		Count:   1,
+	})
+}
+
+// startBlobCleanup — HTTP-обработчик ручного запуска очистки осиротевших объектов.
+// Реагирует на POST /api/admin/blobs/cleanup; очистка идёт фоновой задачей (см. jobs.go).
+func startBlobCleanup(c *gin.Context) {
+	job := jobs.start("blob-cleanup", func(func(interface{})) (interface{}, error) {
+		return cleanupBlobs(context.Background())
+	})
+	c.JSON(http.StatusAccepted, Response{
+		Success: true,
+		Data:    job,
+		Count:   1,
+	})
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// s3Blobs — хранилище в бакете Amazon S3 или совместимого сервиса (в том числе GCS).
+// Как и awsSecrets, запросы подписываются Signature Version 4 вручную, без SDK.
+// Адресация path-style (endpoint/bucket/key) — её понимают и S3, и GCS, и MinIO.
+type s3Blobs struct {
+	endpoint     string
+	bucket       string
+	region       string
+	accessKey    string
+	secretKey    string
+	sessionToken string
+}
+
+// blobLimits — таймаут обращения к хранилищу с учётом срока запроса (см. deadline.go).
+// Скачивание идёт, пока тело ответа не закрыто, поэтому максимум рассчитан на крупные файлы.
+var blobLimits = providerLimits{
+	max:   5 * time.Minute,
+	floor: time.Second,
+	retry: retryPolicy{attempts: 3, base: 200 * time.Millisecond, max: 2 * time.Second},
+}
+
+// unsignedPayload — хэш тела для подписанных ссылок: содержимое заранее неизвестно.
+const unsignedPayload = "UNSIGNED-PAYLOAD"
+
+// objectURL возвращает адрес объекта (или бакета при пустом key).
+func (s *s3Blobs) objectURL(key string) string {
+	u := s.endpoint + "/" + s.bucket
+	if key != "" {
+		u += "/" + key
+	}
+	return u
+}
+
+func (s *s3Blobs) Put(ctx context.Context, key string, r io.Reader, contentType string) error {
+	// S3 не принимает тело без длины, поэтому объект читается в память целиком:
+	// через хранилище идут выгрузки и снимки, а не гигабайтные файлы.
+	body, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, s.objectURL(key), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	s.sign(req, sha256Hex(body), time.Now().UTC())
+	resp, err := s.do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (s *s3Blobs) Open(ctx context.Context, key string) (io.ReadCloser, BlobInfo, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.objectURL(key), nil)
+	if err != nil {
+		return nil, BlobInfo{}, err
+	}
+	s.sign(req, sha256Hex(nil), time.Now().UTC())
+	resp, err := s.do(req)
+	if err != nil {
+		return nil, BlobInfo{}, err
+	}
+	info := BlobInfo{Key: key, ContentType: resp.Header.Get("Content-Type"), Size: resp.ContentLength}
+	info.ModTime, _ = http.ParseTime(resp.Header.Get("Last-Modified"))
+	return resp.Body, info, nil
+}
+
+func (s *s3Blobs) Delete(ctx context.Context, key string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, s.objectURL(key), nil)
+	if err != nil {
+		return err
+	}
+	s.sign(req, sha256Hex(nil), time.Now().UTC())
+	resp, err := s.do(req)
+	if err == errBlobNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// s3ListResult — ответ ListObjectsV2.
+type s3ListResult struct {
+	Contents []struct {
+		Key          string    `xml:"Key"`
+		Size         int64     `xml:"Size"`
+		LastModified time.Time `xml:"LastModified"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+func (s *s3Blobs) List(ctx context.Context, prefix string) ([]BlobInfo, error) {
+	list := []BlobInfo{}
+	token := ""
+	for {
+		q := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+		if token != "" {
+			q.Set("continuation-token", token)
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.objectURL("")+"?"+canonicalQuery(q), nil)
+		if err != nil {
+			return nil, err
+		}
+		s.sign(req, sha256Hex(nil), time.Now().UTC())
+		resp, err := s.do(req)
+		if err != nil {
+			return nil, err
+		}
+		var page s3ListResult
+		err = xml.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("decode object list: %w", err)
+		}
+		for _, o := range page.Contents {
+			list = append(list, BlobInfo{Key: o.Key, Size: o.Size, ModTime: o.LastModified})
+		}
+		if !page.IsTruncated {
+			return list, nil
+		}
+		token = page.NextContinuationToken
+	}
+}
+
+// SignedURL строит presigned GET-ссылку (подпись в параметрах запроса). S3 ограничивает срок 7 сутками.
+func (s *s3Blobs) SignedURL(key string, ttl time.Duration) (string, error) {
+	u, err := url.Parse(s.objectURL(key))
+	if err != nil {
+		return "", err
+	}
+	now := time.Now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	scope := s.scope(now)
+	q := url.Values{
+		"X-Amz-Algorithm":     {"AWS4-HMAC-SHA256"},
+		"X-Amz-Credential":    {s.accessKey + "/" + scope},
+		"X-Amz-Date":          {amzDate},
+		"X-Amz-Expires":       {strconv.Itoa(int(ttl.Seconds()))},
+		"X-Amz-SignedHeaders": {"host"},
+	}
+	if s.sessionToken != "" {
+		q.Set("X-Amz-Security-Token", s.sessionToken)
+	}
+	canonicalRequest := strings.Join([]string{
+		http.MethodGet, u.EscapedPath(), canonicalQuery(q), "host:" + u.Host + "\n", "host", unsignedPayload,
+	}, "\n")
+	q.Set("X-Amz-Signature", s.signature(now, amzDate, canonicalRequest))
+	u.RawQuery = canonicalQuery(q)
+	return u.String(), nil
+}
+
+// sign добавляет к запросу заголовки авторизации Signature Version 4 для сервиса s3.
+func (s *s3Blobs) sign(req *http.Request, payloadHash string, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers := map[string]string{
+		"host":                 req.URL.Host,
+		"x-amz-content-sha256": payloadHash,
+		"x-amz-date":           amzDate,
+	}
+	if ct := req.Header.Get("Content-Type"); ct != "" {
+		headers["content-type"] = ct
+	}
+	if s.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", s.sessionToken)
+		headers["x-amz-security-token"] = s.sessionToken
+	}
+	names := make([]string, 0, len(headers))
+	for n := range headers {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, n := range names {
+		canonicalHeaders.WriteString(n + ":" + headers[n] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method, req.URL.EscapedPath(), canonicalQuery(req.URL.Query()), canonicalHeaders.String(), signedHeaders, payloadHash,
+	}, "\n")
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.accessKey, s.scope(now), signedHeaders, s.signature(now, amzDate, canonicalRequest)))
+}
+
+// scope — область действия подписи: дата, регион и сервис.
+func (s *s3Blobs) scope(now time.Time) string {
+	return now.Format("20060102") + "/" + s.region + "/s3/aws4_request"
+}
+
+// signature подписывает канонический запрос ключом, производным от секретного ключа.
+func (s *s3Blobs) signature(now time.Time, amzDate, canonicalRequest string) string {
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256", amzDate, s.scope(now), sha256Hex([]byte(canonicalRequest)),
+	}, "\n")
+	key := hmacSHA256([]byte("AWS4"+s.secretKey), now.Format("20060102"))
+	key = hmacSHA256(key, s.region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	return hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+// canonicalQuery кодирует параметры так, как требует SigV4: по алфавиту, пробел — %20.
+func canonicalQuery(q url.Values) string {
+	return strings.ReplaceAll(q.Encode(), "+", "%20")
+}
+
+// do выполняет запрос к хранилищу. 404 превращается в errBlobNotFound, прочие ошибки —
+// в текст ответа сервиса. При успехе тело ответа закрывает вызывающий.
+func (s *s3Blobs) do(req *http.Request) (*http.Response, error) {
+	resp, err := doProvider(outboundClient, "object-store", req, blobLimits)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, errBlobNotFound
+	}
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		resp.Body.Close()
+		return nil, fmt.Errorf("object store: unexpected status %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return resp, nil
+}
@@ -0,0 +1,389 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Бронирования.
+//
+// Бронируют партнёры по API-ключу (см. quotaMiddleware) и пользователи по токену
+// доступа (см. auth.go). Бронирование пользователя принадлежит ему, а имя гостя
+// берётся из учётной записи; бронирование по одному API-ключу — тенанту ключа.
+// Другие пользователи и тенанты его не видят. Создание идёт в одной транзакции:
+// строка гостиницы блокируется, проверяются рынок клиента (см. markets.go) и
+// свободные места на каждую ночь (см. availability.go), стоимость считается по
+// действующей цене (см. quoteHotel) и фиксируется в бронировании. Отмена не
+// удаляет запись, а переводит её в статус cancelled:
+//
+//	bookings(id, hotel_id, tenant_id NULL, user_id NULL, guest_name, check_in date, check_out date,
+//	         guests, status, total, created_at, cancelled_at NULL, checked_in_at NULL)
+
+// Статусы бронирования.
+const (
+	bookingConfirmed = "confirmed"
+	bookingCancelled = "cancelled"
+)
+
+// errCodeNoAvailability — код ошибки: на часть ночей не хватает свободных мест (см. availability.go).
+const errCodeNoAvailability = "no_availability"
+
+// maxBookingNights — самое долгое проживание в одном бронировании.
+const maxBookingNights = 30
+
+// maxBookingAdvance — насколько заранее можно бронировать.
+const maxBookingAdvance = 2 * 365 * 24 * time.Hour
+
+// maxGuestNameLength — максимальная длина имени гостя.
+const maxGuestNameLength = 200
+
+// bookingDateLayout — формат дат заезда и выезда.
+const bookingDateLayout = "2006-01-02"
+
+// Booking — бронирование.
+type Booking struct {
+	ID          int        `json:"id"`
+	HotelID     int        `json:"hotel_id"`
+	TenantID    *int       `json:"tenant_id,omitempty"`
+	UserID      *int       `json:"user_id,omitempty"`
+	GuestName   string     `json:"guest_name"`
+	CheckIn     string     `json:"check_in"`
+	CheckOut    string     `json:"check_out"`
+	Guests      int        `json:"guests"`
+	Status      string     `json:"status"`
+	Total       float64    `json:"total"`
+	CreatedAt   time.Time  `json:"created_at"`
+	CancelledAt *time.Time `json:"cancelled_at,omitempty"`
+	// CheckedInAt — когда гость зарегистрировался по QR-коду (см. checkin.go).
+	CheckedInAt *time.Time `json:"checked_in_at,omitempty"`
+}
+
+// bookingSelect — общая часть запросов бронирований; колонки читает scanBooking.
+const bookingSelect = `
+	SELECT id, hotel_id, tenant_id, user_id, guest_name, check_in::text, check_out::text, guests, status, total,
+	       created_at, cancelled_at, checked_in_at
+	FROM bookings`
+
+// scanBooking читает строку bookingSelect.
+func scanBooking(row interface{ Scan(...interface{}) error }) (Booking, error) {
+	var b Booking
+	err := row.Scan(&b.ID, &b.HotelID, &b.TenantID, &b.UserID, &b.GuestName, &b.CheckIn, &b.CheckOut, &b.Guests, &b.Status,
+		&b.Total, &b.CreatedAt, &b.CancelledAt, &b.CheckedInAt)
+	return b, err
+}
+
+// BookingInput — тело создания бронирования.
+type BookingInput struct {
+	HotelID   int    `json:"hotel_id"`
+	GuestName string `json:"guest_name"`
+	CheckIn   string `json:"check_in"`
+	CheckOut  string `json:"check_out"`
+	Guests    int    `json:"guests"`
+}
+
+// validate проверяет поля и возвращает даты заезда и выезда. today — текущая дата (UTC).
+func (in *BookingInput) validate(today time.Time) (checkIn, checkOut time.Time, err error) {
+	in.GuestName = strings.TrimSpace(in.GuestName)
+	switch {
+	case in.HotelID <= 0:
+		return checkIn, checkOut, fmt.Errorf("hotel_id must be a positive integer")
+	case in.GuestName == "":
+		return checkIn, checkOut, fmt.Errorf("guest_name is required")
+	case len([]rune(in.GuestName)) > maxGuestNameLength:
+		return checkIn, checkOut, fmt.Errorf("guest_name must be at most %d characters", maxGuestNameLength)
+	case in.Guests < 1:
+		return checkIn, checkOut, fmt.Errorf("guests must be at least 1")
+	}
+	if checkIn, err = time.Parse(bookingDateLayout, in.CheckIn); err != nil {
+		return checkIn, checkOut, fmt.Errorf("check_in must be a date in YYYY-MM-DD format")
+	}
+	if checkOut, err = time.Parse(bookingDateLayout, in.CheckOut); err != nil {
+		return checkIn, checkOut, fmt.Errorf("check_out must be a date in YYYY-MM-DD format")
+	}
+	switch nights := bookingNights(checkIn, checkOut); {
+	case checkIn.Before(today):
+		return checkIn, checkOut, fmt.Errorf("check_in must not be in the past")
+	case checkIn.Sub(today) > maxBookingAdvance:
+		return checkIn, checkOut, fmt.Errorf("check_in must be within two years from today")
+	case nights < 1:
+		return checkIn, checkOut, fmt.Errorf("check_out must be after check_in")
+	case nights > maxBookingNights:
+		return checkIn, checkOut, fmt.Errorf("a booking can be at most %d nights", maxBookingNights)
+	}
+	return checkIn, checkOut, nil
+}
+
+// bookingNights — число ночей между датами заезда и выезда.
+func bookingNights(checkIn, checkOut time.Time) int {
+	return int(checkOut.Sub(checkIn).Hours() / 24)
+}
+
+// bookingToday — текущая дата в UTC; даты бронирований календарные, без часового пояса.
+func bookingToday() time.Time {
+	return time.Now().UTC().Truncate(24 * time.Hour)
+}
+
+// bookingOwner — чьи бронирования видит запрос: пользователя по токену доступа,
+// а без него — тенанта API-ключа.
+type bookingOwner struct {
+	column string
+	id     int
+}
+
+// bookingOwnerOf возвращает владельца бронирований запроса (см. requireBookingAuth).
+func bookingOwnerOf(c *gin.Context) bookingOwner {
+	if u, ok := currentUser(c); ok {
+		return bookingOwner{column: "user_id", id: u.ID}
+	}
+	return bookingOwner{column: "tenant_id", id: c.MustGet("api_key").(APIKey).TenantID}
+}
+
+// requireBookingAuth — middleware маршрутов бронирования: нужен токен пользователя или API-ключ.
+// Ставится после quotaMiddleware и userMiddleware.
+func requireBookingAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		_, isUser := currentUser(c)
+		_, isPartner := c.Get("api_key")
+		if !isUser && !isPartner {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, Response{
+				Success: false,
+				Error:   "a Bearer token or " + apiKeyHeader + " header is required",
+				Hint:    "log in with POST /api/auth/login",
+			})
+			return
+		}
+		c.Next()
+	}
+}
+
+// bookingIDParam разбирает :id и отвечает 400, если он не число.
+func bookingIDParam(c *gin.Context) (int, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, Response{Success: false, Error: "booking id must be an integer"})
+		return 0, false
+	}
+	return id, true
+}
+
+// createBooking — HTTP-обработчик создания бронирования.
+// Реагирует на POST /api/bookings с телом
+// {"hotel_id": 1, "guest_name": "Ivan Petrov", "check_in": "2026-07-01", "check_out": "2026-07-04", "guests": 2};
+// пользователь guest_name не передаёт — бронирование оформляется на имя из его учётной записи.
+func createBooking(c *gin.Context) {
+	var in BookingInput
+	if err := c.ShouldBindJSON(&in); err != nil {
+		c.JSON(http.StatusBadRequest, Response{Success: false, Error: err.Error()})
+		return
+	}
+	var tenantID, userID *int
+	if k, ok := c.Get("api_key"); ok {
+		id := k.(APIKey).TenantID
+		tenantID = &id
+	}
+	if u, ok := currentUser(c); ok {
+		if in.GuestName != "" && in.GuestName != u.Name {
+			c.JSON(http.StatusBadRequest, Response{
+				Success: false,
+				Error:   "guest_name cannot be set when booking as a signed-in user",
+				Hint:    "the booking is made in the name of the account",
+			})
+			return
+		}
+		in.GuestName, userID = u.Name, &u.ID
+	}
+	checkIn, checkOut, err := in.validate(bookingToday())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, Response{Success: false, Error: err.Error()})
+		return
+	}
+
+	tx, err := db.BeginTx(c.Request.Context(), nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	// Блокируем гостиницу: параллельные бронирования одной гостиницы выполняются по очереди,
+	// а её статус и цена не меняются до конца транзакции.
+	var locked int
+	err = tx.QueryRowContext(c.Request.Context(), "SELECT h.id FROM hotels h WHERE h.id = $1 AND "+publishedHotel+" FOR UPDATE", in.HotelID).Scan(&locked)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, Response{Success: false, Error: "hotel not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	if !requireMarket(c, tx, in.HotelID) {
+		return
+	}
+
+	set, err := queryHotelsIn(c.Request.Context(), tx, true, hotelSelect+" WHERE h.id = $1", in.HotelID)
+	if err != nil || len(set.Items) == 0 {
+		if err == nil {
+			err = fmt.Errorf("hotel %d disappeared while booking", in.HotelID)
+		}
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	hotel := set.Items[0]
+	if hotel.Capacity != nil && in.Guests > *hotel.Capacity {
+		c.JSON(http.StatusUnprocessableEntity, Response{
+			Success: false,
+			Error:   fmt.Sprintf("hotel %d accommodates at most %d guests", hotel.ID, *hotel.Capacity),
+		})
+		return
+	}
+	// Гостиница заблокирована, поэтому занятость не изменится до конца транзакции.
+	nights, err := nightlyBookedGuests(c.Request.Context(), tx, hotel.ID, checkIn, checkOut)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	if a := availabilityFor(hotel.ID, hotel.Capacity, in.Guests, nights); !a.Available {
+		c.JSON(http.StatusConflict, Response{
+			Success: false,
+			Code:    errCodeNoAvailability,
+			Error:   fmt.Sprintf("hotel %d has only %d places left on some of these nights", hotel.ID, *a.MinRemaining),
+			Hint:    "check GET /api/hotels/:id/availability for other dates",
+		})
+		return
+	}
+	quote, err := quoteHotel(hotel, QuoteRequest{Nights: bookingNights(checkIn, checkOut)})
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, Response{Success: false, Error: err.Error()})
+		return
+	}
+
+	var id int
+	err = tx.QueryRowContext(c.Request.Context(), `
+		INSERT INTO bookings (hotel_id, tenant_id, user_id, guest_name, check_in, check_out, guests, status, total)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		RETURNING id
+	`, in.HotelID, tenantID, userID, in.GuestName, checkIn, checkOut, in.Guests, bookingConfirmed, quote.Total).Scan(&id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	booking, err := scanBooking(tx.QueryRowContext(c.Request.Context(), bookingSelect+" WHERE id = $1", id))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	forgetAvailability(in.HotelID)
+
+	c.Header("Location", fmt.Sprintf("/api/bookings/%d", id))
+	c.JSON(http.StatusCreated, Response{Success: true, Data: booking, Count: 1})
+}
+
+// getBookings — HTTP-обработчик списка бронирований пользователя или тенанта, от новых к старым.
+// Реагирует на GET /api/bookings; фильтры ?status=confirmed|cancelled и ?hotel_id=,
+// постранично с ?page=&per_page= (см. pagination.go).
+func getBookings(c *gin.Context) {
+	owner := bookingOwnerOf(c)
+	query := bookingSelect + " WHERE " + owner.column + " = $1"
+	args := []interface{}{owner.id}
+	if status := c.Query("status"); status != "" {
+		if status != bookingConfirmed && status != bookingCancelled {
+			c.JSON(http.StatusBadRequest, Response{Success: false, Error: "status must be confirmed or cancelled"})
+			return
+		}
+		args = append(args, status)
+		query += fmt.Sprintf(" AND status = $%d", len(args))
+	}
+	if v := c.Query("hotel_id"); v != "" {
+		hotelID, err := strconv.Atoi(v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, Response{Success: false, Error: "hotel_id must be an integer"})
+			return
+		}
+		args = append(args, hotelID)
+		query += fmt.Sprintf(" AND hotel_id = $%d", len(args))
+	}
+
+	respondQueryPage(c, "booking", query+" ORDER BY created_at DESC, id DESC", args, scanBooking)
+}
+
+// getBooking — HTTP-обработчик, возвращающий бронирование пользователя или тенанта по id.
+// Реагирует на GET /api/bookings/:id; чужие бронирования не находятся (404).
+func getBooking(c *gin.Context) {
+	id, ok := bookingIDParam(c)
+	if !ok {
+		return
+	}
+	owner := bookingOwnerOf(c)
+	b, err := scanBooking(db.QueryRowContext(c.Request.Context(), bookingSelect+" WHERE id = $1 AND "+owner.column+" = $2", id, owner.id))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, Response{Success: false, Error: "booking not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, Response{Success: true, Data: b, Count: 1})
+}
+
+// cancelBooking — HTTP-обработчик отмены бронирования.
+// Реагирует на DELETE /api/bookings/:id: бронирование переходит в статус cancelled.
+// Отменить можно только подтверждённое бронирование, проживание по которому ещё не началось.
+func cancelBooking(c *gin.Context) {
+	id, ok := bookingIDParam(c)
+	if !ok {
+		return
+	}
+
+	tx, err := db.BeginTx(c.Request.Context(), nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	owner := bookingOwnerOf(c)
+	b, err := scanBooking(tx.QueryRowContext(c.Request.Context(), bookingSelect+" WHERE id = $1 AND "+owner.column+" = $2 FOR UPDATE", id, owner.id))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, Response{Success: false, Error: "booking not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	if b.Status != bookingConfirmed {
+		c.JSON(http.StatusConflict, Response{Success: false, Error: fmt.Sprintf("booking is already %s", b.Status)})
+		return
+	}
+	if checkIn, err := time.Parse(bookingDateLayout, b.CheckIn); b.CheckedInAt != nil || (err == nil && checkIn.Before(bookingToday())) {
+		c.JSON(http.StatusConflict, Response{Success: false, Error: "the stay has already started and cannot be cancelled"})
+		return
+	}
+
+	if _, err := tx.ExecContext(c.Request.Context(), "UPDATE bookings SET status = $2, cancelled_at = now() WHERE id = $1", id, bookingCancelled); err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	if b, err = scanBooking(tx.QueryRowContext(c.Request.Context(), bookingSelect+" WHERE id = $1", id)); err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	forgetAvailability(b.HotelID)
+	c.JSON(http.StatusOK, Response{Success: true, Data: b, Count: 1})
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// bookingBody — тело POST /api/bookings на одну ночь через days дней.
+func bookingBody(hotelID, guests, days int, guest string) string {
+	checkIn := bookingToday().AddDate(0, 0, days)
+	return fmt.Sprintf(`{"hotel_id": %d, "guest_name": %q, "check_in": %q, "check_out": %q, "guests": %d}`,
+		hotelID, guest, checkIn.Format(time.DateOnly), checkIn.AddDate(0, 0, 1).Format(time.DateOnly), guests)
+}
+
+// testBookedGuests — сколько гостей подтверждённых бронирований у гостиницы в самую загруженную ночь.
+func testBookedGuests(t *testing.T, hotelID int) int {
+	t.Helper()
+	peak, err := peakBookedGuests(context.Background(), db, hotelID, bookingToday())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return peak
+}
+
+func TestParallelBookingsCannotOverbook(t *testing.T) {
+	testDB(t)
+	const capacity, parallel = 3, 20
+	hotelID := testHotel(t, "Red Square Inn", testCity(t, "Moscow"), capacity, 5000)
+	testAPIKey(t, "partner-key", "pro", 1000)
+	router := newPublicRouter()
+
+	// Все места, кроме последнего, уже заняты.
+	if w := serve(router, "POST", "/api/bookings", bookingBody(hotelID, capacity-1, 30, "Early Guest"), apiKeyHeader, "partner-key"); w.Code != http.StatusCreated {
+		t.Fatalf("first booking: status %d: %s", w.Code, w.Body)
+	}
+
+	codes := make([]int, parallel)
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := range codes {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			<-start
+			w := serve(router, "POST", "/api/bookings", bookingBody(hotelID, 1, 30, "Guest "+strconv.Itoa(i)), apiKeyHeader, "partner-key")
+			codes[i] = w.Code
+		}(i)
+	}
+	close(start)
+	wg.Wait()
+
+	created := 0
+	for i, code := range codes {
+		switch code {
+		case http.StatusCreated:
+			created++
+		case http.StatusConflict:
+		default:
+			t.Errorf("booking %d: unexpected status %d", i, code)
+		}
+	}
+	if created != 1 {
+		t.Errorf("%d of %d parallel bookings for the last place succeeded, want exactly 1", created, parallel)
+	}
+	if peak := testBookedGuests(t, hotelID); peak != capacity {
+		t.Errorf("%d guests booked for the night, capacity is %d", peak, capacity)
+	}
+}
+
+func TestCapacityShrinkRacesBooking(t *testing.T) {
+	testDB(t)
+	hotelID := testHotel(t, "Red Square Inn", testCity(t, "Moscow"), 2, 5000)
+	testAPIKey(t, "partner-key", "pro", 1000)
+	_, adminToken := testUser(t, "admin@example.com", roleAdmin)
+	router := newPublicRouter()
+	hotelPath := "/api/hotels/" + strconv.Itoa(hotelID)
+
+	// Каждый раунд: одно место занято, одно свободно; уменьшение вместимости до 1
+	// и бронирование последнего места не могут пройти оба.
+	for round := 0; round < 10; round++ {
+		testExec(t, "DELETE FROM bookings")
+		testExec(t, "UPDATE hotels SET capacity = 2 WHERE id = $1", hotelID)
+		if w := serve(router, "POST", "/api/bookings", bookingBody(hotelID, 1, 30, "Early Guest"), apiKeyHeader, "partner-key"); w.Code != http.StatusCreated {
+			t.Fatalf("round %d: first booking: status %d: %s", round, w.Code, w.Body)
+		}
+
+		var shrink, book int
+		start := make(chan struct{})
+		var wg sync.WaitGroup
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			<-start
+			shrink = serve(router, "PATCH", hotelPath, `{"capacity": 1}`, "Authorization", bearerPrefix+adminToken).Code
+		}()
+		go func() {
+			defer wg.Done()
+			<-start
+			book = serve(router, "POST", "/api/bookings", bookingBody(hotelID, 1, 30, "Late Guest"), apiKeyHeader, "partner-key").Code
+		}()
+		close(start)
+		wg.Wait()
+
+		if (shrink == http.StatusOK) == (book == http.StatusCreated) {
+			t.Fatalf("round %d: capacity change answered %d and booking answered %d, want exactly one to succeed", round, shrink, book)
+		}
+		if shrink != http.StatusOK && shrink != http.StatusConflict {
+			t.Fatalf("round %d: capacity change: unexpected status %d", round, shrink)
+		}
+		if book != http.StatusCreated && book != http.StatusConflict {
+			t.Fatalf("round %d: booking: unexpected status %d", round, book)
+		}
+		var capacity int
+		if err := db.QueryRow("SELECT capacity FROM hotels WHERE id = $1", hotelID).Scan(&capacity); err != nil {
+			t.Fatal(err)
+		}
+		if peak := testBookedGuests(t, hotelID); peak > capacity {
+			t.Fatalf("round %d: %d guests booked for the night, capacity is %d", round, peak, capacity)
+		}
+	}
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Массовое изменение цен: POST /api/admin/hotels/prices/bulk.
+//
+// Правила применяются по порядку; гостиница, подходящая под несколько правил,
+// получает их все последовательно. Правило выбирает гостиницы по городу, списку id
+// и статусу (пустое условие — любые) и меняет цену одним из способов:
+//
+//	{"city_id": 5, "percent": 10}   — +10 %
+//	{"hotel_ids": [1, 2], "amount": -500} — минус 500
+//	{"status": "draft", "set": 3000}      — ровно 3000
+//
+// Базой служит цена, действующая на effective_from (по расписанию цен, а без него —
+// hotels.price); новая цена записывается в расписание с тем же effective_from
+// (по умолчанию — сейчас), поэтому изменение можно и запланировать (см. schedule.go).
+// С "dry_run": true ничего не записывается — ответ показывает затронутые гостиницы
+// с ценами до и после. Без него всё изменение выполняется одной транзакцией
+// и каждая изменённая цена попадает в журнал:
+//
+//	price_audit(id, hotel_id, old_price NULL, new_price, effective_from, request_id, created_at)
+
+// bulkPriceMaxRules — сколько правил принимается в одном запросе.
+const bulkPriceMaxRules = 50
+
+// PriceRule — правило массового изменения цен.
+type PriceRule struct {
+	CityID   *int     `json:"city_id"`
+	HotelIDs []int    `json:"hotel_ids"`
+	Status   string   `json:"status"`
+	Percent  *float64 `json:"percent"`
+	Amount   *float64 `json:"amount"`
+	Set      *float64 `json:"set"`
+}
+
+// validate проверяет правило. Возвращает текст ошибки или пустую строку.
+func (r PriceRule) validate() string {
+	changes := 0
+	for _, v := range []*float64{r.Percent, r.Amount, r.Set} {
+		if v != nil {
+			changes++
+		}
+	}
+	if changes != 1 {
+		return "exactly one of percent, amount or set is required"
+	}
+	if r.Percent != nil && *r.Percent <= -100 {
+		return "percent must be greater than -100"
+	}
+	if r.Set != nil && *r.Set < 0 {
+		return "set must not be negative"
+	}
+	if _, ok := hotelTransitions[r.Status]; r.Status != "" && !ok {
+		return fmt.Sprintf("unknown status %q", r.Status)
+	}
+	return ""
+}
+
+// bulkCandidate — гостиница и её цена, к которым применяются правила.
+type bulkCandidate struct {
+	ID     int
+	Name   string
+	CityID *int
+	Status string
+	Price  *float64
+}
+
+// matches сообщает, подходит ли гостиница под условия правила.
+func (r PriceRule) matches(h bulkCandidate) bool {
+	if r.CityID != nil && (h.CityID == nil || *h.CityID != *r.CityID) {
+		return false
+	}
+	if r.Status != "" && h.Status != r.Status {
+		return false
+	}
+	if len(r.HotelIDs) > 0 {
+		for _, id := range r.HotelIDs {
+			if id == h.ID {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// apply возвращает новую цену. Процент и сумма к гостинице без цены неприменимы — ok=false.
+func (r PriceRule) apply(price *float64) (float64, bool) {
+	switch {
+	case r.Set != nil:
+		return *r.Set, true
+	case price == nil:
+		return 0, false
+	case r.Percent != nil:
+		return math.Round(*price*(100+*r.Percent)) / 100, true
+	default:
+		return math.Round((*price+*r.Amount)*100) / 100, true
+	}
+}
+
+// PriceChange — изменение цены одной гостиницы.
+type PriceChange struct {
+	HotelID int      `json:"hotel_id"`
+	Name    string   `json:"name"`
+	Before  *float64 `json:"before"`
+	After   float64  `json:"after"`
+	Rules   []int    `json:"rules"`
+}
+
+// bulkCandidatesQuery — все гостиницы с ценой, действующей на $1.
+const bulkCandidatesQuery = `
+	SELECT h.id, h.name, h.city, h.status, COALESCE((
+		SELECT hp.price::numeric FROM hotel_prices hp
+		WHERE hp.hotel_id = h.id AND hp.effective_from <= $1
+		ORDER BY hp.effective_from DESC LIMIT 1
+	), h.price::numeric)
+	FROM hotels h
+	ORDER BY h.id
+`
+
+// planPriceChanges читает гостиницы в транзакции tx и вычисляет изменения цен по правилам.
+// forUpdate блокирует строки гостиниц до конца транзакции.
+func planPriceChanges(ctx context.Context, tx *sql.Tx, rules []PriceRule, at time.Time, forUpdate bool) ([]PriceChange, error) {
+	query := bulkCandidatesQuery
+	if forUpdate {
+		query += " FOR UPDATE OF h"
+	}
+	rows, err := tx.QueryContext(ctx, query, at)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	changes := []PriceChange{}
+	for rows.Next() {
+		var h bulkCandidate
+		if err := rows.Scan(&h.ID, &h.Name, &h.CityID, &h.Status, &h.Price); err != nil {
+			// Пропуск гостиницы исказил бы и превью, и изменение — ошибка всегда фатальна.
+			return nil, err
+		}
+		change := PriceChange{HotelID: h.ID, Name: h.Name, Before: h.Price, Rules: []int{}}
+		price := h.Price
+		for i, r := range rules {
+			if !r.matches(h) {
+				continue
+			}
+			next, ok := r.apply(price)
+			if !ok {
+				continue
+			}
+			price = &next
+			change.Rules = append(change.Rules, i)
+		}
+		if len(change.Rules) == 0 || (h.Price != nil && *price == *h.Price) {
+			continue
+		}
+		change.After = *price
+		if change.After < 0 {
+			return nil, fmt.Errorf("hotel %d: price would become negative (%.2f)", h.ID, change.After)
+		}
+		changes = append(changes, change)
+	}
+	return changes, rows.Err()
+}
+
+// bulkUpdatePrices — HTTP-обработчик массового изменения цен.
+// Реагирует на POST /api/admin/hotels/prices/bulk с телом
+// {"rules": [{"city_id": 5, "percent": 10}], "effective_from": "...", "dry_run": true}.
+func bulkUpdatePrices(c *gin.Context) {
+	var body struct {
+		Rules         []PriceRule `json:"rules"`
+		EffectiveFrom *time.Time  `json:"effective_from"`
+		DryRun        bool        `json:"dry_run"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, Response{Success: false, Error: err.Error()})
+		return
+	}
+	if len(body.Rules) == 0 || len(body.Rules) > bulkPriceMaxRules {
+		c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Error:   fmt.Sprintf("between 1 and %d rules are required", bulkPriceMaxRules),
+		})
+		return
+	}
+	for i, r := range body.Rules {
+		if msg := r.validate(); msg != "" {
+			c.JSON(http.StatusBadRequest, Response{Success: false, Error: fmt.Sprintf("rule %d: %s", i, msg)})
+			return
+		}
+	}
+	at := time.Now()
+	if body.EffectiveFrom != nil {
+		at = *body.EffectiveFrom
+	}
+
+	// Превью читает в транзакции только для чтения, изменение — с блокировкой гостиниц,
+	// чтобы между расчётом и записью цены никто не поменял.
+	tx, err := db.BeginTx(c.Request.Context(), &sql.TxOptions{ReadOnly: body.DryRun})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	changes, err := planPriceChanges(c.Request.Context(), tx, body.Rules, at, !body.DryRun)
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, Response{Success: false, Error: err.Error()})
+		return
+	}
+	if body.DryRun || len(changes) == 0 {
+		c.JSON(http.StatusOK, Response{
+			Success: true,
+			Data:    gin.H{"dry_run": body.DryRun, "effective_from": at, "changes": changes},
+			Count:   len(changes),
+		})
+		return
+	}
+
+	requestID := c.GetString("request_id")
+	for _, ch := range changes {
+		if _, err := tx.ExecContext(c.Request.Context(), `
+			INSERT INTO hotel_prices (hotel_id, price, effective_from)
+			VALUES ($1, $2, $3)
+			ON CONFLICT (hotel_id, effective_from) DO UPDATE SET price = EXCLUDED.price, created_at = now()
+		`, ch.HotelID, ch.After, at); err != nil {
+			c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+			return
+		}
+		if _, err := tx.ExecContext(c.Request.Context(), `
+			INSERT INTO price_audit (hotel_id, old_price, new_price, effective_from, request_id)
+			VALUES ($1, $2, $3, $4, $5)
+		`, ch.HotelID, ch.Before, ch.After, at, requestID); err != nil {
+			c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+			return
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	cache.flush("hotels")
+
+	c.JSON(http.StatusOK, Response{
+		Success: true,
+		Data:    gin.H{"dry_run": false, "effective_from": at, "changes": changes},
+		Count:   len(changes),
+	})
+}
@@ -0,0 +1,328 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Кэш чтения со стратегией stale-while-revalidate.
+//
+// Пока запись моложе TTL, она отдаётся как есть. Когда TTL истёк, но запись ещё
+// укладывается в бюджет устаревания (Stale), клиент сразу получает старые данные,
+// а обновление запускается в фоне — так задержка не растёт, даже если БД
+// подтормаживает. Только когда запись старше TTL+Stale (или её нет), запрос ждёт БД.
+// Если фоновое обновление не удалось, старое значение остаётся в кэше до конца бюджета.
+// Неполные значения (partialValue) отдаются вызвавшему, но в кэш не попадают.
+//
+// Загрузчик получает контекст: при промахе — контекст запроса (срок запроса и разрыв
+// соединения прерывают запрос к БД), при фоновом обновлении — отвязанный от отмены
+// запроса, ведь ответ уже отправлен, но со сроком REQUEST_TIMEOUT (см. deadline.go).
+//
+// Запись можно закрепить до заданного момента (pin): до него она считается свежей
+// независимо от TTL политики. Так прогрев перед кампанией (см. priming.go) держит данные
+// в кэше всё окно кампании. flush удаляет и закреплённые записи — изменившиеся данные
+// не должны отдаваться до конца закрепления.
+//
+// Параллельные промахи по одному ключу делят одну загрузку (см. do): без этого истечение
+// популярной записи отправляло бы в БД столько одинаковых запросов, сколько пришло клиентов.
+// Каждый сброс увеличивает поколение кэша (gen), а загрузка сохраняет значение, только
+// если её ключ не сбрасывали с момента её начала. Иначе загрузка, прочитавшая БД до
+// изменения, записала бы в кэш старые данные уже после flush, и они жили бы весь TTL.
+
+// cachePolicy — настройки кэширования для одного маршрута.
+// Значения берутся из настроек (см. settings.go), например CACHE_HOTELS_TTL=30s CACHE_HOTELS_STALE=5m.
+type cachePolicy struct {
+	TTL   time.Duration `json:"ttl"`
+	Stale time.Duration `json:"stale"`
+}
+
+// cacheEntry — закэшированное значение и служебные отметки.
+type cacheEntry struct {
+	value      interface{}
+	fetchedAt  time.Time
+	refreshing bool
+	// pinnedUntil — до этого момента запись свежая независимо от политики; нулевое — не закреплена.
+	pinnedUntil time.Time
+}
+
+// Статусы попадания в кэш; отдаются клиенту в заголовке X-Cache.
+const (
+	cacheHit   = "HIT"
+	cacheStale = "STALE"
+	cacheMiss  = "MISS"
+)
+
+// partialValue реализуют значения, которые могут оказаться неполными (см. rowSet в scan.go).
+type partialValue interface {
+	isPartial() bool
+}
+
+// cacheable сообщает, можно ли сохранить значение в кэше.
+func cacheable(value interface{}) bool {
+	p, ok := value.(partialValue)
+	return !ok || !p.isPartial()
+}
+
+// swrCache — потокобезопасный кэш в памяти процесса.
+type swrCache struct {
+	mu      sync.Mutex
+	entries map[string]*cacheEntry
+	// calls — идущие загрузки по ключам; параллельные промахи ждут их, а не идут в БД сами.
+	calls map[string]*cacheCall
+	// gen — счётчик поколений: каждый сброс (flush, flushPrefix) увеличивает его.
+	gen uint64
+	// loading — сколько загрузок ключа сейчас идёт; flushed — поколение последнего
+	// сброса ключа за это время. Загрузка, начатая до сброса, своё значение не сохраняет.
+	loading map[string]int
+	flushed map[string]uint64
+}
+
+// cacheCall — загрузка одного ключа, результат которой делят все её ожидающие.
+type cacheCall struct {
+	done  chan struct{}
+	value interface{}
+	err   error
+}
+
+func newSWRCache() *swrCache {
+	return &swrCache{
+		entries: map[string]*cacheEntry{},
+		calls:   map[string]*cacheCall{},
+		loading: map[string]int{},
+		flushed: map[string]uint64{},
+	}
+}
+
+var cache = newSWRCache()
+
+// cacheLoader загружает значение для кэша.
+type cacheLoader func(ctx context.Context) (interface{}, error)
+
+// get возвращает значение по ключу, при необходимости загружая его через load.
+// Второй результат — статус кэша (HIT, STALE или MISS).
+func (c *swrCache) get(ctx context.Context, key string, policy cachePolicy, load cacheLoader) (interface{}, string, error) {
+	now := time.Now()
+
+	c.mu.Lock()
+	e, ok := c.entries[key]
+	if ok {
+		age := now.Sub(e.fetchedAt)
+		if age < policy.TTL || now.Before(e.pinnedUntil) {
+			c.mu.Unlock()
+			return e.value, cacheHit, nil
+		}
+		if age < policy.TTL+policy.Stale {
+			// Отдаём устаревшее значение и запускаем не больше одного фонового обновления на ключ.
+			if !e.refreshing {
+				e.refreshing = true
+				go c.refresh(context.WithoutCancel(ctx), key, load)
+			}
+			c.mu.Unlock()
+			return e.value, cacheStale, nil
+		}
+	}
+	c.mu.Unlock()
+
+	value, err := c.do(ctx, key, load)
+	if err != nil {
+		return nil, cacheMiss, err
+	}
+	return value, cacheMiss, nil
+}
+
+// do загружает значение ключа и сохраняет его в кэше. Параллельные вызовы для одного
+// ключа делят одну загрузку (single flight). Если загрузку прервал контекст запустившего
+// её запроса, ожидающий с живым контекстом загружает значение сам.
+func (c *swrCache) do(ctx context.Context, key string, load cacheLoader) (interface{}, error) {
+	for {
+		c.mu.Lock()
+		if call, ok := c.calls[key]; ok {
+			c.mu.Unlock()
+			select {
+			case <-call.done:
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+			if isContextError(call.err) && ctx.Err() == nil {
+				continue
+			}
+			return call.value, call.err
+		}
+		call := &cacheCall{done: make(chan struct{})}
+		c.calls[key] = call
+		gen := c.begin(key)
+		c.mu.Unlock()
+
+		c.run(ctx, key, gen, call, time.Time{}, load)
+		return call.value, call.err
+	}
+}
+
+// pin загружает значение ключа и закрепляет его до момента until (см. priming.go).
+// В отличие от do, не присоединяется к идущей загрузке: та не закрепит результат.
+func (c *swrCache) pin(ctx context.Context, key string, until time.Time, load cacheLoader) (interface{}, error) {
+	call := &cacheCall{done: make(chan struct{})}
+	c.mu.Lock()
+	gen := c.begin(key)
+	c.mu.Unlock()
+
+	c.run(ctx, key, gen, call, until, load)
+	return call.value, call.err
+}
+
+// run выполняет загрузку call и сохраняет полное значение, если с начала загрузки
+// (поколение gen) ключ не сбрасывали. Вызывается без c.mu.
+func (c *swrCache) run(ctx context.Context, key string, gen uint64, call *cacheCall, until time.Time, load cacheLoader) {
+	// Если загрузчик запаникует, ожидающие получат ошибку, а не зависнут.
+	call.err = fmt.Errorf("loading cache key %q panicked", key)
+	defer func() {
+		c.mu.Lock()
+		if call.err == nil && cacheable(call.value) && c.flushed[key] <= gen {
+			c.entries[key] = &cacheEntry{value: call.value, fetchedAt: time.Now(), pinnedUntil: until}
+		}
+		c.end(key)
+		if c.calls[key] == call {
+			delete(c.calls, key)
+		}
+		c.mu.Unlock()
+		close(call.done)
+	}()
+	call.value, call.err = load(ctx)
+}
+
+// begin отмечает начало загрузки ключа и возвращает текущее поколение. Вызывается под c.mu.
+func (c *swrCache) begin(key string) uint64 {
+	c.loading[key]++
+	return c.gen
+}
+
+// end отмечает конец загрузки ключа. Вызывается под c.mu.
+func (c *swrCache) end(key string) {
+	if c.loading[key]--; c.loading[key] == 0 {
+		delete(c.loading, key)
+		delete(c.flushed, key)
+	}
+}
+
+// invalidate сбрасывает ключ: удаляет запись, отделяет идущую загрузку (новые промахи
+// начнут свою) и запрещает начатым загрузкам сохранять значение. Вызывается под c.mu
+// после увеличения c.gen; возвращает, была ли запись.
+func (c *swrCache) invalidate(key string) bool {
+	_, ok := c.entries[key]
+	delete(c.entries, key)
+	delete(c.calls, key)
+	if c.loading[key] > 0 {
+		c.flushed[key] = c.gen
+	}
+	return ok
+}
+
+// isContextError сообщает, что ошибка вызвана отменой или истечением срока контекста.
+func isContextError(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// refresh загружает свежее значение в фоне.
+func (c *swrCache) refresh(ctx context.Context, key string, load cacheLoader) {
+	if timeout := settings().RequestTimeout; timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	value, err := c.do(ctx, key, load)
+	if err == nil && !cacheable(value) {
+		err = fmt.Errorf("partial result")
+	}
+	if err != nil {
+		log.Printf("Error refreshing cache key %q: %v", key, err)
+	}
+	// Запись не заменена (ошибка или сброс во время загрузки) — следующий запрос обновит её снова.
+	c.mu.Lock()
+	if e, ok := c.entries[key]; ok {
+		e.refreshing = false
+	}
+	c.mu.Unlock()
+}
+
+// describe возвращает по строке на запись кэша: ключ, возраст и идёт ли обновление.
+func (c *swrCache) describe() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	keys := make([]string, 0, len(c.entries))
+	for key := range c.entries {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	lines := make([]string, 0, len(keys))
+	for _, key := range keys {
+		e := c.entries[key]
+		line := fmt.Sprintf("%s  age=%s refreshing=%t", key, time.Since(e.fetchedAt).Round(time.Second), e.refreshing)
+		if time.Now().Before(e.pinnedUntil) {
+			line += " pinned_until=" + e.pinnedUntil.UTC().Format(time.RFC3339)
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// flush удаляет указанные записи вместе с вложенными в них (ключи вида key:...) или все,
+// если ключи не переданы, и возвращает их количество. Так flush("hotels") сбрасывает
+// и страницы списка, и карточки гостиниц (см. hotelListCacheKey, hotelCacheKey).
+// Загрузки этих ключей, начатые до сброса, своих значений уже не сохранят.
+func (c *swrCache) flush(keys ...string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.gen++
+	if len(keys) == 0 {
+		n := len(c.entries)
+		for key := range c.loading {
+			c.invalidate(key)
+		}
+		c.entries = map[string]*cacheEntry{}
+		c.calls = map[string]*cacheCall{}
+		return n
+	}
+	n := 0
+	for _, key := range keys {
+		if c.invalidate(key) {
+			n++
+		}
+		n += c.invalidatePrefix(key + ":")
+	}
+	return n
+}
+
+// flushPrefix удаляет записи, ключ которых начинается с prefix, и возвращает их количество.
+func (c *swrCache) flushPrefix(prefix string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.gen++
+	return c.invalidatePrefix(prefix)
+}
+
+// invalidatePrefix сбрасывает ключи, начинающиеся с prefix, и возвращает, сколько было
+// записей. Вызывается под c.mu после увеличения c.gen.
+func (c *swrCache) invalidatePrefix(prefix string) int {
+	n := 0
+	for key := range c.entries {
+		if strings.HasPrefix(key, prefix) && c.invalidate(key) {
+			n++
+		}
+	}
+	for key := range c.loading {
+		if strings.HasPrefix(key, prefix) {
+			c.invalidate(key)
+		}
+	}
+	return n
+}
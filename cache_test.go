@@ -0,0 +1,406 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testLoader — загрузчик, возвращающий value и считающий вызовы.
+func testLoader(value interface{}, calls *atomic.Int32) cacheLoader {
+	return func(ctx context.Context) (interface{}, error) {
+		calls.Add(1)
+		return value, nil
+	}
+}
+
+// blockingLoader — загрузчик, который сообщает о старте в started и ждёт release.
+func blockingLoader(value interface{}, started chan<- struct{}, release <-chan struct{}) cacheLoader {
+	return func(ctx context.Context) (interface{}, error) {
+		started <- struct{}{}
+		select {
+		case <-release:
+			return value, nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// hour — политика, при которой записи в тестах не устаревают.
+var hour = cachePolicy{TTL: time.Hour}
+
+// testCacheGet — get с политикой hour; результат в виде (значение, статус).
+func testCacheGet(t *testing.T, c *swrCache, key string, load cacheLoader) (interface{}, string) {
+	t.Helper()
+	value, status, err := c.get(context.Background(), key, hour, load)
+	if err != nil {
+		t.Fatalf("get %s: %v", key, err)
+	}
+	return value, status
+}
+
+// Параллельные промахи по одному ключу делят одну загрузку.
+func TestCacheSingleFlight(t *testing.T) {
+	c := newSWRCache()
+	started, release := make(chan struct{}, 1), make(chan struct{})
+	var calls atomic.Int32
+	load := func(ctx context.Context) (interface{}, error) {
+		calls.Add(1)
+		return blockingLoader("value", started, release)(ctx)
+	}
+
+	const parallel = 20
+	var wg sync.WaitGroup
+	results := make([]interface{}, parallel)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], _, _ = c.get(context.Background(), "k", hour, load)
+		}(i)
+	}
+	<-started
+	// Даём остальным горутинам дойти до ожидания загрузки.
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if calls.Load() != 1 {
+		t.Errorf("%d loads for %d parallel misses, want 1", calls.Load(), parallel)
+	}
+	for i, v := range results {
+		if v != "value" {
+			t.Errorf("caller %d got %v", i, v)
+		}
+	}
+	if _, status := testCacheGet(t, c, "k", load); status != cacheHit {
+		t.Errorf("after the load: %s", status)
+	}
+}
+
+// Загрузка, начатая до сброса ключа, не сохраняет прочитанное до изменения значение,
+// а промах после сброса не присоединяется к ней.
+func TestCacheFlushDuringLoad(t *testing.T) {
+	for name, flush := range map[string]func(c *swrCache){
+		"flush key":    func(c *swrCache) { c.flush("availability:1:a") },
+		"flush all":    func(c *swrCache) { c.flush() },
+		"flush prefix": func(c *swrCache) { c.flushPrefix("availability:1:") },
+	} {
+		c := newSWRCache()
+		started, release := make(chan struct{}, 1), make(chan struct{})
+		done := make(chan interface{})
+		go func() {
+			value, _, _ := c.get(context.Background(), "availability:1:a", hour, blockingLoader("old", started, release))
+			done <- value
+		}()
+		<-started
+		flush(c)
+
+		var calls atomic.Int32
+		if value, status := testCacheGet(t, c, "availability:1:a", testLoader("new", &calls)); value != "new" || status != cacheMiss || calls.Load() != 1 {
+			t.Errorf("%s: miss after the flush got %v (%s, %d loads)", name, value, status, calls.Load())
+		}
+		close(release)
+		if value := <-done; value != "old" {
+			t.Errorf("%s: the caller of the old load got %v", name, value)
+		}
+		if value, status := testCacheGet(t, c, "availability:1:a", testLoader("unexpected", &calls)); value != "new" || status != cacheHit {
+			t.Errorf("%s: cached %v (%s), want the value loaded after the flush", name, value, status)
+		}
+		if len(c.loading) != 0 || len(c.flushed) != 0 || len(c.calls) != 0 {
+			t.Errorf("%s: leftover bookkeeping: loading %v, flushed %v, calls %d", name, c.loading, c.flushed, len(c.calls))
+		}
+	}
+}
+
+// Сброс другого ключа не мешает загрузке сохранить значение.
+func TestCacheFlushOtherKey(t *testing.T) {
+	c := newSWRCache()
+	started, release := make(chan struct{}, 1), make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		c.get(context.Background(), "hotels", hour, blockingLoader("hotels", started, release))
+		close(done)
+	}()
+	<-started
+	c.flushPrefix("availability:1:")
+	c.flush("cities")
+	close(release)
+	<-done
+
+	var calls atomic.Int32
+	if _, status := testCacheGet(t, c, "hotels", testLoader("unexpected", &calls)); status != cacheHit {
+		t.Errorf("hotels: %s after flushing other keys", status)
+	}
+}
+
+// Если загрузку прервал контекст запустившего её запроса, ожидающий загружает сам.
+func TestCacheLeaderCanceled(t *testing.T) {
+	c := newSWRCache()
+	started, release := make(chan struct{}, 2), make(chan struct{})
+	ctx, cancel := context.WithCancel(context.Background())
+	leader := make(chan error)
+	load := blockingLoader("value", started, release)
+	go func() {
+		_, _, err := c.get(ctx, "k", hour, load)
+		leader <- err
+	}()
+	<-started
+
+	waiter := make(chan interface{})
+	go func() {
+		value, _, _ := c.get(context.Background(), "k", hour, load)
+		waiter <- value
+	}()
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+	if err := <-leader; !errors.Is(err, context.Canceled) {
+		t.Fatalf("leader: err = %v", err)
+	}
+	<-started
+	close(release)
+	if value := <-waiter; value != "value" {
+		t.Errorf("waiter got %v", value)
+	}
+}
+
+// Паника загрузчика не оставляет ожидающих висеть.
+func TestCacheLoaderPanic(t *testing.T) {
+	c := newSWRCache()
+	started, release := make(chan struct{}, 1), make(chan struct{})
+	go func() {
+		defer func() { recover() }()
+		c.get(context.Background(), "k", hour, func(ctx context.Context) (interface{}, error) {
+			started <- struct{}{}
+			<-release
+			panic("boom")
+		})
+	}()
+	<-started
+
+	waiter := make(chan error)
+	go func() {
+		_, _, err := c.get(context.Background(), "k", hour, func(ctx context.Context) (interface{}, error) {
+			return "unexpected", nil
+		})
+		waiter <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	select {
+	case err := <-waiter:
+		if err == nil {
+			t.Error("waiter got no error")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("waiter hangs after the loader panicked")
+	}
+}
+
+// Фоновое обновление, начатое до сброса ключа, не возвращает в кэш старое значение.
+func TestCacheRefreshFlushed(t *testing.T) {
+	c := newSWRCache()
+	policy := cachePolicy{TTL: time.Nanosecond, Stale: time.Hour}
+	var calls atomic.Int32
+	if _, _, err := c.get(context.Background(), "k", policy, testLoader("v1", &calls)); err != nil {
+		t.Fatal(err)
+	}
+
+	started, release := make(chan struct{}, 1), make(chan struct{})
+	time.Sleep(time.Millisecond)
+	if value, status, _ := c.get(context.Background(), "k", policy, blockingLoader("v2", started, release)); value != "v1" || status != cacheStale {
+		t.Fatalf("stale read: %v %s", value, status)
+	}
+	<-started
+	c.flush("k")
+	close(release)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		c.mu.Lock()
+		loading := len(c.loading)
+		c.mu.Unlock()
+		if loading == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the refresh does not finish")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if value, status := testCacheGet(t, c, "k", testLoader("v3", &calls)); value != "v3" || status != cacheMiss {
+		t.Errorf("after the flush: %v (%s), the refresh read before the flush was stored", value, status)
+	}
+}
+
+// Закреплённая запись свежая дольше TTL, а flush удаляет и её.
+func TestCachePinned(t *testing.T) {
+	c := newSWRCache()
+	policy := cachePolicy{TTL: time.Nanosecond}
+	var calls atomic.Int32
+	pin := func(value string, until time.Time) {
+		t.Helper()
+		if _, err := c.pin(context.Background(), "k", until, testLoader(value, &calls)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	pin("pinned", time.Now().Add(time.Hour))
+	time.Sleep(time.Millisecond)
+	value, status, err := c.get(context.Background(), "k", policy, testLoader("loaded", &calls))
+	if err != nil || value != "pinned" || status != cacheHit || calls.Load() != 1 {
+		t.Fatalf("pinned entry past TTL: %v %s %v, %d loads", value, status, err, calls.Load())
+	}
+
+	// Закрепление в прошлом не продлевает запись.
+	pin("expired", time.Now().Add(-time.Second))
+	time.Sleep(time.Millisecond)
+	if value, status, _ := c.get(context.Background(), "k", policy, testLoader("loaded", &calls)); value != "loaded" || status != cacheMiss {
+		t.Errorf("expired pin: %v %s", value, status)
+	}
+
+	pin("pinned", time.Now().Add(time.Hour))
+	if n := c.flush("k"); n != 1 {
+		t.Errorf("flush removed %d entries", n)
+	}
+	if value, status, _ := c.get(context.Background(), "k", policy, testLoader("fresh", &calls)); value != "fresh" || status != cacheMiss {
+		t.Errorf("after flush: %v %s", value, status)
+	}
+}
+
+// Прогрев, прочитавший БД до сброса, не закрепляет старое значение.
+func TestCachePinFlushedDuringLoad(t *testing.T) {
+	c := newSWRCache()
+	started, release := make(chan struct{}, 1), make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		c.pin(context.Background(), "availability:1:a", time.Now().Add(time.Hour), blockingLoader("old", started, release))
+		close(done)
+	}()
+	<-started
+	c.flushPrefix("availability:1:")
+	close(release)
+	<-done
+
+	var calls atomic.Int32
+	if value, status := testCacheGet(t, c, "availability:1:a", testLoader("new", &calls)); value != "new" || status != cacheMiss {
+		t.Errorf("got %v (%s), the pinned value was read before the flush", value, status)
+	}
+}
+
+func TestCacheFlushPrefix(t *testing.T) {
+	c := newSWRCache()
+	var calls atomic.Int32
+	for _, key := range []string{"availability:1:a", "availability:1:b", "availability:12:a", "hotels"} {
+		testCacheGet(t, c, key, testLoader(key, &calls))
+	}
+	if n := c.flushPrefix("availability:1:"); n != 2 {
+		t.Errorf("flushPrefix removed %d entries, want 2", n)
+	}
+	fail := func(ctx context.Context) (interface{}, error) { return nil, errors.New("not cached") }
+	for _, key := range []string{"availability:12:a", "hotels"} {
+		if _, status, err := c.get(context.Background(), key, hour, fail); err != nil || status != cacheHit {
+			t.Errorf("%s: %s %v", key, status, err)
+		}
+	}
+}
+
+// flush сбрасывает и вложенные ключи (key:...), но не ключи с тем же началом.
+func TestCacheFlushNested(t *testing.T) {
+	c := newSWRCache()
+	var calls atomic.Int32
+	for _, key := range []string{"hotels", "hotels:1", "hotels:list:RU", "hotels-extra", "cities"} {
+		testCacheGet(t, c, key, testLoader(key, &calls))
+	}
+	if n := c.flush("hotels:list"); n != 1 {
+		t.Errorf("flush hotels:list removed %d entries, want 1", n)
+	}
+	if n := c.flush("hotels"); n != 2 {
+		t.Errorf("flush hotels removed %d entries, want 2", n)
+	}
+	fail := func(ctx context.Context) (interface{}, error) { return nil, errors.New("not cached") }
+	for _, key := range []string{"hotels-extra", "cities"} {
+		if _, status, err := c.get(context.Background(), key, hour, fail); err != nil || status != cacheHit {
+			t.Errorf("%s: %s %v", key, status, err)
+		}
+	}
+}
+
+// Страницы GET /api/hotels без фильтров и карточка GET /api/hotels/:id отдаются из кэша
+// по своим политикам; изменение гостиницы сбрасывает и те, и другую.
+func TestHotelRoutesCache(t *testing.T) {
+	testDB(t)
+	t.Cleanup(func() {
+		if _, err := reloadSettings(); err != nil {
+			t.Error(err)
+		}
+	})
+	for _, policy := range []string{"CACHE_HOTEL_LIST", "CACHE_HOTEL"} {
+		t.Setenv(policy+"_TTL", "300ms")
+		t.Setenv(policy+"_STALE", "1h")
+	}
+	if _, err := reloadSettings(); err != nil {
+		t.Fatal(err)
+	}
+	hotelID := testHotel(t, "Red Square Inn", testCity(t, "Moscow"), 10, 5000)
+	_, adminToken := testUser(t, "admin@example.com", roleAdmin)
+	router := newPublicRouter()
+	hotelPath := "/api/hotels/" + strconv.Itoa(hotelID)
+	paths := []string{"/api/hotels", "/api/hotels?page=1&per_page=5", hotelPath}
+
+	get := func(path string) (string, string) {
+		t.Helper()
+		w := serve(router, "GET", path, "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("GET %s: status %d: %s", path, w.Code, w.Body)
+		}
+		return w.Header().Get("X-Cache"), w.Body.String()
+	}
+	for _, path := range paths {
+		for _, want := range []string{cacheMiss, cacheHit} {
+			if status, _ := get(path); status != want {
+				t.Errorf("GET %s: X-Cache %q, want %q", path, status, want)
+			}
+		}
+	}
+	time.Sleep(400 * time.Millisecond)
+	for _, path := range paths {
+		if status, _ := get(path); status != cacheStale {
+			t.Errorf("GET %s past TTL: X-Cache %q, want %q", path, status, cacheStale)
+		}
+		// Фоновое обновление снова делает запись свежей.
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			if status, _ := get(path); status == cacheHit {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("GET %s: the background refresh does not finish", path)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	if w := serve(router, "PATCH", hotelPath, `{"name": "Kremlin Inn"}`, "Authorization", bearerPrefix+adminToken); w.Code != http.StatusOK {
+		t.Fatalf("rename: status %d: %s", w.Code, w.Body)
+	}
+	for _, path := range paths {
+		if status, body := get(path); status != cacheMiss || !strings.Contains(body, "Kremlin Inn") {
+			t.Errorf("GET %s after the rename: X-Cache %q: %s", path, status, body)
+		}
+	}
+
+	// Отфильтрованный список в кэш не попадает.
+	for i := 0; i < 2; i++ {
+		if status, _ := get("/api/hotels?max_price=6000"); status != cacheMiss {
+			t.Errorf("filtered list, request %d: X-Cache %q", i+1, status)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"math/rand"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Внесение сбоев для проверки устойчивости клиентов (стейджинг).
+//
+// Работает, только если включён флаг функциональности "chaos"
+// (FEATURE_FLAGS=chaos в настройках или "flag chaos on" в управляющем сокете);
+// без флага правила игнорируются, так что случайно оставленное правило
+// не навредит продакшену. Правила задаются через /api/admin/chaos и живут в памяти процесса.
+
+// chaosFlag — флаг функциональности, включающий внесение сбоев.
+const chaosFlag = "chaos"
+
+// ChaosRule — правило внесения сбоев для маршрутов с указанным префиксом.
+// Для Percent процентов подходящих запросов добавляется задержка Latency, после чего
+// соединение обрывается (Drop) или запрос завершается ошибкой ErrorStatus (если задан).
+type ChaosRule struct {
+	RoutePrefix string  `json:"route_prefix"`
+	Percent     float64 `json:"percent"`
+	Latency     string  `json:"latency,omitempty"`
+	ErrorStatus int     `json:"error_status,omitempty"`
+	Drop        bool    `json:"drop,omitempty"`
+
+	latency time.Duration
+}
+
+var chaosRules struct {
+	sync.RWMutex
+	rules []ChaosRule
+}
+
+// chaosMiddleware применяет правила внесения сбоев.
+func chaosMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// Служебные маршруты не трогаем: иначе правило с префиксом "/" не дало бы его же отключить.
+		if !featureEnabled(chaosFlag) || strings.HasPrefix(c.Request.URL.Path, "/api/admin") {
+			c.Next()
+			return
+		}
+
+		rule, ok := matchChaosRule(c.Request.URL.Path)
+		if !ok || rand.Float64()*100 >= rule.Percent {
+			c.Next()
+			return
+		}
+
+		c.Header("X-Chaos-Injected", "true")
+		if rule.latency > 0 {
+			select {
+			case <-time.After(rule.latency):
+			case <-c.Request.Context().Done():
+				c.Abort()
+				return
+			}
+		}
+
+		if rule.Drop {
+			// Обрываем TCP-соединение без ответа — так выглядит упавший балансировщик или сеть.
+			if conn, _, err := c.Writer.Hijack(); err == nil {
+				conn.Close()
+				c.Abort()
+				return
+			}
+		}
+		if rule.ErrorStatus != 0 {
+			c.AbortWithStatusJSON(rule.ErrorStatus, Response{
+				Success: false,
+				Error:   "injected failure",
+			})
+			return
+		}
+		c.Next()
+	}
+}
+
+// matchChaosRule возвращает первое правило, префикс которого подходит к пути.
+func matchChaosRule(path string) (ChaosRule, bool) {
+	chaosRules.RLock()
+	defer chaosRules.RUnlock()
+	for _, r := range chaosRules.rules {
+		if strings.HasPrefix(path, r.RoutePrefix) {
+			return r, true
+		}
+	}
+	return ChaosRule{}, false
+}
+
+// getChaosRules — HTTP-обработчик, отдающий текущие правила.
+// Реагирует на GET /api/admin/chaos.
+func getChaosRules(c *gin.Context) {
+	chaosRules.RLock()
+	rules := append([]ChaosRule{}, chaosRules.rules...)
+	chaosRules.RUnlock()
+
+	c.JSON(http.StatusOK, Response{
+		Success: true,
+		Data:    gin.H{"enabled": featureEnabled(chaosFlag), "rules": rules},
+		Count:   len(rules),
+	})
+}
+
+// setChaosRules — HTTP-обработчик, заменяющий набор правил целиком.
+// Реагирует на PUT /api/admin/chaos с телом {"rules": [...]}.
+func setChaosRules(c *gin.Context) {
+	var body struct {
+		Rules []ChaosRule `json:"rules"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, Response{Success: false, Error: err.Error()})
+		return
+	}
+
+	for i := range body.Rules {
+		r := &body.Rules[i]
+		if !strings.HasPrefix(r.RoutePrefix, "/") {
+			c.JSON(http.StatusBadRequest, Response{Success: false, Error: "route_prefix must start with /"})
+			return
+		}
+		if r.Percent <= 0 || r.Percent > 100 {
+			c.JSON(http.StatusBadRequest, Response{Success: false, Error: "percent must be in (0, 100]"})
+			return
+		}
+		if r.ErrorStatus != 0 && (r.ErrorStatus < 400 || r.ErrorStatus > 599) {
+			c.JSON(http.StatusBadRequest, Response{Success: false, Error: "error_status must be a 4xx or 5xx code"})
+			return
+		}
+		if r.Latency != "" {
+			d, err := time.ParseDuration(r.Latency)
+			if err != nil || d < 0 {
+				c.JSON(http.StatusBadRequest, Response{Success: false, Error: "latency must be a duration, e.g. 500ms"})
+				return
+			}
+			r.latency = d
+		}
+	}
+
+	chaosRules.Lock()
+	chaosRules.rules = body.Rules
+	chaosRules.Unlock()
+
+	resp := Response{Success: true, Data: body.Rules, Count: len(body.Rules)}
+	if !featureEnabled(chaosFlag) {
+		resp.Hint = "rules are stored but inactive until the \"chaos\" feature flag is enabled"
+	}
+	c.JSON(http.StatusOK, resp)
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Команда check: проверка конфигурации и зависимостей перед выкладкой.
+//
+// Проходит по тем же шагам, что и bootstrap, но не останавливается на первой
+// ошибке, а собирает отчёт о готовности: настройки, провайдер секретов, БД,
+// применённые миграции (см. migrate.go), соответствие схемы коду (см. schema.go),
+// хранилище файлов, база GeoIP, внешние источники и админский токен. Код возврата
+// ненулевой, если хоть одна проверка провалилась, — так команду удобно ставить
+// шагом CI/CD перед выкладкой.
+// Предупреждения (warn) выкладку не останавливают.
+//
+//	WB check [-json] [-timeout 10s]
+
+// Итоги проверки.
+const (
+	checkOK   = "ok"
+	checkWarn = "warn"
+	checkFail = "fail"
+	checkSkip = "skip"
+)
+
+// CheckResult — результат одной проверки.
+type CheckResult struct {
+	Name     string `json:"name"`
+	Status   string `json:"status"`
+	Detail   string `json:"detail"`
+	Duration string `json:"duration"`
+}
+
+// readinessCheck — проверка; requires — проверки, без успеха которых она не имеет смысла.
+type readinessCheck struct {
+	name     string
+	requires []string
+	run      func(ctx context.Context) (status, detail string)
+}
+
+// readinessChecks — проверки в порядке выполнения.
+var readinessChecks = []readinessCheck{
+	{name: "settings", run: func(context.Context) (string, string) {
+		s, err := reloadSettings()
+		if err != nil {
+			return checkFail, err.Error()
+		}
+		return checkOK, fmt.Sprintf("%d feature flags, CORS origins %v", len(s.Features), s.CORSOrigins)
+	}},
+	{name: "config", run: func(context.Context) (string, string) {
+		if err := initConfig(); err != nil {
+			return checkFail, err.Error()
+		}
+		db := appConfig.DB
+		return checkOK, fmt.Sprintf("database %s@%s:%d/%s, API on %s", db.User, db.Host, db.Port, db.Name, appConfig.Addr)
+	}},
+	{name: "secrets", run: func(context.Context) (string, string) {
+		if err := initSecrets(); err != nil {
+			return checkFail, err.Error()
+		}
+		return checkOK, "provider " + envOr("SECRETS_PROVIDER", "env")
+	}},
+	{name: "database", requires: []string{"config", "secrets"}, run: func(ctx context.Context) (string, string) {
+		if err := initDB(ctx); err != nil {
+			return checkFail, err.Error()
+		}
+		var version string
+		if err := db.QueryRowContext(ctx, "SHOW server_version").Scan(&version); err != nil {
+			return checkFail, err.Error()
+		}
+		return checkOK, "PostgreSQL " + version
+	}},
+	{name: "migrations", requires: []string{"database"}, run: func(ctx context.Context) (string, string) {
+		status, err := migrationStatus(ctx)
+		if err != nil {
+			return checkFail, err.Error()
+		}
+		var pending []string
+		for _, s := range status {
+			if s.AppliedAt == nil {
+				pending = append(pending, fmt.Sprintf("%04d_%s", s.Version, s.Name))
+			}
+		}
+		if len(pending) > 0 {
+			// Не провал: миграции может применить сама выкладка (serve -migrate).
+			return checkWarn, fmt.Sprintf("%d pending: %s; run WB migrate", len(pending), strings.Join(pending, ", "))
+		}
+		return checkOK, fmt.Sprintf("%d applied", len(status))
+	}},
+	{name: "schema", requires: []string{"database"}, run: func(ctx context.Context) (string, string) {
+		diff, err := checkSchema(ctx)
+		if err != nil {
+			return checkFail, err.Error()
+		}
+		if len(diff) > 0 {
+			return checkFail, fmt.Sprintf("%d differences: %s", len(diff), strings.Join(diff, "; "))
+		}
+		return checkOK, fmt.Sprintf("%d tables match", len(expectedSchema))
+	}},
+	{name: "blob store", requires: []string{"secrets"}, run: func(ctx context.Context) (string, string) {
+		if err := initBlobStore(); err != nil {
+			return checkFail, err.Error()
+		}
+		// Листинг по несуществующему префиксу проверяет доступ, ничего не скачивая.
+		if _, err := blobs.List(ctx, "readiness-check/"); err != nil {
+			return checkFail, err.Error()
+		}
+		return checkOK, "backend " + envOr("BLOB_STORE", "disk")
+	}},
+	{name: "geoip", run: func(context.Context) (string, string) {
+		if os.Getenv("GEOIP_DB") == "" {
+			return checkWarn, "GEOIP_DB is not set: market restrictions treat every client as unknown"
+		}
+		if err := initGeoIP(); err != nil {
+			return checkFail, err.Error()
+		}
+		return checkOK, fmt.Sprintf("%d nodes", geoip.nodeCount)
+	}},
+	{name: "enrichment", requires: []string{"secrets"}, run: func(context.Context) (string, string) {
+		if err := initEnrichment(); err != nil {
+			return checkFail, err.Error()
+		}
+		if len(enrichmentProviders) == 0 {
+			return checkOK, "no providers configured"
+		}
+		names := make([]string, len(enrichmentProviders))
+		for i, p := range enrichmentProviders {
+			names[i] = p.field()
+		}
+		return checkOK, "providers for " + strings.Join(names, ", ")
+	}},
+	{name: "admin token", run: func(context.Context) (string, string) {
+		if len(os.Getenv("ADMIN_TOKEN")) == 0 {
+			return checkWarn, "ADMIN_TOKEN is not set: the admin API is disabled"
+		}
+		if len(os.Getenv("ADMIN_TOKEN")) < 16 {
+			return checkWarn, "ADMIN_TOKEN is shorter than 16 characters"
+		}
+		return checkOK, "set"
+	}},
+}
+
+// envOr возвращает значение переменной окружения или def, если она не задана.
+func envOr(name, def string) string {
+	if v := os.Getenv(name); v != "" {
+		return v
+	}
+	return def
+}
+
+// runReadinessChecks выполняет проверки и возвращает их результаты.
+func runReadinessChecks(timeout time.Duration) []CheckResult {
+	passed := map[string]bool{}
+	results := make([]CheckResult, 0, len(readinessChecks))
+	for _, check := range readinessChecks {
+		r := CheckResult{Name: check.name}
+		for _, dep := range check.requires {
+			if !passed[dep] {
+				r.Status, r.Detail = checkSkip, dep+" check did not pass"
+			}
+		}
+		if r.Status == "" {
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			start := time.Now()
+			r.Status, r.Detail = check.run(ctx)
+			r.Duration = time.Since(start).Round(time.Millisecond).String()
+			cancel()
+		}
+		passed[check.name] = r.Status == checkOK || r.Status == checkWarn
+		results = append(results, r)
+	}
+	return results
+}
+
+// runCheck — команда check: отчёт о готовности к запуску.
+func runCheck(args []string) error {
+	fs := flag.NewFlagSet("check", flag.ExitOnError)
+	asJSON := fs.Bool("json", false, "print the report as JSON")
+	timeout := fs.Duration("timeout", 10*time.Second, "timeout for each check")
+	fs.Parse(args)
+
+	results := runReadinessChecks(*timeout)
+	if db != nil {
+		defer db.Close()
+	}
+
+	failed := 0
+	for _, r := range results {
+		if r.Status == checkFail || r.Status == checkSkip {
+			failed++
+		}
+	}
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(gin.H{"ready": failed == 0, "checks": results}); err != nil {
+			return err
+		}
+	} else {
+		for _, r := range results {
+			fmt.Printf("%-4s  %-12s %-8s %s\n", strings.ToUpper(r.Status), r.Name, r.Duration, r.Detail)
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d checks did not pass", failed, len(results))
+	}
+	if !*asJSON {
+		fmt.Println("ready")
+	}
+	return nil
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Бесконтактная регистрация заезда по QR-коду.
+//
+// Владелец бронирования получает QR-код с подписанным токеном
+// (GET /api/bookings/:id/checkin-qr), сотрудник гостиницы сканирует его и
+// отправляет токен в POST /api/checkins. Токен — это id бронирования и HMAC от
+// него на ключе подписи токенов доступа (см. auth.go, с отдельной меткой, чтобы
+// подписи разных назначений не подходили друг к другу), так что хранить токены
+// не нужно. Одноразовость обеспечивает bookings.checked_in_at: регистрация
+// проходит, только если заезд ещё не отмечен, и повторное сканирование того же
+// кода получает 409. Каждая попытка, удачная или нет, пишется в журнал:
+//
+//	checkin_audit(id, booking_id NULL, hotel_id, outcome, actor, request_id, created_at)
+//
+// Регистрировать заезд может пользователь с ролью не ниже manager или партнёр
+// с API-ключом (см. apiKeyRole в roles.go).
+
+// checkinTokenPrefix — префикс токена регистрации заезда.
+const checkinTokenPrefix = "wbci."
+
+// checkinQRScale — пикселей на модуль в PNG-варианте QR-кода.
+const checkinQRScale = 8
+
+// Результаты попытки регистрации заезда в журнале checkin_audit; неудачные
+// возвращаются клиенту и в поле code ответа.
+const (
+	checkinOK           = "checked_in"
+	checkinInvalid      = "invalid_token"
+	checkinWrongHotel   = "wrong_hotel"
+	checkinNotConfirmed = "not_confirmed"
+	checkinOutsideDates = "outside_dates"
+	checkinAlreadyUsed  = "already_checked_in"
+)
+
+// checkinToken возвращает токен регистрации заезда для бронирования.
+func checkinToken(bookingID int) string {
+	id := strconv.Itoa(bookingID)
+	return checkinTokenPrefix + id + "." + checkinSignature(id)
+}
+
+// checkinSignature — подпись id бронирования для токена регистрации заезда.
+func checkinSignature(id string) string {
+	mac := hmac.New(sha256.New, jwtSigningKey)
+	mac.Write([]byte("checkin\n" + id))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// parseCheckinToken проверяет подпись токена и возвращает id бронирования.
+func parseCheckinToken(token string) (int, bool) {
+	rest, ok := strings.CutPrefix(token, checkinTokenPrefix)
+	if !ok {
+		return 0, false
+	}
+	id, sig, ok := strings.Cut(rest, ".")
+	if !ok || !hmac.Equal([]byte(sig), []byte(checkinSignature(id))) {
+		return 0, false
+	}
+	bookingID, err := strconv.Atoi(id)
+	return bookingID, err == nil
+}
+
+// getCheckinQR — HTTP-обработчик QR-кода регистрации заезда.
+// Реагирует на GET /api/bookings/:id/checkin-qr?format=svg|png|text (по умолчанию svg);
+// text отдаёт сам токен, чтобы клиент нарисовал код сам.
+func getCheckinQR(c *gin.Context) {
+	b, ok := ownedBooking(c)
+	if !ok {
+		return
+	}
+	if b.Status != bookingConfirmed {
+		c.JSON(http.StatusConflict, Response{Success: false, Error: fmt.Sprintf("booking is %s", b.Status)})
+		return
+	}
+	token := checkinToken(b.ID)
+	format := c.DefaultQuery("format", "svg")
+	if format == "text" {
+		c.JSON(http.StatusOK, Response{Success: true, Data: gin.H{"booking_id": b.ID, "token": token}, Count: 1})
+		return
+	}
+	if format != "svg" && format != "png" {
+		c.JSON(http.StatusBadRequest, Response{Success: false, Error: "format must be svg, png or text"})
+		return
+	}
+	qr, err := encodeQR(token)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	// Код действует, пока действует бронирование: кэшировать его где-то, кроме клиента, незачем.
+	c.Header("Cache-Control", "private, no-store")
+	if format == "svg" {
+		c.Data(http.StatusOK, "image/svg+xml", []byte(qr.SVG()))
+		return
+	}
+	img, err := qr.PNG(checkinQRScale)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	c.Data(http.StatusOK, "image/png", img)
+}
+
+// checkinActor — кто регистрирует заезд, для журнала.
+func checkinActor(c *gin.Context) string {
+	if u, ok := currentUser(c); ok {
+		return fmt.Sprintf("user:%d", u.ID)
+	}
+	if k, ok := c.Get("api_key"); ok {
+		return fmt.Sprintf("tenant:%d", k.(APIKey).TenantID)
+	}
+	return ""
+}
+
+// writeCheckinAudit записывает попытку регистрации заезда. Ошибка записи только логируется:
+// из-за недоступного журнала гостя не должны оставлять у стойки.
+func writeCheckinAudit(c *gin.Context, bookingID *int, hotelID int, outcome string) {
+	_, err := db.ExecContext(c.Request.Context(), `
+		INSERT INTO checkin_audit (booking_id, hotel_id, outcome, actor, request_id)
+		VALUES ($1, $2, $3, $4, $5)
+	`, bookingID, hotelID, outcome, checkinActor(c), c.GetString("request_id"))
+	if err != nil {
+		log.Printf("Error writing check-in audit for booking %v: %v", bookingID, err)
+	}
+}
+
+// checkIn — HTTP-обработчик регистрации заезда по отсканированному токену.
+// Реагирует на POST /api/checkins с телом {"token": "wbci.42.…", "hotel_id": 1}:
+// hotel_id — гостиница, в которой сканируют код.
+func checkIn(c *gin.Context) {
+	var body struct {
+		Token   string `json:"token"`
+		HotelID int    `json:"hotel_id"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, Response{Success: false, Error: err.Error()})
+		return
+	}
+	if body.HotelID <= 0 {
+		c.JSON(http.StatusBadRequest, Response{Success: false, Error: "hotel_id must be a positive integer"})
+		return
+	}
+	reject := func(status int, bookingID *int, outcome, msg string) {
+		writeCheckinAudit(c, bookingID, body.HotelID, outcome)
+		c.JSON(status, Response{Success: false, Code: outcome, Error: msg})
+	}
+
+	id, ok := parseCheckinToken(strings.TrimSpace(body.Token))
+	if !ok {
+		reject(http.StatusBadRequest, nil, checkinInvalid, "invalid check-in token")
+		return
+	}
+
+	tx, err := db.BeginTx(c.Request.Context(), nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	// Блокируем бронирование: два одновременных сканирования одного кода не пройдут оба.
+	b, err := scanBooking(tx.QueryRowContext(c.Request.Context(), bookingSelect+" WHERE id = $1 FOR UPDATE", id))
+	if err == sql.ErrNoRows {
+		// Подпись верна, но бронирования нет — его удалили вместе с гостиницей.
+		reject(http.StatusNotFound, nil, checkinInvalid, "booking not found")
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	today := bookingToday().Format(bookingDateLayout)
+	switch {
+	case b.HotelID != body.HotelID:
+		reject(http.StatusConflict, &b.ID, checkinWrongHotel, fmt.Sprintf("booking is for hotel %d", b.HotelID))
+		return
+	case b.Status != bookingConfirmed:
+		reject(http.StatusConflict, &b.ID, checkinNotConfirmed, fmt.Sprintf("booking is %s", b.Status))
+		return
+	case b.CheckedInAt != nil:
+		reject(http.StatusConflict, &b.ID, checkinAlreadyUsed,
+			fmt.Sprintf("guest already checked in at %s", b.CheckedInAt.Format(time.RFC3339)))
+		return
+	case today < b.CheckIn || today >= b.CheckOut:
+		reject(http.StatusConflict, &b.ID, checkinOutsideDates,
+			fmt.Sprintf("check-in is possible from %s until %s", b.CheckIn, b.CheckOut))
+		return
+	}
+
+	if _, err := tx.ExecContext(c.Request.Context(), "UPDATE bookings SET checked_in_at = now() WHERE id = $1", b.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	if b, err = scanBooking(tx.QueryRowContext(c.Request.Context(), bookingSelect+" WHERE id = $1", b.ID)); err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	writeCheckinAudit(c, &b.ID, body.HotelID, checkinOK)
+	c.JSON(http.StatusOK, Response{Success: true, Data: b, Count: 1})
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Слияние и переименование городов.
+//
+// Когда один город заведён дважды («Saint Petersburg» и «St. Petersburg»),
+// администратор сливает дубль (source) в основной (target): гостиницы,
+// продвижения и события переносятся на target, source удаляется. Чтобы старые
+// ссылки не ломались, в city_aliases остаётся запись «старый id/старое имя → город»;
+// по ней GET /api/cities/:id находит город и по старому id. Переименование тоже
+// оставляет псевдоним со старым именем. Каждое действие пишется в city_audit:
+//
+//	city_aliases(id, city_id, old_id NULL, old_name, created_at)
+//	city_audit(id, action, city_id, source_id NULL, old_name, new_name,
+//	           hotels_moved, request_id, created_at)
+
+// CityAudit — запись журнала изменений городов.
+type CityAudit struct {
+	Action      string `json:"action"`
+	CityID      int    `json:"city_id"`
+	SourceID    *int   `json:"source_id,omitempty"`
+	OldName     string `json:"old_name"`
+	NewName     string `json:"new_name"`
+	HotelsMoved int64  `json:"hotels_moved"`
+}
+
+// cityIDParam разбирает :id и отвечает 400, если он не число.
+func cityIDParam(c *gin.Context) (int, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, Response{Success: false, Error: "city id must be an integer"})
+		return 0, false
+	}
+	return id, true
+}
+
+// getCity — HTTP-обработчик, возвращающий город по id.
+// Реагирует на GET /api/cities/:id. Id слитого города тоже находится:
+// отдаётся город, в который его слили, с подсказкой об актуальном id.
+func getCity(c *gin.Context) {
+	id, ok := cityIDParam(c)
+	if !ok {
+		return
+	}
+
+	var city City
+	err := db.QueryRowContext(c.Request.Context(), citySelect+" WHERE c.id = $1", id).Scan(cityFields(&city)...)
+	if err == sql.ErrNoRows {
+		err = db.QueryRowContext(c.Request.Context(), citySelect+" JOIN city_aliases a ON a.city_id = c.id WHERE a.old_id = $1", id).
+			Scan(cityFields(&city)...)
+	}
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, Response{Success: false, Error: "city not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+
+	// Погода и события — из внешних источников; при их недоступности город отдаётся без них.
+	resp := Response{Success: true, Data: enrichCity(c.Request.Context(), city), Count: 1}
+	if city.ID != id {
+		resp.Hint = fmt.Sprintf("city %d was merged into city %d; use the new id", id, city.ID)
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// mergeCity — HTTP-обработчик слияния городов.
+// Реагирует на POST /api/admin/cities/:id/merge с телом {"into": 3}: город :id сливается в город into.
+func mergeCity(c *gin.Context) {
+	sourceID, ok := cityIDParam(c)
+	if !ok {
+		return
+	}
+	var body struct {
+		Into int `json:"into"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, Response{Success: false, Error: err.Error()})
+		return
+	}
+	if body.Into <= 0 || body.Into == sourceID {
+		c.JSON(http.StatusBadRequest, Response{Success: false, Error: "into must be the id of another city"})
+		return
+	}
+
+	tx, err := db.BeginTx(c.Request.Context(), nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	// Блокируем оба города, чтобы параллельное слияние или переименование не вмешалось.
+	names := map[int]string{}
+	rows, err := tx.QueryContext(c.Request.Context(), "SELECT id, name FROM cities WHERE id IN ($1, $2) FOR UPDATE", sourceID, body.Into)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	for rows.Next() {
+		var id int
+		var name string
+		if err := rows.Scan(&id, &name); err != nil {
+			rows.Close()
+			c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+			return
+		}
+		names[id] = name
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	for _, id := range []int{sourceID, body.Into} {
+		if _, ok := names[id]; !ok {
+			c.JSON(http.StatusNotFound, Response{Success: false, Error: fmt.Sprintf("city %d not found", id)})
+			return
+		}
+	}
+
+	res, err := tx.ExecContext(c.Request.Context(), "UPDATE hotels SET city = $2 WHERE city = $1", sourceID, body.Into)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	moved, _ := res.RowsAffected()
+
+	for _, stmt := range []string{
+		"UPDATE promotions SET city_id = $2 WHERE city_id = $1",
+		"UPDATE events SET city_id = $2 WHERE city_id = $1",
+		"UPDATE pois SET city_id = $2 WHERE city_id = $1",
+		// Псевдонимы, указывавшие на source (он сам мог быть целью прошлого слияния),
+		// перенаправляем на target, чтобы не было цепочек.
+		"UPDATE city_aliases SET city_id = $2 WHERE city_id = $1",
+		"INSERT INTO city_aliases (city_id, old_id, old_name) SELECT $2, id, name FROM cities WHERE id = $1",
+		"DELETE FROM cities WHERE id = $1",
+	} {
+		if _, err := tx.ExecContext(c.Request.Context(), stmt, sourceID, body.Into); err != nil {
+			c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+			return
+		}
+	}
+
+	// Перенесённые гостиницы теперь рядом с точками target, а его гостиницы — с точками source.
+	if err := refreshPOIDistances(c.Request.Context(), tx, "city", body.Into); err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+
+	audit := CityAudit{
+		Action:      "merge",
+		CityID:      body.Into,
+		SourceID:    &sourceID,
+		OldName:     names[sourceID],
+		NewName:     names[body.Into],
+		HotelsMoved: moved,
+	}
+	if err := writeCityAudit(c, tx, audit); err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	cache.flush("cities", "hotels", promotionsCacheKey)
+
+	c.JSON(http.StatusOK, Response{
+		Success: true,
+		Data:    audit,
+		Count:   1,
+	})
+}
+
+// renameCity — HTTP-обработчик переименования города.
+// Реагирует на PUT /api/admin/cities/:id с телом {"name": "Saint Petersburg"};
+// старое имя сохраняется как псевдоним.
+func renameCity(c *gin.Context) {
+	id, ok := cityIDParam(c)
+	if !ok {
+		return
+	}
+	var body struct {
+		Name string `json:"name"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, Response{Success: false, Error: err.Error()})
+		return
+	}
+	body.Name = strings.TrimSpace(body.Name)
+	if body.Name == "" {
+		c.JSON(http.StatusBadRequest, Response{Success: false, Error: "name is required"})
+		return
+	}
+
+	tx, err := db.BeginTx(c.Request.Context(), nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	var oldName string
+	var slug *string
+	err = tx.QueryRowContext(c.Request.Context(), "SELECT name, slug FROM cities WHERE id = $1 FOR UPDATE", id).Scan(&oldName, &slug)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, Response{Success: false, Error: "city not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	if oldName == body.Name {
+		c.JSON(http.StatusOK, Response{Success: true, Data: gin.H{"id": id, "name": oldName, "slug": slug}, Count: 1})
+		return
+	}
+
+	for _, q := range []struct {
+		sql  string
+		args []interface{}
+	}{
+		{"UPDATE cities SET name = $2 WHERE id = $1", []interface{}{id, body.Name}},
+		{"INSERT INTO city_aliases (city_id, old_name) VALUES ($1, $2)", []interface{}{id, oldName}},
+	} {
+		if _, err := tx.ExecContext(c.Request.Context(), q.sql, q.args...); err != nil {
+			c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+			return
+		}
+	}
+	if err := writeCityAudit(c, tx, CityAudit{Action: "rename", CityID: id, OldName: oldName, NewName: body.Name}); err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	cache.flush("cities", "hotels")
+
+	c.JSON(http.StatusOK, Response{
+		Success: true,
+		Data:    gin.H{"id": id, "name": body.Name, "slug": slug},
+		Count:   1,
+	})
+}
+
+// writeCityAudit записывает действие в журнал city_audit в той же транзакции.
+// request_id связывает запись с логами и записями запросов (см. recording.go).
+func writeCityAudit(c *gin.Context, tx *sql.Tx, a CityAudit) error {
+	_, err := tx.ExecContext(c.Request.Context(), `
+		INSERT INTO city_audit (action, city_id, source_id, old_name, new_name, hotels_moved, request_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`, a.Action, a.CityID, a.SourceID, a.OldName, a.NewName, a.HotelsMoved, c.GetString("request_id"))
+	return err
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+)
+
+// Команды приложения. Все они используют общую конфигурацию и слой доступа к БД (см. bootstrap):
+//
+//	WB serve  [-addr ...]                              — HTTP-сервер (команда по умолчанию)
+//	WB export [-table hotels|cities] [-format json|csv] [-o file]
+//	                                                   — выгрузка справочников без ручного SQL
+//	WB import-geonames [-file dump.txt] [-countries RU,BY] [-min-population N]
+//	                                                   — импорт городов из GeoNames (см. geonames.go)
+//	WB check [-json] [-timeout 10s]                    — отчёт о готовности конфигурации и зависимостей (см. check.go)
+//	WB migrate [up|down|status] [-steps N]             — применение и откат миграций схемы БД (см. migrate.go)
+//	WB seed [-file fixtures.json]                      — демонстрационные города и гостиницы (см. seed.go)
+//	WB create-admin -email ... [-name ...] [-promote]  — учётная запись администратора, пароль из stdin (см. roles.go)
+//	WB rotate-keys -tenant N [-key ...]                — замена API-ключей тенанта с отзывом старых (см. quota.go)
+
+// command — подкоманда CLI.
+type command struct {
+	summary string
+	run     func(args []string) error
+}
+
+var commands map[string]command
+
+func init() {
+	// Заполняем в init, а не в объявлении: printUsage сам обращается к commands.
+	commands = map[string]command{
+		"serve":           {summary: "run the HTTP API server (default)", run: runServe},
+		"export":          {summary: "export cities or hotels as JSON or CSV", run: runExport},
+		"import-geonames": {summary: "import cities from a GeoNames dump", run: runImportGeoNames},
+		"check":           {summary: "check configuration and dependencies before a deploy", run: runCheck},
+		"migrate":         {summary: "apply or roll back database schema migrations", run: runMigrate},
+		"seed":            {summary: "load demo cities and hotels for development", run: runSeed},
+		"create-admin":    {summary: "create an admin account (password is read from stdin)", run: runCreateAdmin},
+		"rotate-keys":     {summary: "replace a tenant's API keys and revoke the old ones", run: runRotateKeys},
+		"help":            {summary: "show this help", run: func([]string) error { printUsage(); return nil }},
+	}
+}
+
+// printUsage печатает список команд.
+func printUsage() {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintf(os.Stderr, "Usage: %s <command> [flags]\n\nCommands:\n", os.Args[0])
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-16s %s\n", name, commands[name].summary)
+	}
+	fmt.Fprintf(os.Stderr, "\nRun '%s <command> -h' for command flags.\n", os.Args[0])
+}
+
+// runExport — команда export: выгрузка таблицы cities или hotels в JSON или CSV.
+func runExport(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	table := fs.String("table", "hotels", "table to export: hotels or cities")
+	format := fs.String("format", "json", "output format: json or csv")
+	out := fs.String("o", "", "output file (default stdout)")
+	fs.Parse(args)
+
+	if *format != "json" && *format != "csv" {
+		return fmt.Errorf("unknown format %q", *format)
+	}
+
+	if err := bootstrap(); err != nil {
+		return err
+	}
+	defer db.Close()
+
+	var header []string
+	var records [][]string
+	var data interface{}
+	switch *table {
+	case "cities":
+		cities, err := loadCities(context.Background(), true)
+		if err != nil {
+			return err
+		}
+		data = cities.Items
+		header = []string{"id", "name", "slug"}
+		for _, c := range cities.Items {
+			var slug string
+			if c.Slug != nil {
+				slug = *c.Slug
+			}
+			records = append(records, []string{strconv.Itoa(c.ID), c.Name, slug})
+		}
+	case "hotels":
+		// Выгрузка для операторов — все гостиницы, а не только опубликованные.
+		hotels, err := queryHotels(context.Background(), true, adminHotelsQuery, "")
+		if err != nil {
+			return err
+		}
+		data = hotels.Items
+		header = []string{"id", "name", "slug", "city_id", "city_name", "capacity", "price", "status"}
+		for _, h := range hotels.Items {
+			// NULL в CSV — пустая ячейка.
+			var slug, cityID, cityName, capacity, price string
+			if h.Slug != nil {
+				slug = *h.Slug
+			}
+			if h.CityID != nil {
+				cityID = strconv.Itoa(*h.CityID)
+			}
+			if h.CityName != nil {
+				cityName = *h.CityName
+			}
+			if h.Capacity != nil {
+				capacity = strconv.Itoa(*h.Capacity)
+			}
+			if h.Price != nil {
+				price = strconv.FormatFloat(*h.Price, 'f', 2, 64)
+			}
+			records = append(records, []string{
+				strconv.Itoa(h.ID), h.Name, slug, cityID, cityName, capacity, price, h.Status,
+			})
+		}
+	default:
+		return fmt.Errorf("unknown table %q", *table)
+	}
+
+	var w io.Writer = os.Stdout
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+
+	if *format == "json" {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(data)
+	}
+	cw := csv.NewWriter(w)
+	cw.Write(header)
+	cw.WriteAll(records)
+	return cw.Error()
+}
@@ -0,0 +1,556 @@
+// Package client — Go-клиент для API поиска гостиниц.
+//
+// Пример:
+//
+//	c := client.New("http://localhost:8080", client.WithAPIKey("partner-key"))
+//	hotels, page, err := c.ListHotels(ctx, client.HotelQuery{CityID: &moscow, Sort: "price", Page: 1})
+//
+// Все методы принимают context.Context: отмена контекста прерывает и текущий запрос,
+// и ожидание между повторами. Запросы, завершившиеся сетевой ошибкой, 429 или 5xx,
+// повторяются с экспоненциальной задержкой (для 429/503 учитывается Retry-After).
+// Повторяются только идемпотентные GET-запросы.
+//
+// Типы ответа повторяют JSON-модели сервера (main.go); при изменении моделей
+// на сервере их нужно обновить и здесь.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// City — город.
+type City struct {
+	ID          int      `json:"id"`
+	Name        string   `json:"name"`
+	Slug        *string  `json:"slug"`
+	CountryCode *string  `json:"country_code"`
+	Latitude    *float64 `json:"latitude"`
+	Longitude   *float64 `json:"longitude"`
+}
+
+// Hotel — гостиница вместе с названием города.
+type Hotel struct {
+	ID   int     `json:"id"`
+	Name string  `json:"name"`
+	Slug *string `json:"slug"`
+	// Город, вместимость и цена могут быть nil у черновиков; публичный список
+	// содержит только опубликованные гостиницы (Status == "published").
+	CityID   *int     `json:"city_id"`
+	CityName *string  `json:"city_name"`
+	Capacity *int     `json:"capacity"`
+	Price    *float64 `json:"price"`
+	Status   string   `json:"status"`
+	// Координаты и ближайшие точки интереса каждого вида («1.2 km from center»).
+	Latitude  *float64    `json:"latitude"`
+	Longitude *float64    `json:"longitude"`
+	Nearby    []NearbyPOI `json:"nearby,omitempty"`
+	// Accessibility — сведения о доступности; nil-признак значит «не известно».
+	Accessibility *Accessibility `json:"accessibility,omitempty"`
+	// Extras — животные, парковка, кроватки и дополнительные кровати; nil-раздел значит «не известно».
+	Extras *HotelExtras `json:"extras,omitempty"`
+	// Attributes — произвольные атрибуты гостиницы (ski_storage, kitchen, ...).
+	Attributes map[string]interface{} `json:"attributes,omitempty"`
+	// Description есть только в карточке гостиницы, в списках — nil.
+	Description *string `json:"description,omitempty"`
+	// IsSponsored — спонсорское размещение; PromotionID нужен для учёта показов и кликов.
+	IsSponsored bool `json:"is_sponsored"`
+	PromotionID *int `json:"promotion_id,omitempty"`
+}
+
+// Accessibility — сведения о доступности гостиницы для людей с ограниченной подвижностью.
+type Accessibility struct {
+	StepFreeAccess    *bool      `json:"step_free_access,omitempty"`
+	Elevator          *bool      `json:"elevator,omitempty"`
+	RollInShower      *bool      `json:"roll_in_shower,omitempty"`
+	AccessibleParking *bool      `json:"accessible_parking,omitempty"`
+	AccessibleRooms   *int       `json:"accessible_rooms,omitempty"`
+	DoorWidthCm       *int       `json:"door_width_cm,omitempty"`
+	Notes             string     `json:"notes,omitempty"`
+	UpdatedAt         *time.Time `json:"updated_at,omitempty"`
+}
+
+// HotelExtras — дополнительные услуги гостиницы.
+type HotelExtras struct {
+	Pets *struct {
+		Allowed     bool    `json:"allowed"`
+		MaxPets     int     `json:"max_pets"`
+		FeePerNight float64 `json:"fee_per_night"`
+		FeePerStay  float64 `json:"fee_per_stay"`
+	} `json:"pets,omitempty"`
+	Parking *struct {
+		Available           bool    `json:"available"`
+		Spaces              int     `json:"spaces"`
+		PricePerNight       float64 `json:"price_per_night"`
+		ReservationRequired bool    `json:"reservation_required"`
+	} `json:"parking,omitempty"`
+	Cribs     *BedOption `json:"cribs,omitempty"`
+	ExtraBeds *BedOption `json:"extra_beds,omitempty"`
+}
+
+// BedOption — сколько кроваток или дополнительных кроватей можно поставить в номер и почём.
+type BedOption struct {
+	Available     int     `json:"available"`
+	PricePerNight float64 `json:"price_per_night"`
+}
+
+// NewHotel — поля новой гостиницы; незаданные можно заполнить позже.
+type NewHotel struct {
+	Name     string   `json:"name"`
+	CityID   *int     `json:"city_id,omitempty"`
+	Capacity *int     `json:"capacity,omitempty"`
+	Price    *float64 `json:"price,omitempty"`
+}
+
+// Booking — бронирование; даты в формате YYYY-MM-DD.
+// Бронирование делает либо партнёр (TenantID), либо пользователь сайта (UserID).
+type Booking struct {
+	ID          int        `json:"id"`
+	HotelID     int        `json:"hotel_id"`
+	TenantID    *int       `json:"tenant_id,omitempty"`
+	UserID      *int       `json:"user_id,omitempty"`
+	GuestName   string     `json:"guest_name"`
+	CheckIn     string     `json:"check_in"`
+	CheckOut    string     `json:"check_out"`
+	Guests      int        `json:"guests"`
+	Status      string     `json:"status"`
+	Total       float64    `json:"total"`
+	CreatedAt   time.Time  `json:"created_at"`
+	CancelledAt *time.Time `json:"cancelled_at,omitempty"`
+	CheckedInAt *time.Time `json:"checked_in_at,omitempty"`
+}
+
+// NightAvailability — занятость одной ночи; Remaining == nil — вместимость не ограничена.
+type NightAvailability struct {
+	Date      string `json:"date"`
+	Booked    int    `json:"booked"`
+	Remaining *int   `json:"remaining"`
+}
+
+// Availability — свободные места в гостинице по ночам.
+type Availability struct {
+	HotelID      int                 `json:"hotel_id"`
+	Capacity     *int                `json:"capacity"`
+	Guests       int                 `json:"guests"`
+	Available    bool                `json:"available"`
+	MinRemaining *int                `json:"min_remaining"`
+	Nights       []NightAvailability `json:"nights"`
+}
+
+// NewBooking — поля нового бронирования.
+type NewBooking struct {
+	HotelID   int    `json:"hotel_id"`
+	GuestName string `json:"guest_name"`
+	CheckIn   string `json:"check_in"`
+	CheckOut  string `json:"check_out"`
+	Guests    int    `json:"guests"`
+}
+
+// NearbyPOI — ближайшая к гостинице точка интереса одного вида.
+type NearbyPOI struct {
+	Kind       string  `json:"kind"`
+	Name       string  `json:"name"`
+	DistanceKm float64 `json:"distance_km"`
+	Label      string  `json:"label"`
+}
+
+// QuotaStatus — остаток месячной квоты API-ключа. Limit и Used относятся к ключу,
+// Tenant — к общей квоте тенанта; Remaining учитывает оба лимита.
+type QuotaStatus struct {
+	TenantID  int          `json:"tenant_id"`
+	Plan      string       `json:"plan"`
+	Period    string       `json:"period"`
+	Limit     int          `json:"limit"`
+	Used      int          `json:"used"`
+	Remaining int          `json:"remaining"`
+	Tenant    QuotaCounter `json:"tenant"`
+	ResetsAt  time.Time    `json:"resets_at"`
+}
+
+// QuotaCounter — лимит и расход одного счётчика квоты за период.
+type QuotaCounter struct {
+	Limit     int `json:"limit"`
+	Used      int `json:"used"`
+	Remaining int `json:"remaining"`
+}
+
+// PageInfo — метаданные страницы списка: номер, размер, сколько строк всего и сколько страниц.
+type PageInfo struct {
+	Page    int `json:"page"`
+	PerPage int `json:"per_page"`
+	Offset  int `json:"offset"`
+	Total   int `json:"total"`
+	Pages   int `json:"pages"`
+}
+
+// HotelQuery — фильтры, сортировка и страница списка гостиниц; нулевые поля не передаются.
+type HotelQuery struct {
+	CityID      *int
+	MinPrice    *float64
+	MaxPrice    *float64
+	MinCapacity *int
+	// Sort — name, price, capacity или city_name; Desc — в обратном порядке.
+	Sort string
+	Desc bool
+	// Page и PerPage — номер страницы (с 1) и её размер; без них сервер отдаёт весь список.
+	Page    int
+	PerPage int
+}
+
+// values переводит запрос в query-параметры GET /api/hotels.
+func (q HotelQuery) values() url.Values {
+	v := url.Values{}
+	if q.CityID != nil {
+		v.Set("city_id", strconv.Itoa(*q.CityID))
+	}
+	if q.MinPrice != nil {
+		v.Set("min_price", strconv.FormatFloat(*q.MinPrice, 'f', -1, 64))
+	}
+	if q.MaxPrice != nil {
+		v.Set("max_price", strconv.FormatFloat(*q.MaxPrice, 'f', -1, 64))
+	}
+	if q.MinCapacity != nil {
+		v.Set("min_capacity", strconv.Itoa(*q.MinCapacity))
+	}
+	if q.Sort != "" {
+		v.Set("sort", q.Sort)
+	}
+	if q.Desc {
+		v.Set("order", "desc")
+	}
+	if q.Page > 0 {
+		v.Set("page", strconv.Itoa(q.Page))
+	}
+	if q.PerPage > 0 {
+		v.Set("per_page", strconv.Itoa(q.PerPage))
+	}
+	return v
+}
+
+// APIError — ошибка, которую вернул сервер (Success=false в обёртке ответа).
+type APIError struct {
+	StatusCode int
+	Message    string
+	Hint       string
+}
+
+func (e *APIError) Error() string {
+	msg := fmt.Sprintf("api error %d: %s", e.StatusCode, e.Message)
+	if e.Hint != "" {
+		msg += " (" + e.Hint + ")"
+	}
+	return msg
+}
+
+// envelope — универсальная обёртка ответа сервера (Response в main.go).
+type envelope struct {
+	Success bool            `json:"success"`
+	Data    json.RawMessage `json:"data"`
+	Count   int             `json:"count"`
+	Error   string          `json:"error"`
+	Hint    string          `json:"hint"`
+	Partial bool            `json:"partial"`
+	Page    *PageInfo       `json:"page"`
+}
+
+// paged — приёмник списка вместе с метаданными страницы: do раскладывает data в items,
+// а page из ответа — в page.
+type paged struct {
+	items interface{}
+	page  *PageInfo
+}
+
+// ErrPartial возвращается, если сервер отдал неполный список (partial=true в ответе)
+// и повторы не помогли. Результат при этом заполнен тем, что сервер успел прочитать.
+var ErrPartial = errors.New("server returned a partial result")
+
+// Client — клиент API. Создаётся через New; безопасен для использования из нескольких горутин.
+type Client struct {
+	baseURL    string
+	apiKey     string
+	token      string
+	httpClient *http.Client
+	maxRetries int
+	backoff    time.Duration
+}
+
+// Option настраивает Client.
+type Option func(*Client)
+
+// WithAPIKey задаёт API-ключ партнёра (заголовок X-API-Key).
+func WithAPIKey(key string) Option {
+	return func(c *Client) { c.apiKey = key }
+}
+
+// WithToken задаёт токен доступа пользователя (заголовок "Authorization: Bearer <token>"),
+// полученный при входе через /api/auth/login.
+func WithToken(token string) Option {
+	return func(c *Client) { c.token = token }
+}
+
+// WithHTTPClient подменяет HTTP-клиент (таймауты, транспорт, прокси).
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) { c.httpClient = hc }
+}
+
+// WithRetries задаёт число повторов и начальную задержку между ними (удваивается с каждой попыткой).
+func WithRetries(maxRetries int, backoff time.Duration) Option {
+	return func(c *Client) {
+		c.maxRetries = maxRetries
+		c.backoff = backoff
+	}
+}
+
+// New создаёт клиент для сервера по адресу baseURL (например, "http://localhost:8080").
+func New(baseURL string, opts ...Option) *Client {
+	c := &Client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+		maxRetries: 3,
+		backoff:    200 * time.Millisecond,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// ListCities возвращает все города.
+func (c *Client) ListCities(ctx context.Context) ([]City, error) {
+	var cities []City
+	err := c.get(ctx, "/api/cities", &cities)
+	return cities, err
+}
+
+// ListHotels возвращает гостиницы, отобранные и упорядоченные по q. Если в q задана
+// страница, возвращается только она, а page описывает её место в списке; иначе page == nil.
+func (c *Client) ListHotels(ctx context.Context, q HotelQuery) ([]Hotel, *PageInfo, error) {
+	path := "/api/hotels"
+	if v := q.values(); len(v) > 0 {
+		path += "?" + v.Encode()
+	}
+	var hotels []Hotel
+	out := &paged{items: &hotels}
+	err := c.get(ctx, path, out)
+	return hotels, out.page, err
+}
+
+// GetHotel возвращает опубликованную гостиницу по id; для несуществующей — *APIError с кодом 404.
+func (c *Client) GetHotel(ctx context.Context, id int) (*Hotel, error) {
+	var h Hotel
+	if err := c.get(ctx, "/api/hotels/"+strconv.Itoa(id), &h); err != nil {
+		return nil, err
+	}
+	return &h, nil
+}
+
+// CreateHotel создаёт гостиницу (черновиком) и возвращает её вместе с присвоенным id.
+// Нужен токен пользователя с ролью admin (WithToken): с API-ключом сервер отвечает 403.
+// Запрос не повторяется: повтор после обрыва связи мог бы создать дубль.
+func (c *Client) CreateHotel(ctx context.Context, in NewHotel) (*Hotel, error) {
+	var h Hotel
+	if _, err := c.do(ctx, http.MethodPost, "/api/hotels", in, &h); err != nil {
+		return nil, err
+	}
+	return &h, nil
+}
+
+// PatchHotel меняет только переданные поля гостиницы (например, {"price": 16000}) и возвращает её.
+// Нужен токен пользователя с ролью admin (WithToken): с API-ключом сервер отвечает 403.
+func (c *Client) PatchHotel(ctx context.Context, id int, changes map[string]interface{}) (*Hotel, error) {
+	var h Hotel
+	if _, err := c.do(ctx, http.MethodPatch, "/api/hotels/"+strconv.Itoa(id), changes, &h); err != nil {
+		return nil, err
+	}
+	return &h, nil
+}
+
+// DeleteHotel мягко удаляет гостиницу: она пропадает из публичных списков.
+// Нужен токен пользователя с ролью admin (WithToken): с API-ключом сервер отвечает 403.
+func (c *Client) DeleteHotel(ctx context.Context, id int) error {
+	var out struct{}
+	_, err := c.do(ctx, http.MethodDelete, "/api/hotels/"+strconv.Itoa(id), nil, &out)
+	return err
+}
+
+// Availability сообщает, хватит ли в гостинице мест на guests гостей с заезда from до выезда to
+// (даты в формате YYYY-MM-DD). Ответ — подсказка: место может занять другой клиент до бронирования.
+func (c *Client) Availability(ctx context.Context, hotelID int, from, to string, guests int) (*Availability, error) {
+	q := url.Values{"from": {from}, "to": {to}, "guests": {strconv.Itoa(guests)}}
+	var a Availability
+	if err := c.get(ctx, "/api/hotels/"+strconv.Itoa(hotelID)+"/availability?"+q.Encode(), &a); err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+// CreateBooking бронирует гостиницу и возвращает бронирование с рассчитанной стоимостью.
+// Нужен токен пользователя (WithToken) или API-ключ (WithAPIKey): бронирование
+// записывается на пользователя или на тенанта ключа. Запрос не повторяется: повтор после обрыва связи мог бы создать дубль.
+func (c *Client) CreateBooking(ctx context.Context, in NewBooking) (*Booking, error) {
+	var b Booking
+	if _, err := c.do(ctx, http.MethodPost, "/api/bookings", in, &b); err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+// ListBookings возвращает бронирования, от новых к старым: с токеном (WithToken) —
+// бронирования пользователя, с API-ключом (WithAPIKey) — тенанта ключа.
+func (c *Client) ListBookings(ctx context.Context) ([]Booking, error) {
+	var bookings []Booking
+	err := c.get(ctx, "/api/bookings", &bookings)
+	return bookings, err
+}
+
+// GetBooking возвращает бронирование по id; для чужого или несуществующего — *APIError с кодом 404.
+func (c *Client) GetBooking(ctx context.Context, id int) (*Booking, error) {
+	var b Booking
+	if err := c.get(ctx, "/api/bookings/"+strconv.Itoa(id), &b); err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+// CancelBooking отменяет бронирование и возвращает его в статусе cancelled.
+// Нужен токен пользователя или API-ключ, которым бронирование видно (см. ListBookings).
+func (c *Client) CancelBooking(ctx context.Context, id int) (*Booking, error) {
+	var b Booking
+	if _, err := c.do(ctx, http.MethodDelete, "/api/bookings/"+strconv.Itoa(id), nil, &b); err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+// Quota возвращает остаток месячной квоты для API-ключа клиента.
+func (c *Client) Quota(ctx context.Context) (*QuotaStatus, error) {
+	var q QuotaStatus
+	if err := c.get(ctx, "/api/quota", &q); err != nil {
+		return nil, err
+	}
+	return &q, nil
+}
+
+// get выполняет GET-запрос с повторами и раскладывает поле data ответа в out.
+func (c *Client) get(ctx context.Context, path string, out interface{}) error {
+	delay := c.backoff
+	for attempt := 0; ; attempt++ {
+		retryAfter, err := c.do(ctx, http.MethodGet, path, nil, out)
+		if err == nil || attempt >= c.maxRetries || retryAfter < 0 || !retryable(err) {
+			return err
+		}
+
+		wait := delay
+		if retryAfter > 0 {
+			wait = retryAfter
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+		delay *= 2
+	}
+}
+
+// do выполняет один HTTP-запрос; in, если не nil, отправляется телом в JSON.
+// Возвращает значение Retry-After, если сервер его прислал.
+func (c *Client) do(ctx context.Context, method, path string, in, out interface{}) (time.Duration, error) {
+	var reqBody io.Reader
+	if in != nil {
+		raw, err := json.Marshal(in)
+		if err != nil {
+			return 0, err
+		}
+		reqBody = bytes.NewReader(raw)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reqBody)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.apiKey != "" {
+		req.Header.Set("X-API-Key", c.apiKey)
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	retryAfter := parseRetryAfter(resp.Header.Get("Retry-After"))
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return retryAfter, err
+	}
+
+	var env envelope
+	if err := json.Unmarshal(body, &env); err != nil {
+		return retryAfter, &APIError{StatusCode: resp.StatusCode, Message: "unexpected response: " + strings.TrimSpace(string(body))}
+	}
+	if resp.StatusCode >= 400 || !env.Success {
+		return retryAfter, &APIError{StatusCode: resp.StatusCode, Message: env.Error, Hint: env.Hint}
+	}
+	if p, ok := out.(*paged); ok {
+		out = p.items
+		p.page = env.Page
+	}
+	if err := json.Unmarshal(env.Data, out); err != nil {
+		return 0, err
+	}
+	if env.Partial {
+		return 0, ErrPartial
+	}
+	return 0, nil
+}
+
+// retryable сообщает, имеет ли смысл повторить запрос после такой ошибки.
+// Ошибки контекста не повторяются: вызывающий сам отменил запрос или исчерпал срок.
+func retryable(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	if errors.Is(err, ErrPartial) {
+		return true
+	}
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode == http.StatusTooManyRequests || apiErr.StatusCode >= 500
+	}
+	// Сетевая ошибка — сервер мог быть временно недоступен.
+	return true
+}
+
+// maxRetryAfter — дольше этого ждать повтора внутри одного вызова бессмысленно.
+const maxRetryAfter = time.Minute
+
+// parseRetryAfter разбирает заголовок Retry-After в секундах; 0 — заголовка нет.
+// Если сервер просит ждать дольше maxRetryAfter (например, до сброса месячной квоты),
+// возвращает -1: такой запрос повторять не нужно.
+func parseRetryAfter(v string) time.Duration {
+	secs, err := strconv.Atoi(v)
+	if err != nil || secs <= 0 {
+		return 0
+	}
+	d := time.Duration(secs) * time.Second
+	if d > maxRetryAfter {
+		return -1
+	}
+	return d
+}
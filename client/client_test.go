@@ -0,0 +1,243 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// mockServer — подставной сервер API: отвечает в той же обёртке, что и настоящий (Response в main.go).
+// handle получает запрос и возвращает статус и обёртку; requests считает обращения.
+type mockServer struct {
+	*httptest.Server
+	requests atomic.Int32
+}
+
+func newMockServer(t *testing.T, handle func(r *http.Request) (int, map[string]interface{})) *mockServer {
+	t.Helper()
+	m := &mockServer{}
+	m.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m.requests.Add(1)
+		status, body := handle(r)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(body)
+	}))
+	t.Cleanup(m.Close)
+	return m
+}
+
+// ok — успешный ответ с данными data.
+func ok(data interface{}) (int, map[string]interface{}) {
+	return http.StatusOK, map[string]interface{}{"success": true, "data": data}
+}
+
+// fail — ответ с ошибкой.
+func fail(status int, msg string) (int, map[string]interface{}) {
+	return status, map[string]interface{}{"success": false, "error": msg}
+}
+
+// fastRetries — повторы без заметных задержек, чтобы тесты не ждали.
+var fastRetries = WithRetries(3, time.Millisecond)
+
+func TestListHotelsQuery(t *testing.T) {
+	var got url.Values
+	srv := newMockServer(t, func(r *http.Request) (int, map[string]interface{}) {
+		got = r.URL.Query()
+		status, body := ok([]map[string]interface{}{{"id": 7, "name": "Arbat", "status": "published"}})
+		if got.Has("page") {
+			body["page"] = map[string]int{"page": 2, "per_page": 1, "offset": 1, "total": 3, "pages": 3}
+		}
+		return status, body
+	})
+	c := New(srv.URL, fastRetries)
+
+	city, minPrice, capacity := 3, 1000.5, 2
+	hotels, page, err := c.ListHotels(context.Background(), HotelQuery{
+		CityID: &city, MinPrice: &minPrice, MinCapacity: &capacity,
+		Sort: "price", Desc: true, Page: 2, PerPage: 1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := url.Values{
+		"city_id": {"3"}, "min_price": {"1000.5"}, "min_capacity": {"2"},
+		"sort": {"price"}, "order": {"desc"}, "page": {"2"}, "per_page": {"1"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("query %v, want %v", got, want)
+	}
+	if len(hotels) != 1 || hotels[0].ID != 7 || hotels[0].Name != "Arbat" {
+		t.Errorf("hotels: %+v", hotels)
+	}
+	if page == nil || *page != (PageInfo{Page: 2, PerPage: 1, Offset: 1, Total: 3, Pages: 3}) {
+		t.Errorf("page: %+v", page)
+	}
+
+	// Пустой запрос — без параметров и без страницы.
+	if _, page, err := c.ListHotels(context.Background(), HotelQuery{}); err != nil || page != nil || len(got) != 0 {
+		t.Errorf("unfiltered: query %v, page %+v, err %v", got, page, err)
+	}
+}
+
+func TestAuthHeaders(t *testing.T) {
+	var apiKey, auth string
+	srv := newMockServer(t, func(r *http.Request) (int, map[string]interface{}) {
+		apiKey, auth = r.Header.Get("X-API-Key"), r.Header.Get("Authorization")
+		return ok([]interface{}{})
+	})
+
+	if _, err := New(srv.URL, WithToken("user-token")).ListBookings(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if apiKey != "" || auth != "Bearer user-token" {
+		t.Errorf("with a token: X-API-Key %q, Authorization %q", apiKey, auth)
+	}
+
+	if _, err := New(srv.URL, WithAPIKey("partner-key")).ListBookings(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if apiKey != "partner-key" || auth != "" {
+		t.Errorf("with an API key: X-API-Key %q, Authorization %q", apiKey, auth)
+	}
+}
+
+// Бронирование пользователя приходит без tenant_id; ноль вместо nil выдавал бы его за тенанта 0.
+func TestBookingOwner(t *testing.T) {
+	srv := newMockServer(t, func(r *http.Request) (int, map[string]interface{}) {
+		return ok(map[string]interface{}{"id": 1, "hotel_id": 2, "user_id": 5, "status": "confirmed"})
+	})
+	b, err := New(srv.URL).GetBooking(context.Background(), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.TenantID != nil || b.UserID == nil || *b.UserID != 5 {
+		t.Errorf("owner: tenant %v, user %v", b.TenantID, b.UserID)
+	}
+	raw, err := json.Marshal(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := fields["tenant_id"]; ok {
+		t.Errorf("tenant_id is encoded for a user's booking: %s", raw)
+	}
+}
+
+func TestGetRetries(t *testing.T) {
+	var calls atomic.Int32
+	srv := newMockServer(t, func(r *http.Request) (int, map[string]interface{}) {
+		if calls.Add(1) < 3 {
+			return fail(http.StatusServiceUnavailable, "database is unavailable")
+		}
+		return ok([]map[string]interface{}{{"id": 1, "name": "Moscow"}})
+	})
+
+	cities, err := New(srv.URL, fastRetries).ListCities(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cities) != 1 || srv.requests.Load() != 3 {
+		t.Errorf("%d cities after %d requests", len(cities), srv.requests.Load())
+	}
+}
+
+func TestNoRetry(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		call func(c *Client) error
+		resp func(w http.ResponseWriter)
+		code int
+	}{
+		{
+			// POST не повторяется: повтор мог бы создать второе бронирование.
+			name: "booking on 503",
+			call: func(c *Client) error {
+				_, err := c.CreateBooking(context.Background(), NewBooking{HotelID: 1})
+				return err
+			},
+			resp: func(w http.ResponseWriter) { w.WriteHeader(http.StatusServiceUnavailable) },
+			code: http.StatusServiceUnavailable,
+		},
+		{
+			name: "not found",
+			call: func(c *Client) error { _, err := c.GetHotel(context.Background(), 404); return err },
+			resp: func(w http.ResponseWriter) { w.WriteHeader(http.StatusNotFound) },
+			code: http.StatusNotFound,
+		},
+		{
+			// Квота исчерпана до конца месяца: ждать внутри вызова бессмысленно.
+			name: "quota exhausted",
+			call: func(c *Client) error { _, err := c.ListCities(context.Background()); return err },
+			resp: func(w http.ResponseWriter) {
+				w.Header().Set("Retry-After", "86400")
+				w.WriteHeader(http.StatusTooManyRequests)
+			},
+			code: http.StatusTooManyRequests,
+		},
+	} {
+		var requests atomic.Int32
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests.Add(1)
+			tc.resp(w)
+			w.Write([]byte(`{"success": false, "error": "nope", "hint": "try later"}`))
+		}))
+		err := tc.call(New(srv.URL, fastRetries))
+		srv.Close()
+
+		var apiErr *APIError
+		if !errors.As(err, &apiErr) || apiErr.StatusCode != tc.code || apiErr.Message != "nope" || apiErr.Hint != "try later" {
+			t.Errorf("%s: err = %v", tc.name, err)
+		}
+		if requests.Load() != 1 {
+			t.Errorf("%s: %d requests, want 1", tc.name, requests.Load())
+		}
+	}
+}
+
+// Неполный список повторяется, а если сервер так и не отдал всё — возвращается с ErrPartial.
+func TestPartialResult(t *testing.T) {
+	srv := newMockServer(t, func(r *http.Request) (int, map[string]interface{}) {
+		status, body := ok([]map[string]interface{}{{"id": 1, "name": "Moscow"}})
+		body["partial"] = true
+		return status, body
+	})
+	cities, err := New(srv.URL, fastRetries).ListCities(context.Background())
+	if !errors.Is(err, ErrPartial) {
+		t.Fatalf("err = %v, want ErrPartial", err)
+	}
+	if len(cities) != 1 || srv.requests.Load() != 4 {
+		t.Errorf("%d cities after %d requests", len(cities), srv.requests.Load())
+	}
+}
+
+// Отмена контекста прерывает ожидание между повторами.
+func TestCancelDuringBackoff(t *testing.T) {
+	srv := newMockServer(t, func(r *http.Request) (int, map[string]interface{}) {
+		return fail(http.StatusBadGateway, "upstream is down")
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := New(srv.URL, WithRetries(5, time.Hour)).ListCities(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("err = %v, want context.DeadlineExceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("returned after %v", elapsed)
+	}
+	if srv.requests.Load() != 1 {
+		t.Errorf("%d requests, want 1", srv.requests.Load())
+	}
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Коллекция запросов для Postman/Insomnia (формат Postman Collection v2.1).
+//
+// Коллекция строится из таблицы маршрутов роутера в момент запроса, поэтому
+// всегда совпадает с тем, что реально обслуживает сервер. Адрес сервера,
+// API-ключ и токен администратора вынесены в переменные коллекции
+// ({{baseUrl}}, {{apiKey}}, {{adminToken}}), чтобы не хранить их в экспорте.
+
+// collectionSchema — версия формата коллекции.
+const collectionSchema = "https://schema.getpostman.com/json/collection/v2.1.0/collection.json"
+
+// collectionExampleBodies — примеры тел запросов для маршрутов, принимающих JSON.
+// Ключ — "МЕТОД путь" в том виде, в каком маршрут зарегистрирован в Gin.
+// Новые маршруты с телом запроса должны добавлять сюда свой пример.
+var collectionExampleBodies = map[string]interface{}{
+	"POST /api/admin/recordings/targets": map[string]string{"api_key": "partner-key", "ttl": "1h"},
+	"POST /api/events": map[string]interface{}{
+		"events": []map[string]interface{}{{"type": "click", "hotel_id": 1, "session_id": "3f2a9c"}},
+	},
+	"POST /api/auth/register": map[string]interface{}{
+		"email": "ivan@example.com", "password": "correct horse", "name": "Ivan Petrov",
+	},
+	"POST /api/auth/login":   map[string]interface{}{"email": "ivan@example.com", "password": "correct horse"},
+	"POST /api/auth/refresh": map[string]interface{}{"refresh_token": "rt_…"},
+	"POST /api/auth/logout":  map[string]interface{}{"refresh_token": "rt_…", "all": false},
+	"POST /api/bookings": map[string]interface{}{
+		"hotel_id": 1, "guest_name": "Ivan Petrov", "check_in": "2026-07-01", "check_out": "2026-07-04", "guests": 2,
+	},
+	"POST /api/bookings/:id/shares":           map[string]interface{}{"permission": "guests", "expires_in": "72h"},
+	"POST /api/checkins":                      map[string]interface{}{"token": "wbci.42.signature", "hotel_id": 1},
+	"POST /api/shared-bookings/:token/guests": map[string]interface{}{"name": "Anna Petrova", "email": "anna@example.com"},
+	"PUT /api/admin/users/:id/role":           map[string]interface{}{"role": "manager"},
+	"POST /api/admin/promotions": map[string]interface{}{
+		"hotel_id": 1, "starts_at": "2026-01-01T00:00:00Z", "ends_at": "2026-02-01T00:00:00Z",
+	},
+	"POST /api/admin/backups/:name/restore": map[string]interface{}{
+		"schema": "staging",
+	},
+	"POST /api/admin/hotels/:id/status": map[string]interface{}{
+		"status": "published",
+	},
+	"PUT /api/admin/hotels/:id/publish-at": map[string]interface{}{
+		"publish_at": "2026-01-01T00:00:00Z",
+	},
+	"POST /api/admin/hotels/:id/prices": map[string]interface{}{
+		"price": 120.5, "effective_from": "2026-01-01T00:00:00Z",
+	},
+	"PUT /api/admin/cities/:id": map[string]interface{}{
+		"name": "Saint Petersburg",
+	},
+	"POST /api/admin/cities/:id/merge": map[string]interface{}{
+		"into": 3,
+	},
+	"PUT /api/admin/cities/:id/slug": map[string]interface{}{
+		"slug": "saint-petersburg",
+	},
+	"PUT /api/admin/hotels/:id/slug": map[string]interface{}{
+		"slug": "grand-hotel-europe",
+	},
+	"POST /api/admin/short-links": map[string]interface{}{
+		"code": "spb-summer", "type": "city", "id": 3,
+	},
+	"POST /api/admin/imports/geonames": map[string]interface{}{
+		"countries": []string{"RU"}, "min_population": 50000,
+	},
+	"POST /api/admin/widget-tokens": map[string]interface{}{
+		"tenant_id": 1, "origins": []string{"https://partner.example"}, "config": map[string]string{"theme": "dark"},
+	},
+	"PUT /api/admin/widget-tokens/:token": map[string]interface{}{
+		"origins": []string{"https://partner.example", "https://*.partner.example"}, "config": map[string]string{"theme": "light"},
+	},
+	"POST /api/hotels/:id/price-alerts": map[string]interface{}{
+		"session_id": "3f2a9c", "check_in": "2026-07-01", "check_out": "2026-07-04", "threshold": 30000,
+	},
+	"POST /api/hotels/:id/questions": map[string]interface{}{
+		"text": "Is there parking near the hotel?", "session_id": "3f2a9c",
+	},
+	"POST /api/admin/questions/:id/answers": map[string]interface{}{
+		"text": "Yes, the hotel has a free underground car park.",
+	},
+	"POST /api/questions/:id/vote": map[string]interface{}{
+		"vote": "up", "session_id": "3f2a9c",
+	},
+	"POST /api/answers/:id/vote": map[string]interface{}{
+		"vote": "up", "session_id": "3f2a9c",
+	},
+	"PUT /api/admin/hotels/:id/content": map[string]interface{}{
+		"name": "Grand Hotel Europe", "description": "Historic hotel on Nevsky Prospekt.",
+	},
+	"POST /api/admin/attributes": map[string]interface{}{
+		"key": "ski_storage", "type": "bool", "label": "Ski storage",
+	},
+	"PUT /api/admin/hotels/:id/attributes": map[string]interface{}{
+		"attributes": map[string]interface{}{"ski_storage": true},
+	},
+	"POST /api/admin/hotels/prices/bulk": map[string]interface{}{
+		"rules": []map[string]interface{}{{"city_id": 5, "percent": 10}}, "dry_run": true,
+	},
+	"POST /api/admin/cities/:id/pois": map[string]interface{}{
+		"kind": "metro", "name": "Nevsky Prospekt", "latitude": 59.9356, "longitude": 30.3272,
+	},
+	"PUT /api/admin/hotels/:id/location": map[string]interface{}{
+		"latitude": 59.9343, "longitude": 30.3351,
+	},
+	"PUT /api/admin/hotels/:id/markets": map[string]interface{}{
+		"allowed_countries": []string{"RU", "BY"}, "blocked_countries": []string{},
+	},
+	"PUT /api/admin/hotels/:id/accessibility": map[string]interface{}{
+		"step_free_access": true, "elevator": true, "roll_in_shower": true, "accessible_rooms": 2, "door_width_cm": 90,
+	},
+	"PUT /api/admin/hotels/:id/extras": map[string]interface{}{
+		"pets":       map[string]interface{}{"allowed": true, "max_pets": 1, "fee_per_night": 500},
+		"parking":    map[string]interface{}{"available": true, "spaces": 2, "price_per_night": 300},
+		"cribs":      map[string]interface{}{"available": 2, "price_per_night": 0},
+		"extra_beds": map[string]interface{}{"available": 1, "price_per_night": 1200},
+	},
+	"POST /api/hotels": map[string]interface{}{
+		"name": "Grand Hotel Europe", "city_id": 1, "capacity": 120, "price": 15000,
+	},
+	"PUT /api/hotels/:id": map[string]interface{}{
+		"name": "Grand Hotel Europe", "city_id": 1, "capacity": 120, "price": 16000,
+	},
+	"PATCH /api/hotels/:id": map[string]interface{}{
+		"price": 16000,
+	},
+	"POST /api/admin/mappings": map[string]interface{}{
+		"tenant_id": 1, "entity": "hotel", "external_id": "HTL-00042", "internal_id": 7,
+	},
+	"POST /api/admin/mappings/suggest": map[string]interface{}{
+		"tenant_id": 1,
+		"items": []map[string]interface{}{
+			{"external_id": "HTL-00042", "name": "Hotel Astoria", "city": "Saint Petersburg"},
+		},
+	},
+	"PUT /api/admin/chaos": map[string]interface{}{
+		"rules": []map[string]interface{}{{"route_prefix": "/api/hotels", "percent": 10, "latency": "500ms", "error_status": 503}},
+	},
+}
+
+// postmanCollection и вложенные типы — минимальное подмножество формата Postman.
+type postmanCollection struct {
+	Info     postmanInfo       `json:"info"`
+	Item     []postmanItem     `json:"item"`
+	Variable []postmanVariable `json:"variable"`
+}
+
+type postmanInfo struct {
+	Name   string `json:"name"`
+	Schema string `json:"schema"`
+}
+
+type postmanVariable struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+type postmanItem struct {
+	Name    string         `json:"name"`
+	Request postmanRequest `json:"request"`
+}
+
+type postmanRequest struct {
+	Method string          `json:"method"`
+	Header []postmanHeader `json:"header"`
+	URL    postmanURL      `json:"url"`
+	Body   *postmanBody    `json:"body,omitempty"`
+}
+
+type postmanHeader struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+type postmanURL struct {
+	Raw  string   `json:"raw"`
+	Host []string `json:"host"`
+	Path []string `json:"path"`
+}
+
+type postmanBody struct {
+	Mode    string                 `json:"mode"`
+	Raw     string                 `json:"raw"`
+	Options map[string]interface{} `json:"options"`
+}
+
+// collectionHandler возвращает обработчик GET /api/collection.json для указанного роутера.
+func collectionHandler(router *gin.Engine) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		routes := router.Routes()
+		sort.Slice(routes, func(i, j int) bool {
+			if routes[i].Path != routes[j].Path {
+				return routes[i].Path < routes[j].Path
+			}
+			return routes[i].Method < routes[j].Method
+		})
+
+		collection := postmanCollection{
+			Info: postmanInfo{Name: "Hotel Search API", Schema: collectionSchema},
+			Item: []postmanItem{},
+			Variable: []postmanVariable{
+				{Key: "baseUrl", Value: "http://localhost:8080"},
+				{Key: "apiKey", Value: ""},
+				{Key: "adminToken", Value: ""},
+			},
+		}
+		for _, r := range routes {
+			collection.Item = append(collection.Item, collectionItem(r.Method, r.Path))
+		}
+
+		// Отдаём коллекцию как есть, без обёртки Response: её импортируют напрямую в Postman.
+		c.JSON(http.StatusOK, collection)
+	}
+}
+
+// collectionItem описывает один маршрут как запрос коллекции.
+func collectionItem(method, path string) postmanItem {
+	req := postmanRequest{
+		Method: method,
+		Header: []postmanHeader{{Key: "Accept", Value: "application/json"}},
+		URL: postmanURL{
+			Raw:  "{{baseUrl}}" + path,
+			Host: []string{"{{baseUrl}}"},
+			Path: strings.Split(strings.TrimPrefix(path, "/"), "/"),
+		},
+	}
+
+	// Служебные маршруты требуют токен администратора, партнёрские — API-ключ.
+	if strings.HasPrefix(path, "/api/admin") || strings.HasPrefix(path, "/debug") {
+		req.Header = append(req.Header, postmanHeader{Key: "Authorization", Value: "Bearer {{adminToken}}"})
+	} else if strings.HasPrefix(path, "/api/") {
+		req.Header = append(req.Header, postmanHeader{Key: apiKeyHeader, Value: "{{apiKey}}"})
+	}
+
+	if example, ok := collectionExampleBodies[method+" "+path]; ok {
+		raw, _ := json.MarshalIndent(example, "", "  ")
+		req.Header = append(req.Header, postmanHeader{Key: "Content-Type", Value: "application/json"})
+		req.Body = &postmanBody{
+			Mode:    "raw",
+			Raw:     string(raw),
+			Options: map[string]interface{}{"raw": map[string]string{"language": "json"}},
+		}
+	}
+
+	return postmanItem{Name: method + " " + path, Request: req}
+}
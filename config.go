@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Конфигурация запуска.
+//
+// В отличие от настроек (см. settings.go), эти параметры читаются один раз при
+// запуске и без перезапуска не меняются: параметры подключения к БД, адрес
+// публичного API и время на остановку. Источник тот же — переменные окружения
+// или файл CONFIG_FILE:
+//
+//	DB_HOST (localhost), DB_PORT (5432), DB_USER (postgres), DB_NAME (wb), DB_SSLMODE (disable)
+//	ADDR — адрес публичного API; если не задан, то ":" + PORT; если нет и PORT — ":8080"
+//	SHUTDOWN_TIMEOUT (30s) — сколько при остановке ждём начатых запросов, фоновых задач и
+//	                         административных задач, прежде чем закрыть пул соединений с БД
+//
+// Пароль БД сюда не входит: он берётся из хранилища секретов (секрет db_password,
+// см. secrets.go), а с провайдером env — из переменной DB_PASSWORD. Флаг -addr
+// команды serve имеет приоритет над ADDR и PORT. Разрешённые CORS-источники —
+// настройка CORS_ORIGINS (см. settings.go), её можно менять без перезапуска.
+//
+// Ошибки проверяются все сразу, и с неверной конфигурацией приложение не стартует.
+
+// Config — параметры, которые читаются один раз при запуске.
+type Config struct {
+	DB              DBConfig
+	Addr            string
+	ShutdownTimeout time.Duration
+}
+
+// DBConfig — параметры подключения к PostgreSQL, кроме пароля.
+type DBConfig struct {
+	Host    string
+	Port    int
+	User    string
+	Name    string
+	SSLMode string
+}
+
+// dbSSLModes — допустимые значения sslmode драйвера lib/pq.
+var dbSSLModes = []string{"disable", "allow", "prefer", "require", "verify-ca", "verify-full"}
+
+// appConfig — действующая конфигурация; заполняется в initConfig.
+var appConfig *Config
+
+// initConfig читает и проверяет конфигурацию запуска. Повторный вызов ничего не перечитывает.
+func initConfig() error {
+	if appConfig != nil {
+		return nil
+	}
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	appConfig = cfg
+	return nil
+}
+
+// loadConfig читает конфигурацию из окружения и CONFIG_FILE и проверяет её.
+func loadConfig() (*Config, error) {
+	src := &settingsSource{}
+	if path := os.Getenv("CONFIG_FILE"); path != "" {
+		values, err := readConfigFile(path)
+		if err != nil {
+			return nil, err
+		}
+		src.file = values
+	}
+
+	cfg := &Config{
+		DB: DBConfig{
+			Host:    src.string("DB_HOST", "localhost"),
+			Port:    src.int("DB_PORT", 5432),
+			User:    src.string("DB_USER", "postgres"),
+			Name:    src.string("DB_NAME", "wb"),
+			SSLMode: src.string("DB_SSLMODE", "disable"),
+		},
+		Addr:            src.string("ADDR", ""),
+		ShutdownTimeout: src.duration("SHUTDOWN_TIMEOUT", 30*time.Second),
+	}
+	if cfg.Addr == "" {
+		port := src.int("PORT", 8080)
+		if port < 1 || port > 65535 {
+			src.errs = append(src.errs, "PORT must be between 1 and 65535")
+		}
+		cfg.Addr = ":" + strconv.Itoa(port)
+	}
+
+	if cfg.DB.Port < 1 || cfg.DB.Port > 65535 {
+		src.errs = append(src.errs, "DB_PORT must be between 1 and 65535")
+	}
+	if cfg.ShutdownTimeout <= 0 {
+		src.errs = append(src.errs, "SHUTDOWN_TIMEOUT must be positive")
+	}
+	if !slices.Contains(dbSSLModes, cfg.DB.SSLMode) {
+		src.errs = append(src.errs, "DB_SSLMODE must be one of "+strings.Join(dbSSLModes, ", "))
+	}
+	if len(src.errs) > 0 {
+		return nil, fmt.Errorf("invalid configuration: %s", strings.Join(src.errs, "; "))
+	}
+	return cfg, nil
+}
+
+// dsn — строка подключения без пароля (пароль подставляет secretConnector).
+func (c DBConfig) dsn() string {
+	return fmt.Sprintf("host=%s port=%d user=%s dbname=%s sslmode=%s",
+		dsnValue(c.Host), c.Port, dsnValue(c.User), dsnValue(c.Name), c.SSLMode)
+}
+
+// dsnValue заключает значение строки подключения в кавычки с экранированием.
+func dsnValue(v string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(v) + "'"
+}
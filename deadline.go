@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Сроки запросов и вызовы внешних провайдеров.
+//
+// Обработчику публичного API отводится REQUEST_TIMEOUT (см. settings.go): контекст
+// запроса получает срок, и обращения к внешним сервисам (погода, афиша, хранилища
+// секретов и файлов) берут таймаут из оставшегося времени, но не больше собственного
+// максимума провайдера. Если до срока осталось меньше минимума (floor), провайдер
+// не вызывается вовсе: ответ всё равно не успеет прийти, а вызов лишь займёт соединение.
+//
+// Запросы к БД из обработчиков выполняются с контекстом запроса (QueryContext,
+// ExecContext), поэтому срок ограничивает и их: lib/pq отменяет запрос на сервере,
+// транзакция откатывается, а соединение возвращается в пул. Так медленная БД не копит
+// висящие обработчики. Запрос отменяется и тогда, когда клиент разорвал соединение.
+// Административные маршруты срока не получают (их запросы могут идти долго), но
+// отменяются при разрыве соединения. Загрузчик кэша при промахе получает контекст
+// запроса, а при фоновом обновлении — отвязанный от его отмены (см. cache.go);
+// фоновые задачи работают со своим контекстом и останавливаются вместе с сервисом.
+//
+// Длительность каждого вызова попадает:
+//   - в expvar providers (GET /debug/vars): <провайдер>.calls, .errors, .skipped, .latency_ms
+//     (каждая попытка, включая повторы, считается отдельным вызовом);
+//   - в заголовок ответа Server-Timing (видно во вкладке Network браузера).
+
+// providerLimits — таймаут провайдера без срока запроса (max), минимум, ради которого его
+// стоит вызывать (floor), и политика повторов (см. retry.go).
+type providerLimits struct {
+	max   time.Duration
+	floor time.Duration
+	retry retryPolicy
+}
+
+// errDeadlineTooClose — до срока запроса осталось меньше минимума провайдера.
+var errDeadlineTooClose = errors.New("request deadline is too close to call the provider")
+
+// providerMetrics — счётчики вызовов провайдеров: <провайдер>.calls, .errors, .skipped и
+// суммарная длительность .latency_ms (средняя — latency_ms / calls).
+var providerMetrics = expvar.NewMap("providers")
+
+// providerTimeout возвращает таймаут вызова провайдера с учётом срока ctx.
+func providerTimeout(ctx context.Context, limits providerLimits) (time.Duration, error) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return limits.max, nil
+	}
+	remaining := time.Until(deadline)
+	if remaining < limits.floor {
+		return 0, errDeadlineTooClose
+	}
+	if remaining < limits.max {
+		return remaining, nil
+	}
+	return limits.max, nil
+}
+
+// doProvider выполняет запрос к провайдеру name через client с таймаутом из providerTimeout,
+// при необходимости повторяя его (см. retry.go). Тело ответа закрывает вызывающий;
+// таймаут действует до его закрытия.
+func doProvider(client *http.Client, name string, req *http.Request, limits providerLimits) (*http.Response, error) {
+	depositRetryBudget(name)
+	// Тело запроса можно отправить повторно, только если его можно перечитать.
+	canRetry := idempotent(req) && (req.Body == nil || req.GetBody != nil)
+	for attempt := 1; ; attempt++ {
+		resp, err := sendProvider(client, name, req, limits)
+		if attempt >= limits.retry.attempts || !canRetry || !shouldRetry(req.Context(), resp, err) {
+			return resp, err
+		}
+
+		wait := limits.retry.delay(attempt)
+		if after := retryAfter(resp); after > 0 {
+			if after > limits.retry.max {
+				return resp, err
+			}
+			wait = after
+		}
+		if deadline, ok := req.Context().Deadline(); ok && time.Until(deadline)-wait < limits.floor {
+			return resp, err
+		}
+		if !spendRetryBudget(name) {
+			providerMetrics.Add(name+".retry_budget_exhausted", 1)
+			return resp, err
+		}
+		if resp != nil {
+			resp.Body.Close()
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req = req.Clone(req.Context())
+			req.Body = body
+		}
+		providerMetrics.Add(name+".retries", 1)
+	}
+}
+
+// sendProvider выполняет одну попытку запроса к провайдеру и учитывает её в метриках.
+func sendProvider(client *http.Client, name string, req *http.Request, limits providerLimits) (*http.Response, error) {
+	timeout, err := providerTimeout(req.Context(), limits)
+	if err != nil {
+		providerMetrics.Add(name+".skipped", 1)
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	ctx, cancel := context.WithTimeout(req.Context(), timeout)
+
+	start := time.Now()
+	resp, err := client.Do(req.WithContext(ctx))
+	elapsed := time.Since(start)
+	providerMetrics.Add(name+".calls", 1)
+	providerMetrics.Add(name+".latency_ms", elapsed.Milliseconds())
+	recordServerTiming(req.Context(), name, elapsed)
+	if err != nil {
+		cancel()
+		providerMetrics.Add(name+".errors", 1)
+		return nil, err
+	}
+	if resp.StatusCode >= 500 {
+		providerMetrics.Add(name+".errors", 1)
+	}
+	resp.Body = cancelOnClose{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+// cancelOnClose освобождает контекст вызова, когда вызывающий закрывает тело ответа.
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b cancelOnClose) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// serverTiming собирает длительности вызовов провайдеров в заголовок Server-Timing ответа.
+// Провайдеры опрашиваются параллельно, поэтому заголовки пишутся под мьютексом.
+type serverTiming struct {
+	mu     sync.Mutex
+	header http.Header
+}
+
+type serverTimingKey struct{}
+
+// recordServerTiming добавляет в ответ запись о вызове провайдера, если ctx — контекст HTTP-запроса.
+// После завершения запроса (например, при фоновом обновлении кэша) запись отбрасывается.
+func recordServerTiming(ctx context.Context, name string, d time.Duration) {
+	t, ok := ctx.Value(serverTimingKey{}).(*serverTiming)
+	if !ok {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.header == nil {
+		return
+	}
+	t.header.Add("Server-Timing", fmt.Sprintf("%s;dur=%.1f", name, float64(d.Microseconds())/1000))
+}
+
+// requestDeadlineMiddleware задаёт срок контексту запроса (REQUEST_TIMEOUT; 0 — без срока)
+// и подключает сбор Server-Timing.
+func requestDeadlineMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		timing := &serverTiming{header: c.Writer.Header()}
+		ctx := context.WithValue(c.Request.Context(), serverTimingKey{}, timing)
+		if timeout := settings().RequestTimeout; timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+
+		timing.mu.Lock()
+		timing.header = nil
+		timing.mu.Unlock()
+	}
+}
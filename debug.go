@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// explainQuery — запрос, который разрешено анализировать через /debug/explain.
+// Params — имена параметров в порядке плейсхолдеров $1, $2, ... (для документации и проверки числа аргументов).
+type explainQuery struct {
+	SQL    string
+	Params []string
+}
+
+// explainQueries — белый список запросов для /debug/explain.
+// Произвольный SQL принимать нельзя даже от администратора: EXPLAIN ANALYZE реально выполняет запрос.
+var explainQueries = map[string]explainQuery{
+	"cities": {SQL: citiesQuery},
+	"hotels": {SQL: hotelsQuery},
+	// Страница GET /api/hotels без фильтров и продвижений, собранная тем же hotelPageQuery.
+	"hotels_page": {SQL: defaultHotelPageQuery(), Params: []string{"limit", "offset"}},
+	"api_key":     {SQL: apiKeyQuery, Params: []string{"key"}},
+}
+
+// defaultHotelPageQuery — запрос страницы списка гостиниц с параметрами по умолчанию:
+// только опубликованные, порядок по имени; LIMIT и OFFSET — $1 и $2.
+func defaultHotelPageQuery() string {
+	q := sqlConditions{}
+	q.and(publishedHotel)
+	return hotelPageQuery(&q, HotelSort{}, nil, nil)
+}
+
+// ExplainResult — ответ эндпоинта /debug/explain.
+type ExplainResult struct {
+	Name   string          `json:"name"`
+	SQL    string          `json:"sql"`
+	Params []string        `json:"params"`
+	Plan   json.RawMessage `json:"plan"`
+}
+
+// explainHandler — HTTP-обработчик, возвращающий план выполнения запроса из белого списка.
+// Реагирует на GET /debug/explain?name=hotels&arg=...&arg=...
+// Значения arg подставляются в плейсхолдеры $1, $2, ... по порядку.
+//
+// Запрос выполняется внутри транзакции, которая всегда откатывается,
+// поэтому EXPLAIN ANALYZE не может ничего изменить в данных.
+func explainHandler(c *gin.Context) {
+	name := c.Query("name")
+	q, ok := explainQueries[name]
+	if !ok {
+		names := make([]string, 0, len(explainQueries))
+		for n := range explainQueries {
+			names = append(names, n)
+		}
+		c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Error:   "unknown query name",
+			Hint:    "available queries: " + strings.Join(names, ", "),
+		})
+		return
+	}
+
+	args := c.QueryArray("arg")
+	if len(args) != len(q.Params) {
+		c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Error:   "wrong number of arguments",
+			Hint:    "expected arguments: " + strings.Join(q.Params, ", "),
+		})
+		return
+	}
+	params := make([]interface{}, len(args))
+	for i, a := range args {
+		params[i] = a
+	}
+
+	tx, err := db.BeginTx(c.Request.Context(), nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+	defer tx.Rollback()
+
+	// FORMAT JSON возвращает план одной строкой — его удобно отдать клиенту как есть.
+	var plan []byte
+	err = tx.QueryRowContext(c.Request.Context(), "EXPLAIN (ANALYZE, BUFFERS, FORMAT JSON) "+q.SQL, params...).Scan(&plan)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, Response{
+		Success: true,
+		Data: ExplainResult{
+			Name:   name,
+			SQL:    strings.TrimSpace(q.SQL),
+			Params: q.Params,
+			Plan:   plan,
+		},
+		Count: 1,
+	})
+}
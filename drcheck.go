@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+// Проверка восстановимости резервных копий (disaster-recovery dry run).
+//
+// Проверка берёт последнюю готовую копию (см. backup.go), восстанавливает её во
+// временную схему drCheckSchema, пересчитывает в БД число строк и SHA-256 каждой
+// таблицы тем же способом, каким они считались при выгрузке, сравнивает с манифестом
+// и удаляет схему. Копия, которую не удаётся восстановить или которая не сходится
+// с манифестом, — это не копия.
+//
+// Проверку можно запустить вручную (POST /api/admin/dr-check) или по расписанию
+// (DR_CHECK_INTERVAL, по умолчанию выключено). Последний отчёт доступен через
+// GET /api/admin/dr-check.
+
+// drCheckSchema — временная схема для пробного восстановления.
+const drCheckSchema = "dr_check"
+
+// DRCheckTable — результат сверки одной таблицы.
+type DRCheckTable struct {
+	Table            string `json:"table"`
+	ExpectedRows     int64  `json:"expected_rows"`
+	RestoredRows     int64  `json:"restored_rows"`
+	ExpectedChecksum string `json:"expected_checksum"`
+	RestoredChecksum string `json:"restored_checksum"`
+	OK               bool   `json:"ok"`
+}
+
+// DRCheckReport — отчёт о пробном восстановлении.
+type DRCheckReport struct {
+	Backup    string         `json:"backup"`
+	CheckedAt time.Time      `json:"checked_at"`
+	Duration  string         `json:"duration"`
+	OK        bool           `json:"ok"`
+	Error     string         `json:"error,omitempty"`
+	Tables    []DRCheckTable `json:"tables"`
+}
+
+// drCheck хранит последний отчёт; running не даёт двум проверкам делить одну схему.
+var drCheck struct {
+	sync.Mutex
+	running bool
+	last    *DRCheckReport
+}
+
+// restoredChecksumQuery — пересчёт числа строк и контрольной суммы таблицы в БД.
+// Строки склеиваются в том же порядке и с тем же разделителем, что и при выгрузке в файл.
+func restoredChecksumQuery(schema, table string) string {
+	return fmt.Sprintf(`
+		SELECT count(*), encode(sha256(convert_to(COALESCE(
+			string_agg(row_to_json(t)::text || E'\n', '' ORDER BY row_to_json(t)::text COLLATE "C"), ''),
+			'UTF8')), 'hex')
+		FROM %s.%s t
+	`, pq.QuoteIdentifier(schema), pq.QuoteIdentifier(table))
+}
+
+// runDRCheck выполняет пробное восстановление последней копии и сохраняет отчёт.
+// Ошибка возвращается, если копию не удалось проверить или она не сошлась с манифестом.
+func runDRCheck(ctx context.Context) (*DRCheckReport, error) {
+	drCheck.Lock()
+	if drCheck.running {
+		drCheck.Unlock()
+		return nil, errors.New("a dr check is already running")
+	}
+	drCheck.running = true
+	drCheck.Unlock()
+
+	started := time.Now()
+	report := &DRCheckReport{CheckedAt: started.UTC(), Tables: []DRCheckTable{}}
+	err := verifyLatestBackup(ctx, report)
+	report.Duration = time.Since(started).Round(time.Millisecond).String()
+	report.OK = err == nil
+	if err != nil {
+		report.Error = err.Error()
+	}
+
+	drCheck.Lock()
+	drCheck.running = false
+	drCheck.last = report
+	drCheck.Unlock()
+	return report, err
+}
+
+// verifyLatestBackup восстанавливает последнюю копию во временную схему и сверяет таблицы.
+func verifyLatestBackup(ctx context.Context, report *DRCheckReport) error {
+	backups, err := listBackups()
+	if err != nil {
+		return err
+	}
+	if len(backups) == 0 {
+		return errors.New("no backups found in " + backupDir())
+	}
+	latest := backups[0]
+	report.Backup = latest.Name
+
+	// Схема удаляется в любом случае, чтобы проверка не оставляла за собой копию данных,
+	// даже если ctx уже отменён остановкой сервера.
+	defer func() {
+		if _, err := db.ExecContext(context.WithoutCancel(ctx), "DROP SCHEMA IF EXISTS "+pq.QuoteIdentifier(drCheckSchema)+" CASCADE"); err != nil {
+			log.Printf("Error dropping dr check schema: %v", err)
+		}
+	}()
+	if _, err := restoreBackup(ctx, latest.Name, drCheckSchema); err != nil {
+		return err
+	}
+
+	mismatched := 0
+	for _, t := range latest.Tables {
+		r := DRCheckTable{Table: t.Table, ExpectedRows: t.Rows, ExpectedChecksum: t.Checksum}
+		if err := db.QueryRowContext(ctx, restoredChecksumQuery(drCheckSchema, t.Table)).Scan(&r.RestoredRows, &r.RestoredChecksum); err != nil {
+			return fmt.Errorf("checksum %s: %w", t.Table, err)
+		}
+		r.OK = r.RestoredRows == r.ExpectedRows && r.RestoredChecksum == r.ExpectedChecksum
+		if !r.OK {
+			mismatched++
+		}
+		report.Tables = append(report.Tables, r)
+	}
+	if mismatched > 0 {
+		return fmt.Errorf("backup %s: %d of %d tables do not match the manifest", latest.Name, mismatched, len(latest.Tables))
+	}
+	return nil
+}
+
+// runDRCheckScheduler периодически запускает проверку. Интервал берётся из настроек
+// на каждом шаге, поэтому включить, выключить или изменить расписание можно без перезапуска.
+func runDRCheckScheduler(ctx context.Context) {
+	for {
+		interval := settings().DRCheckInterval
+		if interval <= 0 {
+			if !sleepContext(ctx, time.Minute) {
+				return
+			}
+			continue
+		}
+		if !sleepContext(ctx, interval) {
+			return
+		}
+		if _, err := runDRCheck(ctx); err != nil {
+			log.Printf("DR check failed: %v", err)
+		}
+	}
+}
+
+// getDRCheck — HTTP-обработчик, возвращающий отчёт последней проверки восстановимости.
+// Реагирует на GET /api/admin/dr-check
+func getDRCheck(c *gin.Context) {
+	drCheck.Lock()
+	report := drCheck.last
+	drCheck.Unlock()
+
+	if report == nil {
+		c.JSON(http.StatusNotFound, Response{
+			Success: false,
+			Error:   "no dr check has run yet",
+			Hint:    "POST /api/admin/dr-check starts one",
+		})
+		return
+	}
+	c.JSON(http.StatusOK, Response{
+		Success: true,
+		Data:    report,
+		Count:   1,
+	})
+}
+
+// startDRCheck — HTTP-обработчик, запускающий проверку восстановимости фоновой задачей.
+// Реагирует на POST /api/admin/dr-check; отвечает 202 с описанием задачи.
+func startDRCheck(c *gin.Context) {
+	job := jobs.start("dr-check", func(func(interface{})) (interface{}, error) {
+		return runDRCheck(context.Background())
+	})
+	c.JSON(http.StatusAccepted, Response{
+		Success: true,
+		Data:    job,
+		Count:   1,
+	})
+}
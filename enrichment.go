@@ -0,0 +1,299 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Обогащение страницы города внешними данными: прогноз погоды и ближайшие события.
+//
+// Источники подключаются через интерфейс enrichmentProvider и выбираются переменными:
+//   - WEATHER_PROVIDER: open-meteo (по умолчанию, ключ не нужен) или none;
+//   - EVENTS_PROVIDER: ticketmaster (секрет ticketmaster_api_key) или none (по умолчанию).
+//
+// Ответы кэшируются по городу с собственной политикой каждого источника (настройки
+// WeatherCache и CityEventsCache): прогноз устаревает за полчаса, афиша — за часы.
+// Внешний сервис не должен ломать и тормозить страницу города: источники опрашиваются
+// параллельно с таймаутом enrichmentLimits (не дольше оставшегося срока запроса,
+// см. deadline.go), при ошибке отдаётся устаревшее значение
+// из кэша, а если его нет — город без этого блока (с пометкой в поле unavailable).
+// После ошибки источник enrichmentBackoff не опрашивается, чтобы лежащий сервис
+// не добавлял таймаут к каждому запросу.
+
+// enrichmentLimits — сколько ждать ответа внешнего источника в рамках запроса
+// и меньше какого остатка срока запроса его уже не опрашивать.
+var enrichmentLimits = providerLimits{
+	max:   2 * time.Second,
+	floor: 200 * time.Millisecond,
+	// Страница города ждёт источник: один быстрый повтор, дальше — устаревшее значение из кэша.
+	retry: retryPolicy{attempts: 2, base: 100 * time.Millisecond, max: 500 * time.Millisecond},
+}
+
+// enrichmentBackoff — пауза в опросе источника после ошибки.
+const enrichmentBackoff = time.Minute
+
+// errNoCoordinates — у города нет координат, а источнику они нужны.
+var errNoCoordinates = errors.New("city has no coordinates")
+
+// enrichmentProvider — внешний источник данных о городе.
+type enrichmentProvider interface {
+	// field — имя блока в ответе (weather, events).
+	field() string
+	// policy — политика кэширования ответов источника.
+	policy() cachePolicy
+	fetch(ctx context.Context, city City) (interface{}, error)
+}
+
+var enrichmentProviders []enrichmentProvider
+
+// enrichmentFailures — когда источник последний раз ответил ошибкой.
+var enrichmentFailures = struct {
+	sync.Mutex
+	at map[string]time.Time
+}{at: map[string]time.Time{}}
+
+// initEnrichment создаёт источники по переменным WEATHER_PROVIDER и EVENTS_PROVIDER.
+func initEnrichment() error {
+	enrichmentProviders = nil
+	switch name := os.Getenv("WEATHER_PROVIDER"); name {
+	case "", "open-meteo":
+		enrichmentProviders = append(enrichmentProviders, openMeteo{})
+	case "none":
+	default:
+		return fmt.Errorf("unknown WEATHER_PROVIDER %q", name)
+	}
+	switch name := os.Getenv("EVENTS_PROVIDER"); name {
+	case "", "none":
+	case "ticketmaster":
+		key, err := secrets.GetSecret(context.Background(), "ticketmaster_api_key")
+		if err != nil {
+			return fmt.Errorf("ticketmaster events provider requires the ticketmaster_api_key secret: %w", err)
+		}
+		enrichmentProviders = append(enrichmentProviders, ticketmaster{apiKey: key})
+	default:
+		return fmt.Errorf("unknown EVENTS_PROVIDER %q", name)
+	}
+	return nil
+}
+
+// CityDetails — город вместе с данными внешних источников.
+type CityDetails struct {
+	City
+	Weather interface{} `json:"weather,omitempty"`
+	Events  interface{} `json:"events,omitempty"`
+	// Unavailable — блоки, которые не удалось получить.
+	Unavailable []string `json:"unavailable,omitempty"`
+}
+
+// enrichCity опрашивает источники параллельно и собирает их данные о городе.
+// ctx — контекст запроса: от его срока зависит, сколько ждать источники.
+func enrichCity(ctx context.Context, city City) CityDetails {
+	details := CityDetails{City: city}
+	// Все источники ищут по координатам; города без них (не из GeoNames) не обогащаем.
+	if city.Latitude == nil || city.Longitude == nil {
+		return details
+	}
+	results := make([]interface{}, len(enrichmentProviders))
+	var wg sync.WaitGroup
+	for i, p := range enrichmentProviders {
+		wg.Add(1)
+		go func(i int, p enrichmentProvider) {
+			defer wg.Done()
+			results[i] = fetchEnrichment(ctx, p, city)
+		}(i, p)
+	}
+	wg.Wait()
+
+	for i, p := range enrichmentProviders {
+		if results[i] == nil {
+			details.Unavailable = append(details.Unavailable, p.field())
+			continue
+		}
+		switch p.field() {
+		case "weather":
+			details.Weather = results[i]
+		case "events":
+			details.Events = results[i]
+		}
+	}
+	return details
+}
+
+// fetchEnrichment возвращает данные источника о городе из кэша или из источника; nil — данных нет.
+func fetchEnrichment(reqCtx context.Context, p enrichmentProvider, city City) interface{} {
+	// Таймаут считается сейчас, пока известен срок запроса; фоновое обновление кэша получает тот же.
+	timeout, timeoutErr := providerTimeout(reqCtx, enrichmentLimits)
+	key := fmt.Sprintf("enrichment:%s:%d", p.field(), city.ID)
+	value, _, err := cache.get(reqCtx, key, p.policy(), func(ctx context.Context) (interface{}, error) {
+		enrichmentFailures.Lock()
+		failedAt := enrichmentFailures.at[p.field()]
+		enrichmentFailures.Unlock()
+		if time.Since(failedAt) < enrichmentBackoff {
+			return nil, fmt.Errorf("%s provider is backing off after an error", p.field())
+		}
+		if timeoutErr != nil {
+			providerMetrics.Add(p.field()+".skipped", 1)
+			return nil, timeoutErr
+		}
+
+		// Ответ источника сохраняется в кэше и нужен не только этому клиенту: его уход не
+		// должен прерывать вызов (и включать паузу после ошибки). Значения контекста
+		// сохраняем (сбор Server-Timing, см. deadline.go).
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+		defer cancel()
+		v, err := p.fetch(ctx, city)
+		if err != nil && err != errNoCoordinates {
+			enrichmentFailures.Lock()
+			enrichmentFailures.at[p.field()] = time.Now()
+			enrichmentFailures.Unlock()
+			log.Printf("Error fetching %s for city %d: %v", p.field(), city.ID, err)
+		}
+		return v, err
+	})
+	if err != nil {
+		return nil
+	}
+	return value
+}
+
+// getJSON выполняет GET-запрос к внешнему источнику и декодирует JSON-ответ в out;
+// provider — имя источника в метриках (совпадает с field()).
+func getJSON(ctx context.Context, provider, u string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := doProvider(outboundClient, provider, req, enrichmentLimits)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("unexpected status %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// DailyForecast — прогноз погоды на день.
+type DailyForecast struct {
+	Date                     string   `json:"date"`
+	TempMax                  *float64 `json:"temp_max"`
+	TempMin                  *float64 `json:"temp_min"`
+	PrecipitationProbability *float64 `json:"precipitation_probability"`
+	// WeatherCode — код погоды WMO (0 — ясно, 61 — дождь, 71 — снег и т. д.).
+	WeatherCode *int `json:"weather_code"`
+}
+
+// openMeteo — прогноз погоды Open-Meteo (https://open-meteo.com), без ключа.
+type openMeteo struct{}
+
+func (openMeteo) field() string       { return "weather" }
+func (openMeteo) policy() cachePolicy { return settings().WeatherCache }
+
+func (openMeteo) fetch(ctx context.Context, city City) (interface{}, error) {
+	if city.Latitude == nil || city.Longitude == nil {
+		return nil, errNoCoordinates
+	}
+	q := url.Values{
+		"latitude":      {fmt.Sprint(*city.Latitude)},
+		"longitude":     {fmt.Sprint(*city.Longitude)},
+		"daily":         {"temperature_2m_max,temperature_2m_min,precipitation_probability_max,weathercode"},
+		"timezone":      {"auto"},
+		"forecast_days": {"3"},
+	}
+	var body struct {
+		Daily struct {
+			Time          []string   `json:"time"`
+			TempMax       []*float64 `json:"temperature_2m_max"`
+			TempMin       []*float64 `json:"temperature_2m_min"`
+			Precipitation []*float64 `json:"precipitation_probability_max"`
+			WeatherCode   []*int     `json:"weathercode"`
+		} `json:"daily"`
+	}
+	if err := getJSON(ctx, "weather", "https://api.open-meteo.com/v1/forecast?"+q.Encode(), &body); err != nil {
+		return nil, fmt.Errorf("open-meteo: %w", err)
+	}
+
+	d := body.Daily
+	days := make([]DailyForecast, len(d.Time))
+	for i, date := range d.Time {
+		days[i].Date = date
+		if i < len(d.TempMax) {
+			days[i].TempMax = d.TempMax[i]
+		}
+		if i < len(d.TempMin) {
+			days[i].TempMin = d.TempMin[i]
+		}
+		if i < len(d.Precipitation) {
+			days[i].PrecipitationProbability = d.Precipitation[i]
+		}
+		if i < len(d.WeatherCode) {
+			days[i].WeatherCode = d.WeatherCode[i]
+		}
+	}
+	return days, nil
+}
+
+// CityEvent — событие в городе.
+type CityEvent struct {
+	Name string `json:"name"`
+	Date string `json:"date"`
+	URL  string `json:"url"`
+}
+
+// ticketmaster — афиша Ticketmaster Discovery API: ближайшие события в радиусе 30 км от центра города.
+type ticketmaster struct {
+	apiKey string
+}
+
+func (ticketmaster) field() string       { return "events" }
+func (ticketmaster) policy() cachePolicy { return settings().CityEventsCache }
+
+func (t ticketmaster) fetch(ctx context.Context, city City) (interface{}, error) {
+	if city.Latitude == nil || city.Longitude == nil {
+		return nil, errNoCoordinates
+	}
+	q := url.Values{
+		"apikey":  {t.apiKey},
+		"latlong": {fmt.Sprintf("%v,%v", *city.Latitude, *city.Longitude)},
+		"radius":  {"30"},
+		"unit":    {"km"},
+		"sort":    {"date,asc"},
+		"size":    {"5"},
+	}
+	var body struct {
+		Embedded struct {
+			Events []struct {
+				Name  string `json:"name"`
+				URL   string `json:"url"`
+				Dates struct {
+					Start struct {
+						LocalDate string `json:"localDate"`
+					} `json:"start"`
+				} `json:"dates"`
+			} `json:"events"`
+		} `json:"_embedded"`
+	}
+	if err := getJSON(ctx, "events", "https://app.ticketmaster.com/discovery/v2/events.json?"+q.Encode(), &body); err != nil {
+		// Ключ в адресе — не выводим его в лог вместе с ошибкой.
+		return nil, errors.New("ticketmaster: " + strings.ReplaceAll(err.Error(), t.apiKey, "***"))
+	}
+
+	events := make([]CityEvent, 0, len(body.Embedded.Events))
+	for _, e := range body.Embedded.Events {
+		events = append(events, CityEvent{Name: e.Name, Date: e.Dates.Start.LocalDate, URL: e.URL})
+	}
+	return events, nil
+}
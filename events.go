@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+// Приём событий от клиентов (показы, клики, начало и подтверждение бронирования) для аналитики и ранжирования.
+//
+// Клиенты копят события и присылают их пачками; пачка записывается одной транзакцией
+// через COPY — это на порядок быстрее построчных INSERT при большом потоке:
+//
+//	events(id, type, hotel_id NULL, city_id NULL, session_id, api_key NULL,
+//	       occurred_at, received_at DEFAULT now(), props JSONB NULL)
+//
+// Пачка принимается целиком или отклоняется целиком: при ошибке валидации в ответе
+// указывается индекс первого некорректного события.
+
+// maxEventsPerBatch — максимальный размер пачки событий.
+const maxEventsPerBatch = 500
+
+// maxEventPropsBytes — максимальный размер произвольных свойств события.
+const maxEventPropsBytes = 4 << 10
+
+// eventClockSkew — насколько occurred_at может опережать часы сервера (часы клиентов врут).
+const eventClockSkew = 5 * time.Minute
+
+// eventMaxAge — события старше этого срока не принимаются: для аналитики они уже бесполезны.
+const eventMaxAge = 7 * 24 * time.Hour
+
+// eventTypes — допустимые типы событий.
+var eventTypes = map[string]bool{
+	"impression":      true,
+	"click":           true,
+	"booking_started": true,
+	// Подтверждение бронирования присылает страница успешной оплаты партнёра;
+	// нужно для последнего этапа воронки (см. funnel.go).
+	"booking_confirmed": true,
+}
+
+// Event — одно клиентское событие.
+type Event struct {
+	Type       string          `json:"type"`
+	HotelID    *int            `json:"hotel_id"`
+	CityID     *int            `json:"city_id"`
+	SessionID  string          `json:"session_id"`
+	OccurredAt *time.Time      `json:"occurred_at"`
+	Props      json.RawMessage `json:"props"`
+}
+
+// validate проверяет событие и подставляет время получения, если клиент его не указал.
+func (e *Event) validate(now time.Time) error {
+	if !eventTypes[e.Type] {
+		return fmt.Errorf("unknown event type %q", e.Type)
+	}
+	if e.SessionID == "" || len(e.SessionID) > 128 {
+		return fmt.Errorf("session_id is required and must be at most 128 characters")
+	}
+	if (e.Type == "impression" || e.Type == "click") && e.HotelID == nil {
+		return fmt.Errorf("%s event requires hotel_id", e.Type)
+	}
+	if len(e.Props) > maxEventPropsBytes {
+		return fmt.Errorf("props must be at most %d bytes", maxEventPropsBytes)
+	}
+	if e.OccurredAt == nil {
+		e.OccurredAt = &now
+	}
+	if e.OccurredAt.After(now.Add(eventClockSkew)) || e.OccurredAt.Before(now.Add(-eventMaxAge)) {
+		return fmt.Errorf("occurred_at is out of the accepted range")
+	}
+	return nil
+}
+
+// ingestEvents — HTTP-обработчик приёма пачки событий.
+// Реагирует на POST /api/events с телом {"events": [...]}; отвечает 202 Accepted.
+func ingestEvents(c *gin.Context) {
+	var body struct {
+		Events []Event `json:"events"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+	if len(body.Events) == 0 || len(body.Events) > maxEventsPerBatch {
+		c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Error:   fmt.Sprintf("a batch must contain between 1 and %d events", maxEventsPerBatch),
+		})
+		return
+	}
+
+	now := time.Now().UTC()
+	for i := range body.Events {
+		if err := body.Events[i].validate(now); err != nil {
+			c.JSON(http.StatusBadRequest, Response{
+				Success: false,
+				Error:   fmt.Sprintf("event %d: %v", i, err),
+			})
+			return
+		}
+	}
+
+	var apiKey *string
+	if v, ok := c.Get("api_key"); ok {
+		key := v.(APIKey).Key
+		apiKey = &key
+	}
+
+	if err := copyEvents(c.Request.Context(), body.Events, apiKey); err != nil {
+		c.JSON(http.StatusInternalServerError, Response{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusAccepted, Response{
+		Success: true,
+		Count:   len(body.Events),
+	})
+}
+
+// copyEvents записывает пачку событий одной командой COPY внутри транзакции.
+func copyEvents(ctx context.Context, events []Event, apiKey *string) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, pq.CopyIn("events", "type", "hotel_id", "city_id", "session_id", "api_key", "occurred_at", "props"))
+	if err != nil {
+		return err
+	}
+	for _, e := range events {
+		// COPY передаёт значения как текст; пустые свойства записываем как NULL, а не пустую строку.
+		var props interface{}
+		if len(e.Props) > 0 {
+			props = string(e.Props)
+		}
+		if _, err := stmt.ExecContext(ctx, e.Type, e.HotelID, e.CityID, e.SessionID, apiKey, *e.OccurredAt, props); err != nil {
+			stmt.Close()
+			return err
+		}
+	}
+	// Пустой ExecContext завершает COPY и отправляет данные серверу.
+	if _, err := stmt.ExecContext(ctx); err != nil {
+		stmt.Close()
+		return err
+	}
+	if err := stmt.Close(); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,314 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Дополнительные услуги гостиницы: проживание с животными, парковка, детские
+// кроватки и дополнительные кровати.
+//
+// Хранятся в hotels.extras (JSONB) одним объектом по разделам; раздел nil значит
+// «не известно», а не «нет». Цены — в той же валюте, что и цена гостиницы.
+//
+// В публичном списке и на карте работают фильтры ?pets=true, ?parking=true,
+// ?crib=true и ?extra_bed=true. GET /api/hotels/:id/quote считает стоимость
+// проживания вместе с выбранными услугами и проверяет, что они доступны.
+
+// HotelExtras — дополнительные услуги гостиницы.
+type HotelExtras struct {
+	Pets      *PetPolicy     `json:"pets,omitempty"`
+	Parking   *ParkingPolicy `json:"parking,omitempty"`
+	Cribs     *BedOption     `json:"cribs,omitempty"`
+	ExtraBeds *BedOption     `json:"extra_beds,omitempty"`
+}
+
+// PetPolicy — условия проживания с животными.
+type PetPolicy struct {
+	Allowed bool `json:"allowed"`
+	// MaxPets — сколько животных можно разместить в номере; 0 — без ограничения.
+	MaxPets     int     `json:"max_pets"`
+	FeePerNight float64 `json:"fee_per_night"`
+	FeePerStay  float64 `json:"fee_per_stay"`
+}
+
+// ParkingPolicy — условия парковки.
+type ParkingPolicy struct {
+	Available bool `json:"available"`
+	// Spaces — сколько мест можно занять в одном бронировании; 0 — без ограничения.
+	Spaces              int     `json:"spaces"`
+	PricePerNight       float64 `json:"price_per_night"`
+	ReservationRequired bool    `json:"reservation_required"`
+}
+
+// BedOption — кроватки или дополнительные кровати: сколько можно поставить в номер и почём.
+type BedOption struct {
+	Available     int     `json:"available"`
+	PricePerNight float64 `json:"price_per_night"`
+}
+
+// validate проверяет значения.
+func (e *HotelExtras) validate() error {
+	if p := e.Pets; p != nil && (p.MaxPets < 0 || p.FeePerNight < 0 || p.FeePerStay < 0) {
+		return fmt.Errorf("pets: max_pets and fees must not be negative")
+	}
+	if p := e.Parking; p != nil && (p.Spaces < 0 || p.PricePerNight < 0) {
+		return fmt.Errorf("parking: spaces and price must not be negative")
+	}
+	for name, b := range map[string]*BedOption{"cribs": e.Cribs, "extra_beds": e.ExtraBeds} {
+		if b != nil && (b.Available < 0 || b.PricePerNight < 0) {
+			return fmt.Errorf("%s: available and price must not be negative", name)
+		}
+	}
+	return nil
+}
+
+// extrasFilters — фильтры списка по услугам: параметр -> есть ли услуга у гостиницы
+// (в Go и то же условие в SQL по hotels.extras).
+var extrasFilters = map[string]struct {
+	has func(e *HotelExtras) bool
+	sql string
+}{
+	"pets":      {func(e *HotelExtras) bool { return e.Pets != nil && e.Pets.Allowed }, `h.extras @> '{"pets": {"allowed": true}}'`},
+	"parking":   {func(e *HotelExtras) bool { return e.Parking != nil && e.Parking.Available }, `h.extras @> '{"parking": {"available": true}}'`},
+	"crib":      {func(e *HotelExtras) bool { return e.Cribs != nil && e.Cribs.Available > 0 }, `(h.extras #>> '{cribs,available}')::numeric > 0`},
+	"extra_bed": {func(e *HotelExtras) bool { return e.ExtraBeds != nil && e.ExtraBeds.Available > 0 }, `(h.extras #>> '{extra_beds,available}')::numeric > 0`},
+}
+
+// parseExtras разбирает фильтры ?pets=true, ?parking=true, ?crib=true, ?extra_bed=true
+// в список включённых (по алфавиту). При ошибке сам отвечает клиенту и возвращает false.
+func parseExtras(c *gin.Context) ([]string, bool) {
+	var active []string
+	for param := range extrasFilters {
+		v := c.Query(param)
+		if v == "" {
+			continue
+		}
+		want, err := strconv.ParseBool(v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, Response{Success: false, Error: fmt.Sprintf("%s must be true or false", param)})
+			return nil, false
+		}
+		// ?pets=false ничего не фильтрует: «животные не нужны» подходит любой гостинице.
+		if want {
+			active = append(active, param)
+		}
+	}
+	sort.Strings(active)
+	return active, true
+}
+
+// extrasWhere добавляет включённые фильтры по услугам в условия запроса.
+func extrasWhere(q *sqlConditions, active []string) {
+	for _, param := range active {
+		q.and(extrasFilters[param].sql)
+	}
+}
+
+// applyExtras применяет к списку фильтры ?pets=true, ?parking=true, ?crib=true, ?extra_bed=true.
+// При ошибке сам отвечает клиенту и возвращает false.
+func applyExtras(c *gin.Context, hotels []Hotel) ([]Hotel, bool) {
+	active, ok := parseExtras(c)
+	if !ok || len(active) == 0 {
+		return hotels, ok
+	}
+
+	result := make([]Hotel, 0, len(hotels))
+	for _, h := range hotels {
+		if h.Extras == nil {
+			continue
+		}
+		keep := true
+		for _, param := range active {
+			if !extrasFilters[param].has(h.Extras) {
+				keep = false
+				break
+			}
+		}
+		if keep {
+			result = append(result, h)
+		}
+	}
+	return result, true
+}
+
+// QuoteLine — строка расчёта стоимости.
+type QuoteLine struct {
+	Item      string  `json:"item"`
+	Quantity  int     `json:"quantity"`
+	UnitPrice float64 `json:"unit_price"`
+	Amount    float64 `json:"amount"`
+}
+
+// Quote — расчёт стоимости проживания с услугами.
+type Quote struct {
+	HotelID int         `json:"hotel_id"`
+	Nights  int         `json:"nights"`
+	Lines   []QuoteLine `json:"lines"`
+	Total   float64     `json:"total"`
+}
+
+// QuoteRequest — что клиент хочет заказать.
+type QuoteRequest struct {
+	Nights    int
+	Pets      int
+	Parking   int
+	Cribs     int
+	ExtraBeds int
+}
+
+// roundMoney округляет сумму до копеек.
+func roundMoney(v float64) float64 {
+	return math.Round(v*100) / 100
+}
+
+// quoteHotel считает стоимость проживания в гостинице с услугами.
+// Ошибка означает, что запрошенная услуга недоступна или её больше, чем можно.
+func quoteHotel(h Hotel, req QuoteRequest) (Quote, error) {
+	if h.Price == nil {
+		return Quote{}, fmt.Errorf("hotel has no price yet")
+	}
+	q := Quote{HotelID: h.ID, Nights: req.Nights}
+	add := func(item string, qty int, unit float64) {
+		amount := roundMoney(unit * float64(qty))
+		q.Lines = append(q.Lines, QuoteLine{Item: item, Quantity: qty, UnitPrice: unit, Amount: amount})
+		q.Total += amount
+	}
+	add("room_night", req.Nights, *h.Price)
+
+	e := h.Extras
+	if e == nil {
+		e = &HotelExtras{}
+	}
+	if req.Pets > 0 {
+		if e.Pets == nil || !e.Pets.Allowed {
+			return Quote{}, fmt.Errorf("pets are not allowed")
+		}
+		if e.Pets.MaxPets > 0 && req.Pets > e.Pets.MaxPets {
+			return Quote{}, fmt.Errorf("at most %d pets are allowed", e.Pets.MaxPets)
+		}
+		if e.Pets.FeePerNight > 0 {
+			add("pet_night", req.Pets*req.Nights, e.Pets.FeePerNight)
+		}
+		if e.Pets.FeePerStay > 0 {
+			add("pet_stay", req.Pets, e.Pets.FeePerStay)
+		}
+	}
+	if req.Parking > 0 {
+		if e.Parking == nil || !e.Parking.Available {
+			return Quote{}, fmt.Errorf("parking is not available")
+		}
+		if e.Parking.Spaces > 0 && req.Parking > e.Parking.Spaces {
+			return Quote{}, fmt.Errorf("at most %d parking spaces are available", e.Parking.Spaces)
+		}
+		add("parking_night", req.Parking*req.Nights, e.Parking.PricePerNight)
+	}
+	for _, b := range []struct {
+		item   string
+		qty    int
+		option *BedOption
+	}{{"crib_night", req.Cribs, e.Cribs}, {"extra_bed_night", req.ExtraBeds, e.ExtraBeds}} {
+		if b.qty == 0 {
+			continue
+		}
+		if b.option == nil || b.qty > b.option.Available {
+			available := 0
+			if b.option != nil {
+				available = b.option.Available
+			}
+			return Quote{}, fmt.Errorf("%s: only %d available", b.item, available)
+		}
+		add(b.item, b.qty*req.Nights, b.option.PricePerNight)
+	}
+	q.Total = roundMoney(q.Total)
+	return q, nil
+}
+
+// getHotelQuote — HTTP-обработчик расчёта стоимости проживания.
+// Реагирует на GET /api/hotels/:id/quote?nights=3&pets=1&parking=1&cribs=1&extra_beds=0
+func getHotelQuote(c *gin.Context) {
+	id, ok := hotelIDParam(c)
+	if !ok {
+		return
+	}
+	req := QuoteRequest{Nights: 1}
+	for param, dst := range map[string]*int{
+		"nights": &req.Nights, "pets": &req.Pets, "parking": &req.Parking, "cribs": &req.Cribs, "extra_beds": &req.ExtraBeds,
+	} {
+		v := c.Query(param)
+		if v == "" {
+			continue
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 || n > 365 {
+			c.JSON(http.StatusBadRequest, Response{Success: false, Error: fmt.Sprintf("%s must be an integer between 0 and 365", param)})
+			return
+		}
+		*dst = n
+	}
+	if req.Nights < 1 {
+		c.JSON(http.StatusBadRequest, Response{Success: false, Error: "nights must be at least 1"})
+		return
+	}
+
+	// Гостиница — из кэша списка: перед кампаниями он прогревается (см. priming.go).
+	hotel, found, err := cachedHotel(c.Request.Context(), strictScan(c), id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	if !found {
+		c.JSON(http.StatusNotFound, Response{Success: false, Error: "hotel not found"})
+		return
+	}
+	quote, err := quoteHotel(hotel, req)
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, Response{Success: false, Error: err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, Response{Success: true, Data: quote, Count: len(quote.Lines)})
+}
+
+// setHotelExtras — HTTP-обработчик, заменяющий дополнительные услуги гостиницы.
+// Реагирует на PUT /api/admin/hotels/:id/extras с телом
+// {"pets": {"allowed": true, "max_pets": 1, "fee_per_night": 500}, "parking": {"available": true, "price_per_night": 300}};
+// неизвестные поля отклоняются.
+func setHotelExtras(c *gin.Context) {
+	id, ok := hotelIDParam(c)
+	if !ok {
+		return
+	}
+	var e HotelExtras
+	dec := json.NewDecoder(c.Request.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&e); err != nil {
+		c.JSON(http.StatusBadRequest, Response{Success: false, Error: err.Error()})
+		return
+	}
+	if err := e.validate(); err != nil {
+		c.JSON(http.StatusBadRequest, Response{Success: false, Error: err.Error()})
+		return
+	}
+	raw, err := json.Marshal(e)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	res, err := db.ExecContext(c.Request.Context(), "UPDATE hotels SET extras = $2 WHERE id = $1", id, string(raw))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		c.JSON(http.StatusNotFound, Response{Success: false, Error: "hotel not found"})
+		return
+	}
+	cache.flush("hotels")
+	c.JSON(http.StatusOK, Response{Success: true, Data: gin.H{"id": id, "extras": e}, Count: 1})
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Базовые фильтры списка гостиниц: ?city_id=, ?min_price=, ?max_price=, ?min_capacity=.
+//
+// В GET /api/hotels фильтры становятся условиями WHERE с параметрами $n (см. where):
+// отбирает гостиницы база, по индексам, а не обработчик по закэшированному списку.
+// Значения из запроса в текст SQL не попадают никогда — только в параметры.
+// Эндпоинты, которые и так работают с закэшированным списком целиком (лендинги городов),
+// применяют те же фильтры в Go через apply; правила у обоих путей одинаковые:
+// гостиница без цены (или без вместимости) под фильтр по цене (вместимости) не подходит.
+//
+// С ?city_id= в выдаче действуют продвижения этого города и продвижения без города;
+// без него — все активные продвижения, как и раньше (см. promotions.go).
+
+// HotelFilter — разобранные базовые фильтры; nil — фильтр не задан.
+type HotelFilter struct {
+	CityID      *int
+	MinPrice    *float64
+	MaxPrice    *float64
+	MinCapacity *int
+}
+
+// parseHotelFilter разбирает фильтры из запроса и отвечает 400 на некорректные значения.
+func parseHotelFilter(c *gin.Context) (HotelFilter, bool) {
+	var f HotelFilter
+	for _, p := range []struct {
+		name string
+		dst  **int
+	}{{"city_id", &f.CityID}, {"min_capacity", &f.MinCapacity}} {
+		v := c.Query(p.name)
+		if v == "" {
+			continue
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			c.JSON(http.StatusBadRequest, Response{Success: false, Error: fmt.Sprintf("%s must be a non-negative integer", p.name)})
+			return HotelFilter{}, false
+		}
+		*p.dst = &n
+	}
+	for _, p := range []struct {
+		name string
+		dst  **float64
+	}{{"min_price", &f.MinPrice}, {"max_price", &f.MaxPrice}} {
+		v := c.Query(p.name)
+		if v == "" {
+			continue
+		}
+		x, err := strconv.ParseFloat(v, 64)
+		if err != nil || x < 0 || math.IsNaN(x) || math.IsInf(x, 0) {
+			c.JSON(http.StatusBadRequest, Response{Success: false, Error: fmt.Sprintf("%s must be a non-negative number", p.name)})
+			return HotelFilter{}, false
+		}
+		*p.dst = &x
+	}
+	if f.MinPrice != nil && f.MaxPrice != nil && *f.MinPrice > *f.MaxPrice {
+		c.JSON(http.StatusBadRequest, Response{Success: false, Error: "min_price must not exceed max_price"})
+		return HotelFilter{}, false
+	}
+	return f, true
+}
+
+// matches сообщает, подходит ли гостиница под фильтры.
+func (f HotelFilter) matches(h Hotel) bool {
+	if f.CityID != nil && (h.CityID == nil || *h.CityID != *f.CityID) {
+		return false
+	}
+	if f.MinPrice != nil || f.MaxPrice != nil {
+		if h.Price == nil {
+			return false
+		}
+		if f.MinPrice != nil && *h.Price < *f.MinPrice {
+			return false
+		}
+		if f.MaxPrice != nil && *h.Price > *f.MaxPrice {
+			return false
+		}
+	}
+	if f.MinCapacity != nil && (h.Capacity == nil || *h.Capacity < *f.MinCapacity) {
+		return false
+	}
+	return true
+}
+
+// where добавляет фильтры в условия запроса. Цена сравнивается с действующей
+// (та же колонка, что в hotelSelect); сравнение с NULL ложно, как и в matches.
+func (f HotelFilter) where(q *sqlConditions) {
+	if f.CityID != nil {
+		q.and("h.city = " + q.arg(*f.CityID))
+	}
+	if f.MinPrice != nil {
+		q.and(hotelPriceColumn + " >= " + q.arg(*f.MinPrice))
+	}
+	if f.MaxPrice != nil {
+		q.and(hotelPriceColumn + " <= " + q.arg(*f.MaxPrice))
+	}
+	if f.MinCapacity != nil {
+		q.and("h.capacity >= " + q.arg(*f.MinCapacity))
+	}
+}
+
+// sqlConditions собирает условия WHERE и их параметры. Текст условий задаёт код,
+// значения из запроса клиента передаются только через arg.
+type sqlConditions struct {
+	conds []string
+	args  []interface{}
+}
+
+// arg добавляет параметр и возвращает его плейсхолдер ($1, $2, ...).
+func (q *sqlConditions) arg(v interface{}) string {
+	q.args = append(q.args, v)
+	return "$" + strconv.Itoa(len(q.args))
+}
+
+// clone возвращает копию, в которую можно добавлять условия, не меняя исходную.
+func (q sqlConditions) clone() sqlConditions {
+	return sqlConditions{
+		conds: append([]string(nil), q.conds...),
+		args:  append([]interface{}(nil), q.args...),
+	}
+}
+
+// and добавляет условие.
+func (q *sqlConditions) and(cond string) {
+	q.conds = append(q.conds, cond)
+}
+
+// sql возвращает предложение WHERE (пустую строку, если условий нет).
+func (q *sqlConditions) sql() string {
+	if len(q.conds) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(q.conds, " AND ")
+}
+
+// apply возвращает новый список подходящих гостиниц; исходный (он может лежать в кэше) не меняется.
+func (f HotelFilter) apply(hotels []Hotel) []Hotel {
+	if f == (HotelFilter{}) {
+		return hotels
+	}
+	result := make([]Hotel, 0, len(hotels))
+	for _, h := range hotels {
+		if f.matches(h) {
+			result = append(result, h)
+		}
+	}
+	return result
+}
+
+// scopePromotions оставляет продвижения, действующие в выдаче по городу cityID:
+// без города и этого города. nil — выдача не по городу, действуют все.
+func scopePromotions(promos []Promotion, cityID *int) []Promotion {
+	if cityID == nil {
+		return promos
+	}
+	scoped := make([]Promotion, 0, len(promos))
+	for _, p := range promos {
+		if p.CityID == nil || *p.CityID == *cityID {
+			scoped = append(scoped, p)
+		}
+	}
+	return scoped
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// testContext — контекст gin для запроса GET target; ответ пишется в возвращаемый рекордер.
+func testContext(target string) (*gin.Context, *httptest.ResponseRecorder) {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("GET", target, nil)
+	return c, w
+}
+
+func TestParseHotelFilter(t *testing.T) {
+	intp := func(n int) *int { return &n }
+	floatp := func(x float64) *float64 { return &x }
+	for _, tc := range []struct {
+		query string
+		want  HotelFilter
+	}{
+		{"", HotelFilter{}},
+		{"city_id=3", HotelFilter{CityID: intp(3)}},
+		{"min_price=1000&max_price=2500.5", HotelFilter{MinPrice: floatp(1000), MaxPrice: floatp(2500.5)}},
+		{"min_price=2000&max_price=2000", HotelFilter{MinPrice: floatp(2000), MaxPrice: floatp(2000)}},
+		{"min_capacity=2&city_id=0", HotelFilter{CityID: intp(0), MinCapacity: intp(2)}},
+	} {
+		c, w := testContext("/api/hotels?" + tc.query)
+		got, ok := parseHotelFilter(c)
+		if !ok {
+			t.Errorf("%q: rejected with %d: %s", tc.query, w.Code, w.Body)
+			continue
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%q: got %+v, want %+v", tc.query, got, tc.want)
+		}
+	}
+}
+
+func TestParseHotelFilterRejects(t *testing.T) {
+	for _, query := range []string{
+		"city_id=abc",
+		"city_id=-1",
+		"min_capacity=1.5",
+		"min_price=cheap",
+		"max_price=-10",
+		"min_price=NaN&max_price=1",
+		"max_price=Inf",
+		"min_price=3000&max_price=2000",
+		"city_id=1%20OR%201=1",
+	} {
+		c, w := testContext("/api/hotels?" + query)
+		if _, ok := parseHotelFilter(c); ok {
+			t.Errorf("%q: accepted", query)
+			continue
+		}
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%q: status %d, want 400", query, w.Code)
+		}
+	}
+}
+
+func TestHotelFilterWhere(t *testing.T) {
+	intp := func(n int) *int { return &n }
+	floatp := func(x float64) *float64 { return &x }
+	for _, tc := range []struct {
+		name   string
+		filter HotelFilter
+		sql    string
+		args   []interface{}
+	}{
+		{"none", HotelFilter{}, " WHERE " + publishedHotel, nil},
+		{"city", HotelFilter{CityID: intp(7)}, " WHERE " + publishedHotel + " AND h.city = $1", []interface{}{7}},
+		{
+			"all",
+			HotelFilter{CityID: intp(7), MinPrice: floatp(1000), MaxPrice: floatp(5000), MinCapacity: intp(2)},
+			" WHERE " + publishedHotel + " AND h.city = $1 AND " + hotelPriceColumn + " >= $2 AND " +
+				hotelPriceColumn + " <= $3 AND h.capacity >= $4",
+			[]interface{}{7, 1000.0, 5000.0, 2},
+		},
+		{
+			"price range without city",
+			HotelFilter{MaxPrice: floatp(5000), MinCapacity: intp(3)},
+			" WHERE " + publishedHotel + " AND " + hotelPriceColumn + " <= $1 AND h.capacity >= $2",
+			[]interface{}{5000.0, 3},
+		},
+	} {
+		q := sqlConditions{}
+		q.and(publishedHotel)
+		tc.filter.where(&q)
+		if got := q.sql(); got != tc.sql {
+			t.Errorf("%s: sql\n%s\nwant\n%s", tc.name, got, tc.sql)
+		}
+		if !reflect.DeepEqual(q.args, tc.args) {
+			t.Errorf("%s: args %v, want %v", tc.name, q.args, tc.args)
+		}
+	}
+}
+
+// Фильтр в SQL и фильтр в Go (лендинги) должны отбирать одно и то же.
+func TestHotelFilterMatches(t *testing.T) {
+	intp := func(n int) *int { return &n }
+	floatp := func(x float64) *float64 { return &x }
+	hotels := []Hotel{
+		{ID: 1, CityID: intp(1), Capacity: intp(2), Price: floatp(3000)},
+		{ID: 2, CityID: intp(1), Capacity: intp(4), Price: floatp(6000)},
+		{ID: 3, CityID: intp(2), Capacity: nil, Price: floatp(1000)},
+		{ID: 4, CityID: nil, Capacity: intp(10), Price: nil},
+	}
+	ids := func(list []Hotel) []int {
+		out := []int{}
+		for _, h := range list {
+			out = append(out, h.ID)
+		}
+		return out
+	}
+	for _, tc := range []struct {
+		filter HotelFilter
+		want   []int
+	}{
+		{HotelFilter{}, []int{1, 2, 3, 4}},
+		{HotelFilter{CityID: intp(1)}, []int{1, 2}},
+		{HotelFilter{CityID: intp(1), MaxPrice: floatp(5000)}, []int{1}},
+		{HotelFilter{MinPrice: floatp(0)}, []int{1, 2, 3}},
+		{HotelFilter{MinCapacity: intp(3)}, []int{2, 4}},
+		{HotelFilter{MinCapacity: intp(3), MinPrice: floatp(0)}, []int{2}},
+	} {
+		if got := ids(tc.filter.apply(hotels)); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%+v: got %v, want %v", tc.filter, got, tc.want)
+		}
+	}
+}
+
+// testHotelNames запрашивает список гостиниц и возвращает их имена в порядке выдачи.
+func testHotelNames(t *testing.T, h http.Handler, target string) []string {
+	t.Helper()
+	w := serve(h, "GET", target, "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET %s: status %d: %s", target, w.Code, w.Body)
+	}
+	var resp struct {
+		Data []Hotel `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	names := []string{}
+	for _, h := range resp.Data {
+		names = append(names, h.Name)
+	}
+	return names
+}
+
+func TestHotelListFilters(t *testing.T) {
+	testDB(t)
+	moscow, kazan := testCity(t, "Moscow"), testCity(t, "Kazan")
+	testHotel(t, "Arbat", moscow, 2, 3000)
+	testHotel(t, "Kremlin View", moscow, 4, 9000)
+	testHotel(t, "Volga", kazan, 6, 2500)
+	draft := testHotel(t, "Draft", moscow, 10, 1000)
+	testExec(t, "UPDATE hotels SET status = 'draft' WHERE id = $1", draft)
+	router := newPublicRouter()
+
+	for _, tc := range []struct {
+		query string
+		want  []string
+	}{
+		{"", []string{"Arbat", "Kremlin View", "Volga"}},
+		{"city_id=" + strconv.Itoa(moscow), []string{"Arbat", "Kremlin View"}},
+		{"city_id=" + strconv.Itoa(moscow) + "&max_price=5000", []string{"Arbat"}},
+		{"min_price=2500&max_price=3000", []string{"Arbat", "Volga"}},
+		{"min_capacity=4&max_price=9000", []string{"Kremlin View", "Volga"}},
+		{"city_id=" + strconv.Itoa(kazan) + "&min_capacity=7", []string{}},
+	} {
+		if got := testHotelNames(t, router, "/api/hotels?"+tc.query); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%q: got %v, want %v", tc.query, got, tc.want)
+		}
+	}
+}
+
+func TestHotelListSQLFilters(t *testing.T) {
+	testDB(t)
+	moscow := testCity(t, "Moscow")
+	alpine := testHotel(t, "Alpine", moscow, 2, 3000)
+	bridge := testHotel(t, "Bridge", moscow, 2, 3000)
+	german := testHotel(t, "German Only", moscow, 2, 3000)
+	open := testHotel(t, "Open", moscow, 2, 3000)
+	testExec(t, `INSERT INTO attribute_definitions (key, tenant_id, type) VALUES
+		('ski_storage', NULL, 'bool'), ('floors', NULL, 'number'), ('vip', 99, 'string')`)
+	testExec(t, `UPDATE hotels SET
+		attributes = '{"ski_storage": true, "floors": 5, "vip": "gold"}',
+		accessibility = '{"elevator": true, "step_free_access": true}',
+		extras = '{"pets": {"allowed": true}, "cribs": {"available": 2}}'
+		WHERE id = $1`, alpine)
+	testExec(t, `UPDATE hotels SET
+		attributes = '{"ski_storage": false, "floors": 5.0}',
+		accessibility = '{"elevator": false}',
+		extras = '{"parking": {"available": true}, "cribs": {"available": 0}}'
+		WHERE id = $1`, bridge)
+	testExec(t, "UPDATE hotels SET allowed_countries = '{DE}' WHERE id = $1", german)
+	testExec(t, "UPDATE hotels SET blocked_countries = '{DE}' WHERE id = $1", open)
+	metro := testExec(t, "INSERT INTO pois (city_id, kind, name, latitude, longitude) VALUES ($1, 'metro', 'Arbatskaya', 55.75, 37.6) RETURNING id", moscow)
+	testExec(t, "INSERT INTO hotel_poi_distances (hotel_id, poi_id, distance_m) VALUES ($1, $2, 300), ($3, $2, 3000)", alpine, metro, bridge)
+	router := newPublicRouter()
+
+	for _, tc := range []struct {
+		query string
+		want  []string
+	}{
+		// Клиент из неизвестной страны не видит гостиницу, продаваемую только в Германии.
+		{"", []string{"Alpine", "Bridge", "Open"}},
+		{"attr.ski_storage=true", []string{"Alpine"}},
+		{"attr.ski_storage=false", []string{"Bridge"}},
+		{"attr.ski_storage=yes", []string{}},
+		{"attr.floors=5", []string{"Alpine", "Bridge"}},
+		{"attr.floors=5.0&attr.ski_storage=true", []string{"Alpine"}},
+		{"attr.floors=five", []string{}},
+		{"accessible=elevator", []string{"Alpine"}},
+		{"accessible=elevator,step_free_access", []string{"Alpine"}},
+		{"pets=true", []string{"Alpine"}},
+		{"pets=false", []string{"Alpine", "Bridge", "Open"}},
+		{"parking=true", []string{"Bridge"}},
+		{"crib=true", []string{"Alpine"}},
+		{"near_poi=" + strconv.Itoa(metro) + "&within_km=1", []string{"Alpine"}},
+		{"near_poi=metro&within_km=3.5", []string{"Alpine", "Bridge"}},
+		{"near_poi=metro&within_km=0.3005", []string{"Alpine"}},
+		{"near_poi=airport", []string{}},
+	} {
+		if got := testHotelNames(t, router, "/api/hotels?"+tc.query); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%q: got %v, want %v", tc.query, got, tc.want)
+		}
+	}
+
+	// Атрибут чужого тенанта нельзя ни отфильтровать, ни увидеть.
+	if w := serve(router, "GET", "/api/hotels?attr.vip=gold", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("filter by another tenant's attribute: status %d, want 400", w.Code)
+	}
+	w := serve(router, "GET", "/api/hotels?attr.ski_storage=true", "")
+	var resp struct {
+		Data []Hotel `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Data) != 1 || resp.Data[0].Attributes["vip"] != nil || resp.Data[0].Attributes["floors"] == nil {
+		t.Errorf("attributes visible to an anonymous client: %+v", resp.Data)
+	}
+}
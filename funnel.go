@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Воронка конверсии по клиентским событиям (см. events.go).
+//
+// Этапы воронки и события, которые их отмечают:
+//
+//	поиск (гостиница показана в выдаче)   — impression
+//	просмотр карточки гостиницы           — click
+//	начало бронирования                   — booking_started
+//	подтверждённое бронирование           — booking_confirmed
+//
+// На каждом этапе считаются уникальные сессии, а не события: повторные показы одной
+// и той же гостиницы в одной сессии конверсию не портят. Группировка — по гостинице
+// или по городу (город события, а если он не передан — город гостиницы).
+//
+// Запросы тяжёлые (COUNT DISTINCT по всей таблице событий за период), поэтому
+// результат кэшируется по политике FunnelCache, а границы периода по умолчанию
+// округляются до часа, чтобы повторные запросы попадали в один ключ кэша.
+
+// funnelGroupColumns — выражения id и названия группы для каждого вида группировки.
+var funnelGroupColumns = map[string]struct{ id, name string }{
+	"hotel": {id: "h.id", name: "h.name"},
+	"city":  {id: "c.id", name: "c.name"},
+}
+
+// funnelQuery — шаблон запроса воронки; %[1]s и %[2]s — id и название группы.
+// События без гостиницы (booking_started может прийти без hotel_id) попадают
+// только в группировку по городу, и то если в событии указан city_id.
+const funnelQuery = `
+	SELECT %[1]s, %[2]s,
+		COUNT(DISTINCT e.session_id) FILTER (WHERE e.type = 'impression'),
+		COUNT(DISTINCT e.session_id) FILTER (WHERE e.type = 'click'),
+		COUNT(DISTINCT e.session_id) FILTER (WHERE e.type = 'booking_started'),
+		COUNT(DISTINCT e.session_id) FILTER (WHERE e.type = 'booking_confirmed')
+	FROM events e
+	LEFT JOIN hotels h ON h.id = e.hotel_id
+	LEFT JOIN cities c ON c.id = COALESCE(e.city_id, h.city)
+	WHERE e.occurred_at >= $1 AND e.occurred_at < $2 AND %[1]s IS NOT NULL
+	GROUP BY %[1]s, %[2]s
+	ORDER BY 3 DESC, %[1]s
+`
+
+// FunnelRow — воронка одной гостиницы или одного города.
+type FunnelRow struct {
+	ID                int     `json:"id"`
+	Name              string  `json:"name"`
+	Searches          int64   `json:"searches"`
+	DetailViews       int64   `json:"detail_views"`
+	BookingsStarted   int64   `json:"bookings_started"`
+	BookingsConfirmed int64   `json:"bookings_confirmed"`
+	ViewRate          float64 `json:"view_rate"`
+	StartRate         float64 `json:"start_rate"`
+	ConfirmRate       float64 `json:"confirm_rate"`
+	OverallConversion float64 `json:"overall_conversion"`
+}
+
+// FunnelReport — ответ эндпоинта GET /api/admin/funnel.
+type FunnelReport struct {
+	GroupBy string      `json:"group_by"`
+	From    time.Time   `json:"from"`
+	To      time.Time   `json:"to"`
+	Rows    []FunnelRow `json:"rows"`
+}
+
+// rate — доля next от prev; при пустом предыдущем этапе конверсия считается нулевой.
+func rate(next, prev int64) float64 {
+	if prev == 0 {
+		return 0
+	}
+	return float64(next) / float64(prev)
+}
+
+// loadFunnel считает воронку за период [from, to) с группировкой groupBy.
+// strict — строгий режим сканирования (см. scan.go).
+func loadFunnel(ctx context.Context, groupBy string, from, to time.Time, strict bool) (*FunnelReport, error) {
+	cols := funnelGroupColumns[groupBy]
+	rows, err := db.QueryContext(ctx, fmt.Sprintf(funnelQuery, cols.id, cols.name), from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	report := &FunnelReport{GroupBy: groupBy, From: from, To: to, Rows: []FunnelRow{}}
+	for rows.Next() {
+		var r FunnelRow
+		if err := rows.Scan(&r.ID, &r.Name, &r.Searches, &r.DetailViews, &r.BookingsStarted, &r.BookingsConfirmed); err != nil {
+			if err := scanFailed(strict, "funnel row", err); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		r.ViewRate = rate(r.DetailViews, r.Searches)
+		r.StartRate = rate(r.BookingsStarted, r.DetailViews)
+		r.ConfirmRate = rate(r.BookingsConfirmed, r.BookingsStarted)
+		r.OverallConversion = rate(r.BookingsConfirmed, r.Searches)
+		report.Rows = append(report.Rows, r)
+	}
+	// Воронка кэшируется, поэтому неполный отчёт не отдаём никогда.
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// getFunnel — HTTP-обработчик, возвращающий воронку конверсии.
+// Реагирует на GET /api/admin/funnel?from=&to=&group_by=hotel|city.
+// По умолчанию — последние 7 дней с группировкой по гостиницам.
+func getFunnel(c *gin.Context) {
+	groupBy := c.DefaultQuery("group_by", "hotel")
+	if _, ok := funnelGroupColumns[groupBy]; !ok {
+		c.JSON(http.StatusBadRequest, Response{Success: false, Error: "group_by must be 'hotel' or 'city'"})
+		return
+	}
+
+	now := time.Now().UTC().Truncate(time.Hour)
+	from, err := parseTimeParam(c.Query("from"), now.AddDate(0, 0, -7))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, Response{Success: false, Error: "invalid from: " + err.Error()})
+		return
+	}
+	to, err := parseTimeParam(c.Query("to"), now.Add(time.Hour))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, Response{Success: false, Error: "invalid to: " + err.Error()})
+		return
+	}
+
+	strict := strictScan(c)
+	key := fmt.Sprintf("funnel:%s:%s:%s", groupBy, from.Format(time.RFC3339), to.Format(time.RFC3339))
+	report, status, err := cache.get(c.Request.Context(), key, settings().FunnelCache, func(ctx context.Context) (interface{}, error) {
+		return loadFunnel(ctx, groupBy, from, to, strict)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+	c.Header("X-Cache", status)
+
+	c.JSON(http.StatusOK, Response{
+		Success: true,
+		Data:    report,
+		Count:   len(report.(*FunnelReport).Rows),
+	})
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"log"
+	"math"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Умолчания для формы поиска по местоположению клиента.
+//
+// GET /api/context по IP клиента (см. geoip.go) подбирает страну, валюту, язык и
+// ближайший город, чтобы фронтенд заполнил форму поиска до того, как клиент что-то
+// выбрал. Язык из Accept-Language важнее языка страны: человек, настроивший браузер,
+// знает лучше. Без базы GeoIP или для неизвестного адреса отдаются общие умолчания.
+
+// Умолчания, если страну определить не удалось.
+const (
+	defaultCurrency = "EUR"
+	defaultLanguage = "en"
+)
+
+// countryDefaults — валюта и язык по стране.
+var countryDefaults = map[string]struct{ Currency, Language string }{
+	"RU": {"RUB", "ru"}, "BY": {"BYN", "ru"}, "KZ": {"KZT", "ru"}, "UA": {"UAH", "uk"},
+	"AM": {"AMD", "ru"}, "GE": {"GEL", "ka"}, "UZ": {"UZS", "ru"}, "KG": {"KGS", "ru"},
+	"US": {"USD", "en"}, "GB": {"GBP", "en"}, "CA": {"CAD", "en"}, "AU": {"AUD", "en"},
+	"DE": {"EUR", "de"}, "AT": {"EUR", "de"}, "CH": {"CHF", "de"}, "FR": {"EUR", "fr"},
+	"IT": {"EUR", "it"}, "ES": {"EUR", "es"}, "PT": {"EUR", "pt"}, "NL": {"EUR", "nl"},
+	"FI": {"EUR", "fi"}, "EE": {"EUR", "et"}, "LV": {"EUR", "lv"}, "LT": {"EUR", "lt"},
+	"PL": {"PLN", "pl"}, "CZ": {"CZK", "cs"}, "TR": {"TRY", "tr"}, "AE": {"AED", "ar"},
+	"CN": {"CNY", "zh"}, "JP": {"JPY", "ja"}, "IN": {"INR", "en"}, "TH": {"THB", "th"},
+}
+
+// ClientContext — умолчания для клиента.
+type ClientContext struct {
+	// Country — ISO-код страны; nil, если не определена.
+	Country  *string `json:"country"`
+	Currency string  `json:"currency"`
+	Language string  `json:"language"`
+	// City — ближайший город из справочника; nil, если местоположение неизвестно.
+	City *NearestCity `json:"city"`
+	// Source — откуда взяты умолчания: geoip или default.
+	Source string `json:"source"`
+}
+
+// NearestCity — ближайший к клиенту город.
+type NearestCity struct {
+	ID         int     `json:"id"`
+	Name       string  `json:"name"`
+	Slug       *string `json:"slug"`
+	DistanceKm float64 `json:"distance_km"`
+}
+
+// haversineKm — расстояние между точками в километрах.
+func haversineKm(lat1, lon1, lat2, lon2 float64) float64 {
+	rad := math.Pi / 180
+	dLat, dLon := (lat2-lat1)*rad, (lon2-lon1)*rad
+	a := math.Pow(math.Sin(dLat/2), 2) + math.Cos(lat1*rad)*math.Cos(lat2*rad)*math.Pow(math.Sin(dLon/2), 2)
+	return 2 * 6371 * math.Asin(math.Sqrt(a))
+}
+
+// geoFloat достаёт число по пути ключей из записи базы GeoIP.
+func geoFloat(record map[string]interface{}, path ...string) (float64, bool) {
+	var v interface{} = record
+	for _, key := range path {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return 0, false
+		}
+		v = m[key]
+	}
+	f, ok := v.(float64)
+	return f, ok
+}
+
+// nearestCity ищет ближайший к точке город; города страны клиента предпочтительнее.
+func nearestCity(cities []City, lat, lon float64, country string) *NearestCity {
+	var best *NearestCity
+	bestInCountry := false
+	for _, city := range cities {
+		if city.Latitude == nil || city.Longitude == nil {
+			continue
+		}
+		inCountry := country != "" && city.CountryCode != nil && strings.EqualFold(*city.CountryCode, country)
+		d := haversineKm(lat, lon, *city.Latitude, *city.Longitude)
+		if best == nil || (inCountry && !bestInCountry) || (inCountry == bestInCountry && d < best.DistanceKm) {
+			best = &NearestCity{ID: city.ID, Name: city.Name, Slug: city.Slug, DistanceKm: d}
+			bestInCountry = inCountry
+		}
+	}
+	if best != nil {
+		best.DistanceKm = math.Round(best.DistanceKm*10) / 10
+	}
+	return best
+}
+
+// acceptLanguage возвращает основной язык первого тега Accept-Language ("ru-RU,ru;q=0.9" -> "ru").
+func acceptLanguage(header string) string {
+	tag := strings.TrimSpace(strings.SplitN(strings.SplitN(header, ",", 2)[0], ";", 2)[0])
+	lang := strings.ToLower(strings.SplitN(tag, "-", 2)[0])
+	if len(lang) < 2 || len(lang) > 3 || lang == "*" {
+		return ""
+	}
+	return lang
+}
+
+// getClientContext — HTTP-обработчик умолчаний для формы поиска.
+// Реагирует на GET /api/context
+func getClientContext(c *gin.Context) {
+	ctx := ClientContext{Currency: defaultCurrency, Language: defaultLanguage, Source: "default"}
+	record := clientGeo(c)
+	country := clientCountry(c)
+	if country != "" {
+		ctx.Country = &country
+		ctx.Source = "geoip"
+		if d, ok := countryDefaults[country]; ok {
+			ctx.Currency, ctx.Language = d.Currency, d.Language
+		}
+	}
+	if lang := acceptLanguage(c.GetHeader("Accept-Language")); lang != "" {
+		ctx.Language = lang
+	}
+
+	lat, okLat := geoFloat(record, "location", "latitude")
+	lon, okLon := geoFloat(record, "location", "longitude")
+	if okLat && okLon {
+		strict := strictScan(c)
+		cities, _, err := cache.get(c.Request.Context(), "cities", settings().CitiesCache, func(ctx context.Context) (interface{}, error) {
+			return loadCities(ctx, strict)
+		})
+		if err != nil {
+			// Без города умолчания всё равно полезны.
+			log.Printf("Error loading cities for client context: %v", err)
+		} else {
+			ctx.City = nearestCity(cities.(rowSet[City]).Items, lat, lon, country)
+		}
+	}
+
+	// Ответ зависит от адреса клиента: общим кэшам его хранить нельзя.
+	c.Header("Cache-Control", "private, no-store")
+	c.Header("Vary", "Accept-Language")
+	c.JSON(http.StatusOK, Response{Success: true, Data: ctx, Count: 1})
+}
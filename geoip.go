@@ -0,0 +1,354 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"log"
+	"math"
+	"math/big"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Определение страны клиента по IP через локальную базу MaxMind (формат MMDB).
+//
+// Путь к файлу задаёт GEOIP_DB (GeoLite2-Country, GeoLite2-City или совместимая база).
+// Файл целиком читается в память при запуске; без GEOIP_DB страна клиента считается
+// неизвестной. Читатель написан здесь же: формат простой, а из базы нужны только
+// несколько полей записи, и тянуть ради этого зависимость не хочется.
+//
+// Устройство файла: бинарное дерево поиска по битам адреса, за ним 16 нулевых байт
+// и секция данных, в конце — метаданные после маркера "\xAB\xCD\xEFMaxMind.com".
+
+// mmdbMetadataMarker — маркер начала метаданных в конце файла.
+var mmdbMetadataMarker = []byte("\xAB\xCD\xEFMaxMind.com")
+
+// mmdbReader — открытая база MMDB.
+type mmdbReader struct {
+	buf        []byte
+	nodeCount  uint
+	recordSize uint
+	ipVersion  uint
+	treeSize   uint
+	// ipv4Start — узел, с которого ищутся IPv4-адреса в дереве IPv6 (::/96).
+	ipv4Start uint
+}
+
+// geoip — база, открытая initGeoIP; nil, если GEOIP_DB не задана.
+var geoip *mmdbReader
+
+// initGeoIP открывает базу из GEOIP_DB, если переменная задана.
+func initGeoIP() error {
+	path := os.Getenv("GEOIP_DB")
+	if path == "" {
+		geoip = nil
+		return nil
+	}
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	r, err := newMMDBReader(buf)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	geoip = r
+	log.Printf("GeoIP database loaded from %s (%d nodes)", path, r.nodeCount)
+	return nil
+}
+
+// newMMDBReader разбирает метаданные базы.
+func newMMDBReader(buf []byte) (*mmdbReader, error) {
+	at := bytes.LastIndex(buf, mmdbMetadataMarker)
+	if at < 0 {
+		return nil, fmt.Errorf("not a MaxMind DB file: metadata marker not found")
+	}
+	start := at + len(mmdbMetadataMarker)
+	d := mmdbDecoder{buf: buf[start:]}
+	meta, _, err := d.decode(0)
+	if err != nil {
+		return nil, fmt.Errorf("invalid metadata: %w", err)
+	}
+	m, ok := meta.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("invalid metadata: not a map")
+	}
+	r := &mmdbReader{buf: buf}
+	for key, dst := range map[string]*uint{"node_count": &r.nodeCount, "record_size": &r.recordSize, "ip_version": &r.ipVersion} {
+		v, ok := m[key].(uint64)
+		if !ok {
+			return nil, fmt.Errorf("invalid metadata: missing %s", key)
+		}
+		*dst = uint(v)
+	}
+	if r.recordSize != 24 && r.recordSize != 28 && r.recordSize != 32 {
+		return nil, fmt.Errorf("unsupported record size %d", r.recordSize)
+	}
+	r.treeSize = r.recordSize * 2 / 8 * r.nodeCount
+	if r.treeSize+16 > uint(at) {
+		return nil, fmt.Errorf("search tree is larger than the file")
+	}
+	if r.ipVersion == 6 {
+		node := uint(0)
+		for i := 0; i < 96 && node < r.nodeCount; i++ {
+			node = r.record(node, 0)
+		}
+		r.ipv4Start = node
+	}
+	return r, nil
+}
+
+// record читает левую (bit = 0) или правую (bit = 1) запись узла дерева.
+func (r *mmdbReader) record(node uint, bit uint) uint {
+	b := r.buf[node*r.recordSize*2/8:]
+	switch r.recordSize {
+	case 24:
+		b = b[bit*3:]
+		return uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+	case 28:
+		if bit == 0 {
+			return uint(b[3]&0xF0)<<20 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+		}
+		return uint(b[3]&0x0F)<<24 | uint(b[4])<<16 | uint(b[5])<<8 | uint(b[6])
+	default:
+		return uint(binary.BigEndian.Uint32(b[bit*4:]))
+	}
+}
+
+// lookup возвращает запись базы для адреса или nil, если адреса в базе нет.
+func (r *mmdbReader) lookup(ip net.IP) (map[string]interface{}, error) {
+	node := uint(0)
+	addr := ip.To4()
+	if addr != nil {
+		if r.ipVersion == 6 {
+			node = r.ipv4Start
+		}
+	} else {
+		if r.ipVersion == 4 {
+			return nil, nil
+		}
+		addr = ip.To16()
+		if addr == nil {
+			return nil, fmt.Errorf("invalid IP address")
+		}
+	}
+
+	for i := 0; i < len(addr)*8 && node < r.nodeCount; i++ {
+		bit := uint(addr[i/8]>>(7-uint(i%8))) & 1
+		node = r.record(node, bit)
+	}
+	if node == r.nodeCount {
+		return nil, nil
+	}
+	if node < r.nodeCount {
+		return nil, fmt.Errorf("search tree is deeper than the address")
+	}
+
+	// Запись указывает в секцию данных, отсчёт — от конца дерева с разделителем.
+	d := mmdbDecoder{buf: r.buf[r.treeSize+16:]}
+	v, _, err := d.decode(node - r.nodeCount - 16)
+	if err != nil {
+		return nil, err
+	}
+	record, _ := v.(map[string]interface{})
+	return record, nil
+}
+
+// mmdbDecoder декодирует значения секции данных (или метаданных); указатели отсчитываются от начала buf.
+type mmdbDecoder struct {
+	buf []byte
+}
+
+// Типы значений MMDB.
+const (
+	mmdbExtended = 0
+	mmdbPointer  = 1
+	mmdbString   = 2
+	mmdbDouble   = 3
+	mmdbBytes    = 4
+	mmdbUint16   = 5
+	mmdbUint32   = 6
+	mmdbMap      = 7
+	mmdbInt32    = 8
+	mmdbUint64   = 9
+	mmdbUint128  = 10
+	mmdbArray    = 11
+	mmdbBool     = 14
+	mmdbFloat    = 15
+)
+
+// decode читает значение по смещению off и возвращает его вместе со смещением следующего.
+func (d mmdbDecoder) decode(off uint) (interface{}, uint, error) {
+	typ, size, off, err := d.header(off)
+	if err != nil {
+		return nil, 0, err
+	}
+	if typ == mmdbPointer {
+		v, _, err := d.decode(size)
+		return v, off, err
+	}
+	return d.value(typ, size, off)
+}
+
+// header разбирает управляющий байт: тип, размер (для указателя — адрес) и начало значения.
+func (d mmdbDecoder) header(off uint) (typ, size, next uint, err error) {
+	if off >= uint(len(d.buf)) {
+		return 0, 0, 0, fmt.Errorf("offset %d is out of range", off)
+	}
+	ctrl := d.buf[off]
+	off++
+	typ = uint(ctrl >> 5)
+	if typ == mmdbPointer {
+		n := uint(ctrl>>3)&0x3 + 1
+		if off+n > uint(len(d.buf)) {
+			return 0, 0, 0, fmt.Errorf("pointer at %d is truncated", off)
+		}
+		p := uint(ctrl & 0x7)
+		if n == 4 {
+			p = 0
+		}
+		for _, b := range d.buf[off : off+n] {
+			p = p<<8 | uint(b)
+		}
+		p += [...]uint{0, 2048, 526336, 0}[n-1]
+		return mmdbPointer, p, off + n, nil
+	}
+	if typ == mmdbExtended {
+		if off >= uint(len(d.buf)) {
+			return 0, 0, 0, fmt.Errorf("extended type at %d is truncated", off)
+		}
+		typ = 7 + uint(d.buf[off])
+		off++
+	}
+	size = uint(ctrl & 0x1f)
+	if size >= 29 {
+		n := size - 28
+		if off+n > uint(len(d.buf)) {
+			return 0, 0, 0, fmt.Errorf("size at %d is truncated", off)
+		}
+		extra := uint(0)
+		for _, b := range d.buf[off : off+n] {
+			extra = extra<<8 | uint(b)
+		}
+		size = [...]uint{29, 285, 65821}[n-1] + extra
+		off += n
+	}
+	return typ, size, off, nil
+}
+
+// value читает значение типа typ размера size, начинающееся с off.
+func (d mmdbDecoder) value(typ, size, off uint) (interface{}, uint, error) {
+	switch typ {
+	case mmdbMap:
+		m := make(map[string]interface{}, size)
+		for i := uint(0); i < size; i++ {
+			k, next, err := d.decode(off)
+			if err != nil {
+				return nil, 0, err
+			}
+			key, ok := k.(string)
+			if !ok {
+				return nil, 0, fmt.Errorf("map key at %d is not a string", off)
+			}
+			v, next, err := d.decode(next)
+			if err != nil {
+				return nil, 0, err
+			}
+			m[key] = v
+			off = next
+		}
+		return m, off, nil
+	case mmdbArray:
+		a := make([]interface{}, 0, size)
+		for i := uint(0); i < size; i++ {
+			v, next, err := d.decode(off)
+			if err != nil {
+				return nil, 0, err
+			}
+			a = append(a, v)
+			off = next
+		}
+		return a, off, nil
+	case mmdbBool:
+		return size != 0, off, nil
+	}
+
+	if off+size > uint(len(d.buf)) {
+		return nil, 0, fmt.Errorf("value at %d is truncated", off)
+	}
+	b := d.buf[off : off+size]
+	next := off + size
+	switch typ {
+	case mmdbString:
+		return string(b), next, nil
+	case mmdbBytes:
+		return append([]byte(nil), b...), next, nil
+	case mmdbDouble:
+		if size != 8 {
+			return nil, 0, fmt.Errorf("double at %d has size %d", off, size)
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), next, nil
+	case mmdbFloat:
+		if size != 4 {
+			return nil, 0, fmt.Errorf("float at %d has size %d", off, size)
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(b))), next, nil
+	case mmdbUint16, mmdbUint32, mmdbUint64:
+		v := uint64(0)
+		for _, x := range b {
+			v = v<<8 | uint64(x)
+		}
+		return v, next, nil
+	case mmdbInt32:
+		v := uint32(0)
+		for _, x := range b {
+			v = v<<8 | uint32(x)
+		}
+		return int64(int32(v)), next, nil
+	case mmdbUint128:
+		return new(big.Int).SetBytes(b), next, nil
+	}
+	return nil, 0, fmt.Errorf("unsupported data type %d at %d", typ, off)
+}
+
+// geoPath достаёт строку по пути ключей из записи базы (например, "country", "iso_code").
+func geoPath(record map[string]interface{}, path ...string) string {
+	var v interface{} = record
+	for _, key := range path {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return ""
+		}
+		v = m[key]
+	}
+	s, _ := v.(string)
+	return s
+}
+
+// clientGeo возвращает запись базы для адреса клиента (один раз на запрос); nil, если база не задана или адреса в ней нет.
+func clientGeo(c *gin.Context) map[string]interface{} {
+	if v, ok := c.Get("geo"); ok {
+		record, _ := v.(map[string]interface{})
+		return record
+	}
+	var record map[string]interface{}
+	if geoip != nil {
+		if ip := net.ParseIP(c.ClientIP()); ip != nil {
+			var err error
+			if record, err = geoip.lookup(ip); err != nil {
+				log.Printf("GeoIP lookup for %s failed: %v", ip, err)
+			}
+		}
+	}
+	c.Set("geo", record)
+	return record
+}
+
+// clientCountry возвращает ISO-код страны клиента в верхнем регистре или "", если страна неизвестна.
+func clientCountry(c *gin.Context) string {
+	return strings.ToUpper(geoPath(clientGeo(c), "country", "iso_code"))
+}
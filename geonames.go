@@ -0,0 +1,315 @@
+package main
+
+import (
+	"archive/zip"
+	"bufio"
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Импорт городов из GeoNames (https://www.geonames.org/).
+//
+// Источник — выгрузка в формате GeoNames: строки по 19 колонок через табуляцию
+// (geonameid, name, asciiname, alternatenames, latitude, longitude, feature class,
+// feature code, country code, ..., population, ...). Это может быть локальный файл
+// (cities500.txt, allCountries.txt) или архивы стран XX.zip, которые импорт сам
+// скачивает с download.geonames.org.
+//
+// Берутся только населённые пункты (feature class P) из выбранных стран
+// с населением не меньше порога. Дубли с уже заведёнными городами ищутся
+// по geoname_id, затем по названию в той же стране, затем по старым названиям
+// из city_aliases (см. cities.go); найденный город дополняется координатами,
+// страной и населением, но не переименовывается. Новые города получают slug.
+//
+// Запуск: команда CLI import-geonames или POST /api/admin/imports/geonames
+// (фоновая задача; ход импорта — в поле progress задачи, см. jobs.go).
+
+// geonamesDumpURL — адрес архива выгрузки страны; %s — код страны.
+const geonamesDumpURL = "https://download.geonames.org/export/dump/%s.zip"
+
+// countryCodeRe — код страны ISO 3166-1 alpha-2.
+var countryCodeRe = regexp.MustCompile(`^[A-Z]{2}$`)
+
+// GeoNamesImport — параметры импорта.
+type GeoNamesImport struct {
+	// File — локальный файл выгрузки; пусто — скачать архивы стран Countries.
+	File string `json:"-"`
+	// Countries — коды стран; для локального файла пустой список означает «все страны».
+	Countries     []string `json:"countries"`
+	MinPopulation int64    `json:"min_population"`
+}
+
+// GeoNamesProgress — ход и итог импорта.
+type GeoNamesProgress struct {
+	Country  string `json:"country,omitempty"`
+	Read     int64  `json:"read"`
+	Skipped  int64  `json:"skipped"`
+	Inserted int64  `json:"inserted"`
+	Updated  int64  `json:"updated"`
+}
+
+// geoName — населённый пункт из выгрузки.
+type geoName struct {
+	ID         int64
+	Name       string
+	ASCIIName  string
+	Latitude   float64
+	Longitude  float64
+	Country    string
+	Population int64
+}
+
+// parseGeoName разбирает строку выгрузки. ok=false — строка не населённый пункт или повреждена.
+func parseGeoName(line string) (geoName, bool) {
+	f := strings.Split(line, "\t")
+	if len(f) < 19 || f[6] != "P" {
+		return geoName{}, false
+	}
+	var g geoName
+	var err1, err2, err3, err4 error
+	g.ID, err1 = strconv.ParseInt(f[0], 10, 64)
+	g.Latitude, err2 = strconv.ParseFloat(f[4], 64)
+	g.Longitude, err3 = strconv.ParseFloat(f[5], 64)
+	g.Population, err4 = strconv.ParseInt(f[14], 10, 64)
+	if err1 != nil || err2 != nil || err3 != nil || err4 != nil || f[1] == "" {
+		return geoName{}, false
+	}
+	g.Name, g.ASCIIName, g.Country = f[1], f[2], f[8]
+	return g, true
+}
+
+// runGeoNamesImport выполняет импорт; progress вызывается после каждой тысячи прочитанных строк.
+func runGeoNamesImport(ctx context.Context, opts GeoNamesImport, progress func(interface{})) (*GeoNamesProgress, error) {
+	for _, cc := range opts.Countries {
+		if !countryCodeRe.MatchString(cc) {
+			return nil, fmt.Errorf("invalid country code %q", cc)
+		}
+	}
+	p := &GeoNamesProgress{}
+	defer cache.flush("cities")
+
+	if opts.File != "" {
+		f, err := os.Open(opts.File)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		return p, importGeoNames(ctx, f, opts, p, progress)
+	}
+
+	if len(opts.Countries) == 0 {
+		return nil, errors.New("countries are required when downloading from GeoNames")
+	}
+	for _, cc := range opts.Countries {
+		p.Country = cc
+		if err := importGeoNamesCountry(ctx, cc, opts, p, progress); err != nil {
+			return p, fmt.Errorf("%s: %w", cc, err)
+		}
+	}
+	p.Country = ""
+	return p, nil
+}
+
+// importGeoNamesCountry скачивает архив страны во временный файл и импортирует его.
+func importGeoNamesCountry(ctx context.Context, cc string, opts GeoNamesImport, p *GeoNamesProgress, progress func(interface{})) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf(geonamesDumpURL, cc), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := outboundClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("download failed: %s", resp.Status)
+	}
+
+	// zip читается с произвольным доступом, поэтому архив сначала сохраняется на диск.
+	tmp, err := os.CreateTemp("", "geonames-*.zip")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+	size, err := io.Copy(tmp, resp.Body)
+	if err != nil {
+		return err
+	}
+
+	zr, err := zip.NewReader(tmp, size)
+	if err != nil {
+		return err
+	}
+	for _, zf := range zr.File {
+		if zf.Name != cc+".txt" {
+			continue
+		}
+		rc, err := zf.Open()
+		if err != nil {
+			return err
+		}
+		defer rc.Close()
+		return importGeoNames(ctx, rc, opts, p, progress)
+	}
+	return fmt.Errorf("%s.txt not found in the archive", cc)
+}
+
+// importGeoNames читает выгрузку и заносит подходящие населённые пункты в cities.
+func importGeoNames(ctx context.Context, r io.Reader, opts GeoNamesImport, p *GeoNamesProgress, progress func(interface{})) error {
+	countries := map[string]bool{}
+	for _, cc := range opts.Countries {
+		countries[cc] = true
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64<<10), 1<<20)
+	for scanner.Scan() {
+		p.Read++
+		if p.Read%1000 == 0 {
+			snapshot := *p
+			progress(snapshot)
+		}
+		g, ok := parseGeoName(scanner.Text())
+		if !ok || g.Population < opts.MinPopulation || (len(countries) > 0 && !countries[g.Country]) {
+			p.Skipped++
+			continue
+		}
+		inserted, err := upsertGeoName(ctx, g)
+		if err != nil {
+			return fmt.Errorf("geoname %d: %w", g.ID, err)
+		}
+		if inserted {
+			p.Inserted++
+		} else {
+			p.Updated++
+		}
+	}
+	return scanner.Err()
+}
+
+// upsertGeoName находит для населённого пункта существующий город или заводит новый.
+// Возвращает true, если город добавлен.
+func upsertGeoName(ctx context.Context, g geoName) (bool, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	var id int
+	err = tx.QueryRowContext(ctx, `
+		SELECT id FROM cities WHERE geoname_id = $1
+		UNION ALL
+		SELECT id FROM cities
+		WHERE geoname_id IS NULL AND lower(name) IN (lower($2), lower($3))
+		  AND (country_code IS NULL OR country_code = $4)
+		UNION ALL
+		SELECT a.city_id FROM city_aliases a
+		JOIN cities c ON c.id = a.city_id
+		WHERE c.geoname_id IS NULL AND lower(a.old_name) IN (lower($2), lower($3))
+		LIMIT 1
+	`, g.ID, g.Name, g.ASCIIName, g.Country).Scan(&id)
+
+	inserted := false
+	switch {
+	case err == sql.ErrNoRows:
+		slug, err := uniqueSlug(ctx, tx, "city", slugify(g.ASCIIName), 0)
+		if err != nil {
+			return false, err
+		}
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO cities (name, slug, geoname_id, country_code, latitude, longitude, population)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)
+		`, g.Name, slug, g.ID, g.Country, g.Latitude, g.Longitude, g.Population)
+		if err != nil {
+			return false, err
+		}
+		inserted = true
+	case err != nil:
+		return false, err
+	default:
+		_, err = tx.ExecContext(ctx, `
+			UPDATE cities
+			SET geoname_id = $2, country_code = COALESCE(country_code, $3),
+			    latitude = $4, longitude = $5, population = $6
+			WHERE id = $1
+		`, id, g.ID, g.Country, g.Latitude, g.Longitude, g.Population)
+		if err != nil {
+			return false, err
+		}
+	}
+	return inserted, tx.Commit()
+}
+
+// runImportGeoNames — команда import-geonames.
+func runImportGeoNames(args []string) error {
+	fs := flag.NewFlagSet("import-geonames", flag.ExitOnError)
+	file := fs.String("file", "", "local GeoNames dump (default: download per-country archives)")
+	countries := fs.String("countries", "", "comma-separated ISO country codes, e.g. RU,BY")
+	minPopulation := fs.Int64("min-population", 15000, "skip places with a smaller population")
+	fs.Parse(args)
+
+	opts := GeoNamesImport{File: *file, MinPopulation: *minPopulation}
+	for _, cc := range strings.Split(*countries, ",") {
+		if cc = strings.ToUpper(strings.TrimSpace(cc)); cc != "" {
+			opts.Countries = append(opts.Countries, cc)
+		}
+	}
+
+	if err := bootstrap(); err != nil {
+		return err
+	}
+	defer db.Close()
+
+	result, err := runGeoNamesImport(context.Background(), opts, func(p interface{}) {
+		fmt.Fprintf(os.Stderr, "%+v\n", p)
+	})
+	if result != nil {
+		fmt.Fprintf(os.Stderr, "done: %+v\n", *result)
+	}
+	return err
+}
+
+// startGeoNamesImport — HTTP-обработчик, запускающий импорт фоновой задачей.
+// Реагирует на POST /api/admin/imports/geonames с телом {"countries": ["RU"], "min_population": 50000}.
+// Через API доступна только загрузка с download.geonames.org: читать произвольные
+// файлы сервера по запросу нельзя.
+func startGeoNamesImport(c *gin.Context) {
+	var opts GeoNamesImport
+	if err := c.ShouldBindJSON(&opts); err != nil {
+		c.JSON(http.StatusBadRequest, Response{Success: false, Error: err.Error()})
+		return
+	}
+	if len(opts.Countries) == 0 {
+		c.JSON(http.StatusBadRequest, Response{Success: false, Error: "countries are required"})
+		return
+	}
+	for i, cc := range opts.Countries {
+		opts.Countries[i] = strings.ToUpper(cc)
+		if !countryCodeRe.MatchString(opts.Countries[i]) {
+			c.JSON(http.StatusBadRequest, Response{Success: false, Error: fmt.Sprintf("invalid country code %q", cc)})
+			return
+		}
+	}
+
+	job := jobs.start("geonames-import", func(progress func(interface{})) (interface{}, error) {
+		return runGeoNamesImport(context.Background(), opts, progress)
+	})
+	c.JSON(http.StatusAccepted, Response{
+		Success: true,
+		Data:    job,
+		Count:   1,
+	})
+}
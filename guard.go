@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Ограничители размера ответа для списочных эндпоинтов.
+//
+// Клиент, забывший сузить выборку, не должен получить ответ на сотни мегабайт:
+// это бьёт и по серверу (память, сеть), и по самому клиенту. Поэтому список,
+// превышающий MAX_LIST_ROWS строк или MAX_LIST_BYTES байт сериализованного JSON,
+// не отдаётся — вместо него возвращается 400 с подсказкой.
+// Значение 0 отключает соответствующую проверку. Лимиты берутся из настроек (см. settings.go).
+
+// respondList отдаёт список в стандартной обёртке Response, предварительно проверив его размер.
+// partial помечает неполный список (см. rowSet в scan.go).
+func respondList(c *gin.Context, data interface{}, count int, partial bool) {
+	writeList(c, Response{
+		Success: true,
+		Data:    data,
+		Count:   count,
+		Partial: partial,
+	})
+}
+
+// writeList проверяет размер готового ответа со списком и отправляет его.
+// Ответ сериализуется один раз: те же байты и проверяются, и уходят клиенту.
+func writeList(c *gin.Context, resp Response) {
+	maxListRows, maxListBytes := settings().MaxListRows, settings().MaxListBytes
+	if maxListRows > 0 && resp.Count > maxListRows {
+		rejectOversizedList(c, fmt.Sprintf("result has %d rows, the limit is %d", resp.Count, maxListRows))
+		return
+	}
+
+	body, err := json.Marshal(resp)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+	if maxListBytes > 0 && len(body) > maxListBytes {
+		rejectOversizedList(c, fmt.Sprintf("result is %d bytes, the limit is %d", len(body), maxListBytes))
+		return
+	}
+
+	c.Data(http.StatusOK, "application/json; charset=utf-8", body)
+}
+
+// rejectOversizedList отвечает 400 с объяснением, почему список не отдан.
+func rejectOversizedList(c *gin.Context, reason string) {
+	c.JSON(http.StatusBadRequest, Response{
+		Success: false,
+		Error:   "response too large: " + reason,
+		Hint:    "narrow the request or fetch it in pages (?page=&per_page= where supported); server limits are set by MAX_LIST_ROWS and MAX_LIST_BYTES",
+	})
+}
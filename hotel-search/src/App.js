@@ -493,7 +493,7 @@ export default function HotelSearch() {
                             borderRadius: '20px',
                             fontWeight: 'bold'
                           }}>
-                            ${hotel.price.toFixed(2)}
+                            {hotel.price == null ? '—' : `$${hotel.price.toFixed(2)}`}
                           </span>
                         </td>
                       </tr>
@@ -0,0 +1,453 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Гостиница по id, создание и изменение гостиниц через публичный API.
+//
+// Писать могут только пользователи с ролью admin (см. requireRole): партнёр с API-ключом
+// действует с ролью apiKeyRole и получает 403. Новая гостиница заводится черновиком
+// (см. hotelstatus.go) и в публичных списках не видна, пока администратор её
+// не опубликует; недостающие поля можно заполнить позже.
+// Изменение названия попадает в историю правок, изменение цены — в расписание
+// цен и журнал price_audit. Удаление мягкое (hotels.deleted_at): удалённая
+// гостиница исчезает из публичных эндпоинтов, но её можно восстановить.
+
+// maxHotelNameLength — максимальная длина названия гостиницы.
+const maxHotelNameLength = 200
+
+// HotelInput — поля гостиницы, которые задаёт клиент.
+type HotelInput struct {
+	Name     string   `json:"name"`
+	CityID   *int     `json:"city_id"`
+	Capacity *int     `json:"capacity"`
+	Price    *float64 `json:"price"`
+}
+
+// validate приводит название к виду без лишних пробелов и проверяет значения.
+func (in *HotelInput) validate() error {
+	in.Name = strings.TrimSpace(in.Name)
+	if in.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if len([]rune(in.Name)) > maxHotelNameLength {
+		return fmt.Errorf("name must be at most %d characters", maxHotelNameLength)
+	}
+	if in.CityID != nil && *in.CityID <= 0 {
+		return fmt.Errorf("city_id must be a positive integer")
+	}
+	if in.Capacity != nil && *in.Capacity < 1 {
+		return fmt.Errorf("capacity must be at least 1")
+	}
+	if in.Price != nil && *in.Price < 0 {
+		return fmt.Errorf("price must not be negative")
+	}
+	return nil
+}
+
+// cityExists проверяет, что город id есть в справочнике.
+func cityExists(ctx context.Context, tx *sql.Tx, id int) (bool, error) {
+	var exists bool
+	err := tx.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM cities WHERE id = $1)", id).Scan(&exists)
+	return exists, err
+}
+
+// hotelCacheKey — ключ карточки гостиницы id в кэше. Ключ вложен в "hotels", поэтому
+// изменения, сбрасывающие список гостиниц (cache.flush("hotels")), сбрасывают и карточку.
+func hotelCacheKey(id int) string {
+	return fmt.Sprintf("hotels:%d", id)
+}
+
+// getHotel — HTTP-обработчик, возвращающий опубликованную гостиницу по id.
+// Реагирует на GET /api/hotels/:id
+//
+// Карточка отдаётся из кэша по политике HotelCache (см. cache.go, settings.go);
+// заголовок X-Cache сообщает, откуда она взята.
+func getHotel(c *gin.Context) {
+	id, ok := hotelIDParam(c)
+	if !ok {
+		return
+	}
+	strict := strictScan(c)
+	value, status, err := cache.get(c.Request.Context(), hotelCacheKey(id), settings().HotelCache, func(ctx context.Context) (interface{}, error) {
+		return loadHotelCard(ctx, strict, hotelSelect+" WHERE h.id = $1 AND "+publishedHotel, id)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	c.Header("X-Cache", status)
+	set := value.(rowSet[Hotel])
+	if len(set.Items) == 0 {
+		c.JSON(http.StatusNotFound, Response{Success: false, Error: "hotel not found"})
+		return
+	}
+	respondHotel(c, set.Items[0])
+}
+
+// loadHotelCard читает опубликованную гостиницу запросом query (построенным на hotelSelect)
+// вместе с описанием; пустой набор — такой гостиницы нет.
+func loadHotelCard(ctx context.Context, strict bool, query string, args ...interface{}) (rowSet[Hotel], error) {
+	set, err := queryHotels(ctx, strict, query, args...)
+	if err != nil || len(set.Items) == 0 {
+		return set, err
+	}
+	// Описание в hotelSelect не входит, чтобы не раздувать списки.
+	err = db.QueryRowContext(ctx, "SELECT description FROM hotels WHERE id = $1", set.Items[0].ID).Scan(&set.Items[0].Description)
+	if err != nil {
+		return rowSet[Hotel]{}, err
+	}
+	return set, nil
+}
+
+// respondHotel отдаёт карточку гостиницы (см. loadHotelCard) без атрибутов чужих тенантов.
+func respondHotel(c *gin.Context, hotel Hotel) {
+	items, ok := applyAttributes(c, []Hotel{hotel})
+	if !ok {
+		return
+	}
+	if len(items) == 0 {
+		c.JSON(http.StatusNotFound, Response{Success: false, Error: "hotel not found"})
+		return
+	}
+	c.JSON(http.StatusOK, Response{
+		Success: true,
+		Data:    items[0],
+		Count:   1,
+	})
+}
+
+// createHotel — HTTP-обработчик создания гостиницы.
+// Реагирует на POST /api/hotels с телом {"name": "Grand Hotel Europe", "city_id": 1, "capacity": 120, "price": 15000};
+// отвечает 201 с созданной гостиницей (черновиком).
+func createHotel(c *gin.Context) {
+	var in HotelInput
+	if err := c.ShouldBindJSON(&in); err != nil {
+		c.JSON(http.StatusBadRequest, Response{Success: false, Error: err.Error()})
+		return
+	}
+	if err := in.validate(); err != nil {
+		c.JSON(http.StatusBadRequest, Response{Success: false, Error: err.Error()})
+		return
+	}
+
+	tx, err := db.BeginTx(c.Request.Context(), nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	if in.CityID != nil {
+		ok, err := cityExists(c.Request.Context(), tx, *in.CityID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+			return
+		}
+		if !ok {
+			c.JSON(http.StatusUnprocessableEntity, Response{Success: false, Error: fmt.Sprintf("city %d not found", *in.CityID)})
+			return
+		}
+	}
+
+	var id int
+	err = tx.QueryRowContext(c.Request.Context(), `
+		INSERT INTO hotels (name, city, capacity, price, status)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id
+	`, in.Name, in.CityID, in.Capacity, in.Price, hotelDraft).Scan(&id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	// slug присваиваем сразу, чтобы у гостиницы с первого дня был постоянный адрес.
+	if _, err := assignSlugIn(c.Request.Context(), tx, "hotel", id, slugify(in.Name)); err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+
+	c.Header("Location", fmt.Sprintf("/api/hotels/%d", id))
+	set, err := queryHotels(c.Request.Context(), true, hotelSelect+" WHERE h.id = $1", id)
+	if err != nil || len(set.Items) == 0 {
+		// Гостиница уже создана: не прячем это от клиента из-за ошибки повторного чтения.
+		c.JSON(http.StatusCreated, Response{Success: true, Data: gin.H{"id": id}, Count: 1})
+		return
+	}
+	c.JSON(http.StatusCreated, Response{Success: true, Data: set.Items[0], Count: 1})
+}
+
+// updateHotel — HTTP-обработчик изменения гостиницы.
+// Реагирует на PUT /api/hotels/:id (полная замена: неуказанные поля очищаются)
+// и PATCH /api/hotels/:id (меняются только переданные поля, например {"price": 16000});
+// отвечает обновлённой гостиницей.
+func updateHotel(c *gin.Context) {
+	id, ok := hotelIDParam(c)
+	if !ok {
+		return
+	}
+	var fields map[string]json.RawMessage
+	if err := c.ShouldBindJSON(&fields); err != nil {
+		c.JSON(http.StatusBadRequest, Response{Success: false, Error: err.Error()})
+		return
+	}
+
+	tx, err := db.BeginTx(c.Request.Context(), nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	// Текущие значения нужны и для PATCH (основа), и для сравнения цены.
+	var cur HotelInput
+	var status string
+	err = tx.QueryRowContext(c.Request.Context(), `
+		SELECT h.name, h.city, h.capacity, COALESCE(p.price, h.price::numeric), h.status
+		FROM hotels h
+		LEFT JOIN LATERAL (`+effectivePriceQuery+`) p ON true
+		WHERE h.id = $1 AND h.deleted_at IS NULL
+		FOR UPDATE OF h
+	`, id).Scan(&cur.Name, &cur.CityID, &cur.Capacity, &cur.Price, &status)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, Response{Success: false, Error: "hotel not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+
+	in := HotelInput{}
+	if c.Request.Method == http.MethodPatch {
+		in = cur
+	}
+	targets := map[string]interface{}{"name": &in.Name, "city_id": &in.CityID, "capacity": &in.Capacity, "price": &in.Price}
+	for key, raw := range fields {
+		dst, ok := targets[key]
+		if !ok {
+			c.JSON(http.StatusBadRequest, Response{Success: false, Error: fmt.Sprintf("unknown field %q", key)})
+			return
+		}
+		if err := json.Unmarshal(raw, dst); err != nil {
+			c.JSON(http.StatusBadRequest, Response{Success: false, Error: fmt.Sprintf("%s: %v", key, err)})
+			return
+		}
+	}
+	if err := in.validate(); err != nil {
+		c.JSON(http.StatusBadRequest, Response{Success: false, Error: err.Error()})
+		return
+	}
+	if status != hotelDraft && !hotelComplete(Hotel{CityID: in.CityID, Capacity: in.Capacity, Price: in.Price}) {
+		c.JSON(http.StatusUnprocessableEntity, Response{
+			Success: false,
+			Error:   "hotel is " + status + " and must keep city, capacity and price",
+			Hint:    "move the hotel back to draft before clearing these fields",
+		})
+		return
+	}
+	if in.Price == nil && cur.Price != nil {
+		// Цена живёт в расписании hotel_prices; «убрать» её оттуда задним числом нельзя.
+		c.JSON(http.StatusUnprocessableEntity, Response{Success: false, Error: "price cannot be cleared once set"})
+		return
+	}
+	if in.Capacity != nil && (cur.Capacity == nil || *in.Capacity < *cur.Capacity) {
+		// Строка гостиницы заблокирована, поэтому новые бронирования не появятся до конца транзакции.
+		peak, err := peakBookedGuests(c.Request.Context(), tx, id, bookingToday())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+			return
+		}
+		if *in.Capacity < peak {
+			c.JSON(http.StatusConflict, Response{
+				Success: false,
+				Error:   fmt.Sprintf("capacity cannot be below %d: that many guests are already booked for one night", peak),
+				Hint:    "cancel or move bookings before reducing capacity",
+			})
+			return
+		}
+	}
+	if in.CityID != nil && (cur.CityID == nil || *cur.CityID != *in.CityID) {
+		ok, err := cityExists(c.Request.Context(), tx, *in.CityID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+			return
+		}
+		if !ok {
+			c.JSON(http.StatusUnprocessableEntity, Response{Success: false, Error: fmt.Sprintf("city %d not found", *in.CityID)})
+			return
+		}
+	}
+
+	// Название — через историю правок (см. revisions.go).
+	if _, err := setHotelText(c, tx, id, "name", &in.Name); err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	if _, err := tx.ExecContext(c.Request.Context(), "UPDATE hotels SET city = $2, capacity = $3 WHERE id = $1", id, in.CityID, in.Capacity); err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	// Цена — новой записью расписания с текущего момента и записью в журнале цен,
+	// как при массовом изменении (см. bulkprices.go): иначе её перекрыла бы запись расписания.
+	if in.Price != nil && (cur.Price == nil || *cur.Price != *in.Price) {
+		for _, q := range []struct {
+			sql  string
+			args []interface{}
+		}{
+			{`INSERT INTO hotel_prices (hotel_id, price, effective_from) VALUES ($1, $2, now())
+			  ON CONFLICT (hotel_id, effective_from) DO UPDATE SET price = EXCLUDED.price, created_at = now()`,
+				[]interface{}{id, *in.Price}},
+			{`INSERT INTO price_audit (hotel_id, old_price, new_price, effective_from, request_id)
+			  VALUES ($1, $2, $3, now(), $4)`, []interface{}{id, cur.Price, *in.Price, c.GetString("request_id")}},
+		} {
+			if _, err := tx.ExecContext(c.Request.Context(), q.sql, q.args...); err != nil {
+				c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+				return
+			}
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	cache.flush("hotels")
+
+	set, err := queryHotels(c.Request.Context(), true, hotelSelect+" WHERE h.id = $1", id)
+	if err != nil || len(set.Items) == 0 {
+		c.JSON(http.StatusOK, Response{Success: true, Data: gin.H{"id": id}, Count: 1})
+		return
+	}
+	c.JSON(http.StatusOK, Response{Success: true, Data: set.Items[0], Count: 1})
+}
+
+// hotelHardDeletes — что удаляется вместе с гостиницей при окончательном удалении, по порядку
+// (зависимые записи раньше самой гостиницы). События аналитики остаются, но теряют ссылку на неё.
+var hotelHardDeletes = []string{
+	"DELETE FROM promotion_stats WHERE promotion_id IN (SELECT id FROM promotions WHERE hotel_id = $1)",
+	"DELETE FROM promotions WHERE hotel_id = $1",
+	"DELETE FROM checkin_audit WHERE hotel_id = $1",
+	"DELETE FROM booking_guests WHERE booking_id IN (SELECT id FROM bookings WHERE hotel_id = $1)",
+	"DELETE FROM booking_shares WHERE booking_id IN (SELECT id FROM bookings WHERE hotel_id = $1)",
+	"DELETE FROM bookings WHERE hotel_id = $1",
+	"DELETE FROM price_alerts WHERE hotel_id = $1",
+	"DELETE FROM qa_votes WHERE entity = 'answer' AND entity_id IN " +
+		"(SELECT a.id FROM hotel_answers a JOIN hotel_questions q ON q.id = a.question_id WHERE q.hotel_id = $1)",
+	"DELETE FROM qa_votes WHERE entity = 'question' AND entity_id IN (SELECT id FROM hotel_questions WHERE hotel_id = $1)",
+	"DELETE FROM hotel_answers WHERE question_id IN (SELECT id FROM hotel_questions WHERE hotel_id = $1)",
+	"DELETE FROM hotel_questions WHERE hotel_id = $1",
+	"DELETE FROM hotel_poi_distances WHERE hotel_id = $1",
+	"DELETE FROM hotel_prices WHERE hotel_id = $1",
+	"DELETE FROM price_audit WHERE hotel_id = $1",
+	"DELETE FROM hotel_revisions WHERE hotel_id = $1",
+	"DELETE FROM slug_history WHERE entity = 'hotel' AND entity_id = $1",
+	"DELETE FROM short_links WHERE entity = 'hotel' AND entity_id = $1",
+	"DELETE FROM partner_mappings WHERE entity = 'hotel' AND internal_id = $1",
+	"UPDATE events SET hotel_id = NULL WHERE hotel_id = $1",
+	"DELETE FROM hotels WHERE id = $1",
+}
+
+// deleteHotel возвращает HTTP-обработчик удаления гостиницы.
+// Реагирует на DELETE /api/hotels/:id: гостиница помечается удалённой (deleted_at) и пропадает
+// из публичных эндпоинтов, но остаётся в БД и может быть восстановлена. С allowHard (только
+// в админском API, DELETE /api/admin/hotels/:id?hard=true) гостиница удаляется окончательно
+// вместе со своими ценами, вопросами, ревизиями и ссылками.
+func deleteHotel(allowHard bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := hotelIDParam(c)
+		if !ok {
+			return
+		}
+		hard := c.Query("hard") == "true"
+		if hard && !allowHard {
+			c.JSON(http.StatusForbidden, Response{
+				Success: false,
+				Error:   "hard delete is only available to administrators",
+				Hint:    "use DELETE /api/admin/hotels/:id?hard=true on the admin API",
+			})
+			return
+		}
+
+		if !hard {
+			var deletedAt time.Time
+			err := db.QueryRowContext(c.Request.Context(), `
+				UPDATE hotels SET deleted_at = now()
+				WHERE id = $1 AND deleted_at IS NULL
+				RETURNING deleted_at
+			`, id).Scan(&deletedAt)
+			if err == sql.ErrNoRows {
+				c.JSON(http.StatusNotFound, Response{Success: false, Error: "hotel not found"})
+				return
+			}
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+				return
+			}
+			cache.flush("hotels")
+			c.JSON(http.StatusOK, Response{Success: true, Data: gin.H{"id": id, "deleted_at": deletedAt}, Count: 1})
+			return
+		}
+
+		tx, err := db.BeginTx(c.Request.Context(), nil)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+			return
+		}
+		defer tx.Rollback()
+
+		err = tx.QueryRowContext(c.Request.Context(), "SELECT id FROM hotels WHERE id = $1 FOR UPDATE", id).Scan(&id)
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, Response{Success: false, Error: "hotel not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+			return
+		}
+		for _, stmt := range hotelHardDeletes {
+			if _, err := tx.ExecContext(c.Request.Context(), stmt, id); err != nil {
+				c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+				return
+			}
+		}
+		if err := tx.Commit(); err != nil {
+			c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+			return
+		}
+		cache.flush("hotels", promotionsCacheKey)
+		forgetAvailability(id)
+		c.JSON(http.StatusOK, Response{Success: true, Data: gin.H{"id": id, "hard": true}, Count: 1})
+	}
+}
+
+// restoreHotel — HTTP-обработчик восстановления гостиницы, удалённой через DELETE /api/hotels/:id.
+// Реагирует на POST /api/admin/hotels/:id/restore
+func restoreHotel(c *gin.Context) {
+	id, ok := hotelIDParam(c)
+	if !ok {
+		return
+	}
+	res, err := db.ExecContext(c.Request.Context(), "UPDATE hotels SET deleted_at = NULL WHERE id = $1 AND deleted_at IS NOT NULL", id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		c.JSON(http.StatusNotFound, Response{Success: false, Error: "deleted hotel not found"})
+		return
+	}
+	cache.flush("hotels")
+	c.JSON(http.StatusOK, Response{Success: true, Data: gin.H{"id": id}, Count: 1})
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Жизненный цикл карточки гостиницы.
+//
+// Статус хранится в hotels.status (NOT NULL DEFAULT 'draft'):
+//
+//	draft ──submit──> pending_review ──approve──> published ──archive──> archived
+//	  ^                     │                                               │
+//	  └──────reject─────────┘                                               │
+//	  └───────────────────────────────restore───────────────────────────────┘
+//
+// Публичные эндпоинты показывают только published, причём с заданным publish_at —
+// не раньше этого момента (см. schedule.go). На проверку и в публикацию
+// переводится только полностью заполненная карточка (город, вместимость, цена).
+// Переходы выполняет администратор через POST /api/admin/hotels/:id/status.
+
+// Статусы гостиницы.
+const (
+	hotelDraft         = "draft"
+	hotelPendingReview = "pending_review"
+	hotelPublished     = "published"
+	hotelArchived      = "archived"
+)
+
+// hotelTransitions — допустимые переходы: из статуса → в статусы.
+var hotelTransitions = map[string][]string{
+	hotelDraft:         {hotelPendingReview},
+	hotelPendingReview: {hotelPublished, hotelDraft},
+	hotelPublished:     {hotelArchived},
+	hotelArchived:      {hotelDraft},
+}
+
+// canTransition сообщает, разрешён ли переход from → to.
+func canTransition(from, to string) bool {
+	for _, s := range hotelTransitions[from] {
+		if s == to {
+			return true
+		}
+	}
+	return false
+}
+
+// hotelComplete сообщает, заполнены ли у гостиницы поля, без которых её нельзя показывать.
+func hotelComplete(h Hotel) bool {
+	return h.CityID != nil && h.Capacity != nil && h.Price != nil
+}
+
+// adminHotelsQuery — список гостиниц в любом статусе; $1 — фильтр по статусу (пустая строка — все).
+const adminHotelsQuery = hotelSelect + `
+	WHERE $1 = '' OR h.status = $1
+	ORDER BY h.name
+`
+
+// getAdminHotels — HTTP-обработчик списка гостиниц для администраторов.
+// Реагирует на GET /api/admin/hotels?status=draft|pending_review|published|archived
+// (без status — все гостиницы).
+func getAdminHotels(c *gin.Context) {
+	status := c.Query("status")
+	if _, ok := hotelTransitions[status]; status != "" && !ok {
+		c.JSON(http.StatusBadRequest, Response{Success: false, Error: fmt.Sprintf("unknown status %q", status)})
+		return
+	}
+
+	set, err := queryHotels(c.Request.Context(), strictScan(c), adminHotelsQuery, status)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+	respondList(c, set.Items, len(set.Items), set.Partial)
+}
+
+// setHotelStatus — HTTP-обработчик смены статуса гостиницы.
+// Реагирует на POST /api/admin/hotels/:id/status с телом {"status": "published"}.
+func setHotelStatus(c *gin.Context) {
+	id, ok := hotelIDParam(c)
+	if !ok {
+		return
+	}
+	var body struct {
+		Status string `json:"status"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, Response{Success: false, Error: err.Error()})
+		return
+	}
+
+	var h Hotel
+	err := db.QueryRowContext(c.Request.Context(), "SELECT id, city, capacity, price::numeric, status FROM hotels WHERE id = $1", id).
+		Scan(&h.ID, &h.CityID, &h.Capacity, &h.Price, &h.Status)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, Response{Success: false, Error: "hotel not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+
+	if !canTransition(h.Status, body.Status) {
+		c.JSON(http.StatusConflict, Response{
+			Success: false,
+			Error:   fmt.Sprintf("cannot change status from %s to %s", h.Status, body.Status),
+			Hint:    fmt.Sprintf("allowed from %s: %v", h.Status, hotelTransitions[h.Status]),
+		})
+		return
+	}
+	if (body.Status == hotelPendingReview || body.Status == hotelPublished) && !hotelComplete(h) {
+		c.JSON(http.StatusUnprocessableEntity, Response{
+			Success: false,
+			Error:   "hotel is incomplete",
+			Hint:    "set city, capacity and price before submitting the hotel for review",
+		})
+		return
+	}
+
+	// Условие на прежний статус защищает от гонки двух администраторов.
+	res, err := db.ExecContext(c.Request.Context(), "UPDATE hotels SET status = $2 WHERE id = $1 AND status = $3", id, body.Status, h.Status)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		c.JSON(http.StatusConflict, Response{Success: false, Error: "hotel status was changed concurrently, retry"})
+		return
+	}
+	// Публичный список должен сразу отразить публикацию или снятие с публикации.
+	cache.flush("hotels")
+
+	h.Status = body.Status
+	c.JSON(http.StatusOK, Response{
+		Success: true,
+		Data:    gin.H{"id": id, "status": h.Status},
+		Count:   1,
+	})
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+// Советник по индексам.
+//
+// Раз в indexReportInterval фоновая задача читает статистику PostgreSQL
+// (pg_stat_user_tables, pg_stat_user_indexes и, если установлено расширение,
+// pg_stat_statements) по таблицам, с которыми работают наши основные запросы,
+// и собирает отчёт: где таблицы читаются последовательным сканированием,
+// какие индексы ни разу не использовались и какие запросы самые дорогие.
+// Последний отчёт отдаётся через GET /api/admin/index-report.
+
+// indexReportInterval — период пересчёта отчёта.
+const indexReportInterval = time.Hour
+
+// seqScanRowsThreshold — таблицы меньше этого размера читать целиком нормально,
+// индекс для них не предлагаем.
+const seqScanRowsThreshold = 1000
+
+// advisedTables — таблицы, которые затрагивают листинги и проверка API-ключей.
+var advisedTables = []string{"cities", "hotels", "tenants", "api_keys", "quota_usage", "tenant_quota_usage", "usage_rollups"}
+
+// TableScanStats — статистика обращений к таблице.
+type TableScanStats struct {
+	Table      string `json:"table"`
+	LiveRows   int64  `json:"live_rows"`
+	SeqScans   int64  `json:"seq_scans"`
+	SeqTupRead int64  `json:"seq_tuples_read"`
+	IdxScans   int64  `json:"idx_scans"`
+}
+
+// UnusedIndex — индекс, по которому с момента сброса статистики не было ни одного сканирования.
+type UnusedIndex struct {
+	Table     string `json:"table"`
+	Index     string `json:"index"`
+	SizeBytes int64  `json:"size_bytes"`
+}
+
+// StatementStats — агрегированная статистика запроса из pg_stat_statements.
+type StatementStats struct {
+	Query       string  `json:"query"`
+	Calls       int64   `json:"calls"`
+	MeanTimeMs  float64 `json:"mean_time_ms"`
+	TotalTimeMs float64 `json:"total_time_ms"`
+	Rows        int64   `json:"rows"`
+}
+
+// IndexReport — отчёт советника по индексам.
+type IndexReport struct {
+	GeneratedAt       time.Time        `json:"generated_at"`
+	Tables            []TableScanStats `json:"tables"`
+	UnusedIndexes     []UnusedIndex    `json:"unused_indexes"`
+	Statements        []StatementStats `json:"statements"`
+	StatementsEnabled bool             `json:"statements_enabled"`
+	Suggestions       []string         `json:"suggestions"`
+}
+
+// lastIndexReport хранит последний успешно собранный отчёт.
+var lastIndexReport struct {
+	sync.RWMutex
+	report *IndexReport
+}
+
+// buildIndexReport собирает отчёт по текущей статистике БД.
+func buildIndexReport(ctx context.Context) (*IndexReport, error) {
+	report := &IndexReport{
+		GeneratedAt:   time.Now().UTC(),
+		Tables:        []TableScanStats{},
+		UnusedIndexes: []UnusedIndex{},
+		Statements:    []StatementStats{},
+		Suggestions:   []string{},
+	}
+
+	rows, err := db.QueryContext(ctx, `
+		SELECT relname, n_live_tup, seq_scan, seq_tup_read, COALESCE(idx_scan, 0)
+		FROM pg_stat_user_tables
+		WHERE relname = ANY($1)
+		ORDER BY seq_tup_read DESC
+	`, pq.Array(advisedTables))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var t TableScanStats
+		if err := rows.Scan(&t.Table, &t.LiveRows, &t.SeqScans, &t.SeqTupRead, &t.IdxScans); err != nil {
+			log.Printf("Error scanning table stats: %v", err)
+			continue
+		}
+		report.Tables = append(report.Tables, t)
+		if t.LiveRows >= seqScanRowsThreshold && t.SeqScans > t.IdxScans {
+			report.Suggestions = append(report.Suggestions,
+				"table "+t.Table+" is mostly read by sequential scans: check the WHERE/JOIN/ORDER BY columns of its queries for a missing index")
+		}
+	}
+
+	// Уникальные индексы и первичные ключи не предлагаем удалять:
+	// они нужны для ограничений, даже если по ним никто не ищет.
+	idxRows, err := db.QueryContext(ctx, `
+		SELECT s.relname, s.indexrelname, pg_relation_size(s.indexrelid)
+		FROM pg_stat_user_indexes s
+		JOIN pg_index i ON i.indexrelid = s.indexrelid
+		WHERE s.relname = ANY($1) AND s.idx_scan = 0 AND NOT i.indisunique
+		ORDER BY pg_relation_size(s.indexrelid) DESC
+	`, pq.Array(advisedTables))
+	if err != nil {
+		return nil, err
+	}
+	defer idxRows.Close()
+	for idxRows.Next() {
+		var u UnusedIndex
+		if err := idxRows.Scan(&u.Table, &u.Index, &u.SizeBytes); err != nil {
+			log.Printf("Error scanning index stats: %v", err)
+			continue
+		}
+		report.UnusedIndexes = append(report.UnusedIndexes, u)
+		report.Suggestions = append(report.Suggestions,
+			"index "+u.Index+" on "+u.Table+" has never been used: consider dropping it")
+	}
+
+	// pg_stat_statements — необязательное расширение; без него отчёт просто беднее.
+	if err := db.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM pg_extension WHERE extname = 'pg_stat_statements')").
+		Scan(&report.StatementsEnabled); err != nil {
+		return nil, err
+	}
+	if report.StatementsEnabled {
+		stRows, err := db.QueryContext(ctx, `
+			SELECT query, calls, mean_exec_time, total_exec_time, rows
+			FROM pg_stat_statements
+			WHERE query ~* ('\m(' || array_to_string($1::text[], '|') || ')\M')
+			ORDER BY total_exec_time DESC
+			LIMIT 20
+		`, pq.Array(advisedTables))
+		if err != nil {
+			return nil, err
+		}
+		defer stRows.Close()
+		for stRows.Next() {
+			var s StatementStats
+			if err := stRows.Scan(&s.Query, &s.Calls, &s.MeanTimeMs, &s.TotalTimeMs, &s.Rows); err != nil {
+				log.Printf("Error scanning statement stats: %v", err)
+				continue
+			}
+			report.Statements = append(report.Statements, s)
+		}
+	} else {
+		report.Suggestions = append(report.Suggestions,
+			"install the pg_stat_statements extension to include per-query timings in this report")
+	}
+
+	return report, nil
+}
+
+// refreshIndexReport пересобирает отчёт и сохраняет его как последний.
+func refreshIndexReport(ctx context.Context) (*IndexReport, error) {
+	report, err := buildIndexReport(ctx)
+	if err != nil {
+		return nil, err
+	}
+	lastIndexReport.Lock()
+	lastIndexReport.report = report
+	lastIndexReport.Unlock()
+	return report, nil
+}
+
+// runIndexAdvisor периодически пересобирает отчёт до отмены ctx. Запускается в отдельной горутине.
+func runIndexAdvisor(ctx context.Context) {
+	ticker := time.NewTicker(indexReportInterval)
+	defer ticker.Stop()
+	for {
+		if _, err := refreshIndexReport(ctx); err != nil {
+			log.Printf("Error building index report: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// getIndexReport — HTTP-обработчик, отдающий последний отчёт советника по индексам.
+// Реагирует на GET /api/admin/index-report; с ?refresh=true пересобирает отчёт немедленно.
+func getIndexReport(c *gin.Context) {
+	lastIndexReport.RLock()
+	report := lastIndexReport.report
+	lastIndexReport.RUnlock()
+
+	if report == nil || c.Query("refresh") == "true" {
+		var err error
+		if report, err = refreshIndexReport(c.Request.Context()); err != nil {
+			c.JSON(http.StatusInternalServerError, Response{
+				Success: false,
+				Error:   err.Error(),
+			})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, Response{
+		Success: true,
+		Data:    report,
+		Count:   1,
+	})
+}
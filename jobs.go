@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Реестр фоновых административных задач (резервное копирование, восстановление и т. п.).
+//
+// Долгие операции нельзя выполнять внутри HTTP-запроса: их запускают в горутине,
+// клиенту сразу отдают описание задачи, а состояние потом опрашивают через
+// GET /api/admin/jobs/:id. Реестр живёт в памяти процесса и хранит последние
+// maxJobs задач — после перезапуска история пропадает, результаты самих задач
+// (например, файлы резервных копий) остаются на месте.
+
+// maxJobs — сколько последних задач хранится в реестре.
+const maxJobs = 100
+
+// Состояния задачи.
+const (
+	jobRunning   = "running"
+	jobSucceeded = "succeeded"
+	jobFailed    = "failed"
+)
+
+// Job — фоновая задача и её состояние.
+type Job struct {
+	ID         string      `json:"id"`
+	Kind       string      `json:"kind"`
+	Status     string      `json:"status"`
+	StartedAt  time.Time   `json:"started_at"`
+	FinishedAt *time.Time  `json:"finished_at"`
+	Error      string      `json:"error,omitempty"`
+	Progress   interface{} `json:"progress,omitempty"`
+	Result     interface{} `json:"result,omitempty"`
+}
+
+// jobRegistry — потокобезопасный реестр задач.
+type jobRegistry struct {
+	mu    sync.Mutex
+	seq   int
+	order []string
+	jobs  map[string]*Job
+	// running — незавершённые задачи, их дожидается остановка сервера (см. wait).
+	running sync.WaitGroup
+}
+
+var jobs = &jobRegistry{jobs: map[string]*Job{}}
+
+// start регистрирует задачу вида kind и запускает run в отдельной горутине.
+// Через progress задача может сообщать промежуточное состояние (оно видно в GET /api/admin/jobs/:id).
+// Возвращает копию описания задачи на момент запуска.
+func (r *jobRegistry) start(kind string, run func(progress func(interface{})) (interface{}, error)) Job {
+	r.mu.Lock()
+	r.seq++
+	job := &Job{
+		ID:        fmt.Sprintf("%s-%d", kind, r.seq),
+		Kind:      kind,
+		Status:    jobRunning,
+		StartedAt: time.Now().UTC(),
+	}
+	r.jobs[job.ID] = job
+	r.order = append(r.order, job.ID)
+	if len(r.order) > maxJobs {
+		delete(r.jobs, r.order[0])
+		r.order = r.order[1:]
+	}
+	snapshot := *job
+	r.mu.Unlock()
+
+	progress := func(p interface{}) {
+		r.mu.Lock()
+		job.Progress = p
+		r.mu.Unlock()
+	}
+	r.running.Add(1)
+	go func() {
+		defer r.running.Done()
+		result, err := run(progress)
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		finished := time.Now().UTC()
+		job.FinishedAt = &finished
+		job.Result = result
+		if err != nil {
+			log.Printf("Job %s failed: %v", job.ID, err)
+			job.Status = jobFailed
+			job.Error = err.Error()
+			return
+		}
+		job.Status = jobSucceeded
+	}()
+	return snapshot
+}
+
+// wait дожидается завершения начатых задач, но не дольше ctx.
+func (r *jobRegistry) wait(ctx context.Context) error {
+	if err := waitContext(ctx, &r.running); err != nil {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		var running []string
+		for _, id := range r.order {
+			if r.jobs[id].Status == jobRunning {
+				running = append(running, id)
+			}
+		}
+		return fmt.Errorf("jobs still running (%s): %w", strings.Join(running, ", "), err)
+	}
+	return nil
+}
+
+// get возвращает копию задачи по её идентификатору.
+func (r *jobRegistry) get(id string) (Job, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	job, ok := r.jobs[id]
+	if !ok {
+		return Job{}, false
+	}
+	return *job, true
+}
+
+// list возвращает копии всех задач, от новых к старым.
+func (r *jobRegistry) list() []Job {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := make([]Job, 0, len(r.order))
+	for i := len(r.order) - 1; i >= 0; i-- {
+		out = append(out, *r.jobs[r.order[i]])
+	}
+	return out
+}
+
+// getJobs — HTTP-обработчик, возвращающий список фоновых задач.
+// Реагирует на GET /api/admin/jobs
+func getJobs(c *gin.Context) {
+	list := jobs.list()
+	c.JSON(http.StatusOK, Response{
+		Success: true,
+		Data:    list,
+		Count:   len(list),
+	})
+}
+
+// getJob — HTTP-обработчик, возвращающий состояние одной задачи.
+// Реагирует на GET /api/admin/jobs/:id
+func getJob(c *gin.Context) {
+	job, ok := jobs.get(c.Param("id"))
+	if !ok {
+		c.JSON(http.StatusNotFound, Response{
+			Success: false,
+			Error:   "job not found",
+		})
+		return
+	}
+	c.JSON(http.StatusOK, Response{
+		Success: true,
+		Data:    job,
+		Count:   1,
+	})
+}
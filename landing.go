@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"sort"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Данные для SEO-страницы города одним запросом.
+//
+// Страница города раньше делала несколько запросов: город, список гостиниц города,
+// фасеты и статистику цен. GET /api/cities/:id/landing собирает всё это из уже
+// закэшированных списков городов, гостиниц и продвижений (см. cache.go), так что
+// на попадании в кэш к БД не обращается. Готовый ответ целиком не кэшируется:
+// он зависит от рынка клиента (см. markets.go) и видимых ему атрибутов. Зато
+// его можно кэшировать браузеру и CDN — как и виджет, он отдаётся с Cache-Control
+// (бронирование всё равно проверяет рынок, см. requireMarket).
+//
+// Фотографий и описаний у городов в схеме нет, поэтому в ответе их тоже нет.
+
+// landingTopHotels — сколько гостиниц показывать на странице города.
+const landingTopHotels = 10
+
+// PriceStats — статистика цен гостиниц с известной ценой.
+type PriceStats struct {
+	Count  int     `json:"count"`
+	Min    float64 `json:"min"`
+	Max    float64 `json:"max"`
+	Avg    float64 `json:"avg"`
+	Median float64 `json:"median"`
+}
+
+// CityLanding — ответ GET /api/cities/:id/landing.
+type CityLanding struct {
+	City City `json:"city"`
+	// HotelCount — сколько гостиниц города видно клиенту; TopHotels — первые из них
+	// в том же порядке, что и в GET /api/hotels?city_id= (со спонсорскими позициями).
+	HotelCount int     `json:"hotel_count"`
+	TopHotels  []Hotel `json:"top_hotels"`
+	// Prices — nil, если ни у одной гостиницы нет цены.
+	Prices *PriceStats `json:"prices"`
+	Facets []Facet     `json:"facets"`
+}
+
+// priceStats считает статистику цен; nil — цен нет.
+func priceStats(hotels []Hotel) *PriceStats {
+	var prices []float64
+	for _, h := range hotels {
+		if h.Price != nil {
+			prices = append(prices, *h.Price)
+		}
+	}
+	if len(prices) == 0 {
+		return nil
+	}
+	sort.Float64s(prices)
+	s := &PriceStats{Count: len(prices), Min: prices[0], Max: prices[len(prices)-1]}
+	var sum float64
+	for _, p := range prices {
+		sum += p
+	}
+	s.Avg = roundMoney(sum / float64(len(prices)))
+	if mid := len(prices) / 2; len(prices)%2 == 1 {
+		s.Median = prices[mid]
+	} else {
+		s.Median = roundMoney((prices[mid-1] + prices[mid]) / 2)
+	}
+	return s
+}
+
+// getCityLanding — HTTP-обработчик данных страницы города.
+// Реагирует на GET /api/cities/:id/landing; учитывает фильтры ?attr.<key>=<value>, как и список.
+func getCityLanding(c *gin.Context) {
+	id, ok := cityIDParam(c)
+	if !ok {
+		return
+	}
+	strict := strictScan(c)
+	cities, _, err := cache.get(c.Request.Context(), "cities", settings().CitiesCache, func(ctx context.Context) (interface{}, error) {
+		return loadCities(ctx, strict)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	var landing CityLanding
+	found := false
+	for _, city := range cities.(rowSet[City]).Items {
+		if city.ID == id {
+			landing.City, found = city, true
+			break
+		}
+	}
+	if !found {
+		c.JSON(http.StatusNotFound, Response{
+			Success: false,
+			Error:   "city not found",
+			Hint:    "if the city was merged, GET /api/cities/:id returns its new id",
+		})
+		return
+	}
+
+	hotels, status, err := cache.get(c.Request.Context(), "hotels", settings().HotelsCache, func(ctx context.Context) (interface{}, error) {
+		return loadHotels(ctx, strict)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	c.Header("X-Cache", status)
+
+	set := hotels.(rowSet[Hotel])
+	list := HotelFilter{CityID: &id}.apply(set.Items)
+	if promos, _, err := cache.get(c.Request.Context(), promotionsCacheKey, settings().HotelsCache, func(ctx context.Context) (interface{}, error) {
+		return loadActivePromotions(ctx, strict)
+	}); err != nil {
+		log.Printf("Error loading promotions: %v", err)
+	} else {
+		list = interleaveSponsored(list, scopePromotions(promos.([]Promotion), &id))
+	}
+	if list, ok = applyAttributes(c, list); !ok {
+		return
+	}
+	list = applyMarket(c, list)
+
+	landing.HotelCount = len(list)
+	landing.TopHotels = list[:min(len(list), landingTopHotels)]
+	landing.Prices = priceStats(list)
+	if landing.Facets, err = hotelFacets(c, list); err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, Response{Success: true, Data: landing, Count: 1, Partial: set.Partial})
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Адреса слушающих сокетов задаются флагами -addr, -admin-addr и -metrics-addr:
+//   - ":8080", "127.0.0.1:8080" — обычный TCP-адрес;
+//   - "unix:/run/wb/api.sock" — unix-сокет, например для nginx на той же машине;
+//   - "systemd" — первый сокет, открытый systemd (socket activation, см. sd_listen_fds(3));
+//   - "systemd:<name>" — сокет systemd с указанным FileDescriptorName= (нужно, когда их несколько).
+//
+// Обновление без простоя (флаг -reuseport): TCP-сокеты открываются с SO_REUSEPORT,
+// поэтому новая версия запускается на тех же портах, пока старая ещё работает,
+// и ядро распределяет новые соединения между обеими. Затем старому процессу
+// посылается SIGTERM: он закрывает свои сокеты, дожидается завершения начатых
+// запросов (не дольше SHUTDOWN_TIMEOUT, см. config.go) и выходит. Соединения,
+// успевшие попасть в очередь accept старого сокета, но не принятые им, при этом сбрасываются —
+// поэтому между запуском нового процесса и SIGTERM старому стоит выждать,
+// пока новый не ответит на /health.
+
+// systemdListenFDsStart — номер первого дескриптора, который systemd передаёт процессу.
+const systemdListenFDsStart = 3
+
+// unixSocketMode — права на файл unix-сокета: доступ для владельца и группы (например, nginx).
+const unixSocketMode = 0o660
+
+// listen открывает слушающий сокет по описанию из флага.
+func listen(spec string) (net.Listener, error) {
+	switch {
+	case spec == "systemd":
+		return systemdListener("")
+	case strings.HasPrefix(spec, "systemd:"):
+		return systemdListener(strings.TrimPrefix(spec, "systemd:"))
+	case strings.HasPrefix(spec, "unix:"):
+		return unixListener(strings.TrimPrefix(spec, "unix:"))
+	default:
+		lc := net.ListenConfig{}
+		if *reusePort {
+			lc.Control = setReusePort
+		}
+		return lc.Listen(context.Background(), "tcp", spec)
+	}
+}
+
+// unixListener слушает unix-сокет по указанному пути.
+// Файл, оставшийся от предыдущего запуска, удаляется: иначе bind завершится ошибкой.
+func unixListener(path string) (net.Listener, error) {
+	if path == "" {
+		return nil, errors.New("unix socket path is empty")
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, unixSocketMode); err != nil {
+		ln.Close()
+		return nil, err
+	}
+	return ln, nil
+}
+
+// systemdFDs — сокеты, переданные systemd; разбираются один раз, при первом обращении.
+var systemdFDs struct {
+	once  sync.Once
+	files []*os.File
+	names []string
+	err   error
+}
+
+// loadSystemdFDs читает LISTEN_PID/LISTEN_FDS/LISTEN_FDNAMES и запоминает переданные дескрипторы.
+func loadSystemdFDs() {
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		systemdFDs.err = errors.New("no sockets passed by systemd (LISTEN_PID does not match)")
+		return
+	}
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || n < 1 {
+		systemdFDs.err = errors.New("no sockets passed by systemd (LISTEN_FDS is empty)")
+		return
+	}
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+
+	// Переменные больше не нужны и не должны достаться дочерним процессам.
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+
+	for i := 0; i < n; i++ {
+		name := ""
+		if i < len(names) {
+			name = names[i]
+		}
+		systemdFDs.files = append(systemdFDs.files, os.NewFile(uintptr(systemdListenFDsStart+i), "systemd-socket-"+name))
+		systemdFDs.names = append(systemdFDs.names, name)
+	}
+}
+
+// systemdListener возвращает сокет, переданный systemd: с указанным именем
+// или, если имя пустое, первый по порядку.
+func systemdListener(name string) (net.Listener, error) {
+	systemdFDs.once.Do(loadSystemdFDs)
+	if systemdFDs.err != nil {
+		return nil, systemdFDs.err
+	}
+
+	for i, f := range systemdFDs.files {
+		if name != "" && systemdFDs.names[i] != name {
+			continue
+		}
+		ln, err := net.FileListener(f)
+		if err != nil {
+			return nil, fmt.Errorf("systemd socket %q: %w", name, err)
+		}
+		return ln, nil
+	}
+	return nil, fmt.Errorf("systemd did not pass a socket named %q", name)
+}
@@ -1,13 +1,23 @@
 package main
 
 import (
+	"context"
 	"database/sql"
+	"errors"
+	"expvar"
+	"flag"
+	"fmt"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/gin-contrib/cors" // middleware для настройки CORS (разрешения запросов с других доменов)
 	"github.com/gin-gonic/gin"    // веб-фреймворк Gin
-	_ "github.com/lib/pq"         // драйвер PostgreSQL (импортируем ради side-effect: регистрирует драйвер)
+	"github.com/lib/pq"           // драйвер PostgreSQL (при импорте регистрирует драйвер) и pq.Array для параметров-массивов
 )
 
 // City — структура, в которую мы будем маппить строки из таблицы cities.
@@ -15,17 +25,56 @@ import (
 type City struct {
 	ID   int    `json:"id"`
 	Name string `json:"name"`
+	// Slug — человекочитаемый идентификатор для URL (см. slug.go); nil, пока не присвоен.
+	Slug *string `json:"slug"`
+	// Страна (ISO 3166-1 alpha-2) и координаты; заполняются импортом из GeoNames (см. geonames.go).
+	CountryCode *string  `json:"country_code"`
+	Latitude    *float64 `json:"latitude"`
+	Longitude   *float64 `json:"longitude"`
+}
+
+// cityFields возвращает указатели на поля города в порядке колонок citySelect — для rows.Scan.
+func cityFields(city *City) []interface{} {
+	return []interface{}{&city.ID, &city.Name, &city.Slug, &city.CountryCode, &city.Latitude, &city.Longitude}
 }
 
 // Hotel — структура для отданных клиенту данных о гостинице.
 // Содержит как id города (CityID), так и CityName для удобства (чтобы клиент видел имя города сразу).
+//
+// Город, вместимость и цена в БД могут быть NULL (гостиницу заводят постепенно),
+// поэтому они указатели и в JSON отдаются как null, а не как 0 или пустая строка —
+// иначе клиент не отличит «бесплатно» от «цена ещё не указана». Пока чего-то из этого
+// нет, гостиница остаётся черновиком (см. жизненный цикл в hotelstatus.go).
 type Hotel struct {
-	ID       int     `json:"id"`
-	Name     string  `json:"name"`
-	CityID   int     `json:"city_id"`
-	CityName string  `json:"city_name"`
-	Capacity int     `json:"capacity"`
-	Price    float64 `json:"price"`
+	ID       int      `json:"id"`
+	Name     string   `json:"name"`
+	Slug     *string  `json:"slug"`
+	CityID   *int     `json:"city_id"`
+	CityName *string  `json:"city_name"`
+	Capacity *int     `json:"capacity"`
+	Price    *float64 `json:"price"`
+	Status   string   `json:"status"`
+	// PublishAt — запланированный момент публикации (см. schedule.go); nil — сразу.
+	PublishAt *time.Time `json:"publish_at,omitempty"`
+	// DeletedAt — когда гостиница удалена (мягко, см. hotels.go); видно только в админском списке.
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+	// Координаты гостиницы и ближайшие точки интереса каждого вида (см. pois.go).
+	Latitude  *float64   `json:"latitude"`
+	Longitude *float64   `json:"longitude"`
+	Nearby    NearbyPOIs `json:"nearby,omitempty"`
+	// Accessibility — сведения о доступности для людей с ограниченной подвижностью (см. accessibility.go).
+	Accessibility *Accessibility `json:"accessibility,omitempty"`
+	// Extras — животные, парковка, кроватки и дополнительные кровати (см. extras.go).
+	Extras *HotelExtras `json:"extras,omitempty"`
+	// Markets — страны, где гостиницу можно продавать (см. markets.go); клиенту не отдаётся.
+	Markets MarketRules `json:"-"`
+	// Attributes — произвольные атрибуты гостиницы (см. attributes.go).
+	Attributes HotelAttributes `json:"attributes,omitempty"`
+	// Description — описание; заполняется только в карточке гостиницы, не в списках.
+	Description *string `json:"description,omitempty"`
+	// IsSponsored и PromotionID заполняются для спонсорских размещений (см. promotions.go).
+	IsSponsored bool `json:"is_sponsored"`
+	PromotionID *int `json:"promotion_id,omitempty"`
 }
 
 // Response — универсальная обёртка для HTTP-ответа в JSON.
@@ -34,34 +83,101 @@ type Hotel struct {
 // - Data: полезная нагрузка (может быть slice, объект и т.д.)
 // - Count: количество элементов в Data (удобно для фронтенда)
 // - Error: строка ошибки (если есть)
+// - Hint: подсказка клиенту, что делать дальше (например, при превышении квоты)
+// - Code: машинно-читаемый код ошибки, если клиенту нужно отличать её от прочих
 type Response struct {
 	Success bool        `json:"success"`
 	Data    interface{} `json:"data"`
 	Count   int         `json:"count"`
 	Error   string      `json:"error,omitempty"`
+	Hint    string      `json:"hint,omitempty"`
+	Code    string      `json:"code,omitempty"`
+	// Partial — в Data не все строки: часть не удалось прочитать, запрос стоит повторить.
+	Partial bool `json:"partial,omitempty"`
+	// Page — метаданные страницы, если список запрошен постранично (см. pagination.go).
+	Page *PageInfo `json:"page,omitempty"`
 }
 
+// citySelect — общая часть запросов города; колонки читаются через cityFields.
+const citySelect = "SELECT c.id, c.name, c.slug, c.country_code, c.latitude, c.longitude FROM cities c"
+
+// citiesQuery — запрос списка городов, упорядоченных по имени (и по id, чтобы страницы не перекрывались).
+const citiesQuery = citySelect + " ORDER BY c.name, c.id"
+
+// hotelsQuery — запрос списка гостиниц. В этом запросе:
+//   - выбираем поля из таблицы hotels (h)
+//   - LEFT JOIN с cities (c) по полю h.city = c.id, чтобы получить имя города (если оно есть)
+//   - поля, которые могут быть NULL (город, его имя, вместимость, цена), сканируются в указатели
+//   - в публичный список попадают только опубликованные гостиницы (см. hotelstatus.go),
+//     у которых наступило время публикации
+//   - цена — действующая на сейчас по расписанию цен, если оно есть (см. schedule.go)
+//   - h.price::numeric — приведение типа в SQL (в зависимости от схемы можно было бы брать float напрямую)
+//
+// Важно: имена колонок в SELECT соответствуют порядку сканирования в rows.Scan в queryHotels.
+// По hotelsQuery весь список читает loadHotels (кэш "hotels" для виджета, лендингов, карты и
+// свободных мест); /debug/explain анализирует его как "hotels". GET /api/hotels собирает
+// запрос страницы во время выполнения (см. hotelPageQuery) — его план показывает "hotels_page".
+const hotelsQuery = hotelSelect + `
+	WHERE ` + publishedHotel + `
+	ORDER BY h.name
+`
+
+// hotelSelect — общая часть всех запросов гостиниц (SELECT и FROM); условия и порядок
+// добавляет каждый запрос сам. Колонки читает queryHotels.
+const hotelSelect = `
+	SELECT h.id, h.name, h.slug, h.city, c.name, h.capacity, ` + hotelPriceColumn + `, h.status, h.publish_at,
+	       h.attributes, h.latitude, h.longitude, poi.nearby, h.allowed_countries, h.blocked_countries,
+	       h.accessibility, h.extras, h.deleted_at
+` + hotelFrom + `
+	LEFT JOIN LATERAL (` + nearbyPOIQuery + `) poi ON true
+`
+
+// hotelFrom — FROM запросов гостиниц: гостиница, её город и действующая цена.
+// Условия запросов на hotelSelect ссылаются только на них, поэтому COUNT(*) по тем же
+// условиям (см. countHotels) обходится без подзапроса ближайших точек интереса.
+const hotelFrom = `
+	FROM hotels h
+	LEFT JOIN cities c ON h.city = c.id
+	LEFT JOIN LATERAL (` + effectivePriceQuery + `) p ON true
+`
+
+// hotelPriceColumn — действующая цена гостиницы в запросах на hotelSelect: по расписанию
+// цен, если оно есть (см. schedule.go), иначе базовая.
+const hotelPriceColumn = "COALESCE(p.price, h.price::numeric)"
+
+// publishedHotel — условие, при котором гостиница видна в публичных эндпоинтах.
+// Мягко удалённые гостиницы (см. hotels.go) не видны нигде, кроме админского списка.
+const publishedHotel = `h.status = 'published' AND (h.publish_at IS NULL OR h.publish_at <= now()) AND h.deleted_at IS NULL`
+
+// snapshotTx — параметры транзакции, в которой страница списка и COUNT(*) видят
+// одни и те же данные (см. pagination.go).
+var snapshotTx = &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true}
+
 // глобальная переменная db хранит пул подключений к базе данных.
 // Используем её во всех обработчиках. В реальном приложении можно обернуть в структуру приложения.
 var db *sql.DB
 
+// dbMaxIdleConns — сколько простаивающих соединений держит пул.
+const dbMaxIdleConns = 2
+
 // initDB открывает соединение с PostgreSQL и проверяет его.
 // Возвращает ошибку, если не удалось подключиться или пропинговать БД.
-// В connStr указываются параметры подключения: host, port, user, password, dbname, sslmode.
-func initDB() error {
-	connStr := "host=localhost port=5432 user=postgres password=12345 dbname=wb sslmode=disable"
-	var err error
-
-	// sql.Open не делает реального подключения — он просто подготавливает пул соединений.
-	// Реальное подключение проверяется при вызове db.Ping() ниже.
-	db, err = sql.Open("postgres", connStr)
-	if err != nil {
-		// Возвращаем ошибку вызывающему (main) — приложение не может работать без БД.
+// Параметры подключения (host, port, user, dbname, sslmode) берутся из конфигурации (см. config.go).
+// Пароль в строку не входит — он берётся из хранилища секретов при каждом новом соединении (см. secrets.go).
+// ctx ограничивает ожидание первого подключения.
+func initDB(ctx context.Context) error {
+	if err := initConfig(); err != nil {
 		return err
 	}
 
+	// sql.OpenDB не делает реального подключения — он просто подготавливает пул соединений.
+	// Реальное подключение проверяется при вызове db.PingContext() ниже.
+	db = sql.OpenDB(secretConnector{dsn: appConfig.DB.dsn()})
+	db.SetMaxIdleConns(dbMaxIdleConns)
+
 	// Ping проверяет соединение с БД: если БД недоступна — вернёт ошибку.
-	if err = db.Ping(); err != nil {
+	if err := db.PingContext(ctx); err != nil {
+		// Возвращаем ошибку вызывающему (main) — приложение не может работать без БД.
 		return err
 	}
 
@@ -72,8 +188,21 @@ func initDB() error {
 // getAllCities — HTTP-обработчик для получения списка всех городов.
 // Реагирует на GET /api/cities
 func getAllCities(c *gin.Context) {
-	// Выполняем SQL-запрос: выбираем id и name из таблицы cities, упорядочивая по имени.
-	rows, err := db.Query("SELECT id, name FROM cities ORDER BY name")
+	// ?page=&per_page= (или ?limit=&offset=) отдают одну страницу списка (см. pagination.go).
+	page, ok := parsePage(c)
+	if !ok {
+		return
+	}
+	strict := strictScan(c)
+	if page.perPage > 0 {
+		respondCitiesPage(c, strict, page)
+		return
+	}
+
+	// Список городов меняется редко, поэтому целиком отдаём его из кэша (см. cache.go).
+	cities, status, err := cache.get(c.Request.Context(), "cities", settings().CitiesCache, func(ctx context.Context) (interface{}, error) {
+		return loadCities(ctx, strict)
+	})
 	if err != nil {
 		// Если ошибка при выполнении запроса — возвращаем 500 и JSON с ошибкой.
 		c.JSON(http.StatusInternalServerError, Response{
@@ -82,121 +211,743 @@ func getAllCities(c *gin.Context) {
 		})
 		return
 	}
+	c.Header("X-Cache", status)
+
+	// Возвращаем 200 OK и JSON-объект Response (если список не превышает лимиты размера).
+	set := cities.(rowSet[City])
+	respondList(c, set.Items, len(set.Items), set.Partial)
+}
+
+// respondCitiesPage отдаёт страницу городов: строки страницы и их общее число
+// читаются из БД в одном снимке данных.
+func respondCitiesPage(c *gin.Context, strict bool, page pageRequest) {
+	ctx := c.Request.Context()
+	tx, err := db.BeginTx(ctx, snapshotTx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	var total int
+	if err := tx.QueryRowContext(ctx, "SELECT count(*) FROM cities").Scan(&total); err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	set := rowSet[City]{Items: []City{}}
+	if page.offset < total {
+		if set, err = queryCities(ctx, tx, strict, citiesQuery+" LIMIT $1 OFFSET $2", page.perPage, page.offset); err != nil {
+			c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+			return
+		}
+	}
+	writeList(c, Response{
+		Success: true,
+		Data:    set.Items,
+		Count:   len(set.Items),
+		Partial: set.Partial,
+		Page:    page.info(total),
+	})
+}
+
+// loadCities читает все города из БД. strict — строгий режим сканирования (см. scan.go).
+func loadCities(ctx context.Context, strict bool) (rowSet[City], error) {
+	return queryCities(ctx, db, strict, citiesQuery)
+}
+
+// queryCities выполняет запрос городов, построенный на citySelect, через q: пул соединений или транзакцию.
+func queryCities(ctx context.Context, q interface {
+	QueryContext(context.Context, string, ...interface{}) (*sql.Rows, error)
+}, strict bool, query string, args ...interface{}) (rowSet[City], error) {
+	// Выполняем SQL-запрос: выбираем города из таблицы cities.
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return rowSet[City]{}, err
+	}
 	// Не забываем закрыть rows, чтобы вернуть соединение в пул.
 	defer rows.Close()
 
 	// Собираем результаты в слайс City.
-	cities := []City{}
+	cities := rowSet[City]{Items: []City{}}
 	for rows.Next() {
 		var city City
 		// Сканируем колонки в поля структуры.
-		if err := rows.Scan(&city.ID, &city.Name); err != nil {
-			// Если сканирование одной строки провалилось — логируем и продолжаем,
+		if err := rows.Scan(cityFields(&city)...); err != nil {
+			// В строгом режиме ошибка проваливает запрос; в мягком строка пропускается,
 			// чтобы не терять остальные корректные записи.
-			log.Printf("Error scanning city: %v", err)
+			if err := scanFailed(strict, "city", err); err != nil {
+				return rowSet[City]{}, err
+			}
+			cities.Partial = true
 			continue
 		}
-		cities = append(cities, city)
+		cities.Items = append(cities.Items, city)
 	}
-
-	// Возвращаем 200 OK и JSON-объект Response.
-	c.JSON(http.StatusOK, Response{
-		Success: true,
-		Data:    cities,
-		Count:   len(cities),
-	})
+	// Ошибка могла случиться и посреди результата (например, оборвалось соединение):
+	// rows.Next() тогда просто возвращает false, и её видно только через rows.Err().
+	if err := rows.Err(); err != nil {
+		if err := iterationFailed(strict, "city", err); err != nil {
+			return rowSet[City]{}, err
+		}
+		cities.Partial = true
+	}
+	return cities, nil
 }
 
 // getAllHotels — HTTP-обработчик для получения списка гостиниц.
 // Реагирует на GET /api/hotels
+//
+// Фильтры становятся условиями WHERE (см. filters.go), сортировка — ORDER BY (см. sorting.go),
+// страница — LIMIT/OFFSET (см. pagination.go). Выдача без фильтров отдаётся из кэша
+// по политике HotelListCache (см. cache.go): ключ — рынок клиента, сортировка и страница
+// (см. hotelListCacheKey). Отфильтрованный список читается из БД на каждый запрос:
+// вариантов фильтров слишком много, чтобы кэшировать каждый. Заголовок X-Cache
+// сообщает, откуда взят ответ.
 func getAllHotels(c *gin.Context) {
-	// В этом запросе:
-	// - выбираем поля из таблицы hotels (h)
-	// - LEFT JOIN с cities (c) по полю h.city = c.id, чтобы получить имя города (если оно есть)
-	// - COALESCE(c.name, '') используется, чтобы при отсутствии города вернуть пустую строку
-	// - h.price::numeric — приведение типа в SQL (в зависимости от схемы можно было бы брать float напрямую)
-	//
-	// Важно: имена колонок в SELECT соответствуют порядку сканирования в rows.Scan ниже.
-	query := `
-		SELECT h.id, h.name, h.city, COALESCE(c.name, ''), h.capacity, h.price::numeric
-		FROM hotels h
-		LEFT JOIN cities c ON h.city = c.id
-		ORDER BY h.name
-	`
-
-	rows, err := db.Query(query)
+	// Базовые фильтры (?city_id=, ?min_price=, ?max_price=, ?min_capacity=, см. filters.go).
+	filter, ok := parseHotelFilter(c)
+	if !ok {
+		return
+	}
+	// Сортировка (?sort=price&order=desc, см. sorting.go).
+	order, ok := parseHotelSort(c)
+	if !ok {
+		return
+	}
+	// Страница (?page=&per_page= или ?limit=&offset=, см. pagination.go).
+	page, ok := parsePage(c)
+	if !ok {
+		return
+	}
+	// Фильтры по атрибутам (?attr.<key>=) и атрибуты, видимые клиенту (см. attributes.go).
+	attrs, ok := parseAttributeFilter(c)
+	if !ok {
+		return
+	}
+	// Фильтр по расстоянию до точки интереса (?near_poi=).
+	near, ok := parseNearPOI(c)
+	if !ok {
+		return
+	}
+	// Фильтр по подтверждённым признакам доступности (?accessible=).
+	accessible, ok := parseAccessibility(c)
+	if !ok {
+		return
+	}
+	// Фильтры по дополнительным услугам (?pets=true, ?parking=true, ?crib=true, ?extra_bed=true).
+	extras, ok := parseExtras(c)
+	if !ok {
+		return
+	}
+
+	q := sqlConditions{}
+	q.and(publishedHotel)
+	filter.where(&q)
+	attrs.where(&q)
+	// Гостиницы, закрытые для рынка клиента, в выдачу не попадают.
+	country := clientCountry(c)
+	marketWhere(&q, country)
+	near.where(&q)
+	accessibilityWhere(&q, accessible)
+	extrasWhere(&q, extras)
+
+	strict := strictScan(c)
+	load := func(ctx context.Context) (interface{}, error) {
+		return loadHotelList(ctx, strict, q, filter.CityID, order, page)
+	}
+	var value interface{}
+	status := cacheMiss
+	var err error
+	if filter == (HotelFilter{}) && len(attrs.values) == 0 && near == (nearPOIFilter{}) && len(accessible) == 0 && len(extras) == 0 {
+		value, status, err = cache.get(c.Request.Context(), hotelListCacheKey(country, order, page), settings().HotelListCache, load)
+	} else {
+		value, err = load(c.Request.Context())
+	}
+	var tooLarge listTooLargeError
+	if errors.As(err, &tooLarge) {
+		rejectOversizedList(c, tooLarge.Error())
+		return
+	}
 	if err != nil {
 		// Ошибка выполнения запроса — возвращаем 500.
-		c.JSON(http.StatusInternalServerError, Response{
-			Success: false,
-			Error:   err.Error(),
-		})
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
 		return
 	}
+	c.Header("X-Cache", status)
+
+	// Атрибуты чужих тенантов клиенту не отдаются. Закэшированную страницу не меняем:
+	// её же получат и другие клиенты.
+	list := value.(hotelList)
+	items := make([]Hotel, len(list.Items))
+	for i, h := range list.Items {
+		items[i] = attrs.strip(h)
+	}
+
+	resp := Response{
+		Success: true,
+		Data:    items,
+		Count:   len(items),
+		Partial: list.Partial,
+	}
+	if page.perPage > 0 {
+		resp.Page = page.info(list.Total)
+	}
+	writeList(c, resp)
+}
+
+// hotelListsCacheKey — родительский ключ страниц GET /api/hotels в кэше: сброс его
+// (или "hotels", в который он вложен) сбрасывает все страницы.
+const hotelListsCacheKey = "hotels:list"
+
+// hotelListCacheKey — ключ страницы page выдачи без фильтров в порядке order
+// для клиента из страны country.
+func hotelListCacheKey(country string, order HotelSort, page pageRequest) string {
+	return fmt.Sprintf("%s:%s:%s:%t:%d:%d", hotelListsCacheKey, country, order.Key, order.Desc, page.offset, page.perPage)
+}
+
+// hotelList — страница выдачи гостиниц и общее число гостиниц под условиями.
+type hotelList struct {
+	rowSet[Hotel]
+	Total int
+}
+
+// listTooLargeError — список без страницы длиннее MAX_LIST_ROWS (см. guard.go).
+type listTooLargeError struct {
+	total, limit int
+}
+
+func (e listTooLargeError) Error() string {
+	return fmt.Sprintf("result has %d rows, the limit is %d", e.total, e.limit)
+}
+
+// loadHotelList читает страницу page выдачи гостиниц под условиями q в порядке order.
+// Спонсорские размещения города cityID (или всех городов) поднимаются наверх; если
+// продвижения не загрузились, отдаётся органическая выдача: реклама не должна ломать поиск.
+func loadHotelList(ctx context.Context, strict bool, q sqlConditions, cityID *int, order HotelSort, page pageRequest) (hotelList, error) {
+	var promoByHotel map[int]int
+	promos, _, err := cache.get(ctx, promotionsCacheKey, settings().HotelsCache, func(ctx context.Context) (interface{}, error) {
+		return loadActivePromotions(ctx, strict)
+	})
+	if err != nil {
+		log.Printf("Error loading promotions: %v", err)
+	} else {
+		promoByHotel = sponsoredHotels(scopePromotions(promos.([]Promotion), cityID))
+	}
+
+	tx, err := db.BeginTx(ctx, snapshotTx)
+	if err != nil {
+		return hotelList{}, err
+	}
+	defer tx.Rollback()
+
+	total, sponsored, err := countHotels(ctx, tx, q, promoByHotel)
+	if err != nil {
+		return hotelList{}, err
+	}
+	// Без страницы отдаётся весь список — если он не превышает лимиты размера (см. guard.go);
+	// слишком длинный список незачем и читать.
+	start, end := 0, total
+	if page.perPage > 0 {
+		start, end = page.bounds(total)
+	} else if maxRows := settings().MaxListRows; maxRows > 0 && total > maxRows {
+		return hotelList{}, listTooLargeError{total: total, limit: maxRows}
+	}
+	set, err := hotelListPage(ctx, tx, strict, q, order, promoByHotel, total, sponsored, start, end)
+	if err != nil {
+		return hotelList{}, err
+	}
+	return hotelList{rowSet: set, Total: total}, nil
+}
+
+// countHotels считает гостиницы под условиями q и сколько из них продвигается (promoByHotel).
+func countHotels(ctx context.Context, tx *sql.Tx, q sqlConditions, promoByHotel map[int]int) (total, sponsored int, err error) {
+	q = q.clone()
+	ids := q.arg(pq.Array(hotelIDs(promoByHotel)))
+	err = tx.QueryRowContext(ctx, "SELECT count(*), count(*) FILTER (WHERE h.id = ANY("+ids+"))"+hotelFrom+q.sql(), q.args...).
+		Scan(&total, &sponsored)
+	return total, sponsored, err
+}
+
+// hotelListPage читает позиции [start, end) выдачи из total гостиниц под условиями q,
+// sponsored из которых продвигается: спонсорские гостиницы страницы и органические —
+// двумя запросами с LIMIT/OFFSET. Места спонсорских на странице те же, что расставил бы
+// interleaveSponsored во всём списке (см. sponsoredBefore).
+func hotelListPage(ctx context.Context, tx *sql.Tx, strict bool, q sqlConditions, order HotelSort,
+	promoByHotel map[int]int, total, sponsored, start, end int) (rowSet[Hotel], error) {
+	page := rowSet[Hotel]{Items: []Hotel{}}
+	if start >= end {
+		return page, nil
+	}
+	organic := total - sponsored
+	spStart, spEnd := sponsoredBefore(start, sponsored, organic), sponsoredBefore(end, sponsored, organic)
+
+	read := func(promoted bool, offset, limit int) (rowSet[Hotel], error) {
+		if limit == 0 {
+			return rowSet[Hotel]{}, nil
+		}
+		r := q.clone()
+		if len(promoByHotel) > 0 {
+			cond := "h.id = ANY(" + r.arg(pq.Array(hotelIDs(promoByHotel))) + ")"
+			if !promoted {
+				cond = "NOT " + cond
+			}
+			r.and(cond)
+		}
+		return queryHotelsIn(ctx, tx, strict, hotelPageQuery(&r, order, limit, offset), r.args...)
+	}
+	sp, err := read(true, spStart, spEnd-spStart)
+	if err != nil {
+		return rowSet[Hotel]{}, err
+	}
+	org, err := read(false, start-spStart, (end-start)-(spEnd-spStart))
+	if err != nil {
+		return rowSet[Hotel]{}, err
+	}
+
+	page.Items = placeSponsored(sp.Items, org.Items, promoByHotel, total, sponsored, start, end)
+	page.Partial = sp.Partial || org.Partial
+	return page, nil
+}
+
+// hotelPageQuery — запрос страницы выдачи: гостиницы под условиями q в порядке order,
+// limit штук начиная с offset. Параметры limit и offset добавляются в q.
+func hotelPageQuery(q *sqlConditions, order HotelSort, limit, offset interface{}) string {
+	where := q.sql()
+	return hotelSelect + where + order.orderBy() + " LIMIT " + q.arg(limit) + " OFFSET " + q.arg(offset)
+}
+
+// loadHotels читает опубликованные гостиницы вместе с названиями городов. strict — как в loadCities.
+func loadHotels(ctx context.Context, strict bool) (rowSet[Hotel], error) {
+	return queryHotels(ctx, strict, hotelsQuery)
+}
+
+// queryHotels выполняет запрос гостиниц, построенный на hotelSelect.
+func queryHotels(ctx context.Context, strict bool, query string, args ...interface{}) (rowSet[Hotel], error) {
+	return queryHotelsIn(ctx, db, strict, query, args...)
+}
+
+// queryHotelsIn — queryHotels через q: пул соединений или транзакцию.
+func queryHotelsIn(ctx context.Context, q interface {
+	QueryContext(context.Context, string, ...interface{}) (*sql.Rows, error)
+}, strict bool, query string, args ...interface{}) (rowSet[Hotel], error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return rowSet[Hotel]{}, err
+	}
 	defer rows.Close()
 
 	// Собираем результаты в слайс Hotel.
-	hotels := []Hotel{}
+	hotels := rowSet[Hotel]{Items: []Hotel{}}
 	for rows.Next() {
 		var hotel Hotel
 		// Порядок сканирования должен соответствовать SELECT:
-		// id, name, city (id), city.name, capacity, price
-		if err := rows.Scan(&hotel.ID, &hotel.Name, &hotel.CityID, &hotel.CityName, &hotel.Capacity, &hotel.Price); err != nil {
-			// Логируем ошибку и продолжаем считывать остальные строки.
-			log.Printf("Error scanning hotel: %v", err)
+		// id, name, slug, city (id), city.name, capacity, price, status, publish_at, attributes,
+		// latitude, longitude, nearby, allowed_countries, blocked_countries, accessibility, extras, deleted_at
+		if err := rows.Scan(&hotel.ID, &hotel.Name, &hotel.Slug, &hotel.CityID, &hotel.CityName, &hotel.Capacity, &hotel.Price,
+			&hotel.Status, &hotel.PublishAt, &hotel.Attributes, &hotel.Latitude, &hotel.Longitude, &hotel.Nearby,
+			&hotel.Markets.Allowed, &hotel.Markets.Blocked, jsonColumn[Accessibility]{&hotel.Accessibility},
+			jsonColumn[HotelExtras]{&hotel.Extras}, &hotel.DeletedAt); err != nil {
+			// В мягком режиме логируем ошибку и продолжаем считывать остальные строки.
+			if err := scanFailed(strict, "hotel", err); err != nil {
+				return rowSet[Hotel]{}, err
+			}
+			hotels.Partial = true
 			continue
 		}
-		hotels = append(hotels, hotel)
+		hotels.Items = append(hotels.Items, hotel)
 	}
-
-	// Отправляем ответ с данными.
-	c.JSON(http.StatusOK, Response{
-		Success: true,
-		Data:    hotels,
-		Count:   len(hotels),
-	})
+	if err := rows.Err(); err != nil {
+		if err := iterationFailed(strict, "hotel", err); err != nil {
+			return rowSet[Hotel]{}, err
+		}
+		hotels.Partial = true
+	}
+	return hotels, nil
 }
 
+// Флаги команды serve. Адреса слушающих сокетов описаны в listen.go.
+// Пустой -admin-addr означает, что служебные маршруты обслуживаются на основном адресе;
+// пустой -metrics-addr — что метрики не публикуются.
+var (
+	serveFlags  = flag.NewFlagSet("serve", flag.ExitOnError)
+	addr        = serveFlags.String("addr", "", `public API address: host:port, "unix:/path/to.sock" or "systemd[:name]" (default from ADDR or PORT, see config.go)`)
+	adminAddr   = serveFlags.String("admin-addr", "", "separate address for /api/admin and /debug endpoints")
+	metricsAddr = serveFlags.String("metrics-addr", "", "address for the metrics endpoint (/debug/vars)")
+	reusePort   = serveFlags.Bool("reuseport", false, "open TCP listeners with SO_REUSEPORT for zero-downtime upgrades")
+	manageSock  = serveFlags.String("manage-socket", "", "path of the local management unix socket (disabled if empty)")
+	schemaCheck = serveFlags.Bool("schema-check", true, "verify the database schema at startup and refuse to start on drift")
+	migrateDB   = serveFlags.Bool("migrate", false, "apply pending database migrations at startup, before the schema check")
+)
+
 func main() {
-	// Инициализируем подключение к БД. Если ошибка — завершаем приложение.
-	if err := initDB(); err != nil {
-		log.Fatalf("Failed to connect to database: %v", err)
+	// Первый аргумент — имя команды (см. cli.go). Без него, как и раньше, запускается сервер:
+	// "./WB -addr :9090" эквивалентно "./WB serve -addr :9090".
+	name, args := "serve", os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
 	}
-	// Гарантированно закрываем пул соединений при завершении main.
-	defer db.Close()
 
+	cmd, ok := commands[name]
+	if !ok {
+		printUsage()
+		os.Exit(2)
+	}
+	if err := cmd.run(args); err != nil {
+		log.Fatalf("%s: %v", name, err)
+	}
+}
+
+// bootstrap готовит общее для всех команд окружение (см. coreComponents в app.go).
+// Пул соединений с БД закрывает вызывающий.
+func bootstrap() error {
+	return newApp(coreComponents()...).start(context.Background())
+}
+
+// runServe — команда serve: запуск HTTP-серверов приложения.
+func runServe(args []string) error {
+	serveFlags.Parse(args)
+	// Конфигурация проверяется до запуска подсистем: от неё зависит адрес сервера.
+	if err := initConfig(); err != nil {
+		return err
+	}
+	if *addr == "" {
+		*addr = appConfig.Addr
+	}
+
+	app := newApp(databaseComponents()...)
+	// Миграции применяются до остальных подсистем: им уже могут понадобиться таблицы (см. migrate.go).
+	if *migrateDB {
+		app.add(component{name: "migrations", start: func(ctx context.Context) error {
+			_, err := migrateUp(ctx)
+			return err
+		}})
+	}
+	app.add(serviceComponents()...)
+	// Сверяем схему БД с ожиданиями кода до открытия сокетов (см. schema.go).
+	if *schemaCheck {
+		app.add(component{name: "schema check", start: verifySchema})
+	}
+	app.add(workersComponent(), jobsComponent())
+
+	// Каждый адрес обслуживается своим сервером со своим набором middleware.
+	router := newPublicRouter()
+	servers := &httpServers{servers: []namedServer{{name: "api", addr: *addr, handler: router}}}
+	if *adminAddr == "" {
+		registerAdminRoutes(router)
+	} else {
+		servers.servers = append(servers.servers, namedServer{name: "admin", addr: *adminAddr, handler: newAdminRouter()})
+	}
+	if *metricsAddr != "" {
+		servers.servers = append(servers.servers, namedServer{name: "metrics", addr: *metricsAddr, handler: newMetricsHandler()})
+	}
+	app.add(servers.component())
+	// Локальный управляющий сокет для работы во время инцидентов (см. manage.go).
+	if *manageSock != "" {
+		app.add(manageSocketComponent(*manageSock))
+	}
+
+	if err := app.start(context.Background()); err != nil {
+		return err
+	}
+
+	// По SIGTERM/SIGINT перестаём принимать новые соединения и дожидаемся начатых запросов —
+	// так новая версия, запущенная с -reuseport, забирает трафик без обрывов (см. listen.go).
+	// Подсистемы останавливаются в обратном порядке: серверы, затем фоновые и
+	// административные задачи, и только после них закрывается пул соединений с БД.
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGTERM, syscall.SIGINT)
+	var serveErr error
+	select {
+	case serveErr = <-servers.errs:
+	case sig := <-stop:
+		log.Printf("Received %s, draining connections", sig)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), appConfig.ShutdownTimeout)
+	defer cancel()
+	if err := app.stop(ctx); err != nil {
+		log.Printf("Error during shutdown: %v", err)
+	}
+	log.Println("Server stopped")
+	return serveErr
+}
+
+// namedServer — один HTTP-сервер приложения: его назначение, адрес и обработчик.
+type namedServer struct {
+	name    string
+	addr    string
+	handler http.Handler
+}
+
+// newPublicRouter создаёт роутер публичного API.
+func newPublicRouter() *gin.Engine {
 	// Создаём экземпляр роутера Gin с дефолтными middleware (лог, recovery и т.д.).
 	router := gin.Default()
+	// Учёт выполняющихся запросов для управляющего сокета, идентификатор запроса
+	// и запись запросов выбранных клиентов для разбора жалоб (см. recording.go).
+	router.Use(trackRequests(), requestIDMiddleware(), recordingMiddleware())
+	// Внесение сбоев для проверки клиентов; без флага "chaos" ничего не делает (см. chaos.go).
+	router.Use(chaosMiddleware())
 
 	// Настраиваем CORS — актуально, если фронтенд обращается с другого домена/порта.
-	// В данном конфиге разрешены все источники (AllowOrigins: ["*"]) — это удобно при разработке,
+	// По умолчанию разрешены все источники (CORS_ORIGINS=*) — это удобно при разработке,
 	// но в продакшене рекомендуется сузить список разрешённых доменов.
-	router.Use(cors.New(cors.Config{
-		AllowOrigins:     []string{"*"},
-		AllowMethods:     []string{"GET", "POST", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Accept"},
+	// Список проверяется на каждый запрос, поэтому меняется без перезапуска (см. settings.go).
+	// Маршруты виджета проверяют источники сами, по токену (см. widget.go).
+	router.Use(skipForWidget(cors.New(cors.Config{
+		AllowOriginFunc:  func(origin string) bool { return settings().allowsOrigin(origin) },
+		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization", apiKeyHeader, requestIDHeader},
+		ExposeHeaders:    []string{"X-Quota-Limit", "X-Quota-Remaining", "Retry-After", "X-Cache", requestIDHeader},
 		AllowCredentials: true,
-	}))
+	})))
 
 	// Группируем маршруты под префиксом /api
 	api := router.Group("/api")
 	{
-		// Маршрут GET /api/cities — возвращает список городов.
-		api.GET("/cities", getAllCities)
-		// Маршрут GET /api/hotels — возвращает список гостиниц с информацией о городе.
-		api.GET("/hotels", getAllHotels)
+		// Маршрут GET /api/quota — остаток месячной квоты для API-ключа (сам квоту не расходует).
+		api.GET("/quota", getQuota)
+		// Маршрут GET /api/collection.json — коллекция запросов для импорта в Postman/Insomnia.
+		api.GET("/collection.json", collectionHandler(router))
+
+		// Открытые данные: без ключей и квот, с собственным ограничением частоты (см. opendata.go).
+		open := api.Group("/open", openDataMiddleware())
+		open.GET("/data", getOpenData)
+		open.GET("/snapshots", getOpenDataSnapshots)
+		open.GET("/snapshots/:date", getOpenDataSnapshot)
+
+		// Маршрут GET /api/blobs/*key — скачивание локального файла по подписанной ссылке.
+		api.GET("/blobs/*key", serveSignedBlob)
+
+		// Встраиваемый виджет: доступ по виджет-токену с его доменов, без квоты.
+		widget := api.Group("/widget", requestDeadlineMiddleware(), widgetMiddleware())
+		widget.GET("/hotels", getWidgetHotels)
+		widget.OPTIONS("/hotels", getWidgetHotels)
+
+		// Остальные маршруты учитываются в квоте ключа, если он передан,
+		// и попадают в статистику использования для выставления счетов.
+		// Срок запроса ограничивает ожидание БД и внешних провайдеров (см. deadline.go),
+		// в том числе при проверке ключа и токена.
+		// Токен доступа пользователя, если передан, проверяется здесь же (см. auth.go).
+		metered := api.Group("", requestDeadlineMiddleware(), quotaMiddleware(), usageMiddleware(), userMiddleware())
+		// Маршруты POST /api/auth/register и /login — регистрация и вход пользователя, выдают токен доступа.
+		metered.POST("/auth/register", register)
+		metered.POST("/auth/login", login)
+		// Маршруты POST /api/auth/refresh и /logout — обмен токена обновления на новую пару и его отзыв.
+		metered.POST("/auth/refresh", refreshTokens)
+		metered.POST("/auth/logout", logout)
+		// Маршрут GET /api/cities — возвращает список городов (постранично с ?page=&per_page=).
+		metered.GET("/cities", getAllCities)
+		// Маршрут GET /api/cities/:id — город по id (в том числе по id слитого дубля).
+		metered.GET("/cities/:id", getCity)
+		// Маршрут GET /api/cities/:id/pois — точки интереса города (для фильтра ?near_poi=).
+		metered.GET("/cities/:id/pois", getCityPOIs)
+		// Маршрут GET /api/cities/:id/landing — город, его лучшие гостиницы, статистика цен и фасеты одним ответом.
+		metered.GET("/cities/:id/landing", getCityLanding)
+		// Маршруты по slug; по устаревшему slug отвечают 301 на актуальный адрес.
+		metered.GET("/cities/by-slug/:slug", getCityBySlug)
+		metered.GET("/hotels/by-slug/:slug", getHotelBySlug)
+		// Маршрут GET /api/resolve — короткие и устаревшие ссылки в каноническую сущность.
+		metered.GET("/resolve", resolveHandler)
+		// Маршрут GET /api/hotels/:id/quote — стоимость проживания с дополнительными услугами.
+		metered.GET("/hotels/:id/quote", getHotelQuote)
+		// Маршрут GET /api/hotels/:id/availability — свободные места по ночам в диапазоне дат.
+		metered.GET("/hotels/:id/availability", getHotelAvailability)
+		// Маршрут GET /api/context — валюта, язык и ближайший город по IP клиента для формы поиска.
+		metered.GET("/context", getClientContext)
+		// Маршрут GET /api/hotels — возвращает список гостиниц с информацией о городе
+		// (фильтры ?city_id=, ?min_price=, ?max_price=, ?min_capacity=; сортировка ?sort=&order=;
+		// постранично с ?page=&per_page=).
+		metered.GET("/hotels", getAllHotels)
+		// Маршрут GET /api/hotels/:id — опубликованная гостиница с названием города.
+		metered.GET("/hotels/:id", getHotel)
+		// Маршрут POST /api/hotels — создание гостиницы (черновиком); только администратор.
+		metered.POST("/hotels", requireRole(roleAdmin), createHotel)
+		// Маршруты PUT и PATCH /api/hotels/:id — полная и частичная замена полей гостиницы;
+		// только администратор.
+		metered.PUT("/hotels/:id", requireRole(roleAdmin), updateHotel)
+		metered.PATCH("/hotels/:id", requireRole(roleAdmin), updateHotel)
+		// Маршрут DELETE /api/hotels/:id — мягкое удаление гостиницы; только администратор.
+		metered.DELETE("/hotels/:id", requireRole(roleAdmin), deleteHotel(false))
+		// Бронирования пользователя или тенанта API-ключа: создание, список, просмотр и отмена (см. bookings.go).
+		metered.POST("/bookings", requireBookingAuth(), createBooking)
+		metered.GET("/bookings", requireBookingAuth(), getBookings)
+		metered.GET("/bookings/:id", requireBookingAuth(), getBooking)
+		metered.DELETE("/bookings/:id", requireBookingAuth(), cancelBooking)
+		// Ссылки совместного доступа к бронированию для попутчиков и вписанные ими гости (см. sharing.go).
+		metered.POST("/bookings/:id/shares", requireBookingAuth(), createBookingShare)
+		metered.GET("/bookings/:id/shares", requireBookingAuth(), getBookingShares)
+		metered.DELETE("/bookings/:id/shares/:token", requireBookingAuth(), revokeBookingShare)
+		metered.GET("/bookings/:id/guests", requireBookingAuth(), getBookingGuests)
+		// Регистрация заезда: QR-код для гостя и проверка отсканированного кода сотрудником (см. checkin.go).
+		metered.GET("/bookings/:id/checkin-qr", requireBookingAuth(), getCheckinQR)
+		metered.POST("/checkins", requireRole(roleManager), checkIn)
+		// Маршруты /api/shared-bookings/:token — бронирование по ссылке и добавление гостя, без учётной записи.
+		metered.GET("/shared-bookings/:token", getSharedBooking)
+		metered.POST("/shared-bookings/:token/guests", addSharedBookingGuest)
+		// Маршрут GET /api/hotels/facets — число гостиниц по значениям атрибутов.
+		metered.GET("/hotels/facets", getHotelFacets)
+		// Маршрут GET /api/hotels/map — метки или кластеры гостиниц в области карты.
+		metered.GET("/hotels/map", getHotelsMap)
+		// Вопросы и ответы о гостинице: список, новый вопрос и уведомления автору об ответах.
+		metered.GET("/hotels/:id/questions", getHotelQuestions)
+		metered.POST("/hotels/:id/questions", askQuestion)
+		metered.GET("/questions/notifications", getQuestionNotifications)
+		// Подписки на снижение цены проживания: подписка, список, отписка и уведомления (см. pricealerts.go).
+		metered.POST("/hotels/:id/price-alerts", createPriceAlert)
+		metered.GET("/price-alerts", getPriceAlerts)
+		metered.GET("/price-alerts/notifications", getPriceAlertNotifications)
+		metered.DELETE("/price-alerts/:id", deletePriceAlert)
+		// Голоса за полезность вопросов и ответов.
+		metered.POST("/questions/:id/vote", voteHandler("question"))
+		metered.POST("/answers/:id/vote", voteHandler("answer"))
+		// Маршруты POST /api/promotions/:id/impression и /click — учёт показов и кликов спонсорских размещений.
+		metered.POST("/promotions/:id/impression", trackPromotionEvent("impressions"))
+		metered.POST("/promotions/:id/click", trackPromotionEvent("clicks"))
+		// Маршрут POST /api/events — пакетный приём клиентских событий для аналитики.
+		metered.POST("/events", ingestEvents)
+	}
+
+	registerHealthRoute(router)
+	return router
+}
+
+// newAdminRouter создаёт отдельный роутер для служебного адреса (-admin-addr).
+// CORS и квоты здесь не нужны: к этому адресу обращаются администраторы, а не браузеры партнёров.
+func newAdminRouter() *gin.Engine {
+	router := gin.New()
+	router.Use(gin.Logger(), gin.Recovery(), trackRequests(), requestIDMiddleware())
+	registerAdminRoutes(router)
+	registerHealthRoute(router)
+	return router
+}
+
+// registerAdminRoutes регистрирует служебные маршруты (требуют ADMIN_TOKEN).
+func registerAdminRoutes(router *gin.Engine) {
+	admin := router.Group("/api/admin", requireAdmin())
+	{
+		// Маршрут GET /api/admin/usage — статистика использования API по ключам.
+		admin.GET("/usage", getUsage)
+		// Маршрут GET /api/admin/usage/export — CSV для выставления счетов партнёрам.
+		admin.GET("/usage/export", exportUsage)
+		// Маршрут GET /api/admin/index-report — отчёт о недостающих и неиспользуемых индексах.
+		admin.GET("/index-report", getIndexReport)
+		// Маршрут GET /api/admin/funnel — воронка конверсии по клиентским событиям.
+		admin.GET("/funnel", getFunnel)
+		// Пользователи и их роли.
+		admin.GET("/users", getUsers)
+		admin.PUT("/users/:id/role", setUserRole)
+		// Маршрут POST /api/admin/reload — перечитать настройки без перезапуска.
+		admin.POST("/reload", reloadSettingsHandler)
+		// Запись запросов выбранных клиентов: просмотр записей и управление целями записи.
+		admin.GET("/recordings", getRecordings)
+		admin.POST("/recordings/targets", addRecordingTarget)
+		admin.DELETE("/recordings/targets", clearRecordingTargets)
+		// Правила внесения сбоев (действуют только при включённом флаге "chaos").
+		admin.GET("/chaos", getChaosRules)
+		admin.PUT("/chaos", setChaosRules)
+		// Спонсорские размещения: список со статистикой, создание и удаление.
+		admin.GET("/promotions", getPromotions)
+		admin.POST("/promotions", createPromotion)
+		admin.DELETE("/promotions/:id", deletePromotion)
+		// Переименование и слияние городов-дублей.
+		admin.PUT("/cities/:id", renameCity)
+		admin.POST("/cities/:id/merge", mergeCity)
+		// Ручная смена slug и присвоение недостающих.
+		admin.PUT("/cities/:id/slug", setSlug("city"))
+		admin.PUT("/hotels/:id/slug", setSlug("hotel"))
+		admin.POST("/slugs/backfill", startSlugBackfill)
+		// Маршрут POST /api/admin/imports/geonames — импорт городов из GeoNames (фоновая задача).
+		admin.POST("/imports/geonames", startGeoNamesImport)
+		// Маршрут POST /api/admin/cache/prime — прогрев кэша свободных мест перед кампанией (фоновая задача).
+		admin.POST("/cache/prime", startCachePriming)
+		// Короткие маркетинговые ссылки для /api/resolve.
+		admin.GET("/short-links", getShortLinks)
+		admin.POST("/short-links", createShortLink)
+		admin.DELETE("/short-links/:code", deleteShortLink)
+		// Жизненный цикл гостиниц: список с фильтром по статусу и смена статуса.
+		admin.GET("/hotels", getAdminHotels)
+		admin.POST("/hotels/:id/status", setHotelStatus)
+		// Удаление гостиницы (с ?hard=true — окончательное) и восстановление мягко удалённой.
+		admin.DELETE("/hotels/:id", deleteHotel(true))
+		admin.POST("/hotels/:id/restore", restoreHotel)
+		// Отложенная публикация и расписание цен.
+		admin.PUT("/hotels/:id/publish-at", setPublishAt)
+		admin.GET("/hotels/:id/prices", getPriceSchedule)
+		admin.POST("/hotels/:id/prices", schedulePrice)
+		// Массовое изменение цен по правилам, с предпросмотром (dry_run).
+		admin.POST("/hotels/prices/bulk", bulkUpdatePrices)
+		// Точки интереса городов и координаты гостиниц (расстояния пересчитываются сразу).
+		admin.GET("/cities/:id/pois", getCityPOIs)
+		admin.POST("/cities/:id/pois", createPOI)
+		admin.DELETE("/pois/:id", deletePOI)
+		admin.PUT("/hotels/:id/location", setHotelLocation)
+		// Ограничения продаж гостиницы по странам клиента.
+		admin.PUT("/hotels/:id/markets", setHotelMarkets)
+		// Сведения о доступности гостиницы для людей с ограниченной подвижностью.
+		admin.PUT("/hotels/:id/accessibility", setHotelAccessibility)
+		// Животные, парковка, кроватки и дополнительные кровати.
+		admin.PUT("/hotels/:id/extras", setHotelExtras)
+		// Реестр атрибутов гостиниц и их значения.
+		admin.GET("/attributes", getAttributeDefinitions)
+		admin.POST("/attributes", createAttributeDefinition)
+		admin.DELETE("/attributes/:key", deleteAttributeDefinition)
+		admin.PUT("/hotels/:id/attributes", setHotelAttributes)
+		// Правка названия и описания с историей ревизий, диффом и откатом.
+		admin.PUT("/hotels/:id/content", updateHotelContent)
+		admin.GET("/hotels/:id/revisions", getHotelRevisions)
+		admin.GET("/hotels/:id/revisions/:rev/diff", getHotelRevisionDiff)
+		admin.POST("/hotels/:id/revisions/:rev/rollback", rollbackHotelRevision)
+		// Резервное копирование и восстановление в отдельную схему (фоновые задачи).
+		admin.GET("/backups", getBackups)
+		admin.POST("/backups", startBackup)
+		admin.POST("/backups/:name/restore", startRestore)
+		// Пробное восстановление последней копии: отчёт и ручной запуск.
+		admin.GET("/dr-check", getDRCheck)
+		admin.POST("/dr-check", startDRCheck)
+		// Маршруты GET /api/admin/jobs и /jobs/:id — состояние фоновых задач.
+		admin.GET("/jobs", getJobs)
+		admin.GET("/jobs/:id", getJob)
+		// Вопросы о гостиницах: ответ и скрытие.
+		admin.POST("/questions/:id/answers", answerQuestion)
+		admin.DELETE("/questions/:id", hideQuestion)
+		// Хранилище файлов: список объектов, подписанные ссылки и очистка осиротевших.
+		admin.GET("/blobs", getBlobs)
+		admin.GET("/blobs/url", getBlobURL)
+		admin.POST("/blobs/cleanup", startBlobCleanup)
+		// Сопоставление кодов гостиниц партнёров с нашими id и подбор кандидатов.
+		admin.GET("/mappings", getMappings)
+		admin.POST("/mappings", createMapping)
+		admin.POST("/mappings/suggest", suggestMappings)
+		admin.DELETE("/mappings/:tenant_id/:entity/:external_id", deleteMapping)
+		// Виджет-токены партнёров: выпуск, смена доменов и оформления, отзыв.
+		admin.GET("/widget-tokens", getWidgetTokens)
+		admin.POST("/widget-tokens", createWidgetToken)
+		admin.PUT("/widget-tokens/:token", updateWidgetToken)
+		admin.DELETE("/widget-tokens/:token", revokeWidgetToken)
 	}
 
-	// Простейший маршрут для проверки здоровья сервера (health check).
-	// Полезно для оркестраторов, мониторинга и локального тестирования.
+	// Диагностика для администраторов: планы выполнения запросов из белого списка.
+	debug := router.Group("/debug", requireAdmin())
+	{
+		// Маршрут GET /debug/explain — EXPLAIN (ANALYZE, BUFFERS) для именованного запроса.
+		debug.GET("/explain", explainHandler)
+	}
+}
+
+// registerHealthRoute регистрирует простейший маршрут для проверки здоровья сервера (health check).
+// Полезно для оркестраторов, мониторинга и локального тестирования.
+func registerHealthRoute(router *gin.Engine) {
 	router.GET("/health", func(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{"status": "ok"})
 	})
+}
 
-	log.Println("Server starting on :8080")
-	// Запускаем HTTP-сервер на порту 8080.
-	// router.Run блокирует текущий поток, поэтому код после него выполняться не будет, пока сервер запущен.
-	if err := router.Run(":8080"); err != nil {
-		log.Fatalf("Failed to start server: %v", err)
-	}
+// newMetricsHandler создаёт обработчик адреса метрик (-metrics-addr).
+// Метрики публикуются через стандартный expvar: GET /debug/vars отдаёт JSON
+// со статистикой рантайма Go и счётчиками, зарегистрированными приложением.
+func newMetricsHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/debug/vars", expvar.Handler())
+	return mux
 }
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Общие помощники тестов.
+//
+// Тесты, которым нужна БД, работают с PostgreSQL из TEST_DATABASE_URL, например
+//
+//	TEST_DATABASE_URL='postgres://postgres@localhost/wb_test?sslmode=disable' go test ./...
+//
+// и пропускаются, если переменная не задана. Схема поднимается миграциями (см. migrate.go),
+// а перед каждым тестом все таблицы очищаются — поэтому база нужна отдельная, не рабочая.
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	if _, err := reloadSettings(); err != nil {
+		log.Fatal(err)
+	}
+	jwtSigningKey = []byte("test signing key")
+	os.Exit(m.Run())
+}
+
+var (
+	testDBOnce sync.Once
+	testDBErr  error
+)
+
+// testDB подключает глобальный db к тестовой базе и очищает её; без TEST_DATABASE_URL тест пропускается.
+func testDB(t *testing.T) {
+	t.Helper()
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+	testDBOnce.Do(func() {
+		if db, testDBErr = sql.Open("postgres", dsn); testDBErr != nil {
+			return
+		}
+		_, testDBErr = migrateUp(context.Background())
+	})
+	if testDBErr != nil {
+		t.Fatalf("preparing test database: %v", testDBErr)
+	}
+
+	var tables string
+	err := db.QueryRow(`
+		SELECT string_agg(quote_ident(tablename), ', ')
+		FROM pg_tables
+		WHERE schemaname = current_schema() AND tablename <> 'schema_migrations'
+	`).Scan(&tables)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("TRUNCATE " + tables + " RESTART IDENTITY CASCADE"); err != nil {
+		t.Fatal(err)
+	}
+	cache.flush()
+}
+
+// testExec выполняет запрос к тестовой базе и возвращает первое значение RETURNING (если есть).
+func testExec(t *testing.T, query string, args ...interface{}) int {
+	t.Helper()
+	var id int
+	if !strings.Contains(query, "RETURNING") {
+		if _, err := db.Exec(query, args...); err != nil {
+			t.Fatal(err)
+		}
+		return 0
+	}
+	if err := db.QueryRow(query, args...).Scan(&id); err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+// testCity заводит город и возвращает его id.
+func testCity(t *testing.T, name string) int {
+	t.Helper()
+	return testExec(t, "INSERT INTO cities (name) VALUES ($1) RETURNING id", name)
+}
+
+// testHotel заводит опубликованную гостиницу и возвращает её id.
+func testHotel(t *testing.T, name string, cityID, capacity int, price float64) int {
+	t.Helper()
+	return testExec(t, `
+		INSERT INTO hotels (name, city, capacity, price, status) VALUES ($1, $2, $3, $4, $5) RETURNING id
+	`, name, cityID, capacity, price, hotelPublished)
+}
+
+// testAPIKey заводит тенанта с тарифом plan и квотой quota и выдаёт ему ключ.
+func testAPIKey(t *testing.T, key, plan string, quota int) int {
+	t.Helper()
+	tenantID := testExec(t, "INSERT INTO tenants (name, plan, monthly_quota) VALUES ($1, $2, $3) RETURNING id", "tenant "+key, plan, quota)
+	testExec(t, "INSERT INTO api_keys (key, tenant_id) VALUES ($1, $2)", key, tenantID)
+	return tenantID
+}
+
+// testUser заводит пользователя с ролью role и возвращает его вместе с токеном доступа.
+func testUser(t *testing.T, email, role string) (User, string) {
+	t.Helper()
+	hash, err := bcrypt.GenerateFromPassword([]byte("correct horse"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u := User{Email: email, Name: "Test User", Role: role}
+	u.ID = testExec(t, "INSERT INTO users (email, name, password_hash, role) VALUES ($1, $2, $3, $4) RETURNING id",
+		u.Email, u.Name, string(hash), u.Role)
+	token, _, err := signJWT(u.ID, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u, token
+}
+
+// serve выполняет запрос к h; headers — пары имя, значение.
+func serve(h http.Handler, method, path, body string, headers ...string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	return w
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Локальный управляющий сокет (флаг -manage-socket).
+//
+// Во время инцидента HTTP-путь может быть перегружен или сломан, поэтому
+// базовые операции доступны через отдельный unix-сокет, доступный только
+// владельцу процесса. Протокол текстовый, одна команда на строку:
+//
+//	socat - UNIX-CONNECT:/run/wb/manage.sock
+//	> cache
+//	> cache flush hotels
+//	> requests
+//	> flags
+//	> flag maintenance on
+//
+// Флаги, переключённые здесь, действуют до следующей перезагрузки настроек (SIGHUP, /api/admin/reload).
+
+// manageSocketMode — права на файл сокета: только владелец.
+const manageSocketMode = 0o600
+
+// activeRequest — запрос, который сейчас обрабатывается.
+type activeRequest struct {
+	method  string
+	path    string
+	remote  string
+	started time.Time
+}
+
+// requestTracker хранит выполняющиеся запросы для команды requests.
+type requestTracker struct {
+	nextID atomic.Uint64
+	mu     sync.Mutex
+	active map[uint64]activeRequest
+}
+
+var tracker = &requestTracker{active: map[uint64]activeRequest{}}
+
+// trackRequests — middleware, регистрирующий запрос на время его обработки.
+func trackRequests() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := tracker.nextID.Add(1)
+		tracker.mu.Lock()
+		tracker.active[id] = activeRequest{
+			method:  c.Request.Method,
+			path:    c.Request.URL.Path,
+			remote:  c.ClientIP(),
+			started: time.Now(),
+		}
+		tracker.mu.Unlock()
+
+		defer func() {
+			tracker.mu.Lock()
+			delete(tracker.active, id)
+			tracker.mu.Unlock()
+		}()
+		c.Next()
+	}
+}
+
+// serveManageSocket принимает соединения на управляющем сокете. Запускается в отдельной горутине.
+func serveManageSocket(ln net.Listener) {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			log.Printf("Management socket stopped: %v", err)
+			return
+		}
+		go handleManageConn(conn)
+	}
+}
+
+// listenManageSocket открывает управляющий сокет с правами только для владельца.
+func listenManageSocket(path string) (net.Listener, error) {
+	ln, err := unixListener(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, manageSocketMode); err != nil {
+		ln.Close()
+		return nil, err
+	}
+	return ln, nil
+}
+
+// handleManageConn обслуживает одно соединение: читает команды построчно и отвечает на них.
+func handleManageConn(conn net.Conn) {
+	defer conn.Close()
+	scanner := bufio.NewScanner(conn)
+	for {
+		fmt.Fprint(conn, "> ")
+		if !scanner.Scan() {
+			return
+		}
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if fields[0] == "quit" || fields[0] == "exit" {
+			return
+		}
+		runManageCommand(conn, fields)
+	}
+}
+
+// runManageCommand выполняет одну команду управляющего сокета.
+func runManageCommand(w io.Writer, fields []string) {
+	switch {
+	case fields[0] == "help":
+		fmt.Fprintln(w, "commands:")
+		fmt.Fprintln(w, "  cache                 list cache entries")
+		fmt.Fprintln(w, "  cache flush [key]     drop a cache entry with its nested keys, or all of them")
+		fmt.Fprintln(w, "  requests              list requests in progress")
+		fmt.Fprintln(w, "  flags                 list feature flags")
+		fmt.Fprintln(w, "  flag <name> on|off    toggle a feature flag until the next settings reload")
+		fmt.Fprintln(w, "  quit                  close the connection")
+
+	case fields[0] == "cache" && len(fields) == 1:
+		for _, line := range cache.describe() {
+			fmt.Fprintln(w, line)
+		}
+
+	case fields[0] == "cache" && len(fields) >= 2 && fields[1] == "flush":
+		n := cache.flush(fields[2:]...)
+		fmt.Fprintf(w, "flushed %d entries\n", n)
+
+	case fields[0] == "requests":
+		tracker.mu.Lock()
+		reqs := make([]activeRequest, 0, len(tracker.active))
+		for _, r := range tracker.active {
+			reqs = append(reqs, r)
+		}
+		tracker.mu.Unlock()
+		sort.Slice(reqs, func(i, j int) bool { return reqs[i].started.Before(reqs[j].started) })
+		for _, r := range reqs {
+			fmt.Fprintf(w, "%8s  %-6s %s  from %s\n", time.Since(r.started).Round(time.Millisecond), r.method, r.path, r.remote)
+		}
+		fmt.Fprintf(w, "%d requests in progress\n", len(reqs))
+
+	case fields[0] == "flags":
+		features := settings().Features
+		names := make([]string, 0, len(features))
+		for name := range features {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Fprintf(w, "%s=%t\n", name, features[name])
+		}
+
+	case fields[0] == "flag" && len(fields) == 3 && (fields[2] == "on" || fields[2] == "off"):
+		setFeature(fields[1], fields[2] == "on")
+		fmt.Fprintf(w, "%s=%s\n", fields[1], fields[2])
+
+	default:
+		fmt.Fprintln(w, "unknown command, try 'help'")
+	}
+}
+
+// setFeature переключает флаг функциональности: копирует действующие настройки,
+// меняет флаг в копии и атомарно подменяет их, как это делает reloadSettings.
+func setFeature(name string, on bool) {
+	for {
+		old := currentSettings.Load()
+		next := *old
+		next.Features = make(map[string]bool, len(old.Features)+1)
+		for k, v := range old.Features {
+			next.Features[k] = v
+		}
+		next.Features[name] = on
+		if currentSettings.CompareAndSwap(old, &next) {
+			return
+		}
+	}
+}
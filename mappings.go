@@ -0,0 +1,343 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Сопоставление внешних идентификаторов партнёров с нашими.
+//
+// У каждого партнёра (тенанта) свои коды гостиниц. Сопоставления хранятся так:
+//
+//	partner_mappings(tenant_id, entity, external_id, internal_id, created_at)
+//	PRIMARY KEY (tenant_id, entity, external_id), UNIQUE (tenant_id, entity, internal_id)
+//
+// Оба ограничения и есть обнаружение конфликтов: один внешний код не может указывать
+// на две наши гостиницы, а на одну нашу гостиницу — два кода одного партнёра. При
+// конфликте API отвечает 409 и показывает мешающее сопоставление.
+//
+// Для несопоставленных гостиниц партнёра POST /api/admin/mappings/suggest предлагает
+// кандидатов по похожести названий (коэффициент Дайса по биграммам транслитерированного
+// названия; совпадение города добавляет уверенности).
+//
+// Пока сопоставляются только гостиницы: типов номеров и тарифов в модели ещё нет,
+// они добавятся в mappingEntities вместе с ними.
+
+// mappingEntities — сопоставляемые сущности и их таблицы (имя таблицы подставляется в SQL).
+var mappingEntities = map[string]string{
+	"hotel": "hotels",
+}
+
+// mappingSuggestionLimit — сколько кандидатов предлагать на одну внешнюю гостиницу.
+const mappingSuggestionLimit = 3
+
+// mappingMinScore — кандидаты с меньшей похожестью не предлагаются.
+const mappingMinScore = 0.3
+
+// maxMappingSuggestItems — максимальный размер пачки для подбора кандидатов.
+const maxMappingSuggestItems = 500
+
+// PartnerMapping — сопоставление внешнего кода партнёра с нашим id.
+type PartnerMapping struct {
+	TenantID   int       `json:"tenant_id"`
+	Entity     string    `json:"entity"`
+	ExternalID string    `json:"external_id"`
+	InternalID int       `json:"internal_id"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// getMappings — HTTP-обработчик списка сопоставлений партнёра.
+// Реагирует на GET /api/admin/mappings?tenant_id=1&entity=hotel
+func getMappings(c *gin.Context) {
+	tenantID, err := strconv.Atoi(c.Query("tenant_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, Response{Success: false, Error: "tenant_id is required"})
+		return
+	}
+	entity := c.DefaultQuery("entity", "hotel")
+	if _, ok := mappingEntities[entity]; !ok {
+		c.JSON(http.StatusBadRequest, Response{Success: false, Error: fmt.Sprintf("unknown entity %q", entity)})
+		return
+	}
+
+	rows, err := db.QueryContext(c.Request.Context(), `
+		SELECT tenant_id, entity, external_id, internal_id, created_at
+		FROM partner_mappings
+		WHERE tenant_id = $1 AND entity = $2
+		ORDER BY external_id
+	`, tenantID, entity)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	mappings := []PartnerMapping{}
+	for rows.Next() {
+		var m PartnerMapping
+		if err := rows.Scan(&m.TenantID, &m.Entity, &m.ExternalID, &m.InternalID, &m.CreatedAt); err != nil {
+			c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+			return
+		}
+		mappings = append(mappings, m)
+	}
+	if err := rows.Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, Response{Success: true, Data: mappings, Count: len(mappings)})
+}
+
+// createMapping — HTTP-обработчик добавления сопоставления.
+// Реагирует на POST /api/admin/mappings с телом
+// {"tenant_id": 1, "entity": "hotel", "external_id": "HTL-00042", "internal_id": 7};
+// при конфликте отвечает 409 с мешающим сопоставлением в data.
+func createMapping(c *gin.Context) {
+	var m PartnerMapping
+	if err := c.ShouldBindJSON(&m); err != nil {
+		c.JSON(http.StatusBadRequest, Response{Success: false, Error: err.Error()})
+		return
+	}
+	if m.Entity == "" {
+		m.Entity = "hotel"
+	}
+	table, ok := mappingEntities[m.Entity]
+	if !ok {
+		c.JSON(http.StatusBadRequest, Response{Success: false, Error: fmt.Sprintf("unknown entity %q", m.Entity)})
+		return
+	}
+	m.ExternalID = strings.TrimSpace(m.ExternalID)
+	if m.ExternalID == "" || len(m.ExternalID) > 100 {
+		c.JSON(http.StatusBadRequest, Response{Success: false, Error: "external_id is required and must be at most 100 characters"})
+		return
+	}
+
+	tx, err := db.BeginTx(c.Request.Context(), nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	var tenantOK, internalOK bool
+	if err := tx.QueryRowContext(c.Request.Context(),
+		"SELECT EXISTS (SELECT 1 FROM tenants WHERE id = $1), EXISTS (SELECT 1 FROM "+table+" WHERE id = $2)",
+		m.TenantID, m.InternalID,
+	).Scan(&tenantOK, &internalOK); err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	if !tenantOK || !internalOK {
+		c.JSON(http.StatusBadRequest, Response{Success: false, Error: fmt.Sprintf("tenant or %s not found", m.Entity)})
+		return
+	}
+
+	// Существующее сопоставление с тем же внешним кодом или той же нашей записью.
+	var existing PartnerMapping
+	err = tx.QueryRowContext(c.Request.Context(), `
+		SELECT tenant_id, entity, external_id, internal_id, created_at
+		FROM partner_mappings
+		WHERE tenant_id = $1 AND entity = $2 AND (external_id = $3 OR internal_id = $4)
+		LIMIT 1
+		FOR UPDATE
+	`, m.TenantID, m.Entity, m.ExternalID, m.InternalID).
+		Scan(&existing.TenantID, &existing.Entity, &existing.ExternalID, &existing.InternalID, &existing.CreatedAt)
+	if err == nil {
+		if existing.ExternalID == m.ExternalID && existing.InternalID == m.InternalID {
+			c.JSON(http.StatusOK, Response{Success: true, Data: existing, Count: 1})
+			return
+		}
+		c.JSON(http.StatusConflict, Response{
+			Success: false,
+			Data:    existing,
+			Error: fmt.Sprintf("%s %d or external id %q is already mapped (%q -> %d)",
+				m.Entity, m.InternalID, m.ExternalID, existing.ExternalID, existing.InternalID),
+			Hint: "delete the existing mapping first",
+		})
+		return
+	}
+	if err != sql.ErrNoRows {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+
+	err = tx.QueryRowContext(c.Request.Context(), `
+		INSERT INTO partner_mappings (tenant_id, entity, external_id, internal_id)
+		VALUES ($1, $2, $3, $4)
+		RETURNING created_at
+	`, m.TenantID, m.Entity, m.ExternalID, m.InternalID).Scan(&m.CreatedAt)
+	if err != nil {
+		// Параллельная вставка того же сопоставления упрётся в уникальный индекс.
+		c.JSON(http.StatusConflict, Response{Success: false, Error: err.Error(), Hint: "retry to see the conflicting mapping"})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, Response{Success: true, Data: m, Count: 1})
+}
+
+// deleteMapping — HTTP-обработчик удаления сопоставления.
+// Реагирует на DELETE /api/admin/mappings/:tenant_id/:entity/:external_id
+func deleteMapping(c *gin.Context) {
+	tenantID, err := strconv.Atoi(c.Param("tenant_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, Response{Success: false, Error: "tenant id must be an integer"})
+		return
+	}
+	res, err := db.ExecContext(c.Request.Context(),
+		"DELETE FROM partner_mappings WHERE tenant_id = $1 AND entity = $2 AND external_id = $3",
+		tenantID, c.Param("entity"), c.Param("external_id"),
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		c.JSON(http.StatusNotFound, Response{Success: false, Error: "mapping not found"})
+		return
+	}
+	c.JSON(http.StatusOK, Response{Success: true})
+}
+
+// MappingCandidate — наша гостиница, похожая на внешнюю.
+type MappingCandidate struct {
+	InternalID int     `json:"internal_id"`
+	Name       string  `json:"name"`
+	CityName   *string `json:"city_name"`
+	Score      float64 `json:"score"`
+	// MappedTo — внешний код, на который эта гостиница уже сопоставлена у партнёра (конфликт).
+	MappedTo *string `json:"mapped_to,omitempty"`
+}
+
+// MappingSuggestion — кандидаты для одной внешней гостиницы.
+type MappingSuggestion struct {
+	ExternalID string `json:"external_id"`
+	// MappedTo — наш id, если внешняя гостиница уже сопоставлена.
+	MappedTo   *int               `json:"mapped_to,omitempty"`
+	Candidates []MappingCandidate `json:"candidates"`
+}
+
+// bigrams возвращает множество биграмм slug-формы строки.
+func bigrams(s string) map[string]bool {
+	r := []rune(strings.ReplaceAll(slugify(s), "-", " "))
+	set := map[string]bool{}
+	for i := 0; i+1 < len(r); i++ {
+		set[string(r[i:i+2])] = true
+	}
+	return set
+}
+
+// nameSimilarity — коэффициент Дайса по биграммам (0 — ничего общего, 1 — совпадение).
+func nameSimilarity(a, b map[string]bool) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+	common := 0
+	for g := range a {
+		if b[g] {
+			common++
+		}
+	}
+	return 2 * float64(common) / float64(len(a)+len(b))
+}
+
+// suggestMappings — HTTP-обработчик подбора кандидатов для несопоставленных гостиниц партнёра.
+// Реагирует на POST /api/admin/mappings/suggest с телом
+// {"tenant_id": 1, "items": [{"external_id": "HTL-00042", "name": "Hotel Astoria", "city": "Saint Petersburg"}]}.
+func suggestMappings(c *gin.Context) {
+	var body struct {
+		TenantID int `json:"tenant_id"`
+		Items    []struct {
+			ExternalID string `json:"external_id"`
+			Name       string `json:"name"`
+			City       string `json:"city"`
+		} `json:"items"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, Response{Success: false, Error: err.Error()})
+		return
+	}
+	if len(body.Items) == 0 || len(body.Items) > maxMappingSuggestItems {
+		c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Error:   fmt.Sprintf("items must contain between 1 and %d entries", maxMappingSuggestItems),
+		})
+		return
+	}
+
+	// Уже сопоставленное у партнёра: в обе стороны.
+	byExternal := map[string]int{}
+	byInternal := map[int]string{}
+	rows, err := db.QueryContext(c.Request.Context(), "SELECT external_id, internal_id FROM partner_mappings WHERE tenant_id = $1 AND entity = 'hotel'", body.TenantID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	for rows.Next() {
+		var ext string
+		var id int
+		if err := rows.Scan(&ext, &id); err != nil {
+			rows.Close()
+			c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+			return
+		}
+		byExternal[ext], byInternal[id] = id, ext
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+
+	// Сопоставлять можно с любой нашей гостиницей, не только опубликованной.
+	set, err := queryHotels(c.Request.Context(), true, hotelSelect)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	grams := make([]map[string]bool, len(set.Items))
+	for i, h := range set.Items {
+		grams[i] = bigrams(h.Name)
+	}
+
+	suggestions := make([]MappingSuggestion, 0, len(body.Items))
+	for _, item := range body.Items {
+		s := MappingSuggestion{ExternalID: item.ExternalID, Candidates: []MappingCandidate{}}
+		if id, ok := byExternal[item.ExternalID]; ok {
+			s.MappedTo = &id
+			suggestions = append(suggestions, s)
+			continue
+		}
+		want := bigrams(item.Name)
+		for i, h := range set.Items {
+			score := nameSimilarity(want, grams[i])
+			if item.City != "" && h.CityName != nil && slugify(item.City) == slugify(*h.CityName) {
+				score = score*0.9 + 0.1
+			}
+			if score < mappingMinScore {
+				continue
+			}
+			cand := MappingCandidate{InternalID: h.ID, Name: h.Name, CityName: h.CityName, Score: math.Round(score*100) / 100}
+			if ext, ok := byInternal[h.ID]; ok {
+				cand.MappedTo = &ext
+			}
+			s.Candidates = append(s.Candidates, cand)
+		}
+		sort.SliceStable(s.Candidates, func(i, j int) bool { return s.Candidates[i].Score > s.Candidates[j].Score })
+		if len(s.Candidates) > mappingSuggestionLimit {
+			s.Candidates = s.Candidates[:mappingSuggestionLimit]
+		}
+		suggestions = append(suggestions, s)
+	}
+	c.JSON(http.StatusOK, Response{Success: true, Data: suggestions, Count: len(suggestions)})
+}
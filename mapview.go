@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Данные для карты гостиниц.
+//
+// GET /api/hotels/map?bbox=minLon,minLat,maxLon,maxLat&zoom=N отдаёт гостиницы в видимой
+// области. Пока их немного или карта приближена, это отдельные метки; иначе сервер
+// группирует их по сетке, привязанной к тайлам карты (mapCellsPerTile ячеек на сторону
+// тайла), и отдаёт кластеры: число гостиниц, центр масс и диапазон цен. Так карта
+// не получает десятки тысяч меток разом. Сетка фиксирована для зума, поэтому при
+// сдвиге карты кластеры не «прыгают». Гостиницы без координат на карту не попадают.
+
+// mapMaxZoom — максимальный зум карты.
+const mapMaxZoom = 22
+
+// mapPinZoom — начиная с этого зума кластеры не строятся.
+const mapPinZoom = 15
+
+// mapMaxPins — если в области не больше стольких гостиниц, кластеры не строятся.
+const mapMaxPins = 200
+
+// mapCellsPerTile — ячеек сетки кластеризации на сторону тайла (тайл 256 px, ячейка ~64 px).
+const mapCellsPerTile = 4
+
+// MapPin — отдельная гостиница на карте.
+type MapPin struct {
+	ID        int      `json:"id"`
+	Name      string   `json:"name"`
+	Slug      *string  `json:"slug"`
+	Latitude  float64  `json:"latitude"`
+	Longitude float64  `json:"longitude"`
+	Price     *float64 `json:"price"`
+}
+
+// MapCluster — группа гостиниц одной ячейки сетки.
+type MapCluster struct {
+	Count     int      `json:"count"`
+	Latitude  float64  `json:"latitude"`
+	Longitude float64  `json:"longitude"`
+	MinPrice  *float64 `json:"min_price"`
+	MaxPrice  *float64 `json:"max_price"`
+}
+
+// MapView — ответ для карты: либо метки, либо кластеры (mode).
+type MapView struct {
+	Mode     string       `json:"mode"`
+	Total    int          `json:"total"`
+	Pins     []MapPin     `json:"pins,omitempty"`
+	Clusters []MapCluster `json:"clusters,omitempty"`
+}
+
+// parseBBox разбирает bbox=minLon,minLat,maxLon,maxLat.
+func parseBBox(s string) ([4]float64, error) {
+	var box [4]float64
+	parts := strings.Split(s, ",")
+	if len(parts) != 4 {
+		return box, fmt.Errorf("bbox must be minLon,minLat,maxLon,maxLat")
+	}
+	for i, p := range parts {
+		v, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
+		if err != nil {
+			return box, fmt.Errorf("bbox must be minLon,minLat,maxLon,maxLat")
+		}
+		box[i] = v
+	}
+	if !validCoordinates(box[1], box[0]) || !validCoordinates(box[3], box[2]) || box[0] > box[2] || box[1] > box[3] {
+		return box, fmt.Errorf("bbox is out of range or inverted")
+	}
+	return box, nil
+}
+
+// clusterHotels группирует метки по ячейкам сетки для зума zoom.
+func clusterHotels(pins []MapPin, zoom int) []MapCluster {
+	cell := 360 / (math.Exp2(float64(zoom)) * mapCellsPerTile)
+	type acc struct {
+		cluster  MapCluster
+		lat, lon float64
+	}
+	cells := map[[2]int]*acc{}
+	var order [][2]int
+	for _, p := range pins {
+		key := [2]int{int(math.Floor((p.Longitude + 180) / cell)), int(math.Floor((p.Latitude + 90) / cell))}
+		a, ok := cells[key]
+		if !ok {
+			a = &acc{}
+			cells[key] = a
+			order = append(order, key)
+		}
+		a.cluster.Count++
+		a.lat += p.Latitude
+		a.lon += p.Longitude
+		if p.Price != nil {
+			if a.cluster.MinPrice == nil || *p.Price < *a.cluster.MinPrice {
+				a.cluster.MinPrice = p.Price
+			}
+			if a.cluster.MaxPrice == nil || *p.Price > *a.cluster.MaxPrice {
+				a.cluster.MaxPrice = p.Price
+			}
+		}
+	}
+
+	clusters := make([]MapCluster, 0, len(order))
+	for _, key := range order {
+		a := cells[key]
+		a.cluster.Latitude = a.lat / float64(a.cluster.Count)
+		a.cluster.Longitude = a.lon / float64(a.cluster.Count)
+		clusters = append(clusters, a.cluster)
+	}
+	// Крупные кластеры первыми: клиент может отрисовать их раньше.
+	sort.SliceStable(clusters, func(i, j int) bool { return clusters[i].Count > clusters[j].Count })
+	return clusters
+}
+
+// getHotelsMap — HTTP-обработчик данных для карты гостиниц.
+// Реагирует на GET /api/hotels/map?bbox=minLon,minLat,maxLon,maxLat&zoom=N;
+// фильтры атрибутов, доступности и услуг применяются так же, как в списке.
+func getHotelsMap(c *gin.Context) {
+	box, err := parseBBox(c.Query("bbox"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, Response{Success: false, Error: err.Error()})
+		return
+	}
+	zoom, err := strconv.Atoi(c.Query("zoom"))
+	if err != nil || zoom < 0 || zoom > mapMaxZoom {
+		c.JSON(http.StatusBadRequest, Response{Success: false, Error: fmt.Sprintf("zoom must be an integer between 0 and %d", mapMaxZoom)})
+		return
+	}
+
+	strict := strictScan(c)
+	hotels, status, err := cache.get(c.Request.Context(), "hotels", settings().HotelsCache, func(ctx context.Context) (interface{}, error) {
+		return loadHotels(ctx, strict)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	c.Header("X-Cache", status)
+
+	set := hotels.(rowSet[Hotel])
+	list, ok := applyAttributes(c, set.Items)
+	if !ok {
+		return
+	}
+	list = applyMarket(c, list)
+	if list, ok = applyAccessibility(c, list); !ok {
+		return
+	}
+	if list, ok = applyExtras(c, list); !ok {
+		return
+	}
+
+	pins := []MapPin{}
+	for _, h := range list {
+		if h.Latitude == nil || h.Longitude == nil {
+			continue
+		}
+		lat, lon := *h.Latitude, *h.Longitude
+		if lon < box[0] || lat < box[1] || lon > box[2] || lat > box[3] {
+			continue
+		}
+		pins = append(pins, MapPin{ID: h.ID, Name: h.Name, Slug: h.Slug, Latitude: lat, Longitude: lon, Price: h.Price})
+	}
+
+	view := MapView{Mode: "pins", Total: len(pins), Pins: pins}
+	count := len(pins)
+	if zoom < mapPinZoom && len(pins) > mapMaxPins {
+		view = MapView{Mode: "clusters", Total: len(pins), Clusters: clusterHotels(pins, zoom)}
+		count = len(view.Clusters)
+	}
+	c.JSON(http.StatusOK, Response{Success: true, Data: view, Count: count, Partial: set.Partial})
+}
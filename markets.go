@@ -0,0 +1,157 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+// Региональные ограничения продаж.
+//
+// Часть гостиниц можно продавать только на определённых рынках. У гостиницы есть
+// списки стран (ISO 3166-1 alpha-2), где продажа разрешена или запрещена:
+//
+//	hotels.allowed_countries text[] NULL — если не пуст, продаём только в этих странах
+//	hotels.blocked_countries text[] NULL — в этих странах не продаём никогда
+//
+// Страна клиента определяется по IP (см. geoip.go). Недоступные клиенту гостиницы
+// исчезают из поиска, карты, фасетов и виджета, а бронирование такой гостиницы
+// отклоняется с кодом market_restricted. Если страну определить не удалось,
+// гостиница со списком разрешённых стран считается недоступной: продать туда,
+// куда нельзя, хуже, чем не показать.
+
+// errCodeMarketRestricted — код ошибки при попытке забронировать гостиницу, закрытую для рынка клиента.
+const errCodeMarketRestricted = "market_restricted"
+
+// MarketRules — ограничения продаж гостиницы по странам.
+type MarketRules struct {
+	Allowed pq.StringArray `json:"allowed_countries"`
+	Blocked pq.StringArray `json:"blocked_countries"`
+}
+
+// sellableIn сообщает, можно ли продавать гостиницу клиенту из страны country ("" — неизвестна).
+func (m MarketRules) sellableIn(country string) bool {
+	for _, c := range m.Blocked {
+		if c == country {
+			return false
+		}
+	}
+	if len(m.Allowed) == 0 {
+		return true
+	}
+	for _, c := range m.Allowed {
+		if c == country {
+			return true
+		}
+	}
+	return false
+}
+
+// applyMarket убирает из списка гостиницы, которые нельзя продавать в стране клиента.
+func applyMarket(c *gin.Context, hotels []Hotel) []Hotel {
+	country := clientCountry(c)
+	result := make([]Hotel, 0, len(hotels))
+	for _, h := range hotels {
+		if h.Markets.sellableIn(country) {
+			result = append(result, h)
+		}
+	}
+	return result
+}
+
+// marketWhere добавляет в условия запроса то же правило, что sellableIn: страна не
+// в blocked_countries и allowed_countries пуст или содержит её.
+func marketWhere(q *sqlConditions, country string) {
+	p := q.arg(country)
+	q.and("NOT (" + p + " = ANY(COALESCE(h.blocked_countries, '{}'))) AND " +
+		"(COALESCE(cardinality(h.allowed_countries), 0) = 0 OR " + p + " = ANY(h.allowed_countries))")
+}
+
+// requireMarket проверяет, что гостиницу можно продавать клиенту, и иначе отвечает 403
+// с кодом market_restricted. Вызывается в эндпоинтах бронирования внутри их транзакции.
+func requireMarket(c *gin.Context, tx *sql.Tx, hotelID int) bool {
+	var m MarketRules
+	err := tx.QueryRowContext(c.Request.Context(), "SELECT allowed_countries, blocked_countries FROM hotels WHERE id = $1", hotelID).
+		Scan(&m.Allowed, &m.Blocked)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, Response{Success: false, Error: "hotel not found"})
+		return false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return false
+	}
+	country := clientCountry(c)
+	if !m.sellableIn(country) {
+		if country == "" {
+			country = "unknown"
+		}
+		c.JSON(http.StatusForbidden, Response{
+			Success: false,
+			Code:    errCodeMarketRestricted,
+			Error:   fmt.Sprintf("hotel %d is not available in your market (%s)", hotelID, country),
+		})
+		return false
+	}
+	return true
+}
+
+// normalizeCountries приводит коды стран к верхнему регистру и проверяет формат.
+func normalizeCountries(codes []string) (pq.StringArray, error) {
+	result := pq.StringArray{}
+	seen := map[string]bool{}
+	for _, code := range codes {
+		code = strings.ToUpper(strings.TrimSpace(code))
+		if !countryCodeRe.MatchString(code) {
+			return nil, fmt.Errorf("invalid country code %q", code)
+		}
+		if !seen[code] {
+			seen[code] = true
+			result = append(result, code)
+		}
+	}
+	return result, nil
+}
+
+// setHotelMarkets — HTTP-обработчик, задающий ограничения продаж гостиницы.
+// Реагирует на PUT /api/admin/hotels/:id/markets с телом
+// {"allowed_countries": ["RU", "BY"], "blocked_countries": []}; пустые списки снимают ограничения.
+func setHotelMarkets(c *gin.Context) {
+	id, ok := hotelIDParam(c)
+	if !ok {
+		return
+	}
+	var body struct {
+		Allowed []string `json:"allowed_countries"`
+		Blocked []string `json:"blocked_countries"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, Response{Success: false, Error: err.Error()})
+		return
+	}
+	var m MarketRules
+	var err error
+	if m.Allowed, err = normalizeCountries(body.Allowed); err == nil {
+		m.Blocked, err = normalizeCountries(body.Blocked)
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, Response{Success: false, Error: err.Error()})
+		return
+	}
+
+	res, err := db.ExecContext(c.Request.Context(), "UPDATE hotels SET allowed_countries = $2, blocked_countries = $3 WHERE id = $1", id, m.Allowed, m.Blocked)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		c.JSON(http.StatusNotFound, Response{Success: false, Error: "hotel not found"})
+		return
+	}
+	cache.flush("hotels")
+	c.JSON(http.StatusOK, Response{Success: true, Data: gin.H{"id": id, "markets": m}, Count: 1})
+}
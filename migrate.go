@@ -0,0 +1,352 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Миграции схемы БД.
+//
+// Схема описана SQL-файлами в каталоге migrations, которые встраиваются в бинарник:
+// новая установка поднимается с пустой БД одной командой, без отдельного набора
+// скриптов рядом с приложением. Файл называется NNNN_описание.up.sql; номер задаёт
+// порядок применения и не переиспользуется. Рядом может лежать NNNN_описание.down.sql,
+// отменяющий миграцию, — без него откатить её нельзя. Применённые версии записываются в
+//
+//	schema_migrations(version, name, applied_at)
+//
+// Каждая миграция выполняется в своей транзакции вместе с записью о ней, поэтому
+// упавшая миграция не остаётся применённой наполовину. Всё время применения
+// держится advisory-блокировка: несколько экземпляров, запущенных одновременно
+// с serve -migrate, не применят одну миграцию дважды.
+//
+//	WB migrate [up]              — применить недостающие миграции
+//	WB migrate down [-steps N]   — откатить N последних применённых миграций (по умолчанию одну)
+//	WB migrate status            — показать применённые и ожидающие миграции
+//
+// Откат, уничтожающий данные, которые миграция не создавала, помечается в .down.sql
+// строкой destructiveDownMarker и выполняется только с -force. Так помечен откат
+// 0001_initial: он удаляет все таблицы, в том числе cities и hotels, которые на
+// существующих установках были до миграций и 0001 лишь приняла как есть.
+// Без -force migrate down отказывается, не откатив ни одной миграции.
+//
+// Уже применённые файлы не редактируются: изменение схемы — это новая миграция.
+// Вместе с ней дополняется expectedSchema (см. schema.go).
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// migrationFileRe — имя файла миграции: номер версии и описание.
+var migrationFileRe = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.(up|down)\.sql$`)
+
+// destructiveDownMarker — строка в .down.sql, после которой откат требует -force.
+const destructiveDownMarker = "-- migrate: destructive"
+
+// migrationLockID — ключ advisory-блокировки на время применения миграций.
+const migrationLockID = 0x77625f6d6967 // "wb_mig"
+
+// migration — одна миграция из каталога migrations.
+type migration struct {
+	Version int
+	Name    string
+	SQL     string
+	// Down — SQL отката; пусто, если файла .down.sql нет.
+	Down string
+	// Destructive — откат удаляет данные, которые миграция не создавала (см. destructiveDownMarker).
+	Destructive bool
+}
+
+// MigrationStatus — состояние миграции для WB migrate status.
+type MigrationStatus struct {
+	Version   int        `json:"version"`
+	Name      string     `json:"name"`
+	AppliedAt *time.Time `json:"applied_at"`
+}
+
+// loadMigrations читает встроенные миграции, упорядоченные по версии.
+func loadMigrations() ([]migration, error) {
+	entries, err := fs.ReadDir(migrationFiles, "migrations")
+	if err != nil {
+		return nil, err
+	}
+	byVersion := map[int]*migration{}
+	for _, e := range entries {
+		m := migrationFileRe.FindStringSubmatch(e.Name())
+		if m == nil {
+			return nil, fmt.Errorf("migration file %s: name must look like 0001_description.up.sql", e.Name())
+		}
+		version, _ := strconv.Atoi(m[1])
+		body, err := fs.ReadFile(migrationFiles, path.Join("migrations", e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		mig := byVersion[version]
+		if mig == nil {
+			mig = &migration{Version: version, Name: m[2]}
+			byVersion[version] = mig
+		}
+		if mig.Name != m[2] {
+			return nil, fmt.Errorf("migration version %d is used by both %s and %s", version, mig.Name, m[2])
+		}
+		if m[3] == "up" {
+			mig.SQL = string(body)
+		} else {
+			mig.Down = string(body)
+			mig.Destructive = strings.Contains(mig.Down, destructiveDownMarker)
+		}
+	}
+	var migrations []migration
+	for _, m := range byVersion {
+		if m.SQL == "" {
+			return nil, fmt.Errorf("migration %04d_%s has no .up.sql file", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// appliedMigrations возвращает время применения каждой записанной версии.
+// Пока таблицы schema_migrations нет, применённых версий тоже нет.
+func appliedMigrations(ctx context.Context, q interface {
+	QueryRowContext(context.Context, string, ...interface{}) *sql.Row
+	QueryContext(context.Context, string, ...interface{}) (*sql.Rows, error)
+}) (map[int]time.Time, error) {
+	applied := map[int]time.Time{}
+	var exists bool
+	if err := q.QueryRowContext(ctx, "SELECT to_regclass('schema_migrations') IS NOT NULL").Scan(&exists); err != nil {
+		return nil, err
+	}
+	if !exists {
+		return applied, nil
+	}
+	rows, err := q.QueryContext(ctx, "SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var version int
+		var at time.Time
+		if err := rows.Scan(&version, &at); err != nil {
+			return nil, err
+		}
+		applied[version] = at
+	}
+	return applied, rows.Err()
+}
+
+// migrateUp применяет недостающие миграции по порядку и возвращает применённые.
+func migrateUp(ctx context.Context) ([]migration, error) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	var done []migration
+	err = withMigrationLock(ctx, func(conn *sql.Conn) error {
+		applied, err := appliedMigrations(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for _, m := range migrations {
+			if _, ok := applied[m.Version]; ok {
+				continue
+			}
+			err := runMigration(ctx, conn, m.SQL,
+				"INSERT INTO schema_migrations (version, name) VALUES ($1, $2)", m.Version, m.Name)
+			if err != nil {
+				return fmt.Errorf("migration %04d_%s: %w", m.Version, m.Name, err)
+			}
+			log.Printf("Applied migration %04d_%s", m.Version, m.Name)
+			done = append(done, m)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// migrateDown откатывает steps последних применённых миграций и возвращает откаченные.
+// Разрушительные откаты (см. destructiveDownMarker) выполняются только с force; если
+// среди steps миграций есть такой, а force не задан, не откатывается ни одна.
+func migrateDown(ctx context.Context, steps int, force bool) ([]migration, error) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return nil, err
+	}
+	byVersion := map[int]migration{}
+	for _, m := range migrations {
+		byVersion[m.Version] = m
+	}
+
+	var done []migration
+	err = withMigrationLock(ctx, func(conn *sql.Conn) error {
+		applied, err := appliedMigrations(ctx, conn)
+		if err != nil {
+			return err
+		}
+		versions := make([]int, 0, len(applied))
+		for v := range applied {
+			versions = append(versions, v)
+		}
+		sort.Sort(sort.Reverse(sort.IntSlice(versions)))
+		if steps < len(versions) {
+			versions = versions[:steps]
+		}
+		for _, v := range versions {
+			m, ok := byVersion[v]
+			if !ok {
+				// БД уже обновлена более новой версией приложения.
+				return fmt.Errorf("migration %04d is applied but unknown to this build", v)
+			}
+			if m.Down == "" {
+				return fmt.Errorf("migration %04d_%s has no .down.sql file and cannot be rolled back", m.Version, m.Name)
+			}
+			if m.Destructive && !force {
+				return fmt.Errorf("rolling back migration %04d_%s drops tables that existed before migrations, with all their data; "+
+					"nothing was rolled back, rerun with -force if that is intended", m.Version, m.Name)
+			}
+		}
+		for _, v := range versions {
+			m := byVersion[v]
+			if err := runMigration(ctx, conn, m.Down, "DELETE FROM schema_migrations WHERE version = $1", m.Version); err != nil {
+				return fmt.Errorf("rolling back migration %04d_%s: %w", m.Version, m.Name, err)
+			}
+			log.Printf("Rolled back migration %04d_%s", m.Version, m.Name)
+			done = append(done, m)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// withMigrationLock выполняет fn под advisory-блокировкой миграций. Блокировка
+// сессионная, поэтому всё делается на одном соединении пула.
+func withMigrationLock(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", migrationLockID); err != nil {
+		return err
+	}
+	defer conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", migrationLockID)
+
+	if _, err := conn.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version    integer PRIMARY KEY,
+			name       text NOT NULL,
+			applied_at timestamptz NOT NULL DEFAULT now()
+		)
+	`); err != nil {
+		return err
+	}
+	return fn(conn)
+}
+
+// runMigration выполняет SQL миграции и запись о ней в schema_migrations в одной транзакции.
+func runMigration(ctx context.Context, conn *sql.Conn, script, record string, args ...interface{}) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, script); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, record, args...); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// migrationStatus сопоставляет встроенные миграции с применёнными.
+func migrationStatus(ctx context.Context) ([]MigrationStatus, error) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return nil, err
+	}
+	applied, err := appliedMigrations(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	status := make([]MigrationStatus, len(migrations))
+	for i, m := range migrations {
+		status[i] = MigrationStatus{Version: m.Version, Name: m.Name}
+		if at, ok := applied[m.Version]; ok {
+			status[i].AppliedAt = &at
+		}
+	}
+	return status, nil
+}
+
+// runMigrate — команда migrate: применение и откат миграций, отчёт о них.
+func runMigrate(args []string) error {
+	action := "up"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		action, args = args[0], args[1:]
+	}
+	flags := flag.NewFlagSet("migrate "+action, flag.ExitOnError)
+	steps := flags.Int("steps", 1, "number of migrations to roll back (down only)")
+	force := flags.Bool("force", false, "allow rollbacks that drop pre-existing tables and their data, such as 0001_initial (down only)")
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s migrate [up|down|status] [flags]\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if action != "up" && action != "down" && action != "status" {
+		flags.Usage()
+		return fmt.Errorf("unknown action %q", action)
+	}
+	if *steps < 1 {
+		return fmt.Errorf("-steps must be at least 1")
+	}
+
+	// Остальным подсистемам нужны таблицы, которых на пустой БД ещё нет.
+	if err := newApp(databaseComponents()...).start(context.Background()); err != nil {
+		return err
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	if action == "status" {
+		status, err := migrationStatus(ctx)
+		if err != nil {
+			return err
+		}
+		for _, s := range status {
+			applied := "pending"
+			if s.AppliedAt != nil {
+				applied = "applied " + s.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Printf("%04d_%-30s %s\n", s.Version, s.Name, applied)
+		}
+		return nil
+	}
+
+	if action == "down" {
+		done, err := migrateDown(ctx, *steps, *force)
+		if err == nil && len(done) == 0 {
+			log.Println("No applied migrations to roll back")
+		}
+		return err
+	}
+	done, err := migrateUp(ctx)
+	if err == nil && len(done) == 0 {
+		log.Println("Database schema is up to date")
+	}
+	return err
+}
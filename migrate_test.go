@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestInitialRollbackIsDestructive(t *testing.T) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range migrations {
+		if m.Version == 1 && !m.Destructive {
+			t.Errorf("%04d_%s drops the baseline tables but its rollback is not marked destructive", m.Version, m.Name)
+		}
+	}
+}
+
+func TestMigrateDownRefusesWithoutForce(t *testing.T) {
+	testDB(t)
+	cityID := testCity(t, "Moscow")
+	migrations, err := loadMigrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done, err := migrateDown(context.Background(), len(migrations), false)
+	if err == nil || !strings.Contains(err.Error(), "-force") {
+		t.Fatalf("rolling back everything without -force: err = %v", err)
+	}
+	if len(done) != 0 {
+		t.Fatalf("%d migrations were rolled back before the refusal", len(done))
+	}
+	var name string
+	if err := db.QueryRow("SELECT name FROM cities WHERE id = $1", cityID).Scan(&name); err != nil {
+		t.Fatalf("baseline data is gone: %v", err)
+	}
+	applied, err := appliedMigrations(context.Background(), db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(applied) != len(migrations) {
+		t.Errorf("%d of %d migrations are still applied", len(applied), len(migrations))
+	}
+}
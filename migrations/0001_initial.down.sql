@@ -0,0 +1,13 @@
+-- Удаляет всю схему вместе с данными. Зависимые таблицы — раньше тех, на которые они ссылаются.
+-- cities и hotels на существующих установках были до миграций, поэтому откат требует -force:
+-- migrate: destructive
+
+DROP TABLE IF EXISTS
+    blobs,
+    qa_votes, hotel_answers, hotel_questions,
+    events, promotion_stats, promotions,
+    price_alerts, checkin_audit, booking_guests, booking_shares, bookings,
+    refresh_tokens, users,
+    widget_tokens, partner_mappings, usage_rollups, quota_usage, api_keys, tenants,
+    attribute_definitions, hotel_poi_distances, pois, short_links, slug_history,
+    hotel_revisions, price_audit, hotel_prices, hotels, city_audit, city_aliases, cities;
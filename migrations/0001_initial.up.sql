@@ -0,0 +1,340 @@
+-- Исходная схема. Все объекты создаются с IF NOT EXISTS: на базе, схему которой
+-- раньше вели вручную, миграция ничего не ломает и только отмечается применённой.
+-- Расхождения с тем, что ждёт код, покажет проверка схемы при запуске (schema.go).
+
+-- Справочники.
+
+CREATE TABLE IF NOT EXISTS cities (
+    id           serial PRIMARY KEY,
+    name         text NOT NULL,
+    slug         text,
+    geoname_id   integer UNIQUE,
+    country_code text,
+    latitude     double precision,
+    longitude    double precision,
+    population   bigint
+);
+
+CREATE TABLE IF NOT EXISTS city_aliases (
+    id         serial PRIMARY KEY,
+    city_id    integer NOT NULL REFERENCES cities (id),
+    old_id     integer,
+    old_name   text NOT NULL,
+    created_at timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS city_audit (
+    id           serial PRIMARY KEY,
+    action       text NOT NULL,
+    city_id      integer NOT NULL,
+    source_id    integer,
+    old_name     text NOT NULL DEFAULT '',
+    new_name     text NOT NULL DEFAULT '',
+    hotels_moved integer NOT NULL DEFAULT 0,
+    request_id   text,
+    created_at   timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS hotels (
+    id                serial PRIMARY KEY,
+    name              text NOT NULL,
+    slug              text,
+    city              integer REFERENCES cities (id),
+    capacity          integer,
+    price             numeric(12, 2),
+    status            text NOT NULL DEFAULT 'draft',
+    publish_at        timestamptz,
+    description       text,
+    attributes        jsonb,
+    latitude          double precision,
+    longitude         double precision,
+    allowed_countries text[],
+    blocked_countries text[],
+    accessibility     jsonb,
+    extras            jsonb,
+    deleted_at        timestamptz
+);
+CREATE INDEX IF NOT EXISTS hotels_city_idx ON hotels (city);
+CREATE INDEX IF NOT EXISTS hotels_slug_idx ON hotels (slug);
+
+CREATE TABLE IF NOT EXISTS hotel_prices (
+    hotel_id       integer NOT NULL REFERENCES hotels (id),
+    price          numeric(12, 2) NOT NULL,
+    effective_from timestamptz NOT NULL,
+    created_at     timestamptz NOT NULL DEFAULT now(),
+    PRIMARY KEY (hotel_id, effective_from)
+);
+
+CREATE TABLE IF NOT EXISTS price_audit (
+    id             serial PRIMARY KEY,
+    hotel_id       integer NOT NULL,
+    old_price      numeric(12, 2),
+    new_price      numeric(12, 2) NOT NULL,
+    effective_from timestamptz NOT NULL,
+    request_id     text,
+    created_at     timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS hotel_revisions (
+    id         serial PRIMARY KEY,
+    hotel_id   integer NOT NULL,
+    field      text NOT NULL,
+    value      text,
+    request_id text,
+    created_at timestamptz NOT NULL DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS hotel_revisions_hotel_idx ON hotel_revisions (hotel_id, created_at);
+
+CREATE TABLE IF NOT EXISTS slug_history (
+    entity     text NOT NULL,
+    slug       text NOT NULL,
+    entity_id  integer NOT NULL,
+    created_at timestamptz NOT NULL DEFAULT now(),
+    PRIMARY KEY (entity, slug)
+);
+
+CREATE TABLE IF NOT EXISTS short_links (
+    code       text PRIMARY KEY,
+    entity     text NOT NULL,
+    entity_id  integer NOT NULL,
+    created_at timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS pois (
+    id         serial PRIMARY KEY,
+    city_id    integer NOT NULL REFERENCES cities (id),
+    kind       text NOT NULL,
+    name       text NOT NULL,
+    latitude   double precision NOT NULL,
+    longitude  double precision NOT NULL,
+    created_at timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS hotel_poi_distances (
+    hotel_id   integer NOT NULL REFERENCES hotels (id),
+    poi_id     integer NOT NULL REFERENCES pois (id),
+    distance_m integer NOT NULL,
+    PRIMARY KEY (hotel_id, poi_id)
+);
+
+CREATE TABLE IF NOT EXISTS attribute_definitions (
+    key            text PRIMARY KEY,
+    tenant_id      integer,
+    type           text NOT NULL,
+    allowed_values text[],
+    label          text NOT NULL DEFAULT '',
+    created_at     timestamptz NOT NULL DEFAULT now()
+);
+
+-- Партнёры и учёт использования API.
+
+CREATE TABLE IF NOT EXISTS tenants (
+    id             serial PRIMARY KEY,
+    name           text NOT NULL,
+    plan           text NOT NULL,
+    monthly_quota  integer NOT NULL,
+    price_per_call numeric(12, 4) NOT NULL DEFAULT 0
+);
+
+CREATE TABLE IF NOT EXISTS api_keys (
+    key           text PRIMARY KEY,
+    tenant_id     integer NOT NULL REFERENCES tenants (id),
+    monthly_quota integer,
+    revoked       boolean NOT NULL DEFAULT false
+);
+
+CREATE TABLE IF NOT EXISTS quota_usage (
+    api_key   text NOT NULL,
+    tenant_id integer NOT NULL,
+    period    timestamptz NOT NULL,
+    requests  integer NOT NULL,
+    PRIMARY KEY (api_key, period)
+);
+
+CREATE TABLE IF NOT EXISTS usage_rollups (
+    api_key     text NOT NULL,
+    tenant_id   integer NOT NULL,
+    granularity text NOT NULL,
+    bucket      timestamptz NOT NULL,
+    requests    bigint NOT NULL,
+    bytes       bigint NOT NULL,
+    PRIMARY KEY (api_key, granularity, bucket)
+);
+
+CREATE TABLE IF NOT EXISTS partner_mappings (
+    tenant_id   integer NOT NULL REFERENCES tenants (id),
+    entity      text NOT NULL,
+    external_id text NOT NULL,
+    internal_id integer NOT NULL,
+    created_at  timestamptz NOT NULL DEFAULT now(),
+    PRIMARY KEY (tenant_id, entity, external_id),
+    UNIQUE (tenant_id, entity, internal_id)
+);
+
+CREATE TABLE IF NOT EXISTS widget_tokens (
+    token      text PRIMARY KEY,
+    tenant_id  integer NOT NULL REFERENCES tenants (id),
+    origins    text[] NOT NULL,
+    config     jsonb,
+    revoked    boolean NOT NULL DEFAULT false,
+    created_at timestamptz NOT NULL DEFAULT now()
+);
+
+-- Пользователи.
+
+CREATE TABLE IF NOT EXISTS users (
+    id            serial PRIMARY KEY,
+    email         text NOT NULL UNIQUE,
+    name          text NOT NULL,
+    password_hash text NOT NULL,
+    role          text NOT NULL DEFAULT 'user',
+    created_at    timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+    token_hash text PRIMARY KEY,
+    user_id    integer NOT NULL REFERENCES users (id),
+    expires_at timestamptz NOT NULL,
+    revoked_at timestamptz,
+    created_at timestamptz NOT NULL DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS refresh_tokens_user_idx ON refresh_tokens (user_id);
+
+-- Бронирования.
+
+CREATE TABLE IF NOT EXISTS bookings (
+    id            serial PRIMARY KEY,
+    hotel_id      integer NOT NULL REFERENCES hotels (id),
+    tenant_id     integer REFERENCES tenants (id),
+    user_id       integer REFERENCES users (id),
+    guest_name    text NOT NULL,
+    check_in      date NOT NULL,
+    check_out     date NOT NULL,
+    guests        integer NOT NULL,
+    status        text NOT NULL,
+    total         numeric(12, 2) NOT NULL,
+    created_at    timestamptz NOT NULL DEFAULT now(),
+    cancelled_at  timestamptz,
+    checked_in_at timestamptz
+);
+CREATE INDEX IF NOT EXISTS bookings_hotel_dates_idx ON bookings (hotel_id, check_in, check_out);
+
+CREATE TABLE IF NOT EXISTS booking_shares (
+    token      text PRIMARY KEY,
+    booking_id integer NOT NULL REFERENCES bookings (id),
+    permission text NOT NULL,
+    expires_at timestamptz NOT NULL,
+    revoked    boolean NOT NULL DEFAULT false,
+    created_at timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS booking_guests (
+    id          serial PRIMARY KEY,
+    booking_id  integer NOT NULL REFERENCES bookings (id),
+    name        text NOT NULL,
+    email       text,
+    share_token text,
+    created_at  timestamptz NOT NULL DEFAULT now()
+);
+
+-- Журнал ссылается на бронирование и гостиницу без внешних ключей: в нём бывают
+-- и попытки с чужой гостиницей, и записи должны переживать удаление бронирования.
+CREATE TABLE IF NOT EXISTS checkin_audit (
+    id         bigserial PRIMARY KEY,
+    booking_id integer,
+    hotel_id   integer NOT NULL,
+    outcome    text NOT NULL,
+    actor      text NOT NULL,
+    request_id text,
+    created_at timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS price_alerts (
+    id           serial PRIMARY KEY,
+    hotel_id     integer NOT NULL REFERENCES hotels (id),
+    session_id   text NOT NULL,
+    check_in     date NOT NULL,
+    check_out    date NOT NULL,
+    threshold    numeric(12, 2) NOT NULL,
+    last_quote   numeric(12, 2),
+    triggered_at timestamptz,
+    notified_at  timestamptz,
+    created_at   timestamptz NOT NULL DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS price_alerts_session_idx ON price_alerts (session_id);
+
+-- Продвижение и аналитика.
+
+CREATE TABLE IF NOT EXISTS promotions (
+    id         serial PRIMARY KEY,
+    hotel_id   integer NOT NULL REFERENCES hotels (id),
+    city_id    integer REFERENCES cities (id),
+    starts_at  timestamptz NOT NULL,
+    ends_at    timestamptz NOT NULL,
+    created_at timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS promotion_stats (
+    promotion_id integer NOT NULL REFERENCES promotions (id),
+    day          date NOT NULL,
+    impressions  integer NOT NULL DEFAULT 0,
+    clicks       integer NOT NULL DEFAULT 0,
+    PRIMARY KEY (promotion_id, day)
+);
+
+-- События приходят от клиентов пачками через COPY; ссылки на гостиницу и город
+-- не проверяются, при удалении гостиницы hotel_id обнуляется (см. hotelHardDeletes).
+CREATE TABLE IF NOT EXISTS events (
+    id          bigserial PRIMARY KEY,
+    type        text NOT NULL,
+    hotel_id    integer,
+    city_id     integer,
+    session_id  text NOT NULL DEFAULT '',
+    api_key     text,
+    occurred_at timestamptz NOT NULL,
+    received_at timestamptz NOT NULL DEFAULT now(),
+    props       jsonb
+);
+CREATE INDEX IF NOT EXISTS events_occurred_at_idx ON events (occurred_at);
+
+-- Вопросы и ответы.
+
+CREATE TABLE IF NOT EXISTS hotel_questions (
+    id                serial PRIMARY KEY,
+    hotel_id          integer NOT NULL REFERENCES hotels (id),
+    text              text NOT NULL,
+    session_id        text NOT NULL,
+    hidden            boolean NOT NULL DEFAULT false,
+    helpful_votes     integer NOT NULL DEFAULT 0,
+    answered_at       timestamptz,
+    asker_notified_at timestamptz,
+    created_at        timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS hotel_answers (
+    id            serial PRIMARY KEY,
+    question_id   integer NOT NULL REFERENCES hotel_questions (id),
+    text          text NOT NULL,
+    helpful_votes integer NOT NULL DEFAULT 0,
+    created_at    timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS qa_votes (
+    entity     text NOT NULL,
+    entity_id  integer NOT NULL,
+    session_id text NOT NULL,
+    ip         text NOT NULL DEFAULT '',
+    value      smallint NOT NULL,
+    created_at timestamptz NOT NULL DEFAULT now(),
+    PRIMARY KEY (entity, entity_id, session_id)
+);
+
+-- Хранилище файлов.
+
+CREATE TABLE IF NOT EXISTS blobs (
+    key          text PRIMARY KEY,
+    kind         text NOT NULL,
+    content_type text NOT NULL,
+    size         bigint NOT NULL,
+    created_at   timestamptz NOT NULL DEFAULT now()
+);
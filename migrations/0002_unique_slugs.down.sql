@@ -0,0 +1,5 @@
+-- Возвращает неуникальный индекс по hotels.slug; сброшенные при применении дубли не восстанавливаются.
+
+DROP INDEX IF EXISTS cities_slug_idx;
+DROP INDEX IF EXISTS hotels_slug_idx;
+CREATE INDEX IF NOT EXISTS hotels_slug_idx ON hotels (slug);
@@ -0,0 +1,16 @@
+-- slug — постоянный адрес города или гостиницы, поэтому уникален на уровне БД, а не только
+-- проверкой в uniqueSlug: две транзакции, подобравшие один и тот же свободный slug, иначе
+-- обе его записывали бы. Записи без slug (NULL) индекс не ограничивает.
+--
+-- Дубли, которые могли появиться до этой миграции, остаются у записи с меньшим id;
+-- у остальных slug сбрасывается, и POST /api/admin/slugs/backfill присвоит им новый.
+
+UPDATE hotels h SET slug = NULL
+WHERE h.slug IS NOT NULL AND EXISTS (SELECT 1 FROM hotels o WHERE o.slug = h.slug AND o.id < h.id);
+
+UPDATE cities c SET slug = NULL
+WHERE c.slug IS NOT NULL AND EXISTS (SELECT 1 FROM cities o WHERE o.slug = c.slug AND o.id < c.id);
+
+DROP INDEX IF EXISTS hotels_slug_idx;
+CREATE UNIQUE INDEX hotels_slug_idx ON hotels (slug) WHERE slug IS NOT NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS cities_slug_idx ON cities (slug) WHERE slug IS NOT NULL;
@@ -0,0 +1,14 @@
+-- Месячный счётчик запросов тенанта по всем его ключам. Квота тенанта — общий лимит:
+-- без отдельного счётчика партнёр обходил её, заводя новые ключи.
+CREATE TABLE IF NOT EXISTS tenant_quota_usage (
+    tenant_id integer NOT NULL,
+    period    timestamptz NOT NULL,
+    requests  integer NOT NULL,
+    PRIMARY KEY (tenant_id, period)
+);
+
+INSERT INTO tenant_quota_usage (tenant_id, period, requests)
+SELECT tenant_id, period, SUM(requests)
+FROM quota_usage
+GROUP BY tenant_id, period
+ON CONFLICT (tenant_id, period) DO NOTHING;
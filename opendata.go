@@ -0,0 +1,312 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Открытые данные для исследователей: /api/open/...
+//
+// Это отдельный от партнёрского API вход: без ключей и квот (quota.go, usage.go),
+// зато с ограничением частоты запросов по IP (OPEN_DATA_RATE запросов в минуту)
+// и с долгим кэшированием (политика OpenDataCache). Отдаётся только публичное
+// подмножество данных: опубликованные гостиницы без контактов и служебных полей
+// (OpenHotel перечисляет поля явно, чтобы новые поля Hotel не утекали сюда сами).
+// Каждый ответ несёт заголовки лицензии, а в теле — атрибуцию.
+//
+// Раз в сутки полный набор сохраняется снимком open-data/YYYY-MM-DD.json в хранилище
+// файлов (см. blobstore.go); снимки доступны через /api/open/snapshots,
+// хранятся openDataSnapshotsKept дней.
+
+// Лицензия открытых данных.
+const (
+	openDataLicense     = "CC-BY-4.0"
+	openDataLicenseURL  = "https://creativecommons.org/licenses/by/4.0/"
+	openDataAttribution = "Hotel data by WB, licensed under CC BY 4.0"
+)
+
+// openDataSnapshotsKept — сколько последних ежедневных снимков хранится.
+const openDataSnapshotsKept = 30
+
+// openDataBlobKind — вид объектов-снимков в хранилище файлов; он же префикс их ключей.
+const openDataBlobKind = "open-data"
+
+// openDataCacheKey — ключ набора открытых данных в кэше.
+const openDataCacheKey = "open-data"
+
+// snapshotNameRe — имя файла снимка.
+var snapshotNameRe = regexp.MustCompile(`^(\d{4}-\d{2}-\d{2})\.json$`)
+
+// OpenHotel — гостиница в открытых данных.
+type OpenHotel struct {
+	ID       int      `json:"id"`
+	Name     string   `json:"name"`
+	Slug     *string  `json:"slug"`
+	CityID   *int     `json:"city_id"`
+	Capacity *int     `json:"capacity"`
+	Price    *float64 `json:"price"`
+}
+
+// OpenCity — город в открытых данных.
+type OpenCity struct {
+	ID          int      `json:"id"`
+	Name        string   `json:"name"`
+	CountryCode *string  `json:"country_code"`
+	Latitude    *float64 `json:"latitude"`
+	Longitude   *float64 `json:"longitude"`
+}
+
+// OpenDataSet — полный набор открытых данных (и формат ежедневного снимка).
+type OpenDataSet struct {
+	License     string      `json:"license"`
+	LicenseURL  string      `json:"license_url"`
+	Attribution string      `json:"attribution"`
+	GeneratedAt time.Time   `json:"generated_at"`
+	Cities      []OpenCity  `json:"cities"`
+	Hotels      []OpenHotel `json:"hotels"`
+}
+
+// loadOpenData собирает набор открытых данных из БД. Строгий режим: в открытые
+// данные не должен попасть неполный набор.
+func loadOpenData(ctx context.Context) (*OpenDataSet, error) {
+	cities, err := loadCities(ctx, true)
+	if err != nil {
+		return nil, err
+	}
+	hotels, err := loadHotels(ctx, true)
+	if err != nil {
+		return nil, err
+	}
+
+	set := &OpenDataSet{
+		License:     openDataLicense,
+		LicenseURL:  openDataLicenseURL,
+		Attribution: openDataAttribution,
+		GeneratedAt: time.Now().UTC(),
+		Cities:      make([]OpenCity, 0, len(cities.Items)),
+		Hotels:      make([]OpenHotel, 0, len(hotels.Items)),
+	}
+	for _, c := range cities.Items {
+		set.Cities = append(set.Cities, OpenCity{
+			ID: c.ID, Name: c.Name, CountryCode: c.CountryCode, Latitude: c.Latitude, Longitude: c.Longitude,
+		})
+	}
+	for _, h := range hotels.Items {
+		set.Hotels = append(set.Hotels, OpenHotel{
+			ID: h.ID, Name: h.Name, Slug: h.Slug, CityID: h.CityID, Capacity: h.Capacity, Price: h.Price,
+		})
+	}
+	return set, nil
+}
+
+// ipLimiter — ограничитель частоты запросов по IP с окном в одну минуту.
+type ipLimiter struct {
+	mu     sync.Mutex
+	window time.Time
+	counts map[string]int
+}
+
+// newIPLimiter создаёт ограничитель; у каждого ограничиваемого входа он свой.
+func newIPLimiter() *ipLimiter {
+	return &ipLimiter{counts: map[string]int{}}
+}
+
+var openLimiter = newIPLimiter()
+
+// allow учитывает запрос с адреса ip и сообщает, укладывается ли он в лимит.
+// Второй результат — когда начнётся следующее окно.
+func (l *ipLimiter) allow(ip string, limit int) (bool, time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	if now.Sub(l.window) >= time.Minute {
+		// Новое окно: старые счётчики больше не нужны — заодно не копим адреса.
+		l.window = now.Truncate(time.Minute)
+		l.counts = map[string]int{}
+	}
+	l.counts[ip]++
+	return l.counts[ip] <= limit, l.window.Add(time.Minute)
+}
+
+// openDataMiddleware ограничивает частоту запросов и добавляет заголовки лицензии.
+func openDataMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Link", fmt.Sprintf(`<%s>; rel="license"`, openDataLicenseURL))
+		c.Header("X-License", openDataLicense)
+		c.Header("X-Attribution", openDataAttribution)
+
+		limit := settings().OpenDataRate
+		if limit > 0 {
+			ok, reset := openLimiter.allow(c.ClientIP(), limit)
+			if !ok {
+				c.Header("Retry-After", strconv.Itoa(int(time.Until(reset).Seconds())+1))
+				c.AbortWithStatusJSON(http.StatusTooManyRequests, Response{
+					Success: false,
+					Error:   fmt.Sprintf("open data is limited to %d requests per minute", limit),
+					Hint:    "download the daily snapshot from /api/open/snapshots instead of polling",
+				})
+				return
+			}
+		}
+		c.Next()
+	}
+}
+
+// getOpenData — HTTP-обработчик, отдающий текущий набор открытых данных.
+// Реагирует на GET /api/open/data
+func getOpenData(c *gin.Context) {
+	policy := settings().OpenDataCache
+	set, status, err := cache.get(c.Request.Context(), openDataCacheKey, policy, func(ctx context.Context) (interface{}, error) {
+		return loadOpenData(ctx)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+	c.Header("X-Cache", status)
+	// Данные меняются редко: разрешаем кэшировать и прокси, и клиентам.
+	c.Header("Cache-Control", fmt.Sprintf("public, max-age=%d", int(policy.TTL.Seconds())))
+
+	data := set.(*OpenDataSet)
+	c.JSON(http.StatusOK, Response{
+		Success: true,
+		Data:    data,
+		Count:   len(data.Cities) + len(data.Hotels),
+	})
+}
+
+// listOpenDataSnapshots возвращает даты имеющихся снимков, от новых к старым.
+func listOpenDataSnapshots(ctx context.Context) ([]string, error) {
+	rows, err := db.QueryContext(ctx, "SELECT key FROM blobs WHERE kind = $1 ORDER BY key DESC", openDataBlobKind)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	dates := []string{}
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, err
+		}
+		if m := snapshotNameRe.FindStringSubmatch(strings.TrimPrefix(key, openDataBlobKind+"/")); m != nil {
+			dates = append(dates, m[1])
+		}
+	}
+	return dates, rows.Err()
+}
+
+// snapshotBlobKey — ключ снимка за дату в хранилище файлов.
+func snapshotBlobKey(date string) string {
+	return openDataBlobKind + "/" + date + ".json"
+}
+
+// writeOpenDataSnapshot сохраняет снимок за сегодня, если его ещё нет, и удаляет старые.
+func writeOpenDataSnapshot(ctx context.Context) error {
+	dates, err := listOpenDataSnapshots(ctx)
+	if err != nil {
+		return err
+	}
+	today := time.Now().UTC().Format("2006-01-02")
+	if len(dates) > 0 && dates[0] == today {
+		return nil
+	}
+
+	set, err := loadOpenData(ctx)
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(set)
+	if err != nil {
+		return err
+	}
+	if _, err := putBlob(ctx, openDataBlobKind, snapshotBlobKey(today), bytes.NewReader(body), "application/json"); err != nil {
+		return err
+	}
+	log.Printf("Open data snapshot written: %s", snapshotBlobKey(today))
+
+	dates = append([]string{today}, dates...)
+	for i := openDataSnapshotsKept; i < len(dates); i++ {
+		if err := deleteBlob(ctx, snapshotBlobKey(dates[i])); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runOpenDataSnapshots раз в час проверяет, есть ли снимок за сегодня, и создаёт его.
+// Проверка, а не таймер на сутки: так перезапуск сервиса не сдвигает и не пропускает снимки.
+func runOpenDataSnapshots(ctx context.Context) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+	for {
+		if err := writeOpenDataSnapshot(ctx); err != nil {
+			log.Printf("Error writing open data snapshot: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// getOpenDataSnapshots — HTTP-обработчик списка ежедневных снимков.
+// Реагирует на GET /api/open/snapshots
+func getOpenDataSnapshots(c *gin.Context) {
+	dates, err := listOpenDataSnapshots(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+	snapshots := make([]gin.H, 0, len(dates))
+	for _, d := range dates {
+		snapshots = append(snapshots, gin.H{"date": d, "url": "/api/open/snapshots/" + d})
+	}
+	c.JSON(http.StatusOK, Response{
+		Success: true,
+		Data:    snapshots,
+		Count:   len(snapshots),
+	})
+}
+
+// getOpenDataSnapshot — HTTP-обработчик, отдающий файл снимка за дату.
+// Реагирует на GET /api/open/snapshots/:date (YYYY-MM-DD).
+func getOpenDataSnapshot(c *gin.Context) {
+	name := c.Param("date") + ".json"
+	if !snapshotNameRe.MatchString(name) {
+		c.JSON(http.StatusBadRequest, Response{Success: false, Error: "date must be in YYYY-MM-DD format"})
+		return
+	}
+	r, info, err := blobs.Open(c.Request.Context(), snapshotBlobKey(c.Param("date")))
+	if err == errBlobNotFound {
+		c.JSON(http.StatusNotFound, Response{Success: false, Error: "snapshot not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	defer r.Close()
+	// Снимок за прошедший день не меняется.
+	c.Header("Cache-Control", "public, max-age=86400, immutable")
+	c.DataFromReader(http.StatusOK, info.Size, "application/json", r, map[string]string{
+		"Content-Disposition": "attachment; filename=hotels-" + name,
+	})
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"expvar"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Общий HTTP-клиент для исходящих запросов.
+//
+// Все интеграции (погода и афиша, хранилища секретов и файлов, загрузка GeoNames)
+// ходят через outboundClient, а не через собственные http.Client: у них общий пул
+// соединений с едиными настройками, и один медленный провайдер не может занять
+// все сокеты процесса — на каждый хост открывается не больше outboundMaxConnsPerHost
+// соединений, остальные запросы ждут свободного.
+//
+// Таймаут всего запроса у клиента не задан: его задаёт вызывающий через контекст
+// (см. providerLimits в deadline.go), потому что чтение прогноза и загрузка файла
+// в хранилище требуют совсем разного времени. Транспорт ограничивает только
+// установку соединения, TLS и ожидание заголовков ответа.
+//
+// Адреса хостов кэшируются на outboundDNSTTL, чтобы не резолвить провайдера на
+// каждом новом соединении. По каждому хосту назначения в expvar outbound
+// (GET /debug/vars) ведутся <хост>.requests, .errors (сетевые ошибки и ответы 5xx),
+// .latency_ms (суммарно, до получения заголовков) и .in_flight.
+
+const (
+	outboundMaxConnsPerHost     = 32
+	outboundMaxIdleConnsPerHost = 8
+	outboundDNSTTL              = time.Minute
+)
+
+// outboundClient — общий клиент исходящих запросов.
+var outboundClient = newOutboundClient()
+
+// outboundMetrics — метрики исходящих запросов по хостам назначения.
+var outboundMetrics = expvar.NewMap("outbound")
+
+// newOutboundClient создаёт клиент с настроенным транспортом, кэшем DNS и метриками.
+func newOutboundClient() *http.Client {
+	dialer := &net.Dialer{Timeout: 5 * time.Second, KeepAlive: 30 * time.Second}
+	resolver := &dnsCache{ttl: outboundDNSTTL, entries: map[string]dnsEntry{}}
+	transport := &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           resolver.dialer(dialer),
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          100,
+		MaxIdleConnsPerHost:   outboundMaxIdleConnsPerHost,
+		MaxConnsPerHost:       outboundMaxConnsPerHost,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   5 * time.Second,
+		ResponseHeaderTimeout: 30 * time.Second,
+		ExpectContinueTimeout: time.Second,
+	}
+	return &http.Client{Transport: instrumentedTransport{base: transport}}
+}
+
+// instrumentedTransport учитывает запросы в outboundMetrics по хосту назначения.
+type instrumentedTransport struct {
+	base http.RoundTripper
+}
+
+func (t instrumentedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	host := req.URL.Host
+	outboundMetrics.Add(host+".in_flight", 1)
+	defer outboundMetrics.Add(host+".in_flight", -1)
+
+	start := time.Now()
+	resp, err := t.base.RoundTrip(req)
+	outboundMetrics.Add(host+".requests", 1)
+	outboundMetrics.Add(host+".latency_ms", time.Since(start).Milliseconds())
+	if err != nil || resp.StatusCode >= 500 {
+		outboundMetrics.Add(host+".errors", 1)
+	}
+	return resp, err
+}
+
+// dnsCache — кэш адресов хостов с фиксированным временем жизни записей.
+type dnsCache struct {
+	ttl     time.Duration
+	mu      sync.Mutex
+	entries map[string]dnsEntry
+}
+
+type dnsEntry struct {
+	addrs   []string
+	expires time.Time
+}
+
+// lookup возвращает адреса хоста из кэша или из DNS.
+func (d *dnsCache) lookup(ctx context.Context, host string) ([]string, error) {
+	d.mu.Lock()
+	e, ok := d.entries[host]
+	d.mu.Unlock()
+	if ok && time.Now().Before(e.expires) {
+		return e.addrs, nil
+	}
+
+	addrs, err := net.DefaultResolver.LookupHost(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	d.mu.Lock()
+	d.entries[host] = dnsEntry{addrs: addrs, expires: time.Now().Add(d.ttl)}
+	d.mu.Unlock()
+	return addrs, nil
+}
+
+// dialer возвращает DialContext для транспорта: адреса берутся из кэша и перебираются по очереди.
+func (d *dnsCache) dialer(dialer *net.Dialer) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil || net.ParseIP(host) != nil {
+			return dialer.DialContext(ctx, network, addr)
+		}
+		addrs, err := d.lookup(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+		var lastErr error
+		for _, ip := range addrs {
+			conn, err := dialer.DialContext(ctx, network, net.JoinHostPort(ip, port))
+			if err == nil {
+				return conn, nil
+			}
+			lastErr = err
+		}
+		// Адреса могли смениться: следующее соединение резолвит хост заново.
+		d.mu.Lock()
+		delete(d.entries, host)
+		d.mu.Unlock()
+		return nil, lastErr
+	}
+}
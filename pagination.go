@@ -0,0 +1,198 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Постраничная выдача списков.
+//
+// Страницы городов и гостиниц (GET /api/cities, GET /api/hotels) читает база: LIMIT/OFFSET
+// в запросе и COUNT(*) с теми же условиями для total, в одной транзакции со снимком
+// данных, чтобы total и строки страницы не разошлись. Все фильтры гостиниц поэтому —
+// условия WHERE (см. filters.go). Прочие списки из одного запроса (бронирования,
+// пользователи) отдаёт так же respondQueryPage.
+//
+// Страницу можно задать двумя способами:
+//
+//	?page=2&per_page=50   — номер страницы (с 1) и её размер;
+//	?limit=50&offset=100  — сколько строк отдать и сколько пропустить.
+//
+// Без этих параметров список отдаётся целиком, как раньше (в пределах MAX_LIST_ROWS
+// и MAX_LIST_BYTES, см. guard.go). Метаданные страницы приходят в поле page ответа.
+
+const (
+	defaultPerPage = 50
+	maxPerPage     = 500
+	// maxPageOffset — наибольшее смещение страницы: дальше смещение вместе с размером
+	// страницы не помещается в int.
+	maxPageOffset = math.MaxInt - maxPerPage
+)
+
+// PageInfo — метаданные страницы в ответе: номер, размер, сколько строк всего и сколько страниц.
+type PageInfo struct {
+	Page    int `json:"page"`
+	PerPage int `json:"per_page"`
+	Offset  int `json:"offset"`
+	Total   int `json:"total"`
+	Pages   int `json:"pages"`
+}
+
+// pageRequest — разобранные параметры страницы; per_page == 0 — страница не запрошена.
+type pageRequest struct {
+	offset  int
+	perPage int
+}
+
+// parsePage разбирает ?page=&per_page= или ?limit=&offset= и отвечает 400 на некорректные значения.
+func parsePage(c *gin.Context) (pageRequest, bool) {
+	page, perPage := c.Query("page"), c.Query("per_page")
+	limit, offset := c.Query("limit"), c.Query("offset")
+	if (page != "" || perPage != "") && (limit != "" || offset != "") {
+		c.JSON(http.StatusBadRequest, Response{Success: false, Error: "use either page/per_page or limit/offset, not both"})
+		return pageRequest{}, false
+	}
+
+	intParam := func(name, raw string, def, min int) (int, bool) {
+		if raw == "" {
+			return def, true
+		}
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < min {
+			c.JSON(http.StatusBadRequest, Response{Success: false, Error: fmt.Sprintf("%s must be an integer >= %d", name, min)})
+			return 0, false
+		}
+		return n, true
+	}
+	sizeParam := func(name, raw string) (int, bool) {
+		n, ok := intParam(name, raw, defaultPerPage, 1)
+		if ok && n > maxPerPage {
+			c.JSON(http.StatusBadRequest, Response{Success: false, Error: fmt.Sprintf("%s must be at most %d", name, maxPerPage)})
+			return 0, false
+		}
+		return n, ok
+	}
+
+	switch {
+	case page != "" || perPage != "":
+		n, ok := intParam("page", page, 1, 1)
+		if !ok {
+			return pageRequest{}, false
+		}
+		size, ok := sizeParam("per_page", perPage)
+		if !ok {
+			return pageRequest{}, false
+		}
+		if n-1 > maxPageOffset/size {
+			c.JSON(http.StatusBadRequest, Response{Success: false, Error: fmt.Sprintf("page must be at most %d for per_page=%d", maxPageOffset/size+1, size)})
+			return pageRequest{}, false
+		}
+		return pageRequest{offset: (n - 1) * size, perPage: size}, true
+	case limit != "" || offset != "":
+		size, ok := sizeParam("limit", limit)
+		if !ok {
+			return pageRequest{}, false
+		}
+		skip, ok := intParam("offset", offset, 0, 0)
+		if !ok {
+			return pageRequest{}, false
+		}
+		if skip > maxPageOffset {
+			c.JSON(http.StatusBadRequest, Response{Success: false, Error: fmt.Sprintf("offset must be at most %d", maxPageOffset)})
+			return pageRequest{}, false
+		}
+		return pageRequest{offset: skip, perPage: size}, true
+	}
+	return pageRequest{}, true
+}
+
+// bounds возвращает границы страницы [start, end) в списке из total строк;
+// страница за концом списка пуста (start == end).
+func (p pageRequest) bounds(total int) (start, end int) {
+	if p.offset >= total {
+		return total, total
+	}
+	return p.offset, p.offset + min(p.perPage, total-p.offset)
+}
+
+// info возвращает метаданные страницы для списка из total строк.
+func (p pageRequest) info(total int) *PageInfo {
+	return &PageInfo{
+		Page:    p.offset/p.perPage + 1,
+		PerPage: p.perPage,
+		Offset:  p.offset,
+		Total:   total,
+		Pages:   (total + p.perPage - 1) / p.perPage,
+	}
+}
+
+// respondQueryPage отдаёт строки запроса query (с ORDER BY), прочитанные scan:
+// запрошенную страницу — через LIMIT/OFFSET, с total из COUNT(*) по тому же запросу
+// в том же снимке данных; без страницы — весь список (в пределах лимитов guard.go).
+// Ошибки чтения строк сущности entity обрабатываются как в queryHotels: в строгом
+// режиме — 500, в мягком (LENIENT_SCAN_ROUTES) строка пропускается и ответ помечается partial.
+func respondQueryPage[T any](c *gin.Context, entity, query string, args []interface{}, scan func(row interface{ Scan(...interface{}) error }) (T, error)) {
+	p, ok := parsePage(c)
+	if !ok {
+		return
+	}
+	ctx := c.Request.Context()
+	tx, err := db.BeginTx(ctx, snapshotTx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	var info *PageInfo
+	if p.perPage > 0 {
+		var total int
+		if err := tx.QueryRowContext(ctx, "SELECT count(*) FROM ("+query+") AS list", args...).Scan(&total); err != nil {
+			c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+			return
+		}
+		info = p.info(total)
+		n := len(args)
+		query += fmt.Sprintf(" LIMIT $%d OFFSET $%d", n+1, n+2)
+		args = append(args[:n:n], p.perPage, p.offset)
+	}
+
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	defer rows.Close()
+	strict := strictScan(c)
+	set := rowSet[T]{Items: []T{}}
+	for rows.Next() {
+		item, err := scan(rows)
+		if err != nil {
+			if err := scanFailed(strict, entity, err); err != nil {
+				c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+				return
+			}
+			set.Partial = true
+			continue
+		}
+		set.Items = append(set.Items, item)
+	}
+	if err := rows.Err(); err != nil {
+		if err := iterationFailed(strict, entity, err); err != nil {
+			c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+			return
+		}
+		set.Partial = true
+	}
+	writeList(c, Response{
+		Success: true,
+		Data:    set.Items,
+		Count:   len(set.Items),
+		Partial: set.Partial,
+		Page:    info,
+	})
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"expvar"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestParsePage(t *testing.T) {
+	lastPage := strconv.Itoa(maxPageOffset/maxPerPage + 1)
+	for _, tc := range []struct {
+		query string
+		want  pageRequest
+	}{
+		{"", pageRequest{}},
+		{"page=1", pageRequest{offset: 0, perPage: defaultPerPage}},
+		{"page=3&per_page=20", pageRequest{offset: 40, perPage: 20}},
+		{"per_page=10", pageRequest{offset: 0, perPage: 10}},
+		{"limit=5&offset=12", pageRequest{offset: 12, perPage: 5}},
+		{"offset=7", pageRequest{offset: 7, perPage: defaultPerPage}},
+		{"page=" + lastPage + "&per_page=" + strconv.Itoa(maxPerPage), pageRequest{offset: (maxPageOffset / maxPerPage) * maxPerPage, perPage: maxPerPage}},
+		{"offset=" + strconv.Itoa(maxPageOffset) + "&limit=" + strconv.Itoa(maxPerPage), pageRequest{offset: maxPageOffset, perPage: maxPerPage}},
+	} {
+		c, w := testContext("/api/hotels?" + tc.query)
+		got, ok := parsePage(c)
+		if !ok {
+			t.Errorf("%q: rejected with %d: %s", tc.query, w.Code, w.Body)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("%q: got %+v, want %+v", tc.query, got, tc.want)
+		}
+		if got.offset < 0 || got.offset+got.perPage < got.offset {
+			t.Errorf("%q: offset %d overflows", tc.query, got.offset)
+		}
+	}
+}
+
+func TestParsePageRejects(t *testing.T) {
+	for _, query := range []string{
+		"page=0",
+		"page=-1",
+		"per_page=0",
+		"per_page=501",
+		"page=2&limit=10",
+		"offset=-1",
+		"limit=abc",
+		"page=9223372036854775807&per_page=2",
+		"page=9223372036854775807",
+		"page=4611686018427387905&per_page=2",
+		"offset=9223372036854775807",
+		"offset=" + strconv.Itoa(maxPageOffset+1),
+		"page=99999999999999999999",
+	} {
+		c, w := testContext("/api/hotels?" + query)
+		if _, ok := parsePage(c); ok {
+			t.Errorf("%q: accepted", query)
+		} else if w.Code != http.StatusBadRequest {
+			t.Errorf("%q: status %d, want 400", query, w.Code)
+		}
+	}
+}
+
+// Страница с огромным номером раньше давала отрицательное смещение и панику при срезе.
+func TestRespondPageHugePage(t *testing.T) {
+	router := gin.New()
+	// До БД дело не доходит: страница отклоняется при разборе.
+	router.GET("/list", func(c *gin.Context) {
+		respondQueryPage(c, "number", "SELECT 1", nil, func(row interface{ Scan(...interface{}) error }) (int, error) {
+			var n int
+			return n, row.Scan(&n)
+		})
+	})
+	w := serve(router, "GET", "/list?page=9223372036854775807&per_page=2", "")
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("status %d, want 400: %s", w.Code, w.Body)
+	}
+}
+
+func TestPageBounds(t *testing.T) {
+	for _, tc := range []struct {
+		p                    pageRequest
+		total                int
+		start, end, page, of int
+	}{
+		{pageRequest{offset: 0, perPage: 2}, 5, 0, 2, 1, 3},
+		{pageRequest{offset: 4, perPage: 2}, 5, 4, 5, 3, 3},
+		{pageRequest{offset: 5, perPage: 2}, 5, 5, 5, 3, 3},
+		{pageRequest{offset: 0, perPage: 10}, 0, 0, 0, 1, 0},
+		{pageRequest{offset: maxPageOffset, perPage: maxPerPage}, 5, 5, 5, maxPageOffset/maxPerPage + 1, 1},
+	} {
+		start, end := tc.p.bounds(tc.total)
+		info := tc.p.info(tc.total)
+		if start != tc.start || end != tc.end {
+			t.Errorf("%+v of %d: bounds [%d, %d), want [%d, %d)", tc.p, tc.total, start, end, tc.start, tc.end)
+		}
+		if info.Total != tc.total || info.Page != tc.page || info.Pages != tc.of {
+			t.Errorf("%+v of %d: page info %+v", tc.p, tc.total, info)
+		}
+	}
+}
+
+// testPageResponse — ответ списка с метаданными страницы.
+type testPageResponse struct {
+	Data  []Hotel   `json:"data"`
+	Count int       `json:"count"`
+	Page  *PageInfo `json:"page"`
+}
+
+func TestHotelListPages(t *testing.T) {
+	testDB(t)
+	moscow := testCity(t, "Moscow")
+	names := []string{"A1", "A2", "A3", "A4", "A5", "A6", "A7", "A8"}
+	ids := map[string]int{}
+	for i, name := range names {
+		ids[name] = testHotel(t, name, moscow, 2, float64(1000+i))
+	}
+	// A6 продвигается: в выдаче он на первом месте.
+	testExec(t, "INSERT INTO promotions (hotel_id, starts_at, ends_at) VALUES ($1, now() - interval '1 day', now() + interval '1 day')", ids["A6"])
+	router := newPublicRouter()
+
+	all := testHotelNames(t, router, "/api/hotels")
+	if len(all) != len(names) || all[0] != "A6" {
+		t.Fatalf("full list: %v", all)
+	}
+	for _, perPage := range []int{1, 3, 5, 8, 10} {
+		var joined []string
+		for page := 1; ; page++ {
+			w := serve(router, "GET", "/api/hotels?page="+strconv.Itoa(page)+"&per_page="+strconv.Itoa(perPage), "")
+			if w.Code != http.StatusOK {
+				t.Fatalf("per_page=%d page=%d: status %d: %s", perPage, page, w.Code, w.Body)
+			}
+			var resp testPageResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			if resp.Page == nil || resp.Page.Total != len(names) {
+				t.Fatalf("per_page=%d page=%d: page info %+v", perPage, page, resp.Page)
+			}
+			if len(resp.Data) == 0 {
+				break
+			}
+			for _, h := range resp.Data {
+				if h.IsSponsored != (h.Name == "A6") {
+					t.Errorf("per_page=%d: %s is_sponsored=%v", perPage, h.Name, h.IsSponsored)
+				}
+				joined = append(joined, h.Name)
+			}
+		}
+		if !reflect.DeepEqual(joined, all) {
+			t.Errorf("per_page=%d: pages give %v, the full list is %v", perPage, joined, all)
+		}
+	}
+
+	// Фильтр сужает и total.
+	w := serve(router, "GET", "/api/hotels?max_price=1002&per_page=2", "")
+	var resp testPageResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Page == nil || resp.Page.Total != 3 || resp.Page.Pages != 2 || resp.Count != 2 {
+		t.Errorf("filtered page: count %d, page %+v", resp.Count, resp.Page)
+	}
+
+	if w := serve(router, "GET", "/api/hotels?page=9223372036854775807&per_page=2", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("huge page: status %d, want 400", w.Code)
+	}
+}
+
+func TestCityListPages(t *testing.T) {
+	testDB(t)
+	for _, name := range []string{"Omsk", "Kazan", "Moscow", "Perm", "Sochi"} {
+		testCity(t, name)
+	}
+	router := newPublicRouter()
+
+	w := serve(router, "GET", "/api/cities?page=2&per_page=2", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	var resp struct {
+		Data []City   `json:"data"`
+		Page PageInfo `json:"page"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Data) != 2 || resp.Data[0].Name != "Omsk" || resp.Data[1].Name != "Perm" {
+		t.Errorf("page 2: %+v", resp.Data)
+	}
+	if resp.Page.Total != 5 || resp.Page.Pages != 3 || resp.Page.Offset != 2 {
+		t.Errorf("page info: %+v", resp.Page)
+	}
+}
+
+// План "hotels_page" в /debug/explain строится тем же hotelPageQuery, что и страницы GET /api/hotels.
+func TestExplainHotelPageQuery(t *testing.T) {
+	q := explainQueries["hotels_page"]
+	if !strings.Contains(q.SQL, " WHERE "+publishedHotel+" ORDER BY h.name, h.id LIMIT $1 OFFSET $2") {
+		t.Errorf("hotels_page SQL: %s", q.SQL)
+	}
+	if strings.Contains(q.SQL, "$3") || len(q.Params) != 2 {
+		t.Errorf("hotels_page takes %v, the SQL: %s", q.Params, q.SQL)
+	}
+
+	testDB(t)
+	t.Setenv("ADMIN_TOKEN", "admin-token")
+	w := serve(newAdminRouter(), "GET", "/debug/explain?name=hotels_page&arg=20&arg=0", "", "Authorization", bearerPrefix+"admin-token")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+}
+
+// Ошибка чтения строки в постраничном списке: 500 в строгом режиме, неполный ответ в мягком.
+func TestRespondPageScanFailure(t *testing.T) {
+	testDB(t)
+	router := gin.New()
+	router.GET("/list", func(c *gin.Context) {
+		respondQueryPage(c, "test_number", "SELECT n FROM generate_series(1, 5) n ORDER BY n", nil, func(row interface{ Scan(...interface{}) error }) (int, error) {
+			var n int
+			if err := row.Scan(&n); err != nil {
+				return 0, err
+			}
+			if n == 3 {
+				return 0, errors.New("broken row")
+			}
+			return n, nil
+		})
+	})
+	failures := func() int64 {
+		if v, ok := scanErrors.Get("test_number").(*expvar.Int); ok {
+			return v.Value()
+		}
+		return 0
+	}
+	before := failures()
+
+	for _, path := range []string{"/list", "/list?page=1&per_page=4"} {
+		if w := serve(router, "GET", path, ""); w.Code != http.StatusInternalServerError {
+			t.Errorf("strict %s: status %d, want 500: %s", path, w.Code, w.Body)
+		}
+	}
+
+	testLenientRoutes(t, "/list")
+	w := serve(router, "GET", "/list?page=1&per_page=4", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("lenient: status %d: %s", w.Code, w.Body)
+	}
+	var resp struct {
+		Data    []int     `json:"data"`
+		Partial bool      `json:"partial"`
+		Page    *PageInfo `json:"page"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(resp.Data, []int{1, 2, 4}) || !resp.Partial || resp.Page == nil || resp.Page.Total != 5 {
+		t.Errorf("lenient page: %s", w.Body)
+	}
+	if got := failures() - before; got != 3 {
+		t.Errorf("scan_errors grew by %d, want 3", got)
+	}
+}
@@ -0,0 +1,423 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Достопримечательности (точки интереса) городов и расстояния до них от гостиниц.
+//
+//	pois(id, city_id, kind, name, latitude, longitude, created_at)
+//	hotel_poi_distances(hotel_id, poi_id, distance_m), PRIMARY KEY (hotel_id, poi_id)
+//
+// Расстояния (по дуге большого круга) считаются заранее и хранятся в
+// hotel_poi_distances, чтобы список гостиниц не вычислял их на каждый запрос.
+// Их пересчитывает refreshPOIDistances в той же транзакции, что и изменение,
+// после которого они устаревают: координаты гостиницы, добавление или удаление
+// точки, слияние городов. Учитываются только точки города гостиницы.
+//
+// В списке у гостиницы есть nearby — ближайшая точка каждого вида («1.2 km from center»),
+// а фильтр ?near_poi=<id или вид>&within_km=N оставляет гостиницы не дальше N км от точки.
+
+// Виды точек интереса.
+var poiKinds = map[string]bool{
+	"center":   true,
+	"airport":  true,
+	"metro":    true,
+	"station":  true,
+	"landmark": true,
+}
+
+// nearPOIDefaultKm — радиус фильтра ?near_poi= по умолчанию.
+const nearPOIDefaultKm = 1.0
+
+// POI — точка интереса города.
+type POI struct {
+	ID        int       `json:"id"`
+	CityID    int       `json:"city_id"`
+	Kind      string    `json:"kind"`
+	Name      string    `json:"name"`
+	Latitude  float64   `json:"latitude"`
+	Longitude float64   `json:"longitude"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// NearbyPOI — ближайшая к гостинице точка одного вида.
+type NearbyPOI struct {
+	Kind       string  `json:"kind"`
+	Name       string  `json:"name"`
+	DistanceKm float64 `json:"distance_km"`
+	// Label — готовая подпись для карточки: «1.2 km from center».
+	Label string `json:"label"`
+}
+
+// NearbyPOIs — ближайшие точки гостиницы; читается из JSON, который строит nearbyPOIQuery.
+type NearbyPOIs []NearbyPOI
+
+// Scan реализует sql.Scanner.
+func (n *NearbyPOIs) Scan(src interface{}) error {
+	var raw []byte
+	switch v := src.(type) {
+	case nil:
+		*n = nil
+		return nil
+	case []byte:
+		raw = v
+	case string:
+		raw = []byte(v)
+	default:
+		return fmt.Errorf("cannot scan %T into nearby points of interest", src)
+	}
+	var rows []struct {
+		Kind      string `json:"kind"`
+		Name      string `json:"name"`
+		DistanceM int    `json:"distance_m"`
+	}
+	if err := json.Unmarshal(raw, &rows); err != nil {
+		return err
+	}
+	list := make(NearbyPOIs, len(rows))
+	for i, r := range rows {
+		km := math.Round(float64(r.DistanceM)/100) / 10
+		from := r.Name
+		if r.Kind == "center" {
+			from = "center"
+		}
+		list[i] = NearbyPOI{Kind: r.Kind, Name: r.Name, DistanceKm: km, Label: fmt.Sprintf("%.1f km from %s", km, from)}
+	}
+	*n = list
+	return nil
+}
+
+// nearbyPOIQuery — подзапрос ближайшей точки каждого вида для гостиницы h (для LEFT JOIN LATERAL).
+const nearbyPOIQuery = `
+	SELECT json_agg(json_build_object('kind', n.kind, 'name', n.name, 'distance_m', n.distance_m) ORDER BY n.distance_m) AS nearby
+	FROM (
+		SELECT DISTINCT ON (p.kind) p.kind, p.name, d.distance_m
+		FROM hotel_poi_distances d
+		JOIN pois p ON p.id = d.poi_id
+		WHERE d.hotel_id = h.id
+		ORDER BY p.kind, d.distance_m
+	) n
+`
+
+// distanceSQL — расстояние в метрах между гостиницей h и точкой p по формуле гаверсинусов.
+const distanceSQL = `round(2 * 6371000 * asin(sqrt(
+	power(sin(radians(p.latitude - h.latitude) / 2), 2) +
+	cos(radians(h.latitude)) * cos(radians(p.latitude)) * power(sin(radians(p.longitude - h.longitude) / 2), 2)
+)))`
+
+// poiDistanceScopes — какие пары «гостиница — точка» пересчитывать: условие удаления
+// старых расстояний и условие выбора пар для вставки ($1 — id гостиницы, точки или города).
+var poiDistanceScopes = map[string][2]string{
+	"hotel": {"hotel_id = $1", "h.id = $1"},
+	"poi":   {"poi_id = $1", "p.id = $1"},
+	"city": {
+		"hotel_id IN (SELECT id FROM hotels WHERE city = $1) OR poi_id IN (SELECT id FROM pois WHERE city_id = $1)",
+		"h.city = $1",
+	},
+}
+
+// refreshPOIDistances пересчитывает расстояния для гостиницы, точки или всего города (scope) в транзакции tx.
+func refreshPOIDistances(ctx context.Context, tx *sql.Tx, scope string, id int) error {
+	cond, ok := poiDistanceScopes[scope]
+	if !ok {
+		return fmt.Errorf("unknown distance scope %q", scope)
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM hotel_poi_distances WHERE "+cond[0], id); err != nil {
+		return err
+	}
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO hotel_poi_distances (hotel_id, poi_id, distance_m)
+		SELECT h.id, p.id, `+distanceSQL+`
+		FROM hotels h
+		JOIN pois p ON p.city_id = h.city
+		WHERE h.latitude IS NOT NULL AND h.longitude IS NOT NULL AND (`+cond[1]+`)
+	`, id)
+	return err
+}
+
+// validCoordinates проверяет широту и долготу.
+func validCoordinates(lat, lon float64) bool {
+	return lat >= -90 && lat <= 90 && lon >= -180 && lon <= 180
+}
+
+// hotelsNearPOIQuery — id гостиниц не дальше $3 метров от точки с id $1
+// или от любой точки вида $2 в городе гостиницы. $3 — дробное число метров
+// (within_km=1.2345), поэтому приводится к double precision, а не к типу distance_m.
+const hotelsNearPOIQuery = `
+	SELECT DISTINCT d.hotel_id
+	FROM hotel_poi_distances d
+	JOIN pois p ON p.id = d.poi_id
+	WHERE (p.id = $1 OR p.kind = $2) AND d.distance_m <= $3::double precision
+`
+
+// nearPOIFilter — разобранный фильтр ?near_poi=<id или вид>&within_km=N; пустой POI — фильтра нет.
+type nearPOIFilter struct {
+	POI      string
+	WithinKm float64
+}
+
+// parseNearPOI разбирает фильтр. При ошибке сам отвечает клиенту и возвращает false.
+func parseNearPOI(c *gin.Context) (nearPOIFilter, bool) {
+	poi := c.Query("near_poi")
+	if poi == "" {
+		return nearPOIFilter{}, true
+	}
+	if _, err := strconv.Atoi(poi); err != nil && !poiKinds[poi] {
+		c.JSON(http.StatusBadRequest, Response{Success: false, Error: "near_poi must be a point of interest id or kind"})
+		return nearPOIFilter{}, false
+	}
+	within := nearPOIDefaultKm
+	if v := c.Query("within_km"); v != "" {
+		km, err := strconv.ParseFloat(v, 64)
+		if err != nil || km <= 0 || km > 100 {
+			c.JSON(http.StatusBadRequest, Response{Success: false, Error: "within_km must be a number between 0 and 100"})
+			return nearPOIFilter{}, false
+		}
+		within = km
+	}
+	return nearPOIFilter{POI: poi, WithinKm: within}, true
+}
+
+// args — параметры hotelsNearPOIQuery.
+func (f nearPOIFilter) args() (poiID int, kind string, withinM float64) {
+	poiID, _ = strconv.Atoi(f.POI)
+	return poiID, f.POI, f.WithinKm * 1000
+}
+
+// where добавляет фильтр в условия запроса подзапросом hotelsNearPOIQuery.
+func (f nearPOIFilter) where(q *sqlConditions) {
+	if f.POI == "" {
+		return
+	}
+	poiID, kind, withinM := f.args()
+	sub := strings.NewReplacer("$1", q.arg(poiID), "$2", q.arg(kind), "$3", q.arg(withinM)).Replace(hotelsNearPOIQuery)
+	q.and("h.id IN (" + sub + ")")
+}
+
+// hotelsNearPOI возвращает id гостиниц, подходящих под фильтр f.
+func hotelsNearPOI(ctx context.Context, f nearPOIFilter) (map[int]bool, error) {
+	poiID, kind, withinM := f.args()
+	rows, err := db.QueryContext(ctx, hotelsNearPOIQuery, poiID, kind, withinM)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	ids := map[int]bool{}
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids[id] = true
+	}
+	return ids, rows.Err()
+}
+
+// applyNearPOI применяет к списку фильтр ?near_poi=<id или вид>&within_km=N.
+// При ошибке сам отвечает клиенту и возвращает false.
+func applyNearPOI(c *gin.Context, hotels []Hotel) ([]Hotel, bool) {
+	f, ok := parseNearPOI(c)
+	if !ok || f.POI == "" {
+		return hotels, ok
+	}
+	near, err := hotelsNearPOI(c.Request.Context(), f)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return nil, false
+	}
+	result := make([]Hotel, 0, len(near))
+	for _, h := range hotels {
+		if near[h.ID] {
+			result = append(result, h)
+		}
+	}
+	return result, true
+}
+
+// getCityPOIs — HTTP-обработчик списка точек интереса города.
+// Реагирует на GET /api/cities/:id/pois и GET /api/admin/cities/:id/pois
+func getCityPOIs(c *gin.Context) {
+	id, ok := cityIDParam(c)
+	if !ok {
+		return
+	}
+	rows, err := db.QueryContext(c.Request.Context(), `
+		SELECT id, city_id, kind, name, latitude, longitude, created_at
+		FROM pois WHERE city_id = $1
+		ORDER BY kind, name
+	`, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	pois := []POI{}
+	for rows.Next() {
+		var p POI
+		if err := rows.Scan(&p.ID, &p.CityID, &p.Kind, &p.Name, &p.Latitude, &p.Longitude, &p.CreatedAt); err != nil {
+			c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+			return
+		}
+		pois = append(pois, p)
+	}
+	if err := rows.Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, Response{Success: true, Data: pois, Count: len(pois)})
+}
+
+// createPOI — HTTP-обработчик добавления точки интереса и расчёта расстояний до неё.
+// Реагирует на POST /api/admin/cities/:id/pois с телом
+// {"kind": "metro", "name": "Nevsky Prospekt", "latitude": 59.9356, "longitude": 30.3272}.
+func createPOI(c *gin.Context) {
+	cityID, ok := cityIDParam(c)
+	if !ok {
+		return
+	}
+	var p POI
+	if err := c.ShouldBindJSON(&p); err != nil {
+		c.JSON(http.StatusBadRequest, Response{Success: false, Error: err.Error()})
+		return
+	}
+	if !poiKinds[p.Kind] {
+		c.JSON(http.StatusBadRequest, Response{Success: false, Error: fmt.Sprintf("unknown kind %q", p.Kind)})
+		return
+	}
+	if p.Name == "" || !validCoordinates(p.Latitude, p.Longitude) {
+		c.JSON(http.StatusBadRequest, Response{Success: false, Error: "name and valid latitude and longitude are required"})
+		return
+	}
+
+	tx, err := db.BeginTx(c.Request.Context(), nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	p.CityID = cityID
+	err = tx.QueryRowContext(c.Request.Context(), `
+		INSERT INTO pois (city_id, kind, name, latitude, longitude)
+		SELECT id, $2, $3, $4, $5 FROM cities WHERE id = $1
+		RETURNING id, created_at
+	`, cityID, p.Kind, p.Name, p.Latitude, p.Longitude).Scan(&p.ID, &p.CreatedAt)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, Response{Success: false, Error: "city not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	if err := refreshPOIDistances(c.Request.Context(), tx, "poi", p.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	cache.flush("hotels")
+	c.JSON(http.StatusCreated, Response{Success: true, Data: p, Count: 1})
+}
+
+// deletePOI — HTTP-обработчик удаления точки интереса вместе с расстояниями до неё.
+// Реагирует на DELETE /api/admin/pois/:id
+func deletePOI(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, Response{Success: false, Error: "point of interest id must be an integer"})
+		return
+	}
+	tx, err := db.BeginTx(c.Request.Context(), nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(c.Request.Context(), "DELETE FROM hotel_poi_distances WHERE poi_id = $1", id); err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	res, err := tx.ExecContext(c.Request.Context(), "DELETE FROM pois WHERE id = $1", id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		c.JSON(http.StatusNotFound, Response{Success: false, Error: "point of interest not found"})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	cache.flush("hotels")
+	c.JSON(http.StatusOK, Response{Success: true})
+}
+
+// setHotelLocation — HTTP-обработчик, задающий координаты гостиницы и пересчитывающий расстояния.
+// Реагирует на PUT /api/admin/hotels/:id/location с телом {"latitude": 59.93, "longitude": 30.33}.
+func setHotelLocation(c *gin.Context) {
+	id, ok := hotelIDParam(c)
+	if !ok {
+		return
+	}
+	var body struct {
+		Latitude  *float64 `json:"latitude"`
+		Longitude *float64 `json:"longitude"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, Response{Success: false, Error: err.Error()})
+		return
+	}
+	if body.Latitude == nil || body.Longitude == nil || !validCoordinates(*body.Latitude, *body.Longitude) {
+		c.JSON(http.StatusBadRequest, Response{Success: false, Error: "valid latitude and longitude are required"})
+		return
+	}
+
+	tx, err := db.BeginTx(c.Request.Context(), nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(c.Request.Context(), "UPDATE hotels SET latitude = $2, longitude = $3 WHERE id = $1", id, *body.Latitude, *body.Longitude)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		c.JSON(http.StatusNotFound, Response{Success: false, Error: "hotel not found"})
+		return
+	}
+	if err := refreshPOIDistances(c.Request.Context(), tx, "hotel", id); err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	cache.flush("hotels")
+	c.JSON(http.StatusOK, Response{
+		Success: true,
+		Data:    gin.H{"id": id, "latitude": *body.Latitude, "longitude": *body.Longitude},
+		Count:   1,
+	})
+}
@@ -0,0 +1,296 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Подписки на снижение цены.
+//
+// Посетитель подписывается на гостиницу и даты проживания с порогом: «сообщить,
+// когда проживание станет дешевле threshold». Учётных записей нет, поэтому
+// подписчик, как и автор вопроса (см. questions.go), опознаётся по session_id,
+// и по нему же клиент забирает уведомления: GET /api/price-alerts/notifications
+// возвращает сработавшие с прошлого обращения подписки и отмечает их просмотренными.
+//
+// Раз в PRICE_ALERT_INTERVAL (см. settings.go; 0 — выключено) фоновая проверка
+// считает стоимость каждого ещё не начавшегося проживания так же, как
+// GET /api/hotels/:id/quote (см. quoteHotel). Подписка срабатывает, когда
+// стоимость опускается ниже порога, и больше не срабатывает, пока цена не
+// поднимется до порога и снова не опустится: колебания цены около порога не
+// превращаются в поток уведомлений.
+//
+//	price_alerts(id, hotel_id, session_id, check_in date, check_out date, threshold,
+//	             last_quote NULL, triggered_at NULL, notified_at NULL, created_at)
+
+// maxPriceAlertsPerSession — сколько действующих подписок может быть у одной сессии.
+const maxPriceAlertsPerSession = 20
+
+// PriceAlert — подписка на снижение цены.
+type PriceAlert struct {
+	ID        int      `json:"id"`
+	HotelID   int      `json:"hotel_id"`
+	CheckIn   string   `json:"check_in"`
+	CheckOut  string   `json:"check_out"`
+	Threshold float64  `json:"threshold"`
+	LastQuote *float64 `json:"last_quote"`
+	// TriggeredAt — когда стоимость последний раз опустилась ниже порога; nil — сейчас не ниже.
+	TriggeredAt *time.Time `json:"triggered_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// priceAlertSelect — общая часть запросов подписок; колонки читает scanPriceAlert.
+const priceAlertSelect = `
+	SELECT id, hotel_id, check_in::text, check_out::text, threshold, last_quote, triggered_at, created_at
+	FROM price_alerts`
+
+// scanPriceAlert читает строку priceAlertSelect.
+func scanPriceAlert(row interface{ Scan(...interface{}) error }) (PriceAlert, error) {
+	var a PriceAlert
+	err := row.Scan(&a.ID, &a.HotelID, &a.CheckIn, &a.CheckOut, &a.Threshold, &a.LastQuote, &a.TriggeredAt, &a.CreatedAt)
+	return a, err
+}
+
+// loadPriceAlerts читает подписки по условию where.
+func loadPriceAlerts(ctx context.Context, where string, args ...interface{}) ([]PriceAlert, error) {
+	rows, err := db.QueryContext(ctx, priceAlertSelect+" WHERE "+where+" ORDER BY id", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	alerts := []PriceAlert{}
+	for rows.Next() {
+		a, err := scanPriceAlert(rows)
+		if err != nil {
+			return nil, err
+		}
+		alerts = append(alerts, a)
+	}
+	return alerts, rows.Err()
+}
+
+// createPriceAlert — HTTP-обработчик подписки на снижение цены.
+// Реагирует на POST /api/hotels/:id/price-alerts с телом
+// {"session_id": "3f2a9c", "check_in": "2026-07-01", "check_out": "2026-07-04", "threshold": 30000}.
+func createPriceAlert(c *gin.Context) {
+	hotelID, ok := hotelIDParam(c)
+	if !ok {
+		return
+	}
+	var body struct {
+		SessionID string  `json:"session_id"`
+		CheckIn   string  `json:"check_in"`
+		CheckOut  string  `json:"check_out"`
+		Threshold float64 `json:"threshold"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, Response{Success: false, Error: err.Error()})
+		return
+	}
+	body.SessionID = strings.TrimSpace(body.SessionID)
+	if body.SessionID == "" {
+		c.JSON(http.StatusBadRequest, Response{Success: false, Error: "session_id is required"})
+		return
+	}
+	if body.Threshold <= 0 {
+		c.JSON(http.StatusBadRequest, Response{Success: false, Error: "threshold must be positive"})
+		return
+	}
+	// Даты проверяются по тем же правилам, что и у бронирования.
+	stay := BookingInput{HotelID: hotelID, GuestName: "-", CheckIn: body.CheckIn, CheckOut: body.CheckOut, Guests: 1}
+	checkIn, checkOut, err := stay.validate(bookingToday())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, Response{Success: false, Error: err.Error()})
+		return
+	}
+
+	var exists bool
+	if err := db.QueryRowContext(c.Request.Context(), "SELECT EXISTS (SELECT 1 FROM hotels h WHERE h.id = $1 AND "+publishedHotel+")", hotelID).Scan(&exists); err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	if !exists {
+		c.JSON(http.StatusNotFound, Response{Success: false, Error: "hotel not found"})
+		return
+	}
+
+	var active int
+	if err := db.QueryRowContext(c.Request.Context(), "SELECT count(*) FROM price_alerts WHERE session_id = $1 AND check_in >= current_date", body.SessionID).Scan(&active); err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	if active >= maxPriceAlertsPerSession {
+		c.JSON(http.StatusUnprocessableEntity, Response{
+			Success: false,
+			Error:   fmt.Sprintf("a session can have at most %d active price alerts", maxPriceAlertsPerSession),
+			Hint:    "delete alerts you no longer need",
+		})
+		return
+	}
+
+	a, err := scanPriceAlert(db.QueryRowContext(c.Request.Context(), `
+		INSERT INTO price_alerts (hotel_id, session_id, check_in, check_out, threshold)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, hotel_id, check_in::text, check_out::text, threshold, last_quote, triggered_at, created_at
+	`, hotelID, body.SessionID, checkIn, checkOut, body.Threshold))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, Response{Success: true, Data: a, Count: 1})
+}
+
+// getPriceAlerts — HTTP-обработчик списка подписок сессии.
+// Реагирует на GET /api/price-alerts?session_id=...
+func getPriceAlerts(c *gin.Context) {
+	sessionID := c.Query("session_id")
+	if sessionID == "" {
+		c.JSON(http.StatusBadRequest, Response{Success: false, Error: "session_id is required"})
+		return
+	}
+	alerts, err := loadPriceAlerts(c.Request.Context(), "session_id = $1", sessionID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, Response{Success: true, Data: alerts, Count: len(alerts)})
+}
+
+// deletePriceAlert — HTTP-обработчик отписки.
+// Реагирует на DELETE /api/price-alerts/:id?session_id=...; чужие подписки не находятся (404).
+func deletePriceAlert(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, Response{Success: false, Error: "price alert id must be an integer"})
+		return
+	}
+	res, err := db.ExecContext(c.Request.Context(), "DELETE FROM price_alerts WHERE id = $1 AND session_id = $2", id, c.Query("session_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		c.JSON(http.StatusNotFound, Response{Success: false, Error: "price alert not found"})
+		return
+	}
+	c.JSON(http.StatusOK, Response{Success: true, Data: gin.H{"id": id}, Count: 1})
+}
+
+// getPriceAlertNotifications — HTTP-обработчик уведомлений о снижении цены.
+// Реагирует на GET /api/price-alerts/notifications?session_id=...: отдаёт подписки,
+// сработавшие после прошлого обращения, и отмечает их просмотренными.
+func getPriceAlertNotifications(c *gin.Context) {
+	sessionID := c.Query("session_id")
+	if sessionID == "" {
+		c.JSON(http.StatusBadRequest, Response{Success: false, Error: "session_id is required"})
+		return
+	}
+	rows, err := db.QueryContext(c.Request.Context(), `
+		UPDATE price_alerts SET notified_at = now()
+		WHERE session_id = $1 AND triggered_at IS NOT NULL
+		  AND (notified_at IS NULL OR notified_at < triggered_at)
+		RETURNING id, hotel_id, check_in::text, check_out::text, threshold, last_quote, triggered_at, created_at
+	`, sessionID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	defer rows.Close()
+	alerts := []PriceAlert{}
+	for rows.Next() {
+		a, err := scanPriceAlert(rows)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+			return
+		}
+		alerts = append(alerts, a)
+	}
+	if err := rows.Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, Response{Success: true, Data: alerts, Count: len(alerts)})
+}
+
+// evaluatePriceAlerts пересчитывает стоимость проживания по действующим подпискам
+// и отмечает сработавшие. Возвращает, сколько подписок проверено и сколько сработало.
+func evaluatePriceAlerts(ctx context.Context) (checked, triggered int, err error) {
+	alerts, err := loadPriceAlerts(ctx, "check_in >= current_date")
+	if err != nil {
+		return 0, 0, err
+	}
+	if len(alerts) == 0 {
+		return 0, 0, nil
+	}
+	set, err := loadHotels(ctx, false)
+	if err != nil {
+		return 0, 0, err
+	}
+	hotels := make(map[int]Hotel, len(set.Items))
+	for _, h := range set.Items {
+		hotels[h.ID] = h
+	}
+
+	for _, a := range alerts {
+		h, ok := hotels[a.HotelID]
+		if !ok {
+			// Гостиницу сняли с публикации: подписка ждёт, пока её вернут.
+			continue
+		}
+		checkIn, err1 := time.Parse(bookingDateLayout, a.CheckIn)
+		checkOut, err2 := time.Parse(bookingDateLayout, a.CheckOut)
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		quote, err := quoteHotel(h, QuoteRequest{Nights: bookingNights(checkIn, checkOut)})
+		if err != nil {
+			continue
+		}
+		checked++
+
+		update := "UPDATE price_alerts SET last_quote = $2 WHERE id = $1"
+		switch below := quote.Total < a.Threshold; {
+		case below && a.TriggeredAt == nil:
+			update = "UPDATE price_alerts SET last_quote = $2, triggered_at = now() WHERE id = $1"
+			triggered++
+		case !below && a.TriggeredAt != nil:
+			// Цена вернулась к порогу — следующее снижение снова сработает.
+			update = "UPDATE price_alerts SET last_quote = $2, triggered_at = NULL WHERE id = $1"
+		}
+		if _, err := db.ExecContext(ctx, update, a.ID, quote.Total); err != nil {
+			return checked, triggered, err
+		}
+	}
+	return checked, triggered, nil
+}
+
+// runPriceAlertScheduler периодически проверяет подписки (PRICE_ALERT_INTERVAL, 0 — выключено).
+func runPriceAlertScheduler(ctx context.Context) {
+	for {
+		interval := settings().PriceAlertInterval
+		if interval <= 0 {
+			if !sleepContext(ctx, time.Minute) {
+				return
+			}
+			continue
+		}
+		if !sleepContext(ctx, interval) {
+			return
+		}
+		checked, triggered, err := evaluatePriceAlerts(ctx)
+		if err != nil {
+			log.Printf("Price alert check failed: %v", err)
+			continue
+		}
+		if triggered > 0 {
+			log.Printf("Price alerts: %d checked, %d triggered", checked, triggered)
+		}
+	}
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Прогрев кэша перед маркетинговыми кампаниями.
+//
+// Во время кампании на страницы гостиниц её городов приходит в разы больше запросов
+// свободных мест и расчётов стоимости, чем обычно, и все они с холодного кэша упираются
+// в БД. Администратор заранее запускает задачу прогрева (POST /api/admin/cache/prime):
+// она загружает список гостиниц (из него берутся вместимость для свободных мест и цены
+// для расчёта стоимости, см. cachedHotel) и занятость по ночам каждой гостиницы
+// перечисленных городов на каждый диапазон дат.
+//
+// Записи закрепляются в кэше (swrCache.pin) до конца кампании, а не живут обычный TTL:
+//   - занятость диапазона — не дольше дня заезда: потом диапазон уже не забронировать;
+//   - список гостиниц — не дольше ближайшего запланированного изменения (цены из
+//     hotel_prices, публикации по publish_at): такие изменения наступают по времени,
+//     без сброса кэша, и закреплённый список их бы скрыл.
+// Изменения через API по-прежнему сбрасывают закреплённые записи (forgetAvailability,
+// cache.flush), так что прогретый кэш не отдаёт уже занятые места и старые цены.
+
+// Ограничения на один прогрев: число записей — произведение гостиниц на диапазоны.
+const (
+	maxPrimeCities = 50
+	maxPrimeRanges = 20
+	// maxCampaignWindow — насколько вперёд можно закрепить записи.
+	maxCampaignWindow = 31 * 24 * time.Hour
+)
+
+// CachePriming — тело POST /api/admin/cache/prime.
+type CachePriming struct {
+	CityIDs []int        `json:"city_ids"`
+	Ranges  []PrimeRange `json:"ranges"`
+	// EndsAt — конец кампании: дольше него записи не закрепляются.
+	EndsAt time.Time `json:"ends_at"`
+}
+
+// PrimeRange — диапазон дат, как в GET /api/hotels/:id/availability: to — дата выезда.
+type PrimeRange struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// primeRange — разобранный диапазон.
+type primeRange struct {
+	from, to time.Time
+}
+
+// PrimingProgress — промежуточное состояние задачи прогрева.
+type PrimingProgress struct {
+	HotelsTotal int `json:"hotels_total"`
+	HotelsDone  int `json:"hotels_done"`
+	Entries     int `json:"entries"`
+}
+
+// PrimingResult — итог задачи прогрева.
+type PrimingResult struct {
+	PrimingProgress
+	// HotelsPinnedUntil — до какого момента закреплён список гостиниц.
+	HotelsPinnedUntil time.Time `json:"hotels_pinned_until"`
+	EndsAt            time.Time `json:"ends_at"`
+}
+
+// validate проверяет запрос и разбирает диапазоны. now — текущий момент.
+func (p *CachePriming) validate(now time.Time) ([]primeRange, error) {
+	switch {
+	case len(p.CityIDs) == 0:
+		return nil, fmt.Errorf("city_ids are required")
+	case len(p.CityIDs) > maxPrimeCities:
+		return nil, fmt.Errorf("at most %d cities can be primed at once", maxPrimeCities)
+	case len(p.Ranges) == 0:
+		return nil, fmt.Errorf("ranges are required")
+	case len(p.Ranges) > maxPrimeRanges:
+		return nil, fmt.Errorf("at most %d ranges can be primed at once", maxPrimeRanges)
+	case p.EndsAt.IsZero():
+		return nil, fmt.Errorf("ends_at is required")
+	case !p.EndsAt.After(now):
+		return nil, fmt.Errorf("ends_at must be in the future")
+	case p.EndsAt.Sub(now) > maxCampaignWindow:
+		return nil, fmt.Errorf("ends_at must be within %d days from now", int(maxCampaignWindow.Hours()/24))
+	}
+	for _, id := range p.CityIDs {
+		if id <= 0 {
+			return nil, fmt.Errorf("city_ids must be positive integers")
+		}
+	}
+	today := now.UTC().Truncate(24 * time.Hour)
+	ranges := make([]primeRange, 0, len(p.Ranges))
+	for i, r := range p.Ranges {
+		from, err := time.Parse(bookingDateLayout, r.From)
+		if err != nil {
+			return nil, fmt.Errorf("ranges[%d]: from must be a date in YYYY-MM-DD format", i)
+		}
+		to, err := time.Parse(bookingDateLayout, r.To)
+		if err != nil {
+			return nil, fmt.Errorf("ranges[%d]: to must be a date in YYYY-MM-DD format", i)
+		}
+		if from.Before(today) {
+			return nil, fmt.Errorf("ranges[%d]: from must not be in the past", i)
+		}
+		if n := bookingNights(from, to); n < 1 || n > maxAvailabilityNights {
+			return nil, fmt.Errorf("ranges[%d]: to must be 1 to %d days after from", i, maxAvailabilityNights)
+		}
+		ranges = append(ranges, primeRange{from: from, to: to})
+	}
+	return ranges, nil
+}
+
+// pinUntil — до какого момента закрепить занятость диапазона: до конца дня заезда,
+// но не дольше кампании.
+func (r primeRange) pinUntil(endsAt time.Time) time.Time {
+	if end := r.from.Add(24 * time.Hour); end.Before(endsAt) {
+		return end
+	}
+	return endsAt
+}
+
+// nextScheduledChange возвращает ближайший момент после now, когда список гостиниц
+// изменится без участия API: вступит в силу запланированная цена или будет
+// опубликована гостиница; false — таких изменений не запланировано.
+func nextScheduledChange(ctx context.Context) (time.Time, bool, error) {
+	var next *time.Time
+	err := db.QueryRowContext(ctx, `
+		SELECT LEAST(
+			(SELECT MIN(effective_from) FROM hotel_prices WHERE effective_from > now()),
+			(SELECT MIN(publish_at) FROM hotels WHERE publish_at > now() AND deleted_at IS NULL)
+		)
+	`).Scan(&next)
+	if err != nil || next == nil {
+		return time.Time{}, false, err
+	}
+	return *next, true, nil
+}
+
+// runCachePriming прогревает кэш для гостиниц городов p.CityIDs на диапазоны ranges.
+func runCachePriming(p CachePriming, ranges []primeRange, progress func(interface{})) (interface{}, error) {
+	ctx := context.Background()
+	result := PrimingResult{EndsAt: p.EndsAt}
+
+	result.HotelsPinnedUntil = p.EndsAt
+	next, ok, err := nextScheduledChange(ctx)
+	if err != nil {
+		return result, fmt.Errorf("find scheduled changes: %w", err)
+	}
+	if ok && next.Before(result.HotelsPinnedUntil) {
+		result.HotelsPinnedUntil = next
+	}
+	value, err := cache.pin(ctx, "hotels", result.HotelsPinnedUntil, func(ctx context.Context) (interface{}, error) {
+		return loadHotels(ctx, true)
+	})
+	if err != nil {
+		return result, fmt.Errorf("load hotels: %w", err)
+	}
+	hotels := value.(rowSet[Hotel])
+
+	cities := make(map[int]bool, len(p.CityIDs))
+	for _, id := range p.CityIDs {
+		cities[id] = true
+	}
+	var targets []int
+	for _, h := range hotels.Items {
+		if h.CityID != nil && cities[*h.CityID] {
+			targets = append(targets, h.ID)
+		}
+	}
+	result.HotelsTotal = len(targets)
+	progress(result.PrimingProgress)
+
+	for _, id := range targets {
+		for _, r := range ranges {
+			_, err := cache.pin(ctx, availabilityCacheKey(id, r.from, r.to), r.pinUntil(p.EndsAt), func(ctx context.Context) (interface{}, error) {
+				return nightlyBookedGuests(ctx, db, id, r.from, r.to)
+			})
+			if err != nil {
+				return result, fmt.Errorf("hotel %d: %w", id, err)
+			}
+			result.Entries++
+		}
+		result.HotelsDone++
+		progress(result.PrimingProgress)
+	}
+	return result, nil
+}
+
+// startCachePriming — HTTP-обработчик, запускающий прогрев кэша фоновой задачей.
+// Реагирует на POST /api/admin/cache/prime с телом
+// {"city_ids": [1, 2], "ranges": [{"from": "2026-07-01", "to": "2026-07-04"}], "ends_at": "2026-07-10T00:00:00Z"};
+// отвечает 202 с описанием задачи, ход виден в GET /api/admin/jobs/:id.
+func startCachePriming(c *gin.Context) {
+	var p CachePriming
+	if err := c.ShouldBindJSON(&p); err != nil {
+		c.JSON(http.StatusBadRequest, Response{Success: false, Error: err.Error()})
+		return
+	}
+	ranges, err := p.validate(time.Now())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, Response{Success: false, Error: err.Error()})
+		return
+	}
+
+	job := jobs.start("cache-prime", func(progress func(interface{})) (interface{}, error) {
+		return runCachePriming(p, ranges, progress)
+	})
+	c.JSON(http.StatusAccepted, Response{
+		Success: true,
+		Data:    job,
+		Count:   1,
+	})
+}
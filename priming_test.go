@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCachePrimingValidate(t *testing.T) {
+	now := time.Date(2026, 6, 1, 15, 0, 0, 0, time.UTC)
+	ends := now.Add(7 * 24 * time.Hour)
+	valid := func() CachePriming {
+		return CachePriming{
+			CityIDs: []int{1},
+			Ranges:  []PrimeRange{{From: "2026-06-01", To: "2026-06-03"}, {From: "2026-06-10", To: "2026-06-11"}},
+			EndsAt:  ends,
+		}
+	}
+	p := valid()
+	ranges, err := p.validate(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ranges) != 2 || ranges[0].from.Format(bookingDateLayout) != "2026-06-01" || ranges[1].to.Format(bookingDateLayout) != "2026-06-11" {
+		t.Errorf("ranges: %+v", ranges)
+	}
+
+	for name, tc := range map[string]struct {
+		change func(*CachePriming)
+		err    string
+	}{
+		"no cities":       {func(p *CachePriming) { p.CityIDs = nil }, "city_ids are required"},
+		"bad city":        {func(p *CachePriming) { p.CityIDs = []int{0} }, "positive integers"},
+		"too many cities": {func(p *CachePriming) { p.CityIDs = make([]int, maxPrimeCities+1) }, "at most"},
+		"no ranges":       {func(p *CachePriming) { p.Ranges = nil }, "ranges are required"},
+		"too many ranges": {func(p *CachePriming) { p.Ranges = make([]PrimeRange, maxPrimeRanges+1) }, "at most"},
+		"no ends_at":      {func(p *CachePriming) { p.EndsAt = time.Time{} }, "ends_at is required"},
+		"ended":           {func(p *CachePriming) { p.EndsAt = now.Add(-time.Minute) }, "in the future"},
+		"too far":         {func(p *CachePriming) { p.EndsAt = now.Add(maxCampaignWindow + time.Hour) }, "within"},
+		"bad date":        {func(p *CachePriming) { p.Ranges[1].From = "10.06.2026" }, "ranges[1]: from"},
+		"past":            {func(p *CachePriming) { p.Ranges[0].From = "2026-05-31" }, "in the past"},
+		"empty range":     {func(p *CachePriming) { p.Ranges[0].To = p.Ranges[0].From }, "ranges[0]: to must be"},
+		"too long": {func(p *CachePriming) {
+			p.Ranges[0].To = time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC).AddDate(0, 0, maxAvailabilityNights+1).Format(bookingDateLayout)
+		}, "ranges[0]: to must be"},
+	} {
+		p := valid()
+		tc.change(&p)
+		if _, err := p.validate(now); err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("%s: err = %v, want %q", name, err, tc.err)
+		}
+	}
+}
+
+// Занятость закрепляется до конца дня заезда, но не дольше кампании.
+func TestPrimeRangePinUntil(t *testing.T) {
+	r := primeRange{from: time.Date(2026, 6, 10, 0, 0, 0, 0, time.UTC)}
+	dayEnd := time.Date(2026, 6, 11, 0, 0, 0, 0, time.UTC)
+	if got := r.pinUntil(dayEnd.Add(time.Hour)); !got.Equal(dayEnd) {
+		t.Errorf("campaign after check-in: pinned until %v, want %v", got, dayEnd)
+	}
+	ends := time.Date(2026, 6, 5, 12, 0, 0, 0, time.UTC)
+	if got := r.pinUntil(ends); !got.Equal(ends) {
+		t.Errorf("campaign ends earlier: pinned until %v, want %v", got, ends)
+	}
+}
+
+// testWaitJob дожидается завершения фоновой задачи.
+func testWaitJob(t *testing.T, id string) Job {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		job, ok := jobs.get(id)
+		if !ok {
+			t.Fatalf("job %s not found", id)
+		}
+		if job.Status != jobRunning {
+			return job
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("job %s is still running", id)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestCachePriming(t *testing.T) {
+	testDB(t)
+	t.Setenv("ADMIN_TOKEN", "admin-token")
+	moscow, kazan := testCity(t, "Moscow"), testCity(t, "Kazan")
+	primed := testHotel(t, "Arbat", moscow, 3, 5000)
+	testHotel(t, "Tverskaya", moscow, 3, 6000)
+	other := testHotel(t, "Kremlin", kazan, 3, 4000)
+	testAPIKey(t, "partner-key", "pro", 1000)
+
+	from := bookingToday().AddDate(0, 0, 30)
+	to := from.AddDate(0, 0, 1)
+	body := fmt.Sprintf(`{"city_ids": [%d], "ranges": [{"from": %q, "to": %q}, {"from": %q, "to": %q}], "ends_at": %q}`,
+		moscow, from.Format(bookingDateLayout), to.Format(bookingDateLayout),
+		from.Format(bookingDateLayout), to.AddDate(0, 0, 1).Format(bookingDateLayout),
+		time.Now().Add(24*time.Hour).Format(time.RFC3339))
+	w := serve(newAdminRouter(), "POST", "/api/admin/cache/prime", body, "Authorization", bearerPrefix+"admin-token")
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	var resp struct {
+		Data Job `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	job := testWaitJob(t, resp.Data.ID)
+	if job.Status != jobSucceeded {
+		t.Fatalf("job %s: %s", job.Status, job.Error)
+	}
+	if result := job.Result.(PrimingResult); result.HotelsTotal != 2 || result.HotelsDone != 2 || result.Entries != 4 {
+		t.Errorf("result: %+v", result)
+	}
+
+	router := newPublicRouter()
+	availability := func(hotelID int) *http.Response {
+		path := fmt.Sprintf("/api/hotels/%d/availability?from=%s&to=%s", hotelID, from.Format(bookingDateLayout), to.Format(bookingDateLayout))
+		return serve(router, "GET", path, "", apiKeyHeader, "partner-key").Result()
+	}
+	if r := availability(primed); r.StatusCode != http.StatusOK || r.Header.Get("X-Cache") != cacheHit {
+		t.Errorf("primed hotel: status %d, X-Cache %q", r.StatusCode, r.Header.Get("X-Cache"))
+	}
+	if r := availability(other); r.Header.Get("X-Cache") != cacheMiss {
+		t.Errorf("hotel of another city: X-Cache %q", r.Header.Get("X-Cache"))
+	}
+
+	// Бронирование сбрасывает закреплённую занятость своей гостиницы.
+	booking := fmt.Sprintf(`{"hotel_id": %d, "guest_name": "Guest", "check_in": %q, "check_out": %q, "guests": 2}`,
+		primed, from.Format(bookingDateLayout), to.Format(bookingDateLayout))
+	if w := serve(router, "POST", "/api/bookings", booking, apiKeyHeader, "partner-key"); w.Code != http.StatusCreated {
+		t.Fatalf("booking: status %d: %s", w.Code, w.Body)
+	}
+	path := fmt.Sprintf("/api/hotels/%d/availability?from=%s&to=%s", primed, from.Format(bookingDateLayout), to.Format(bookingDateLayout))
+	w = serve(router, "GET", path, "", apiKeyHeader, "partner-key")
+	var got struct {
+		Data Availability `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if w.Header().Get("X-Cache") != cacheMiss || got.Data.MinRemaining == nil || *got.Data.MinRemaining != 1 {
+		t.Errorf("after booking: X-Cache %q, %+v", w.Header().Get("X-Cache"), got.Data)
+	}
+}
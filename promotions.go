@@ -0,0 +1,328 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Спонсорские размещения.
+//
+// Администратор продвигает гостиницу на период (и, при желании, только в определённом
+// городе). Активные продвижения поднимаются в списке гостиниц на фиксированные позиции
+// (каждая sponsoredSlotEvery-я, начиная с первой) и помечаются is_sponsored=true;
+// из органической выдачи такие гостиницы убираются, чтобы не было дублей.
+// Показы и клики клиенты сообщают через /api/promotions/:id/impression и /click,
+// счётчики копятся по дням:
+//
+//	promotions(id, hotel_id, city_id NULL, starts_at, ends_at, created_at)
+//	promotion_stats(promotion_id, day, impressions, clicks), PRIMARY KEY (promotion_id, day)
+//
+// city_id ограничивает продвижение выдачей по этому городу (?city_id= в GET /api/hotels
+// и виджет); в общем списке без фильтра по городу действуют все активные продвижения.
+
+// sponsoredSlotEvery — шаг спонсорских позиций в списке: 0, 5, 10, ...
+const sponsoredSlotEvery = 5
+
+// promotionsCacheKey — ключ активных продвижений в кэше; они меняются редко, а нужны на каждый листинг.
+const promotionsCacheKey = "promotions"
+
+// Promotion — продвижение гостиницы.
+type Promotion struct {
+	ID          int       `json:"id"`
+	HotelID     int       `json:"hotel_id"`
+	CityID      *int      `json:"city_id"`
+	StartsAt    time.Time `json:"starts_at"`
+	EndsAt      time.Time `json:"ends_at"`
+	Impressions int64     `json:"impressions"`
+	Clicks      int64     `json:"clicks"`
+}
+
+// loadActivePromotions читает продвижения, действующие прямо сейчас, от более ранних к поздним.
+// strict — строгий режим сканирования (см. scan.go).
+func loadActivePromotions(ctx context.Context, strict bool) ([]Promotion, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT id, hotel_id, city_id, starts_at, ends_at
+		FROM promotions
+		WHERE starts_at <= now() AND ends_at > now()
+		ORDER BY starts_at, id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	promos := []Promotion{}
+	for rows.Next() {
+		var p Promotion
+		if err := rows.Scan(&p.ID, &p.HotelID, &p.CityID, &p.StartsAt, &p.EndsAt); err != nil {
+			if err := scanFailed(strict, "promotion", err); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		promos = append(promos, p)
+	}
+	// Неполный список продвижений не отдаём: без него выдача просто останется органической.
+	return promos, rows.Err()
+}
+
+// sponsoredHotels — продвигаемые гостиницы: id гостиницы -> id первого её продвижения.
+func sponsoredHotels(promos []Promotion) map[int]int {
+	promoByHotel := make(map[int]int, len(promos))
+	for _, p := range promos {
+		if _, dup := promoByHotel[p.HotelID]; !dup {
+			promoByHotel[p.HotelID] = p.ID
+		}
+	}
+	return promoByHotel
+}
+
+// hotelIDs — id продвигаемых гостиниц для параметра запроса (по возрастанию).
+func hotelIDs(promoByHotel map[int]int) []int64 {
+	ids := make([]int64, 0, len(promoByHotel))
+	for id := range promoByHotel {
+		ids = append(ids, int64(id))
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+// interleaveSponsored возвращает новый список, в котором продвигаемые гостиницы стоят
+// на спонсорских позициях. Исходный слайс (он может лежать в кэше) не изменяется.
+func interleaveSponsored(hotels []Hotel, promos []Promotion) []Hotel {
+	if len(promos) == 0 {
+		return hotels
+	}
+
+	promoByHotel := sponsoredHotels(promos)
+	var sponsored, organic []Hotel
+	for _, h := range hotels {
+		if promoID, ok := promoByHotel[h.ID]; ok {
+			h.IsSponsored = true
+			h.PromotionID = &promoID
+			sponsored = append(sponsored, h)
+		} else {
+			organic = append(organic, h)
+		}
+	}
+
+	result := make([]Hotel, 0, len(hotels))
+	for len(sponsored) > 0 || len(organic) > 0 {
+		if len(result)%sponsoredSlotEvery == 0 && len(sponsored) > 0 {
+			result = append(result, sponsored[0])
+			sponsored = sponsored[1:]
+			continue
+		}
+		if len(organic) == 0 {
+			result = append(result, sponsored...)
+			break
+		}
+		result = append(result, organic[0])
+		organic = organic[1:]
+	}
+	return result
+}
+
+// sponsoredBefore — сколько из первых pos позиций выдачи interleaveSponsored отдаёт
+// спонсорским гостиницам, если их sponsored, а органических organic. Так страница
+// GET /api/hotels читается из БД двумя запросами (органические с LIMIT/OFFSET и спонсорские),
+// и спонсорские места на ней те же, что и в списке целиком.
+func sponsoredBefore(pos, sponsored, organic int) int {
+	// Позиции 0, sponsoredSlotEvery, 2*sponsoredSlotEvery, ... — спонсорские, пока
+	// спонсорские гостиницы есть; когда кончаются органические, спонсорские идут подряд.
+	slots := min(sponsored, (pos+sponsoredSlotEvery-1)/sponsoredSlotEvery)
+	return max(slots, pos-organic)
+}
+
+// placeSponsored собирает позиции [start, end) выдачи из total гостиниц, sponsored из
+// которых продвигается: sp — продвигаемые гостиницы этих позиций, organic — органические,
+// обе в порядке выдачи. Продвигаемые помечаются is_sponsored и promotion_id.
+// Если строк меньше, чем позиций (в мягком режиме сканирования часть строк пропускается),
+// страница просто короче.
+func placeSponsored(sp, organic []Hotel, promoByHotel map[int]int, total, sponsored, start, end int) []Hotel {
+	page := make([]Hotel, 0, end-start)
+	for pos := start; pos < end; pos++ {
+		if sponsoredBefore(pos+1, sponsored, total-sponsored) > sponsoredBefore(pos, sponsored, total-sponsored) {
+			if len(sp) > 0 {
+				h := sp[0]
+				sp = sp[1:]
+				promoID := promoByHotel[h.ID]
+				h.IsSponsored, h.PromotionID = true, &promoID
+				page = append(page, h)
+			}
+			continue
+		}
+		if len(organic) > 0 {
+			page = append(page, organic[0])
+			organic = organic[1:]
+		}
+	}
+	return page
+}
+
+// trackPromotionEvent возвращает обработчик, увеличивающий счётчик показов или кликов.
+// Реагирует на POST /api/promotions/:id/impression и POST /api/promotions/:id/click.
+func trackPromotionEvent(column string) gin.HandlerFunc {
+	// column подставляется в SQL, поэтому допускаются только известные имена колонок.
+	if column != "impressions" && column != "clicks" {
+		panic("unknown promotion counter " + column)
+	}
+	return func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, Response{Success: false, Error: "promotion id must be an integer"})
+			return
+		}
+
+		res, err := db.ExecContext(c.Request.Context(), `
+			INSERT INTO promotion_stats (promotion_id, day, `+column+`)
+			SELECT id, CURRENT_DATE, 1 FROM promotions WHERE id = $1
+			ON CONFLICT (promotion_id, day) DO UPDATE
+				SET `+column+` = promotion_stats.`+column+` + 1
+		`, id)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+			return
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			c.JSON(http.StatusNotFound, Response{Success: false, Error: "promotion not found"})
+			return
+		}
+		c.JSON(http.StatusOK, Response{Success: true})
+	}
+}
+
+// getPromotions — HTTP-обработчик списка продвижений со счётчиками.
+// Реагирует на GET /api/admin/promotions; с ?active=true — только действующие сейчас.
+func getPromotions(c *gin.Context) {
+	strict := strictScan(c)
+	rows, err := db.QueryContext(c.Request.Context(), `
+		SELECT p.id, p.hotel_id, p.city_id, p.starts_at, p.ends_at,
+		       COALESCE(SUM(s.impressions), 0), COALESCE(SUM(s.clicks), 0)
+		FROM promotions p
+		LEFT JOIN promotion_stats s ON s.promotion_id = p.id
+		WHERE NOT $1 OR (p.starts_at <= now() AND p.ends_at > now())
+		GROUP BY p.id
+		ORDER BY p.starts_at DESC, p.id
+	`, c.Query("active") == "true")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	promos := []Promotion{}
+	partial := false
+	for rows.Next() {
+		var p Promotion
+		if err := rows.Scan(&p.ID, &p.HotelID, &p.CityID, &p.StartsAt, &p.EndsAt, &p.Impressions, &p.Clicks); err != nil {
+			if err := scanFailed(strict, "promotion", err); err != nil {
+				c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+				return
+			}
+			partial = true
+			continue
+		}
+		promos = append(promos, p)
+	}
+	if err := rows.Err(); err != nil {
+		if err := iterationFailed(strict, "promotion", err); err != nil {
+			c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+			return
+		}
+		partial = true
+	}
+
+	c.JSON(http.StatusOK, Response{
+		Success: true,
+		Data:    promos,
+		Count:   len(promos),
+		Partial: partial,
+	})
+}
+
+// createPromotion — HTTP-обработчик создания продвижения.
+// Реагирует на POST /api/admin/promotions с телом
+// {"hotel_id": 1, "city_id": 2, "starts_at": "...", "ends_at": "..."} (city_id необязателен).
+func createPromotion(c *gin.Context) {
+	var p Promotion
+	if err := c.ShouldBindJSON(&p); err != nil {
+		c.JSON(http.StatusBadRequest, Response{Success: false, Error: err.Error()})
+		return
+	}
+	if p.HotelID <= 0 {
+		c.JSON(http.StatusBadRequest, Response{Success: false, Error: "hotel_id is required"})
+		return
+	}
+	if !p.EndsAt.After(p.StartsAt) {
+		c.JSON(http.StatusBadRequest, Response{Success: false, Error: "ends_at must be after starts_at"})
+		return
+	}
+
+	err := db.QueryRowContext(c.Request.Context(), `
+		INSERT INTO promotions (hotel_id, city_id, starts_at, ends_at)
+		SELECT id, $2, $3, $4 FROM hotels WHERE id = $1
+		RETURNING id
+	`, p.HotelID, p.CityID, p.StartsAt, p.EndsAt).Scan(&p.ID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusBadRequest, Response{Success: false, Error: "hotel not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+
+	// Новое продвижение должно появиться в выдаче сразу, не дожидаясь истечения кэша:
+	// сбрасываем и закэшированные страницы выдачи.
+	cache.flush(promotionsCacheKey, hotelListsCacheKey)
+	c.JSON(http.StatusCreated, Response{
+		Success: true,
+		Data:    p,
+		Count:   1,
+	})
+}
+
+// deletePromotion — HTTP-обработчик удаления продвижения вместе со статистикой.
+// Реагирует на DELETE /api/admin/promotions/:id.
+func deletePromotion(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, Response{Success: false, Error: "promotion id must be an integer"})
+		return
+	}
+
+	tx, err := db.BeginTx(c.Request.Context(), nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(c.Request.Context(), "DELETE FROM promotion_stats WHERE promotion_id = $1", id); err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	res, err := tx.ExecContext(c.Request.Context(), "DELETE FROM promotions WHERE id = $1", id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		c.JSON(http.StatusNotFound, Response{Success: false, Error: "promotion not found"})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+
+	cache.flush(promotionsCacheKey, hotelListsCacheKey)
+	c.JSON(http.StatusOK, Response{Success: true})
+}
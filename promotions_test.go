@@ -0,0 +1,58 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+// Страница, собранная placeSponsored из двух срезов (как их читает hotelListPage),
+// должна совпадать с тем же окном списка, переставленного interleaveSponsored целиком.
+func TestPlaceSponsoredMatchesInterleave(t *testing.T) {
+	for sponsored := 0; sponsored <= 12; sponsored++ {
+		for organic := 0; organic <= 12; organic++ {
+			total := sponsored + organic
+			var hotels, sp, org []Hotel
+			var promos []Promotion
+			for id := 1; id <= total; id++ {
+				h := Hotel{ID: id}
+				hotels = append(hotels, h)
+				// Продвигаются гостиницы с чётными id, пока не наберётся sponsored.
+				if len(promos) < sponsored && (id%2 == 0 || total-id < sponsored-len(promos)) {
+					promos = append(promos, Promotion{ID: 100 + id, HotelID: id})
+					sp = append(sp, h)
+				} else {
+					org = append(org, h)
+				}
+			}
+			want := interleaveSponsored(hotels, promos)
+			promoByHotel := sponsoredHotels(promos)
+
+			for start := 0; start <= total; start++ {
+				for end := start; end <= total; end++ {
+					spStart, spEnd := sponsoredBefore(start, sponsored, organic), sponsoredBefore(end, sponsored, organic)
+					orgStart := start - spStart
+					orgEnd := orgStart + (end - start) - (spEnd - spStart)
+					if spStart < 0 || spEnd > sponsored || orgStart < 0 || orgEnd > organic {
+						t.Fatalf("S=%d O=%d [%d,%d): sponsored [%d,%d), organic [%d,%d) out of range",
+							sponsored, organic, start, end, spStart, spEnd, orgStart, orgEnd)
+					}
+					got := placeSponsored(sp[spStart:spEnd], org[orgStart:orgEnd], promoByHotel, total, sponsored, start, end)
+					if !reflect.DeepEqual(got, want[start:end]) && !(len(got) == 0 && end == start) {
+						t.Fatalf("S=%d O=%d [%d,%d): got %v, want %v", sponsored, organic, start, end, got, want[start:end])
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestSponsoredHotelsKeepsFirstPromotion(t *testing.T) {
+	got := sponsoredHotels([]Promotion{{ID: 1, HotelID: 10}, {ID: 2, HotelID: 20}, {ID: 3, HotelID: 10}})
+	want := map[int]int{10: 1, 20: 2}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if ids := hotelIDs(got); !reflect.DeepEqual(ids, []int64{10, 20}) {
+		t.Errorf("hotelIDs: %v", ids)
+	}
+}
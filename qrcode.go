@@ -0,0 +1,457 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"strings"
+)
+
+// Кодировщик QR-кодов для коротких строк (см. checkin.go).
+//
+// Поддерживается только то, что нужно для токенов регистрации заезда: байтовый
+// режим, уровень коррекции ошибок M и версии 1–10 (до 213 байт). Алгоритм — по
+// ISO/IEC 18004: данные дополняются до ёмкости версии, делятся на блоки, к каждому
+// блоку добавляются коды Рида — Соломона, блоки чередуются и укладываются
+// зигзагом в свободные модули; из восьми масок выбирается та, у которой меньше штраф.
+
+// qrQuietZone — ширина пустого поля вокруг кода в модулях (требование стандарта).
+const qrQuietZone = 4
+
+// qrBlocks — разбиение кодовых слов версии на блоки для уровня M:
+// ecPerBlock кодов коррекции на блок, g1 блоков по d1 слов данных и g2 блоков по d1+1.
+type qrBlocks struct {
+	ecPerBlock, g1, d1, g2 int
+}
+
+// qrVersionsM — разбиение для версий 1–10 на уровне M (индекс — версия минус 1).
+var qrVersionsM = []qrBlocks{
+	{10, 1, 16, 0}, {16, 1, 28, 0}, {26, 1, 44, 0}, {18, 2, 32, 0}, {24, 2, 43, 0},
+	{16, 4, 27, 0}, {18, 4, 31, 0}, {22, 2, 38, 2}, {22, 3, 36, 2}, {26, 4, 43, 1},
+}
+
+// qrAlignment — координаты центров выравнивающих узоров версий 1–10.
+var qrAlignment = [][]int{
+	nil, {6, 18}, {6, 22}, {6, 26}, {6, 30}, {6, 34}, {6, 22, 38}, {6, 24, 42}, {6, 26, 46}, {6, 28, 50},
+}
+
+// dataCodewords — число кодовых слов данных версии.
+func (b qrBlocks) dataCodewords() int {
+	return b.g1*b.d1 + b.g2*(b.d1+1)
+}
+
+// QRCode — матрица модулей; true — тёмный модуль.
+type QRCode struct {
+	size    int
+	modules [][]bool
+	// reserved отмечает служебные модули, которые не занимают данные и не маскируются.
+	reserved [][]bool
+}
+
+// encodeQR строит QR-код для строки.
+func encodeQR(text string) (*QRCode, error) {
+	data := []byte(text)
+	version := 0
+	for v := 1; v <= len(qrVersionsM); v++ {
+		if 4+qrCountBits(v)+8*len(data) <= 8*qrVersionsM[v-1].dataCodewords() {
+			version = v
+			break
+		}
+	}
+	if version == 0 {
+		return nil, fmt.Errorf("qr: %d bytes do not fit into version %d", len(data), len(qrVersionsM))
+	}
+
+	q := newQRCode(version)
+	q.drawFunctionPatterns(version)
+	q.drawCodewords(qrInterleave(qrVersionsM[version-1], qrDataCodewords(version, data)))
+
+	best, bestPenalty := 0, -1
+	for mask := 0; mask < 8; mask++ {
+		q.applyMask(mask)
+		q.drawFormat(mask)
+		if p := q.penalty(); bestPenalty < 0 || p < bestPenalty {
+			best, bestPenalty = mask, p
+		}
+		q.applyMask(mask) // маска — XOR, повторное наложение её снимает
+	}
+	q.applyMask(best)
+	q.drawFormat(best)
+	return q, nil
+}
+
+// qrCountBits — длина поля длины данных в байтовом режиме.
+func qrCountBits(version int) int {
+	if version < 10 {
+		return 8
+	}
+	return 16
+}
+
+func newQRCode(version int) *QRCode {
+	size := 17 + 4*version
+	q := &QRCode{size: size, modules: make([][]bool, size), reserved: make([][]bool, size)}
+	for i := range q.modules {
+		q.modules[i] = make([]bool, size)
+		q.reserved[i] = make([]bool, size)
+	}
+	return q
+}
+
+// set ставит служебный модуль (x — столбец, y — строка).
+func (q *QRCode) set(x, y int, dark bool) {
+	q.modules[y][x] = dark
+	q.reserved[y][x] = true
+}
+
+// drawFunctionPatterns рисует поисковые, синхронизирующие и выравнивающие узоры,
+// резервирует места под формат и версию.
+func (q *QRCode) drawFunctionPatterns(version int) {
+	for i := 0; i < q.size; i++ {
+		q.set(6, i, i%2 == 0)
+		q.set(i, 6, i%2 == 0)
+	}
+	q.drawFinder(3, 3)
+	q.drawFinder(q.size-4, 3)
+	q.drawFinder(3, q.size-4)
+
+	centers := qrAlignment[version-1]
+	for i, x := range centers {
+		for j, y := range centers {
+			// Углы, занятые поисковыми узорами, пропускаются.
+			if (i == 0 && j == 0) || (i == 0 && j == len(centers)-1) || (i == len(centers)-1 && j == 0) {
+				continue
+			}
+			for dy := -2; dy <= 2; dy++ {
+				for dx := -2; dx <= 2; dx++ {
+					q.set(x+dx, y+dy, max(abs(dx), abs(dy)) != 1)
+				}
+			}
+		}
+	}
+
+	q.drawFormat(0) // резервирует модули формата; значения перезапишутся после выбора маски
+	if version >= 7 {
+		rem := version
+		for i := 0; i < 12; i++ {
+			rem = (rem << 1) ^ ((rem >> 11) * 0x1F25)
+		}
+		bits := version<<12 | rem
+		for i := 0; i < 18; i++ {
+			dark := (bits>>i)&1 != 0
+			a, b := q.size-11+i%3, i/3
+			q.set(a, b, dark)
+			q.set(b, a, dark)
+		}
+	}
+}
+
+// drawFinder рисует поисковый узор с разделителем вокруг центра (x, y).
+func (q *QRCode) drawFinder(x, y int) {
+	for dy := -4; dy <= 4; dy++ {
+		for dx := -4; dx <= 4; dx++ {
+			xx, yy := x+dx, y+dy
+			if xx < 0 || xx >= q.size || yy < 0 || yy >= q.size {
+				continue
+			}
+			d := max(abs(dx), abs(dy))
+			q.set(xx, yy, d != 2 && d != 4)
+		}
+	}
+}
+
+// drawFormat записывает обе копии информации о формате (уровень M и маска).
+func (q *QRCode) drawFormat(mask int) {
+	const levelM = 0
+	data := levelM<<3 | mask
+	rem := data
+	for i := 0; i < 10; i++ {
+		rem = (rem << 1) ^ ((rem >> 9) * 0x537)
+	}
+	bits := (data<<10 | rem) ^ 0x5412
+	bit := func(i int) bool { return (bits>>i)&1 != 0 }
+
+	for i := 0; i <= 5; i++ {
+		q.set(8, i, bit(i))
+	}
+	q.set(8, 7, bit(6))
+	q.set(8, 8, bit(7))
+	q.set(7, 8, bit(8))
+	for i := 9; i < 15; i++ {
+		q.set(14-i, 8, bit(i))
+	}
+	for i := 0; i < 8; i++ {
+		q.set(q.size-1-i, 8, bit(i))
+	}
+	for i := 8; i < 15; i++ {
+		q.set(8, q.size-15+i, bit(i))
+	}
+	q.set(8, q.size-8, true) // тёмный модуль есть всегда
+}
+
+// qrDataCodewords кодирует данные в байтовом режиме и дополняет их до ёмкости версии.
+func qrDataCodewords(version int, data []byte) []byte {
+	capacity := qrVersionsM[version-1].dataCodewords()
+	var bits []bool
+	put := func(v, n int) {
+		for i := n - 1; i >= 0; i-- {
+			bits = append(bits, (v>>i)&1 != 0)
+		}
+	}
+	put(0b0100, 4)
+	put(len(data), qrCountBits(version))
+	for _, b := range data {
+		put(int(b), 8)
+	}
+	put(0, min(4, capacity*8-len(bits)))
+	put(0, (8-len(bits)%8)%8)
+	for pad := 0xEC; len(bits) < capacity*8; pad ^= 0xEC ^ 0x11 {
+		put(pad, 8)
+	}
+
+	out := make([]byte, capacity)
+	for i, b := range bits {
+		if b {
+			out[i/8] |= 1 << (7 - i%8)
+		}
+	}
+	return out
+}
+
+// qrInterleave делит данные на блоки, добавляет коды коррекции и чередует блоки.
+func qrInterleave(b qrBlocks, data []byte) []byte {
+	divisor := rsDivisor(b.ecPerBlock)
+	var blocks, ecc [][]byte
+	for i, off := 0, 0; i < b.g1+b.g2; i++ {
+		n := b.d1
+		if i >= b.g1 {
+			n++
+		}
+		block := data[off : off+n]
+		off += n
+		blocks = append(blocks, block)
+		ecc = append(ecc, rsRemainder(block, divisor))
+	}
+	var out []byte
+	for i := 0; i <= b.d1; i++ {
+		for _, block := range blocks {
+			if i < len(block) {
+				out = append(out, block[i])
+			}
+		}
+	}
+	for i := 0; i < b.ecPerBlock; i++ {
+		for _, e := range ecc {
+			out = append(out, e[i])
+		}
+	}
+	return out
+}
+
+// drawCodewords укладывает кодовые слова зигзагом снизу справа, пропуская служебные модули.
+func (q *QRCode) drawCodewords(data []byte) {
+	i := 0
+	for right := q.size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5 // столбец синхронизирующего узора
+		}
+		upward := (right+1)&2 == 0
+		for vert := 0; vert < q.size; vert++ {
+			y := vert
+			if upward {
+				y = q.size - 1 - vert
+			}
+			for j := 0; j < 2; j++ {
+				x := right - j
+				if q.reserved[y][x] || i >= len(data)*8 {
+					continue
+				}
+				q.modules[y][x] = (data[i/8]>>(7-i%8))&1 != 0
+				i++
+			}
+		}
+	}
+}
+
+// applyMask инвертирует модули данных по шаблону маски.
+func (q *QRCode) applyMask(mask int) {
+	for y := 0; y < q.size; y++ {
+		for x := 0; x < q.size; x++ {
+			if q.reserved[y][x] {
+				continue
+			}
+			var invert bool
+			switch mask {
+			case 0:
+				invert = (x+y)%2 == 0
+			case 1:
+				invert = y%2 == 0
+			case 2:
+				invert = x%3 == 0
+			case 3:
+				invert = (x+y)%3 == 0
+			case 4:
+				invert = (x/3+y/2)%2 == 0
+			case 5:
+				invert = x*y%2+x*y%3 == 0
+			case 6:
+				invert = (x*y%2+x*y%3)%2 == 0
+			case 7:
+				invert = ((x+y)%2+x*y%3)%2 == 0
+			}
+			if invert {
+				q.modules[y][x] = !q.modules[y][x]
+			}
+		}
+	}
+}
+
+// penalty считает штраф маски по четырём правилам стандарта.
+func (q *QRCode) penalty() int {
+	p, dark := 0, 0
+	line := make([]bool, q.size)
+	for _, horizontal := range []bool{true, false} {
+		for a := 0; a < q.size; a++ {
+			for b := 0; b < q.size; b++ {
+				if horizontal {
+					line[b] = q.modules[a][b]
+				} else {
+					line[b] = q.modules[b][a]
+				}
+			}
+			// Серии из пяти и более одинаковых модулей.
+			run := 1
+			for b := 1; b <= q.size; b++ {
+				if b < q.size && line[b] == line[b-1] {
+					run++
+					continue
+				}
+				if run >= 5 {
+					p += 3 + run - 5
+				}
+				run = 1
+			}
+			// Узоры, похожие на поисковый: 1:1:3:1:1 со светлым полем в четыре модуля с одной стороны.
+			for b := 0; b+11 <= q.size; b++ {
+				s := line[b : b+11]
+				core := s[0] && !s[1] && s[2] && s[3] && s[4] && !s[5] && s[6]
+				if core && !s[7] && !s[8] && !s[9] && !s[10] {
+					p += 40
+				}
+				core = s[4] && !s[5] && s[6] && s[7] && s[8] && !s[9] && s[10]
+				if core && !s[0] && !s[1] && !s[2] && !s[3] {
+					p += 40
+				}
+			}
+		}
+	}
+	for y := 0; y < q.size; y++ {
+		for x := 0; x < q.size; x++ {
+			if q.modules[y][x] {
+				dark++
+			}
+			// Квадраты 2×2 одного цвета.
+			if x+1 < q.size && y+1 < q.size {
+				c := q.modules[y][x]
+				if q.modules[y][x+1] == c && q.modules[y+1][x] == c && q.modules[y+1][x+1] == c {
+					p += 3
+				}
+			}
+		}
+	}
+	// Отклонение доли тёмных модулей от половины, по 10 за каждые 5%.
+	total := q.size * q.size
+	p += 10 * (abs(dark*100/total-50) / 5)
+	return p
+}
+
+// SVG рисует код в SVG; каждый модуль — квадрат со стороной 1, масштабирует клиент.
+func (q *QRCode) SVG() string {
+	full := q.size + 2*qrQuietZone
+	var path strings.Builder
+	for y := 0; y < q.size; y++ {
+		for x := 0; x < q.size; x++ {
+			if q.modules[y][x] {
+				fmt.Fprintf(&path, "M%d,%dh1v1h-1z", x+qrQuietZone, y+qrQuietZone)
+			}
+		}
+	}
+	return fmt.Sprintf(`<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 %d %d" shape-rendering="crispEdges">`+
+		`<rect width="100%%" height="100%%" fill="#fff"/><path d="%s" fill="#000"/></svg>`, full, full, path.String())
+}
+
+// PNG рисует код в PNG по scale пикселей на модуль.
+func (q *QRCode) PNG(scale int) ([]byte, error) {
+	full := (q.size + 2*qrQuietZone) * scale
+	img := image.NewGray(image.Rect(0, 0, full, full))
+	for i := range img.Pix {
+		img.Pix[i] = 0xFF
+	}
+	for y := 0; y < q.size; y++ {
+		for x := 0; x < q.size; x++ {
+			if !q.modules[y][x] {
+				continue
+			}
+			for dy := 0; dy < scale; dy++ {
+				for dx := 0; dx < scale; dx++ {
+					img.SetGray((x+qrQuietZone)*scale+dx, (y+qrQuietZone)*scale+dy, color.Gray{})
+				}
+			}
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// rsDivisor — порождающий многочлен кода Рида — Соломона степени degree над GF(256).
+func rsDivisor(degree int) []byte {
+	result := make([]byte, degree)
+	result[degree-1] = 1
+	root := byte(1)
+	for i := 0; i < degree; i++ {
+		for j := range result {
+			result[j] = gfMultiply(result[j], root)
+			if j+1 < len(result) {
+				result[j] ^= result[j+1]
+			}
+		}
+		root = gfMultiply(root, 0x02)
+	}
+	return result
+}
+
+// rsRemainder — коды коррекции: остаток от деления данных на порождающий многочлен.
+func rsRemainder(data, divisor []byte) []byte {
+	result := make([]byte, len(divisor))
+	for _, b := range data {
+		factor := b ^ result[0]
+		copy(result, result[1:])
+		result[len(result)-1] = 0
+		for i, coef := range divisor {
+			result[i] ^= gfMultiply(coef, factor)
+		}
+	}
+	return result
+}
+
+// gfMultiply — умножение в GF(256) по модулю x^8 + x^4 + x^3 + x^2 + 1.
+func gfMultiply(x, y byte) byte {
+	var z int
+	for i := 7; i >= 0; i-- {
+		z = (z << 1) ^ ((z >> 7) * 0x11D)
+		z ^= int((y>>i)&1) * int(x)
+	}
+	return byte(z)
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
@@ -0,0 +1,303 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+// Вопросы и ответы о гостинице.
+//
+// Посетитель задаёт вопрос об опубликованной гостинице, администратор отвечает.
+// Учётных записей у посетителей нет, поэтому автор вопроса опознаётся так же, как
+// в аналитике (events.go), — по session_id клиента. По нему же клиент забирает
+// уведомления об ответах: GET /api/questions/notifications возвращает вопросы,
+// на которые ответили после прошлого обращения, и отмечает их просмотренными.
+//
+//	hotel_questions(id, hotel_id, text, session_id, hidden, helpful_votes, answered_at NULL,
+//	                asker_notified_at NULL, created_at)
+//	hotel_answers(id, question_id, text, helpful_votes, created_at)
+//
+// Публичный список упорядочен по helpful_votes — счётчику полезности, денормализованному
+// для сортировки (голоса — см. votes.go); ответы внутри вопроса — тоже. Скрытые
+// администратором вопросы в список не попадают.
+
+// Ограничения длины текста вопроса или ответа (в символах).
+const (
+	qaMinLength = 10
+	qaMaxLength = 2000
+)
+
+// questionsPerMinute — сколько вопросов в минуту можно задать с одного IP.
+const questionsPerMinute = 5
+
+var questionLimiter = newIPLimiter()
+
+// Answer — ответ на вопрос.
+type Answer struct {
+	ID           int       `json:"id"`
+	Text         string    `json:"text"`
+	HelpfulVotes int       `json:"helpful_votes"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// Question — вопрос о гостинице вместе с ответами.
+type Question struct {
+	ID           int        `json:"id"`
+	HotelID      int        `json:"hotel_id"`
+	Text         string     `json:"text"`
+	HelpfulVotes int        `json:"helpful_votes"`
+	AnsweredAt   *time.Time `json:"answered_at"`
+	CreatedAt    time.Time  `json:"created_at"`
+	Answers      []Answer   `json:"answers"`
+}
+
+// validQAText проверяет длину текста вопроса или ответа. Возвращает текст ошибки или пустую строку.
+func validQAText(text string) string {
+	if n := utf8.RuneCountInString(strings.TrimSpace(text)); n < qaMinLength || n > qaMaxLength {
+		return "text must be between " + strconv.Itoa(qaMinLength) + " and " + strconv.Itoa(qaMaxLength) + " characters"
+	}
+	return ""
+}
+
+// loadQuestions читает вопросы по условию where (с параметрами args) вместе с ответами.
+func loadQuestions(ctx context.Context, where string, args ...interface{}) ([]Question, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT q.id, q.hotel_id, q.text, q.helpful_votes, q.answered_at, q.created_at
+		FROM hotel_questions q
+		WHERE `+where+`
+		ORDER BY q.helpful_votes DESC, q.created_at DESC
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	questions := []Question{}
+	index := map[int]int{}
+	ids := []int{}
+	for rows.Next() {
+		q := Question{Answers: []Answer{}}
+		if err := rows.Scan(&q.ID, &q.HotelID, &q.Text, &q.HelpfulVotes, &q.AnsweredAt, &q.CreatedAt); err != nil {
+			return nil, err
+		}
+		index[q.ID] = len(questions)
+		ids = append(ids, q.ID)
+		questions = append(questions, q)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return questions, nil
+	}
+
+	// Ответы — одним запросом на все вопросы страницы.
+	rows, err = db.QueryContext(ctx, `
+		SELECT question_id, id, text, helpful_votes, created_at
+		FROM hotel_answers
+		WHERE question_id = ANY($1)
+		ORDER BY helpful_votes DESC, created_at
+	`, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var questionID int
+		var a Answer
+		if err := rows.Scan(&questionID, &a.ID, &a.Text, &a.HelpfulVotes, &a.CreatedAt); err != nil {
+			return nil, err
+		}
+		q := &questions[index[questionID]]
+		q.Answers = append(q.Answers, a)
+	}
+	return questions, rows.Err()
+}
+
+// getHotelQuestions — HTTP-обработчик списка вопросов о гостинице, от самых полезных.
+// Реагирует на GET /api/hotels/:id/questions
+func getHotelQuestions(c *gin.Context) {
+	id, ok := hotelIDParam(c)
+	if !ok {
+		return
+	}
+	questions, err := loadQuestions(c.Request.Context(), "q.hotel_id = $1 AND NOT q.hidden", id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	respondList(c, questions, len(questions), false)
+}
+
+// askQuestion — HTTP-обработчик, публикующий вопрос о гостинице.
+// Реагирует на POST /api/hotels/:id/questions с телом {"text": "...", "session_id": "3f2a9c"}.
+func askQuestion(c *gin.Context) {
+	id, ok := hotelIDParam(c)
+	if !ok {
+		return
+	}
+	var body struct {
+		Text      string `json:"text"`
+		SessionID string `json:"session_id"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, Response{Success: false, Error: err.Error()})
+		return
+	}
+	if msg := validQAText(body.Text); msg != "" {
+		c.JSON(http.StatusBadRequest, Response{Success: false, Error: msg})
+		return
+	}
+	if body.SessionID == "" || len(body.SessionID) > 128 {
+		c.JSON(http.StatusBadRequest, Response{Success: false, Error: "session_id is required and must be at most 128 characters"})
+		return
+	}
+	if ok, reset := questionLimiter.allow(c.ClientIP(), questionsPerMinute); !ok {
+		c.Header("Retry-After", strconv.Itoa(int(time.Until(reset).Seconds())+1))
+		c.JSON(http.StatusTooManyRequests, Response{Success: false, Error: "too many questions, try again later"})
+		return
+	}
+
+	q := Question{HotelID: id, Text: strings.TrimSpace(body.Text), Answers: []Answer{}}
+	err := db.QueryRowContext(c.Request.Context(), `
+		INSERT INTO hotel_questions (hotel_id, text, session_id)
+		SELECT h.id, $2, $3 FROM hotels h WHERE h.id = $1 AND `+publishedHotel+`
+		RETURNING id, created_at
+	`, id, q.Text, body.SessionID).Scan(&q.ID, &q.CreatedAt)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, Response{Success: false, Error: "hotel not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, Response{Success: true, Data: q, Count: 1})
+}
+
+// getQuestionNotifications — HTTP-обработчик уведомлений автора об ответах.
+// Реагирует на GET /api/questions/notifications?session_id=3f2a9c: возвращает вопросы
+// сессии, на которые пришёл ответ после прошлого обращения, и отмечает их просмотренными.
+func getQuestionNotifications(c *gin.Context) {
+	sessionID := c.Query("session_id")
+	if sessionID == "" {
+		c.JSON(http.StatusBadRequest, Response{Success: false, Error: "session_id is required"})
+		return
+	}
+
+	rows, err := db.QueryContext(c.Request.Context(), `
+		UPDATE hotel_questions SET asker_notified_at = now()
+		WHERE session_id = $1 AND answered_at IS NOT NULL
+		  AND (asker_notified_at IS NULL OR asker_notified_at < answered_at)
+		RETURNING id
+	`, sessionID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	ids := []int{}
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+			return
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+
+	questions := []Question{}
+	if len(ids) > 0 {
+		if questions, err = loadQuestions(c.Request.Context(), "q.id = ANY($1)", pq.Array(ids)); err != nil {
+			c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+			return
+		}
+	}
+	c.JSON(http.StatusOK, Response{Success: true, Data: questions, Count: len(questions)})
+}
+
+// answerQuestion — HTTP-обработчик ответа администратора на вопрос.
+// Реагирует на POST /api/admin/questions/:id/answers с телом {"text": "..."}.
+func answerQuestion(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, Response{Success: false, Error: "question id must be an integer"})
+		return
+	}
+	var body struct {
+		Text string `json:"text"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, Response{Success: false, Error: err.Error()})
+		return
+	}
+	if msg := validQAText(body.Text); msg != "" {
+		c.JSON(http.StatusBadRequest, Response{Success: false, Error: msg})
+		return
+	}
+
+	tx, err := db.BeginTx(c.Request.Context(), nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	a := Answer{Text: strings.TrimSpace(body.Text)}
+	err = tx.QueryRowContext(c.Request.Context(), `
+		INSERT INTO hotel_answers (question_id, text)
+		SELECT id, $2 FROM hotel_questions WHERE id = $1
+		RETURNING id, created_at
+	`, id, a.Text).Scan(&a.ID, &a.CreatedAt)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, Response{Success: false, Error: "question not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	// answered_at — по последнему ответу: автор получит уведомление и о дополнении.
+	if _, err := tx.ExecContext(c.Request.Context(), "UPDATE hotel_questions SET answered_at = $2 WHERE id = $1", id, a.CreatedAt); err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, Response{Success: true, Data: a, Count: 1})
+}
+
+// hideQuestion — HTTP-обработчик, скрывающий вопрос из публичного списка (спам, оскорбления).
+// Реагирует на DELETE /api/admin/questions/:id
+func hideQuestion(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, Response{Success: false, Error: "question id must be an integer"})
+		return
+	}
+	res, err := db.ExecContext(c.Request.Context(), "UPDATE hotel_questions SET hidden = true WHERE id = $1", id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		c.JSON(http.StatusNotFound, Response{Success: false, Error: "question not found"})
+		return
+	}
+	c.JSON(http.StatusOK, Response{Success: true})
+}
@@ -0,0 +1,406 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Квоты партнёрского API.
+//
+// Каждый партнёр (tenant) работает через один или несколько API-ключей, которые
+// передаются в заголовке X-API-Key. У тенанта есть тарифный план и месячная квота
+// запросов; у отдельного ключа можно задать свою квоту, по умолчанию равную квоте тенанта.
+// Действуют оба лимита сразу: квота тенанта — общая на все его ключи, поэтому новыми
+// ключами её не обойти. Счётчики хранятся помесячно, отдельно по ключам и по тенантам:
+//
+//	tenants(id, name, plan, monthly_quota)
+//	api_keys(key, tenant_id, monthly_quota NULL, revoked)
+//	quota_usage(api_key, tenant_id, period, requests), PRIMARY KEY (api_key, period)
+//	tenant_quota_usage(tenant_id, period, requests), PRIMARY KEY (tenant_id, period)
+//
+// Запросы без ключа (например, от нашего фронтенда) квотами не ограничиваются.
+
+// apiKeyHeader — заголовок, в котором клиент передаёт свой API-ключ.
+const apiKeyHeader = "X-API-Key"
+
+// freePlan — тарифный план, при превышении квоты на котором отвечаем 402 (нужно платить),
+// а не 429 (нужно подождать до следующего месяца).
+const freePlan = "free"
+
+// APIKey — информация о ключе и его тенанте, нужная для проверки квоты.
+type APIKey struct {
+	Key          string
+	TenantID     int
+	Plan         string
+	MonthlyQuota int
+	TenantQuota  int
+}
+
+// QuotaStatus — ответ эндпоинта GET /api/quota. Limit и Used относятся к ключу,
+// Tenant — к тенанту в целом; Remaining — сколько ещё запросов пройдёт с этим ключом
+// с учётом обоих лимитов.
+type QuotaStatus struct {
+	TenantID  int          `json:"tenant_id"`
+	Plan      string       `json:"plan"`
+	Period    string       `json:"period"`
+	Limit     int          `json:"limit"`
+	Used      int          `json:"used"`
+	Remaining int          `json:"remaining"`
+	Tenant    QuotaCounter `json:"tenant"`
+	ResetsAt  time.Time    `json:"resets_at"`
+}
+
+// QuotaCounter — лимит и расход одного счётчика квоты за период.
+type QuotaCounter struct {
+	Limit     int `json:"limit"`
+	Used      int `json:"used"`
+	Remaining int `json:"remaining"`
+}
+
+// newQuotaCounter считает остаток; перерасход (после снижения квоты) даёт 0, а не минус.
+func newQuotaCounter(limit, used int) QuotaCounter {
+	return QuotaCounter{Limit: limit, Used: used, Remaining: max(limit-used, 0)}
+}
+
+// currentPeriod возвращает начало текущего расчётного месяца (UTC) и момент сброса квоты.
+func currentPeriod(now time.Time) (start, next time.Time) {
+	now = now.UTC()
+	start = time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	return start, start.AddDate(0, 1, 0)
+}
+
+// apiKeyQuery — поиск активного ключа вместе с тарифом и квотой тенанта.
+const apiKeyQuery = `
+	SELECT t.id, t.plan, COALESCE(k.monthly_quota, t.monthly_quota), t.monthly_quota
+	FROM api_keys k
+	JOIN tenants t ON t.id = k.tenant_id
+	WHERE k.key = $1 AND NOT k.revoked
+`
+
+// lookupAPIKey ищет активный ключ. Квота ключа, если не задана явно, равна квоте тенанта.
+// Возвращает sql.ErrNoRows, если ключ неизвестен или отозван.
+func lookupAPIKey(ctx context.Context, key string) (APIKey, error) {
+	k := APIKey{Key: key}
+	err := db.QueryRowContext(ctx, apiKeyQuery, key).Scan(&k.TenantID, &k.Plan, &k.MonthlyQuota, &k.TenantQuota)
+	return k, err
+}
+
+// Счётчики квоты: какой из лимитов исчерпан.
+const (
+	quotaKey    = "key"
+	quotaTenant = "tenant"
+)
+
+// chargeQuota списывает один запрос ключа k со счётчиков ключа и тенанта за period.
+// Каждый счётчик увеличивается UPSERT-ом с условием, поэтому параллельные запросы
+// не могут вместе превысить лимит. Оба UPSERT-а идут одной транзакцией: если исчерпан
+// любой лимит, exceeded называет его (quotaKey или quotaTenant), и не меняется ни один
+// счётчик — отклонённый запрос в расход не попадает. Счётчик тенанта всегда
+// блокируется первым, чтобы параллельные запросы разных ключей не взаимоблокировались.
+func chargeQuota(ctx context.Context, k APIKey, period time.Time) (key, tenant QuotaCounter, exceeded string, err error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return key, tenant, "", err
+	}
+	defer tx.Rollback()
+
+	var used int
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO tenant_quota_usage (tenant_id, period, requests)
+		VALUES ($1, $2, 1)
+		ON CONFLICT (tenant_id, period) DO UPDATE
+			SET requests = tenant_quota_usage.requests + 1
+			WHERE tenant_quota_usage.requests < $3
+		RETURNING requests
+	`, k.TenantID, period, k.TenantQuota).Scan(&used)
+	if err == sql.ErrNoRows || (err == nil && used > k.TenantQuota) {
+		// Строка не обновилась — квота исчерпана.
+		return key, newQuotaCounter(k.TenantQuota, k.TenantQuota), quotaTenant, nil
+	}
+	if err != nil {
+		return key, tenant, "", err
+	}
+	tenant = newQuotaCounter(k.TenantQuota, used)
+
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO quota_usage (api_key, tenant_id, period, requests)
+		VALUES ($1, $2, $3, 1)
+		ON CONFLICT (api_key, period) DO UPDATE
+			SET requests = quota_usage.requests + 1
+			WHERE quota_usage.requests < $4
+		RETURNING requests
+	`, k.Key, k.TenantID, period, k.MonthlyQuota).Scan(&used)
+	if err == sql.ErrNoRows || (err == nil && used > k.MonthlyQuota) {
+		return newQuotaCounter(k.MonthlyQuota, k.MonthlyQuota), tenant, quotaKey, nil
+	}
+	if err != nil {
+		return key, tenant, "", err
+	}
+	return newQuotaCounter(k.MonthlyQuota, used), tenant, "", tx.Commit()
+}
+
+// quotaMiddleware проверяет API-ключ и списывает один запрос из месячных квот ключа
+// и тенанта (см. chargeQuota).
+func quotaMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(apiKeyHeader)
+		if key == "" {
+			c.Next()
+			return
+		}
+
+		k, ok := authenticateAPIKey(c, key)
+		if !ok {
+			return
+		}
+
+		period, next := currentPeriod(time.Now())
+		keyCounter, tenantCounter, exceeded, err := chargeQuota(c.Request.Context(), k, period)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, Response{
+				Success: false,
+				Error:   err.Error(),
+			})
+			return
+		}
+		switch exceeded {
+		case quotaTenant:
+			rejectOverQuota(c, k, quotaTenant, k.TenantQuota, next)
+			return
+		case quotaKey:
+			rejectOverQuota(c, k, quotaKey, k.MonthlyQuota, next)
+			return
+		}
+
+		// В заголовках — тот лимит, который закончится раньше.
+		binding := keyCounter
+		if tenantCounter.Remaining < binding.Remaining {
+			binding = tenantCounter
+		}
+		c.Header("X-Quota-Limit", strconv.Itoa(binding.Limit))
+		c.Header("X-Quota-Remaining", strconv.Itoa(binding.Remaining))
+		c.Next()
+	}
+}
+
+// authenticateAPIKey загружает ключ и кладёт его в контекст запроса.
+// При ошибке сам отвечает клиенту и прерывает цепочку обработчиков.
+func authenticateAPIKey(c *gin.Context, key string) (APIKey, bool) {
+	k, err := lookupAPIKey(c.Request.Context(), key)
+	if err == sql.ErrNoRows {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, Response{
+			Success: false,
+			Error:   "invalid or revoked API key",
+		})
+		return k, false
+	}
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, Response{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return k, false
+	}
+	c.Set("api_key", k)
+	return k, true
+}
+
+// rejectOverQuota отвечает клиенту, превысившему месячную квоту limit ключа
+// или тенанта (scope — quotaKey или quotaTenant).
+// Бесплатному плану — 402 с подсказкой перейти на платный тариф,
+// платным — 429 с Retry-After до начала следующего периода.
+func rejectOverQuota(c *gin.Context, k APIKey, scope string, limit int, resetsAt time.Time) {
+	c.Header("X-Quota-Limit", strconv.Itoa(limit))
+	c.Header("X-Quota-Remaining", "0")
+
+	msg := fmt.Sprintf("monthly quota of %d requests exceeded", limit)
+	if scope == quotaTenant {
+		msg = fmt.Sprintf("tenant monthly quota of %d requests exceeded across all API keys", limit)
+	}
+	if k.Plan == freePlan {
+		c.AbortWithStatusJSON(http.StatusPaymentRequired, Response{
+			Success: false,
+			Error:   msg,
+			Hint:    "upgrade to a paid plan to raise the monthly quota",
+		})
+		return
+	}
+
+	c.Header("Retry-After", strconv.Itoa(int(time.Until(resetsAt).Seconds())))
+	c.AbortWithStatusJSON(http.StatusTooManyRequests, Response{
+		Success: false,
+		Error:   msg,
+		Hint:    fmt.Sprintf("quota resets at %s; contact sales to upgrade your plan", resetsAt.Format(time.RFC3339)),
+	})
+}
+
+// getQuota — HTTP-обработчик, возвращающий остаток квоты для переданного ключа.
+// Реагирует на GET /api/quota. Сам запрос квоту не расходует.
+func getQuota(c *gin.Context) {
+	key := c.GetHeader(apiKeyHeader)
+	if key == "" {
+		c.JSON(http.StatusUnauthorized, Response{
+			Success: false,
+			Error:   apiKeyHeader + " header is required",
+		})
+		return
+	}
+
+	k, ok := authenticateAPIKey(c, key)
+	if !ok {
+		return
+	}
+
+	period, next := currentPeriod(time.Now())
+	var used, tenantUsed int
+	err := db.QueryRowContext(c.Request.Context(), `
+		SELECT
+			COALESCE((SELECT requests FROM quota_usage WHERE api_key = $1 AND period = $3), 0),
+			COALESCE((SELECT requests FROM tenant_quota_usage WHERE tenant_id = $2 AND period = $3), 0)
+	`, k.Key, k.TenantID, period).Scan(&used, &tenantUsed)
+	if err != nil {
+		log.Printf("Error reading quota usage: %v", err)
+		c.JSON(http.StatusInternalServerError, Response{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	keyCounter := newQuotaCounter(k.MonthlyQuota, used)
+	tenantCounter := newQuotaCounter(k.TenantQuota, tenantUsed)
+	c.JSON(http.StatusOK, Response{
+		Success: true,
+		Data: QuotaStatus{
+			TenantID:  k.TenantID,
+			Plan:      k.Plan,
+			Period:    period.Format("2006-01"),
+			Limit:     keyCounter.Limit,
+			Used:      keyCounter.Used,
+			Remaining: min(keyCounter.Remaining, tenantCounter.Remaining),
+			Tenant:    tenantCounter,
+			ResetsAt:  next,
+		},
+		Count: 1,
+	})
+}
+
+// apiKeyPrefix — префикс ключей, которые выдаёт сервис: по нему ключ узнаётся в логах и утечках.
+const apiKeyPrefix = "wbk_"
+
+// newAPIKey генерирует новый API-ключ.
+func newAPIKey() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return apiKeyPrefix + hex.EncodeToString(b), nil
+}
+
+// keyRotation — старый ключ и выданная ему замена.
+type keyRotation struct {
+	Old string
+	New string
+}
+
+// rotateAPIKeys заменяет активные ключи тенанта (или только ключ only, если он задан)
+// новыми и отзывает старые. Замена наследует квоту ключа и его расход за текущий
+// период — иначе ротация обнуляла бы счётчик ключа. Всё делается одной транзакцией:
+// тенант не останется ни без старых ключей, ни без новых.
+func rotateAPIKeys(ctx context.Context, tenantID int, only string) ([]keyRotation, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT key FROM api_keys
+		WHERE tenant_id = $1 AND NOT revoked AND ($2 = '' OR key = $2)
+		ORDER BY key
+		FOR UPDATE
+	`, tenantID, only)
+	if err != nil {
+		return nil, err
+	}
+	var rotated []keyRotation
+	for rows.Next() {
+		var r keyRotation
+		if err := rows.Scan(&r.Old); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		rotated = append(rotated, r)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(rotated) == 0 {
+		if only != "" {
+			return nil, fmt.Errorf("tenant %d has no active key %s", tenantID, only)
+		}
+		return nil, fmt.Errorf("tenant %d has no active API keys", tenantID)
+	}
+
+	period, _ := currentPeriod(time.Now())
+	for i := range rotated {
+		if rotated[i].New, err = newAPIKey(); err != nil {
+			return nil, err
+		}
+		old, key := rotated[i].Old, rotated[i].New
+		for _, q := range []struct {
+			sql  string
+			args []interface{}
+		}{
+			{`INSERT INTO api_keys (key, tenant_id, monthly_quota)
+			  SELECT $2, tenant_id, monthly_quota FROM api_keys WHERE key = $1`, []interface{}{old, key}},
+			{`INSERT INTO quota_usage (api_key, tenant_id, period, requests)
+			  SELECT $2, tenant_id, period, requests FROM quota_usage WHERE api_key = $1 AND period = $3`, []interface{}{old, key, period}},
+			{"UPDATE api_keys SET revoked = true WHERE key = $1", []interface{}{old}},
+		} {
+			if _, err := tx.ExecContext(ctx, q.sql, q.args...); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return rotated, tx.Commit()
+}
+
+// runRotateKeys — команда rotate-keys: замена API-ключей тенанта, например после утечки.
+// Новые ключи печатаются в стандартный вывод (по строке «старый новый»), старые сразу
+// перестают действовать.
+func runRotateKeys(args []string) error {
+	fs := flag.NewFlagSet("rotate-keys", flag.ExitOnError)
+	tenantID := fs.Int("tenant", 0, "id of the tenant whose keys to rotate (required)")
+	only := fs.String("key", "", "rotate only this key (default: all active keys of the tenant)")
+	fs.Parse(args)
+	if *tenantID <= 0 {
+		return fmt.Errorf("-tenant is required")
+	}
+
+	if err := newApp(databaseComponents()...).start(context.Background()); err != nil {
+		return err
+	}
+	defer db.Close()
+
+	rotated, err := rotateAPIKeys(context.Background(), *tenantID, *only)
+	if err != nil {
+		return err
+	}
+	for _, r := range rotated {
+		fmt.Printf("%s %s\n", r.Old, r.New)
+	}
+	log.Printf("Rotated %d API keys of tenant %d; the old keys are revoked", len(rotated), *tenantID)
+	return nil
+}
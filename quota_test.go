@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// testQuotaUsed возвращает расход ключа key и его тенанта за текущий период.
+func testQuotaUsed(t *testing.T, key string) (keyUsed, tenantUsed int) {
+	t.Helper()
+	w := serve(newPublicRouter(), "GET", "/api/quota", "", apiKeyHeader, key)
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET /api/quota: status %d: %s", w.Code, w.Body)
+	}
+	var resp struct {
+		Data QuotaStatus `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	return resp.Data.Used, resp.Data.Tenant.Used
+}
+
+// Квота тенанта общая на все его ключи: заведя второй ключ, её не обойти.
+func TestTenantQuotaAcrossKeys(t *testing.T) {
+	testDB(t)
+	tenant := testAPIKey(t, "key-a", "pro", 3)
+	testExec(t, "INSERT INTO api_keys (key, tenant_id) VALUES ('key-b', $1)", tenant)
+	router := newPublicRouter()
+
+	for _, key := range []string{"key-a", "key-a", "key-b"} {
+		if w := serve(router, "GET", "/api/cities", "", apiKeyHeader, key); w.Code != http.StatusOK {
+			t.Fatalf("%s: status %d: %s", key, w.Code, w.Body)
+		}
+	}
+	w := serve(router, "GET", "/api/cities", "", apiKeyHeader, "key-b")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("over the tenant quota: status %d, want 429: %s", w.Code, w.Body)
+	}
+	if w.Header().Get("X-Quota-Limit") != "3" || w.Header().Get("X-Quota-Remaining") != "0" {
+		t.Errorf("quota headers: %v", w.Header())
+	}
+
+	if keyUsed, tenantUsed := testQuotaUsed(t, "key-b"); keyUsed != 1 || tenantUsed != 3 {
+		t.Errorf("key-b used %d, tenant used %d; want 1 and 3", keyUsed, tenantUsed)
+	}
+	w = serve(router, "GET", "/api/quota", "", apiKeyHeader, "key-b")
+	var resp struct {
+		Data QuotaStatus `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Data.Remaining != 0 || resp.Data.Tenant != (QuotaCounter{Limit: 3, Used: 3, Remaining: 0}) {
+		t.Errorf("quota status: %+v", resp.Data)
+	}
+}
+
+// Отказ по квоте ключа не расходует квоту тенанта.
+func TestKeyQuotaRejectionKeepsTenantCounter(t *testing.T) {
+	testDB(t)
+	tenant := testAPIKey(t, "key-a", "free", 100)
+	testExec(t, "INSERT INTO api_keys (key, tenant_id, monthly_quota) VALUES ('key-b', $1, 1)", tenant)
+	router := newPublicRouter()
+
+	if w := serve(router, "GET", "/api/cities", "", apiKeyHeader, "key-b"); w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	for i := 0; i < 3; i++ {
+		if w := serve(router, "GET", "/api/cities", "", apiKeyHeader, "key-b"); w.Code != http.StatusPaymentRequired {
+			t.Fatalf("over the key quota on the free plan: status %d, want 402: %s", w.Code, w.Body)
+		}
+	}
+	if keyUsed, tenantUsed := testQuotaUsed(t, "key-b"); keyUsed != 1 || tenantUsed != 1 {
+		t.Errorf("key-b used %d, tenant used %d; want 1 and 1", keyUsed, tenantUsed)
+	}
+}
+
+// Параллельные запросы с разных ключей вместе не превышают квоту тенанта.
+func TestTenantQuotaConcurrent(t *testing.T) {
+	testDB(t)
+	const quota, keys, perKey = 10, 4, 6
+	tenant := testAPIKey(t, "key-0", "pro", quota)
+	for i := 1; i < keys; i++ {
+		testExec(t, "INSERT INTO api_keys (key, tenant_id) VALUES ($1, $2)", "key-"+strconv.Itoa(i), tenant)
+	}
+	router := newPublicRouter()
+
+	var (
+		wg    sync.WaitGroup
+		mu    sync.Mutex
+		codes = map[int]int{}
+	)
+	for i := 0; i < keys; i++ {
+		for j := 0; j < perKey; j++ {
+			wg.Add(1)
+			go func(key string) {
+				defer wg.Done()
+				code := serve(router, "GET", "/api/cities", "", apiKeyHeader, key).Code
+				mu.Lock()
+				codes[code]++
+				mu.Unlock()
+			}("key-" + strconv.Itoa(i))
+		}
+	}
+	wg.Wait()
+	if codes[http.StatusOK] != quota || codes[http.StatusTooManyRequests] != keys*perKey-quota {
+		t.Errorf("responses: %v, want %d × 200", codes, quota)
+	}
+	if _, tenantUsed := testQuotaUsed(t, "key-0"); tenantUsed != quota {
+		t.Errorf("tenant used %d, want %d", tenantUsed, quota)
+	}
+}
+
+func TestNewAPIKey(t *testing.T) {
+	seen := map[string]bool{}
+	for i := 0; i < 100; i++ {
+		key, err := newAPIKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(key, apiKeyPrefix) || len(key) != len(apiKeyPrefix)+48 || seen[key] {
+			t.Fatalf("key %q", key)
+		}
+		seen[key] = true
+	}
+}
+
+func TestRotateAPIKeys(t *testing.T) {
+	testDB(t)
+	tenant := testAPIKey(t, "key-a", "pro", 100)
+	testExec(t, "INSERT INTO api_keys (key, tenant_id, monthly_quota) VALUES ('key-b', $1, 5)", tenant)
+	testExec(t, "INSERT INTO api_keys (key, tenant_id, revoked) VALUES ('key-old', $1, true)", tenant)
+	other := testAPIKey(t, "key-other", "pro", 100)
+	router := newPublicRouter()
+	for i := 0; i < 2; i++ {
+		serve(router, "GET", "/api/cities", "", apiKeyHeader, "key-b")
+	}
+
+	rotated, err := rotateAPIKeys(context.Background(), tenant, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rotated) != 2 || rotated[0].Old != "key-a" || rotated[1].Old != "key-b" {
+		t.Fatalf("rotated: %+v", rotated)
+	}
+	for _, old := range []string{"key-a", "key-b"} {
+		if w := serve(router, "GET", "/api/cities", "", apiKeyHeader, old); w.Code != http.StatusUnauthorized {
+			t.Errorf("old key %s: status %d, want 401", old, w.Code)
+		}
+	}
+	// Замена key-b сохраняет его квоту и расход за месяц.
+	newB := rotated[1].New
+	if w := serve(router, "GET", "/api/cities", "", apiKeyHeader, newB); w.Code != http.StatusOK {
+		t.Fatalf("new key: status %d: %s", w.Code, w.Body)
+	}
+	w := serve(router, "GET", "/api/quota", "", apiKeyHeader, newB)
+	var resp struct {
+		Data QuotaStatus `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Data.TenantID != tenant || resp.Data.Limit != 5 || resp.Data.Used != 3 {
+		t.Errorf("new key quota: %+v", resp.Data)
+	}
+	if w := serve(router, "GET", "/api/cities", "", apiKeyHeader, "key-other"); w.Code != http.StatusOK {
+		t.Errorf("another tenant's key: status %d", w.Code)
+	}
+
+	if _, err := rotateAPIKeys(context.Background(), other, "key-a"); err == nil {
+		t.Error("rotated a key of another tenant")
+	}
+}
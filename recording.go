@@ -0,0 +1,276 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Запись запросов для разбора жалоб «у меня не работает».
+//
+// По умолчанию ничего не записывается. Администратор включает запись для
+// конкретного API-ключа или конкретного X-Request-ID (например, попросив
+// клиента повторить запрос с заданным идентификатором), и пары
+// запрос/ответ этих клиентов попадают в кольцевой буфер в памяти.
+// Перед сохранением секреты маскируются: заголовки авторизации и ключи
+// не попадают в запись, от API-ключа остаётся только префикс.
+
+// requestIDHeader — заголовок с идентификатором запроса. Если клиент его не прислал,
+// идентификатор генерируется сервером; в обоих случаях он возвращается в ответе.
+const requestIDHeader = "X-Request-ID"
+
+// recordingBufferSize — сколько последних записей хранится в кольцевом буфере.
+const recordingBufferSize = 200
+
+// recordingBodyLimit — сколько байт тела запроса и ответа сохраняется.
+const recordingBodyLimit = 64 << 10
+
+// maskedHeaders — заголовки, значения которых в записи заменяются на "***".
+var maskedHeaders = []string{"Authorization", "Cookie", "Set-Cookie", apiKeyHeader}
+
+// Recording — записанная пара запрос/ответ.
+type Recording struct {
+	RequestID       string      `json:"request_id"`
+	APIKeyPrefix    string      `json:"api_key_prefix,omitempty"`
+	At              time.Time   `json:"at"`
+	DurationMs      int64       `json:"duration_ms"`
+	Method          string      `json:"method"`
+	URL             string      `json:"url"`
+	RequestHeaders  http.Header `json:"request_headers"`
+	RequestBody     string      `json:"request_body,omitempty"`
+	Status          int         `json:"status"`
+	ResponseHeaders http.Header `json:"response_headers"`
+	ResponseBody    string      `json:"response_body,omitempty"`
+}
+
+// RecordingTarget — кого записывать: по API-ключу или по идентификатору запроса, до момента Until.
+type RecordingTarget struct {
+	APIKey    string    `json:"api_key,omitempty"`
+	RequestID string    `json:"request_id,omitempty"`
+	Until     time.Time `json:"until"`
+}
+
+// recorder — цели записи и кольцевой буфер записей.
+type recorder struct {
+	mu      sync.Mutex
+	targets []RecordingTarget
+	buf     []Recording
+	next    int
+}
+
+var recordings = &recorder{}
+
+// matches сообщает, нужно ли записывать запрос с таким ключом и идентификатором.
+func (r *recorder) matches(apiKey, requestID string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	for _, t := range r.targets {
+		if now.After(t.Until) {
+			continue
+		}
+		if (t.APIKey != "" && t.APIKey == apiKey) || (t.RequestID != "" && t.RequestID == requestID) {
+			return true
+		}
+	}
+	return false
+}
+
+// add кладёт запись в буфер, вытесняя самую старую при переполнении.
+func (r *recorder) add(rec Recording) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.buf) < recordingBufferSize {
+		r.buf = append(r.buf, rec)
+		return
+	}
+	r.buf[r.next] = rec
+	r.next = (r.next + 1) % recordingBufferSize
+}
+
+// list возвращает записи от старых к новым, отфильтрованные по префиксу ключа и идентификатору.
+func (r *recorder) list(apiKeyPrefix, requestID string) []Recording {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := []Recording{}
+	for i := 0; i < len(r.buf); i++ {
+		rec := r.buf[(r.next+i)%len(r.buf)]
+		if apiKeyPrefix != "" && rec.APIKeyPrefix != maskAPIKey(apiKeyPrefix) {
+			continue
+		}
+		if requestID != "" && rec.RequestID != requestID {
+			continue
+		}
+		out = append(out, rec)
+	}
+	return out
+}
+
+// maskAPIKey оставляет от ключа первые символы — достаточно, чтобы отличить клиентов.
+func maskAPIKey(key string) string {
+	if len(key) <= 6 {
+		return key
+	}
+	return key[:6] + "…"
+}
+
+// anonymizeHeaders копирует заголовки, маскируя секреты.
+func anonymizeHeaders(h http.Header) http.Header {
+	out := h.Clone()
+	for _, name := range maskedHeaders {
+		if out.Get(name) != "" {
+			out.Set(name, "***")
+		}
+	}
+	return out
+}
+
+// requestIDMiddleware назначает запросу идентификатор и возвращает его клиенту.
+func requestIDMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(requestIDHeader)
+		if id == "" || len(id) > 128 {
+			b := make([]byte, 8)
+			rand.Read(b)
+			id = hex.EncodeToString(b)
+		}
+		c.Set("request_id", id)
+		c.Header(requestIDHeader, id)
+		c.Next()
+	}
+}
+
+// recordingWriter дублирует тело ответа в буфер (не больше recordingBodyLimit байт).
+type recordingWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *recordingWriter) Write(b []byte) (int, error) {
+	if room := recordingBodyLimit - w.body.Len(); room > 0 {
+		if len(b) < room {
+			room = len(b)
+		}
+		w.body.Write(b[:room])
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// recordingMiddleware записывает запросы выбранных клиентов.
+// Должен стоять после requestIDMiddleware.
+func recordingMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		apiKey := c.GetHeader(apiKeyHeader)
+		requestID := c.GetString("request_id")
+		if !recordings.matches(apiKey, requestID) {
+			c.Next()
+			return
+		}
+
+		var reqBody []byte
+		if c.Request.Body != nil {
+			reqBody, _ = io.ReadAll(io.LimitReader(c.Request.Body, recordingBodyLimit))
+			// Возвращаем прочитанное обратно, чтобы обработчик получил тело целиком.
+			c.Request.Body = io.NopCloser(io.MultiReader(bytes.NewReader(reqBody), c.Request.Body))
+		}
+
+		w := &recordingWriter{ResponseWriter: c.Writer}
+		c.Writer = w
+		started := time.Now()
+		c.Next()
+
+		rec := Recording{
+			RequestID:       requestID,
+			At:              started.UTC(),
+			DurationMs:      time.Since(started).Milliseconds(),
+			Method:          c.Request.Method,
+			URL:             c.Request.URL.String(),
+			RequestHeaders:  anonymizeHeaders(c.Request.Header),
+			RequestBody:     string(reqBody),
+			Status:          w.Status(),
+			ResponseHeaders: anonymizeHeaders(w.Header()),
+			ResponseBody:    w.body.String(),
+		}
+		if apiKey != "" {
+			rec.APIKeyPrefix = maskAPIKey(apiKey)
+		}
+		recordings.add(rec)
+	}
+}
+
+// getRecordings — HTTP-обработчик, отдающий записанные запросы.
+// Реагирует на GET /api/admin/recordings?api_key=&request_id=
+func getRecordings(c *gin.Context) {
+	recs := recordings.list(c.Query("api_key"), c.Query("request_id"))
+	c.JSON(http.StatusOK, Response{
+		Success: true,
+		Data:    recs,
+		Count:   len(recs),
+	})
+}
+
+// addRecordingTarget — HTTP-обработчик, включающий запись для клиента.
+// Реагирует на POST /api/admin/recordings/targets с телом
+// {"api_key": "...", "request_id": "...", "ttl": "1h"} (нужно одно из api_key/request_id; ttl по умолчанию 1h).
+func addRecordingTarget(c *gin.Context) {
+	var body struct {
+		APIKey    string `json:"api_key"`
+		RequestID string `json:"request_id"`
+		TTL       string `json:"ttl"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, Response{Success: false, Error: err.Error()})
+		return
+	}
+	if (body.APIKey == "") == (body.RequestID == "") {
+		c.JSON(http.StatusBadRequest, Response{Success: false, Error: "exactly one of api_key or request_id is required"})
+		return
+	}
+	ttl := time.Hour
+	if body.TTL != "" {
+		d, err := time.ParseDuration(body.TTL)
+		if err != nil || d <= 0 {
+			c.JSON(http.StatusBadRequest, Response{Success: false, Error: "ttl must be a positive duration, e.g. 30m"})
+			return
+		}
+		ttl = d
+	}
+
+	target := RecordingTarget{APIKey: body.APIKey, RequestID: body.RequestID, Until: time.Now().Add(ttl).UTC()}
+	recordings.mu.Lock()
+	// Заодно выбрасываем истёкшие цели, чтобы список не рос бесконечно.
+	active := recordings.targets[:0]
+	for _, t := range recordings.targets {
+		if time.Now().Before(t.Until) {
+			active = append(active, t)
+		}
+	}
+	recordings.targets = append(active, target)
+	recordings.mu.Unlock()
+
+	c.JSON(http.StatusCreated, Response{
+		Success: true,
+		Data:    target,
+		Count:   1,
+	})
+}
+
+// clearRecordingTargets — HTTP-обработчик, выключающий запись для всех клиентов.
+// Реагирует на DELETE /api/admin/recordings/targets. Уже сделанные записи сохраняются.
+func clearRecordingTargets(c *gin.Context) {
+	recordings.mu.Lock()
+	n := len(recordings.targets)
+	recordings.targets = nil
+	recordings.mu.Unlock()
+
+	c.JSON(http.StatusOK, Response{
+		Success: true,
+		Count:   n,
+	})
+}
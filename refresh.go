@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Токены обновления.
+//
+// Вместе с коротким токеном доступа (см. auth.go) пользователь получает токен
+// обновления на REFRESH_TOKEN_TTL. По нему POST /api/auth/refresh выдаёт новую пару,
+// а сам он при этом отзывается: каждый токен обновления одноразовый. Если кто-то
+// предъявит уже использованный токен, значит, его украли и им воспользовались
+// дважды — тогда отзываются все токены обновления пользователя, и войти заново
+// придётся и владельцу, и похитителю. POST /api/auth/logout отзывает токен явно.
+//
+// В БД хранится только SHA-256 токена, так что по копии таблицы токены не восстановить:
+//
+//	refresh_tokens(token_hash, user_id, expires_at, revoked_at NULL, created_at)
+
+// refreshTokenPrefix — префикс токенов обновления, чтобы их нельзя было спутать с другими токенами.
+const refreshTokenPrefix = "rt_"
+
+// hashRefreshToken — то, что хранится в БД вместо токена.
+func hashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// issueTokens выдаёт пользователю токен доступа и записывает новый токен обновления.
+func issueTokens(ctx context.Context, q interface {
+	ExecContext(context.Context, string, ...interface{}) (sql.Result, error)
+}, u User) (AuthToken, error) {
+	now := time.Now()
+	t := AuthToken{User: u, RefreshExpiresAt: now.Add(settings().RefreshTokenTTL)}
+	var err error
+	if t.Token, t.ExpiresAt, err = signJWT(u.ID, now); err != nil {
+		return AuthToken{}, err
+	}
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return AuthToken{}, err
+	}
+	t.RefreshToken = refreshTokenPrefix + hex.EncodeToString(raw)
+	// Заодно убираем истёкшие токены пользователя; отозванные, но не истёкшие, остаются —
+	// по ним распознаётся повторное предъявление.
+	if _, err := q.ExecContext(ctx, "DELETE FROM refresh_tokens WHERE user_id = $1 AND expires_at < now()", u.ID); err != nil {
+		return AuthToken{}, err
+	}
+	_, err = q.ExecContext(ctx, `
+		INSERT INTO refresh_tokens (token_hash, user_id, expires_at)
+		VALUES ($1, $2, $3)
+	`, hashRefreshToken(t.RefreshToken), u.ID, t.RefreshExpiresAt)
+	if err != nil {
+		return AuthToken{}, err
+	}
+	return t, nil
+}
+
+// refreshTokenRequest — тело POST /api/auth/refresh и /logout; All учитывает только logout.
+type refreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token"`
+	All          bool   `json:"all"`
+}
+
+// bindRefreshToken читает тело запроса и отвечает 400, если токена в нём нет.
+func bindRefreshToken(c *gin.Context) (refreshTokenRequest, bool) {
+	var body refreshTokenRequest
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, Response{Success: false, Error: err.Error()})
+		return body, false
+	}
+	body.RefreshToken = strings.TrimSpace(body.RefreshToken)
+	if body.RefreshToken == "" {
+		c.JSON(http.StatusBadRequest, Response{Success: false, Error: "refresh_token is required"})
+		return body, false
+	}
+	return body, true
+}
+
+// refreshTokens — HTTP-обработчик обновления токенов.
+// Реагирует на POST /api/auth/refresh с телом {"refresh_token": "rt_…"}: выдаёт новую пару токенов
+// и отзывает предъявленный токен обновления.
+func refreshTokens(c *gin.Context) {
+	body, ok := bindRefreshToken(c)
+	if !ok {
+		return
+	}
+	unauthorized := Response{Success: false, Code: errCodeInvalidCredentials, Error: "invalid or expired refresh token",
+		Hint: "log in again with POST /api/auth/login"}
+
+	tx, err := db.BeginTx(c.Request.Context(), nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	// Блокировка строки не даёт двум параллельным запросам обменять один токен дважды.
+	var u User
+	var expiresAt time.Time
+	var revokedAt *time.Time
+	err = tx.QueryRowContext(c.Request.Context(), `
+		SELECT u.id, u.email, u.name, u.role, u.created_at, t.expires_at, t.revoked_at
+		FROM refresh_tokens t
+		JOIN users u ON u.id = t.user_id
+		WHERE t.token_hash = $1
+		FOR UPDATE OF t
+	`, hashRefreshToken(body.RefreshToken)).Scan(&u.ID, &u.Email, &u.Name, &u.Role, &u.CreatedAt, &expiresAt, &revokedAt)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusUnauthorized, unauthorized)
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	if revokedAt != nil {
+		// Повторное предъявление отозванного токена — признак кражи.
+		if _, err := tx.ExecContext(c.Request.Context(), "UPDATE refresh_tokens SET revoked_at = now() WHERE user_id = $1 AND revoked_at IS NULL", u.ID); err != nil {
+			c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+			return
+		}
+		if err := tx.Commit(); err != nil {
+			c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+			return
+		}
+		log.Printf("Revoked refresh token reused for user %d, all refresh tokens of the user revoked", u.ID)
+		c.JSON(http.StatusUnauthorized, unauthorized)
+		return
+	}
+	if !time.Now().Before(expiresAt) {
+		c.JSON(http.StatusUnauthorized, unauthorized)
+		return
+	}
+
+	if _, err := tx.ExecContext(c.Request.Context(), "UPDATE refresh_tokens SET revoked_at = now() WHERE token_hash = $1", hashRefreshToken(body.RefreshToken)); err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	t, err := issueTokens(c.Request.Context(), tx, u)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, Response{Success: true, Data: t, Count: 1})
+}
+
+// logout — HTTP-обработчик выхода.
+// Реагирует на POST /api/auth/logout с телом {"refresh_token": "rt_…", "all": false}:
+// отзывает токен обновления, а с "all": true — все токены обновления его владельца
+// (выход на всех устройствах). Неизвестный или уже отозванный токен — не ошибка.
+func logout(c *gin.Context) {
+	body, ok := bindRefreshToken(c)
+	if !ok {
+		return
+	}
+	query := "UPDATE refresh_tokens SET revoked_at = now() WHERE token_hash = $1 AND revoked_at IS NULL"
+	if body.All {
+		query = `UPDATE refresh_tokens SET revoked_at = now()
+			WHERE user_id = (SELECT user_id FROM refresh_tokens WHERE token_hash = $1) AND revoked_at IS NULL`
+	}
+	res, err := db.ExecContext(c.Request.Context(), query, hashRefreshToken(body.RefreshToken))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	n, _ := res.RowsAffected()
+	c.JSON(http.StatusOK, Response{Success: true, Data: gin.H{"revoked": n}, Count: 1})
+}
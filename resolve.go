@@ -0,0 +1,278 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Разрешение ссылок в канонические сущности.
+//
+// SPA-роутер и мобильные deep link получают самые разные адреса: короткие
+// маркетинговые ссылки (/s/spb-summer), старые адреса по id (/hotel.php?id=5,
+// /hotels/5), адреса по slug, в том числе устаревшим. GET /api/resolve?url=...
+// сводит их к одному ответу: тип сущности, id, актуальный slug и канонический адрес.
+// Хост в url не важен: смотрим только путь и query-параметры.
+//
+// Короткие ссылки заводит администратор:
+//
+//	short_links(code, entity, entity_id, created_at), PRIMARY KEY (code)
+
+// errNotResolved — ссылка не соответствует ни одной известной сущности.
+var errNotResolved = errors.New("url does not point to a known city or hotel")
+
+// shortLinkCodeRe — допустимые коды коротких ссылок (тот же вид, что у slug).
+var shortLinkCodeRe = slugRe
+
+// ResolvedEntity — результат разрешения ссылки.
+type ResolvedEntity struct {
+	Type string  `json:"type"`
+	ID   int     `json:"id"`
+	Slug *string `json:"slug"`
+	// CanonicalURL — адрес сущности во фронтенде; по нему стоит сделать редирект,
+	// если он отличается от исходного.
+	CanonicalURL string `json:"canonical_url"`
+}
+
+// ShortLink — короткая маркетинговая ссылка.
+type ShortLink struct {
+	Code string `json:"code"`
+	Type string `json:"type"`
+	ID   int    `json:"id"`
+}
+
+// entityPaths — сегменты пути, обозначающие сущность (в том числе устаревшие варианты).
+var entityPaths = map[string]string{
+	"hotels": "hotel", "hotel": "hotel", "hotel.php": "hotel",
+	"cities": "city", "city": "city", "city.php": "city",
+}
+
+// resolveURL разбирает ссылку и находит сущность, на которую она указывает.
+func resolveURL(ctx context.Context, raw string) (*ResolvedEntity, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, err
+	}
+	segments := strings.FieldsFunc(u.Path, func(r rune) bool { return r == '/' })
+	// Адреса API ведут себя так же, как адреса фронтенда.
+	if len(segments) > 0 && segments[0] == "api" {
+		segments = segments[1:]
+	}
+	if len(segments) > 2 && segments[1] == "by-slug" {
+		segments = append(segments[:1], segments[2:]...)
+	}
+
+	switch {
+	case len(segments) == 2 && (segments[0] == "s" || segments[0] == "go"):
+		return resolveShortLink(ctx, segments[1])
+	case len(segments) == 2 && entityPaths[segments[0]] != "":
+		entity := entityPaths[segments[0]]
+		if id, err := strconv.Atoi(segments[1]); err == nil {
+			return resolveByID(ctx, entity, id)
+		}
+		return resolveBySlug(ctx, entity, segments[1])
+	case len(segments) == 1 && entityPaths[segments[0]] != "":
+		// Старые адреса вида /hotel.php?id=5.
+		if id, err := strconv.Atoi(u.Query().Get("id")); err == nil {
+			return resolveByID(ctx, entityPaths[segments[0]], id)
+		}
+	}
+	// Совсем старые ссылки с параметрами на любой странице: /?hotel_id=5.
+	for param, entity := range map[string]string{"hotel_id": "hotel", "city_id": "city"} {
+		if id, err := strconv.Atoi(u.Query().Get(param)); err == nil {
+			return resolveByID(ctx, entity, id)
+		}
+	}
+	return nil, errNotResolved
+}
+
+// canonical дополняет найденную сущность каноническим адресом.
+// Пока slug не присвоен, канонический адрес строится по id.
+func canonical(entity string, id int, slug *string) *ResolvedEntity {
+	key := strconv.Itoa(id)
+	if slug != nil {
+		key = *slug
+	}
+	return &ResolvedEntity{Type: entity, ID: id, Slug: slug, CanonicalURL: "/" + slugEntities[entity] + "/" + key}
+}
+
+// resolveByID находит сущность по id. Для городов учитываются id слитых дублей,
+// гостиницы находятся только опубликованные.
+func resolveByID(ctx context.Context, entity string, id int) (*ResolvedEntity, error) {
+	var query string
+	switch entity {
+	case "city":
+		query = `
+			SELECT c.id, c.slug FROM cities c WHERE c.id = $1
+			UNION ALL
+			SELECT c.id, c.slug FROM city_aliases a JOIN cities c ON c.id = a.city_id WHERE a.old_id = $1
+			LIMIT 1
+		`
+	case "hotel":
+		query = "SELECT h.id, h.slug FROM hotels h WHERE h.id = $1 AND " + publishedHotel
+	}
+	var slug *string
+	err := db.QueryRowContext(ctx, query, id).Scan(&id, &slug)
+	if err == sql.ErrNoRows {
+		return nil, errNotResolved
+	}
+	if err != nil {
+		return nil, err
+	}
+	return canonical(entity, id, slug), nil
+}
+
+// resolveBySlug находит сущность по текущему или устаревшему slug.
+func resolveBySlug(ctx context.Context, entity, slug string) (*ResolvedEntity, error) {
+	table := slugEntities[entity]
+	visible := "true"
+	if entity == "hotel" {
+		visible = publishedHotel
+	}
+	var id int
+	var current *string
+	err := db.QueryRowContext(ctx, `
+		SELECT h.id, h.slug FROM `+table+` h WHERE h.slug = $2 AND `+visible+`
+		UNION ALL
+		SELECT h.id, h.slug FROM slug_history s JOIN `+table+` h ON h.id = s.entity_id
+		WHERE s.entity = $1 AND s.slug = $2 AND `+visible+`
+		LIMIT 1
+	`, entity, slug).Scan(&id, &current)
+	if err == sql.ErrNoRows {
+		return nil, errNotResolved
+	}
+	if err != nil {
+		return nil, err
+	}
+	return canonical(entity, id, current), nil
+}
+
+// resolveShortLink находит сущность по коду короткой ссылки.
+func resolveShortLink(ctx context.Context, code string) (*ResolvedEntity, error) {
+	var entity string
+	var id int
+	err := db.QueryRowContext(ctx, "SELECT entity, entity_id FROM short_links WHERE code = $1", code).Scan(&entity, &id)
+	if err == sql.ErrNoRows {
+		return nil, errNotResolved
+	}
+	if err != nil {
+		return nil, err
+	}
+	return resolveByID(ctx, entity, id)
+}
+
+// resolveHandler — HTTP-обработчик разрешения ссылок.
+// Реагирует на GET /api/resolve?url=https://example.com/s/spb-summer
+func resolveHandler(c *gin.Context) {
+	raw := c.Query("url")
+	if raw == "" {
+		c.JSON(http.StatusBadRequest, Response{Success: false, Error: "url parameter is required"})
+		return
+	}
+	entity, err := resolveURL(c.Request.Context(), raw)
+	if err == errNotResolved {
+		c.JSON(http.StatusNotFound, Response{Success: false, Error: err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, Response{
+		Success: true,
+		Data:    entity,
+		Count:   1,
+	})
+}
+
+// getShortLinks — HTTP-обработчик списка коротких ссылок.
+// Реагирует на GET /api/admin/short-links
+func getShortLinks(c *gin.Context) {
+	rows, err := db.QueryContext(c.Request.Context(), "SELECT code, entity, entity_id FROM short_links ORDER BY code")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	links := []ShortLink{}
+	for rows.Next() {
+		var l ShortLink
+		if err := rows.Scan(&l.Code, &l.Type, &l.ID); err != nil {
+			if err := scanFailed(strictScan(c), "short link", err); err != nil {
+				c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+				return
+			}
+			continue
+		}
+		links = append(links, l)
+	}
+	if err := rows.Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, Response{
+		Success: true,
+		Data:    links,
+		Count:   len(links),
+	})
+}
+
+// createShortLink — HTTP-обработчик создания или замены короткой ссылки.
+// Реагирует на POST /api/admin/short-links с телом {"code": "spb-summer", "type": "city", "id": 3}.
+func createShortLink(c *gin.Context) {
+	var l ShortLink
+	if err := c.ShouldBindJSON(&l); err != nil {
+		c.JSON(http.StatusBadRequest, Response{Success: false, Error: err.Error()})
+		return
+	}
+	if !shortLinkCodeRe.MatchString(l.Code) {
+		c.JSON(http.StatusBadRequest, Response{Success: false, Error: "code must consist of lowercase latin letters, digits and single dashes"})
+		return
+	}
+	table, ok := slugEntities[l.Type]
+	if !ok {
+		c.JSON(http.StatusBadRequest, Response{Success: false, Error: "type must be 'city' or 'hotel'"})
+		return
+	}
+
+	res, err := db.ExecContext(c.Request.Context(), `
+		INSERT INTO short_links (code, entity, entity_id)
+		SELECT $1, $2, id FROM `+table+` WHERE id = $3
+		ON CONFLICT (code) DO UPDATE SET entity = EXCLUDED.entity, entity_id = EXCLUDED.entity_id, created_at = now()
+	`, l.Code, l.Type, l.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		c.JSON(http.StatusNotFound, Response{Success: false, Error: l.Type + " not found"})
+		return
+	}
+	c.JSON(http.StatusCreated, Response{
+		Success: true,
+		Data:    l,
+		Count:   1,
+	})
+}
+
+// deleteShortLink — HTTP-обработчик удаления короткой ссылки.
+// Реагирует на DELETE /api/admin/short-links/:code
+func deleteShortLink(c *gin.Context) {
+	res, err := db.ExecContext(c.Request.Context(), "DELETE FROM short_links WHERE code = $1", c.Param("code"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		c.JSON(http.StatusNotFound, Response{Success: false, Error: "short link not found"})
+		return
+	}
+	c.JSON(http.StatusOK, Response{Success: true})
+}
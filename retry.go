@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Повторы исходящих запросов к внешним провайдерам.
+//
+// Все обращения к провайдерам идут через doProvider (см. deadline.go), и повторы
+// устроены одинаково для всех:
+//   - повторяются сетевые ошибки и ответы 429, 500, 502, 503, 504;
+//   - пауза растёт экспоненциально от base до max со случайным разбросом (full jitter),
+//     чтобы клиенты, упавшие одновременно, не возвращались одновременно; Retry-After
+//     провайдера соблюдается, если он не больше max;
+//   - повторяются только идемпотентные запросы: GET, HEAD, OPTIONS, PUT, DELETE,
+//     запросы с заголовком Idempotency-Key и помеченные markIdempotent;
+//   - повтор не начинается, если после паузы до срока запроса останется меньше floor;
+//   - у каждого провайдера есть бюджет повторов: каждый вызов пополняет его на
+//     retryBudgetRatio, каждый повтор тратит единицу. Когда провайдер лежит, повторы
+//     быстро заканчиваются и не умножают нагрузку на него.
+//
+// Повторы и отказы из-за бюджета видны в expvar providers: <провайдер>.retries и
+// <провайдер>.retry_budget_exhausted.
+
+// retryPolicy — политика повторов провайдера; attempts — всего попыток, включая первую.
+type retryPolicy struct {
+	attempts int
+	base     time.Duration
+	max      time.Duration
+}
+
+// Параметры бюджета повторов: сколько единиц даёт один вызов и сколько их копится максимум.
+const (
+	retryBudgetRatio = 0.1
+	retryBudgetMax   = 10
+)
+
+// retryBudget — бюджет повторов одного провайдера.
+type retryBudget struct {
+	tokens float64
+}
+
+var retryBudgets = struct {
+	sync.Mutex
+	byProvider map[string]*retryBudget
+}{byProvider: map[string]*retryBudget{}}
+
+// depositRetryBudget пополняет бюджет провайдера за очередной вызов.
+func depositRetryBudget(provider string) {
+	retryBudgets.Lock()
+	defer retryBudgets.Unlock()
+	b, ok := retryBudgets.byProvider[provider]
+	if !ok {
+		// Новый провайдер начинает с полным бюджетом, чтобы первый же сбой после запуска можно было повторить.
+		b = &retryBudget{tokens: retryBudgetMax}
+		retryBudgets.byProvider[provider] = b
+	}
+	if b.tokens += retryBudgetRatio; b.tokens > retryBudgetMax {
+		b.tokens = retryBudgetMax
+	}
+}
+
+// spendRetryBudget списывает один повтор; false — бюджет исчерпан.
+func spendRetryBudget(provider string) bool {
+	retryBudgets.Lock()
+	defer retryBudgets.Unlock()
+	b, ok := retryBudgets.byProvider[provider]
+	if !ok || b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// delay возвращает паузу перед повтором номер attempt (с 1).
+func (p retryPolicy) delay(attempt int) time.Duration {
+	d := p.base << (attempt - 1)
+	if d <= 0 || d > p.max {
+		d = p.max
+	}
+	return time.Duration(rand.Int63n(int64(d) + 1))
+}
+
+type idempotentKey struct{}
+
+// markIdempotent помечает запрос как безопасный для повтора, хотя его метод этого не гарантирует
+// (например, чтение через POST).
+func markIdempotent(req *http.Request) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), idempotentKey{}, true))
+}
+
+// idempotent сообщает, можно ли отправить запрос повторно без побочных эффектов.
+func idempotent(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	if req.Header.Get("Idempotency-Key") != "" {
+		return true
+	}
+	marked, _ := req.Context().Value(idempotentKey{}).(bool)
+	return marked
+}
+
+// shouldRetry сообщает, стоит ли повторять запрос после такого результата. Ошибки контекста
+// не повторяются: вызывающий отменил запрос или исчерпал свой срок.
+func shouldRetry(ctx context.Context, resp *http.Response, err error) bool {
+	if err != nil {
+		return ctx.Err() == nil && !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+	}
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// retryAfter возвращает паузу из заголовка Retry-After (в секундах); 0 — заголовка нет.
+func retryAfter(resp *http.Response) time.Duration {
+	if resp == nil {
+		return 0
+	}
+	secs, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+	if err != nil || secs < 0 {
+		return 0
+	}
+	return time.Duration(secs) * time.Second
+}
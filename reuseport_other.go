@@ -0,0 +1,13 @@
+//go:build !linux
+
+package main
+
+import (
+	"errors"
+	"syscall"
+)
+
+// setReusePort — SO_REUSEPORT поддерживается только на Linux.
+func setReusePort(network, address string, conn syscall.RawConn) error {
+	return errors.New("SO_REUSEPORT is only supported on Linux")
+}
@@ -0,0 +1,365 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+)
+
+// История правок текстовых полей гостиницы (название, описание).
+//
+// Каждое изменение поля записывается ревизией с новым значением:
+//
+//	hotel_revisions(id, hotel_id, field, value NULL, request_id, created_at)
+//
+// Перед первой правкой поля сохраняется и исходное значение (ревизия-основа), иначе
+// первую же правку было бы нечем откатить. Дифф ревизии строится относительно
+// предыдущей ревизии того же поля. Откат записывает значение старой ревизии как новую
+// правку — история только дописывается, так что откат тоже можно откатить.
+// Все изменения текстовых полей гостиницы должны идти через setHotelText.
+
+// hotelTextFields — редактируемые текстовые поля гостиницы и их ограничения длины.
+var hotelTextFields = map[string]int{
+	"name":        200,
+	"description": 20000,
+}
+
+// HotelRevision — ревизия текстового поля гостиницы.
+type HotelRevision struct {
+	ID        int       `json:"id"`
+	HotelID   int       `json:"hotel_id"`
+	Field     string    `json:"field"`
+	Value     *string   `json:"value"`
+	RequestID string    `json:"request_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// validHotelText проверяет новое значение поля. Возвращает текст ошибки или пустую строку.
+func validHotelText(field string, value *string) string {
+	limit, ok := hotelTextFields[field]
+	if !ok {
+		return fmt.Sprintf("unknown field %q", field)
+	}
+	if value == nil {
+		if field == "name" {
+			return "name cannot be empty"
+		}
+		return ""
+	}
+	if n := utf8.RuneCountInString(*value); n > limit {
+		return fmt.Sprintf("%s must be at most %d characters", field, limit)
+	}
+	if field == "name" && strings.TrimSpace(*value) == "" {
+		return "name cannot be empty"
+	}
+	return ""
+}
+
+// setHotelText меняет текстовое поле гостиницы в транзакции tx и пишет ревизию.
+// Пустое значение описания хранится как NULL. Возвращает false, если значение не изменилось.
+// Вызывающий отвечает за sql.ErrNoRows (гостиницы нет) и за сброс кэша.
+func setHotelText(c *gin.Context, tx *sql.Tx, hotelID int, field string, value *string) (bool, error) {
+	if _, ok := hotelTextFields[field]; !ok {
+		// field подставляется в SQL как имя колонки.
+		return false, fmt.Errorf("unknown field %q", field)
+	}
+	if value != nil && *value == "" {
+		value = nil
+	}
+
+	var old *string
+	if err := tx.QueryRowContext(c.Request.Context(), "SELECT "+field+" FROM hotels WHERE id = $1 FOR UPDATE", hotelID).Scan(&old); err != nil {
+		return false, err
+	}
+	if (old == nil && value == nil) || (old != nil && value != nil && *old == *value) {
+		return false, nil
+	}
+
+	requestID := c.GetString("request_id")
+	var revisions int
+	if err := tx.QueryRowContext(c.Request.Context(),
+		"SELECT count(*) FROM hotel_revisions WHERE hotel_id = $1 AND field = $2", hotelID, field,
+	).Scan(&revisions); err != nil {
+		return false, err
+	}
+	if revisions == 0 {
+		// Ревизия-основа: значение, которое было до появления истории.
+		if err := insertHotelRevision(c.Request.Context(), tx, hotelID, field, old, ""); err != nil {
+			return false, err
+		}
+	}
+	if _, err := tx.ExecContext(c.Request.Context(), "UPDATE hotels SET "+field+" = $2 WHERE id = $1", hotelID, value); err != nil {
+		return false, err
+	}
+	return true, insertHotelRevision(c.Request.Context(), tx, hotelID, field, value, requestID)
+}
+
+func insertHotelRevision(ctx context.Context, tx *sql.Tx, hotelID int, field string, value *string, requestID string) error {
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO hotel_revisions (hotel_id, field, value, request_id)
+		VALUES ($1, $2, $3, $4)
+	`, hotelID, field, value, requestID)
+	return err
+}
+
+// updateHotelContent — HTTP-обработчик правки текстовых полей гостиницы.
+// Реагирует на PUT /api/admin/hotels/:id/content с телом {"name": "...", "description": "..."}
+// (переданные поля меняются, отсутствующие остаются как есть; "description": "" — очистить).
+func updateHotelContent(c *gin.Context) {
+	id, ok := hotelIDParam(c)
+	if !ok {
+		return
+	}
+	var body map[string]*string
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, Response{Success: false, Error: err.Error()})
+		return
+	}
+	if len(body) == 0 {
+		c.JSON(http.StatusBadRequest, Response{Success: false, Error: "nothing to update"})
+		return
+	}
+	for field, value := range body {
+		if msg := validHotelText(field, value); msg != "" {
+			c.JSON(http.StatusBadRequest, Response{Success: false, Error: msg})
+			return
+		}
+	}
+
+	tx, err := db.BeginTx(c.Request.Context(), nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	changed := []string{}
+	// Порядок полей фиксирован, чтобы ревизии одного запроса шли предсказуемо.
+	for _, field := range []string{"name", "description"} {
+		value, ok := body[field]
+		if !ok {
+			continue
+		}
+		updated, err := setHotelText(c, tx, id, field, value)
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, Response{Success: false, Error: "hotel not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+			return
+		}
+		if updated {
+			changed = append(changed, field)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	if len(changed) > 0 {
+		// Название видно в публичном списке.
+		cache.flush("hotels")
+	}
+	c.JSON(http.StatusOK, Response{
+		Success: true,
+		Data:    gin.H{"id": id, "changed": changed},
+		Count:   len(changed),
+	})
+}
+
+// getHotelRevisions — HTTP-обработчик истории правок гостиницы, от новых к старым.
+// Реагирует на GET /api/admin/hotels/:id/revisions?field=description (без field — все поля).
+func getHotelRevisions(c *gin.Context) {
+	id, ok := hotelIDParam(c)
+	if !ok {
+		return
+	}
+	field := c.Query("field")
+	if _, known := hotelTextFields[field]; field != "" && !known {
+		c.JSON(http.StatusBadRequest, Response{Success: false, Error: fmt.Sprintf("unknown field %q", field)})
+		return
+	}
+
+	rows, err := db.QueryContext(c.Request.Context(), `
+		SELECT id, hotel_id, field, value, request_id, created_at
+		FROM hotel_revisions
+		WHERE hotel_id = $1 AND ($2 = '' OR field = $2)
+		ORDER BY id DESC
+	`, id, field)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	revisions := []HotelRevision{}
+	for rows.Next() {
+		var r HotelRevision
+		if err := rows.Scan(&r.ID, &r.HotelID, &r.Field, &r.Value, &r.RequestID, &r.CreatedAt); err != nil {
+			c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+			return
+		}
+		revisions = append(revisions, r)
+	}
+	if err := rows.Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	respondList(c, revisions, len(revisions), false)
+}
+
+// loadHotelRevision читает ревизию :rev гостиницы :id. При ошибке сам отвечает клиенту.
+func loadHotelRevision(c *gin.Context, q interface {
+	QueryRowContext(context.Context, string, ...interface{}) *sql.Row
+}) (HotelRevision, bool) {
+	var r HotelRevision
+	id, ok := hotelIDParam(c)
+	if !ok {
+		return r, false
+	}
+	rev, err := strconv.Atoi(c.Param("rev"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, Response{Success: false, Error: "revision id must be an integer"})
+		return r, false
+	}
+	err = q.QueryRowContext(c.Request.Context(), `
+		SELECT id, hotel_id, field, value, request_id, created_at
+		FROM hotel_revisions WHERE id = $1 AND hotel_id = $2
+	`, rev, id).Scan(&r.ID, &r.HotelID, &r.Field, &r.Value, &r.RequestID, &r.CreatedAt)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, Response{Success: false, Error: "revision not found"})
+		return r, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return r, false
+	}
+	return r, true
+}
+
+// getHotelRevisionDiff — HTTP-обработчик построчного диффа ревизии относительно предыдущей.
+// Реагирует на GET /api/admin/hotels/:id/revisions/:rev/diff
+func getHotelRevisionDiff(c *gin.Context) {
+	r, ok := loadHotelRevision(c, db)
+	if !ok {
+		return
+	}
+	var previous HotelRevision
+	err := db.QueryRowContext(c.Request.Context(), `
+		SELECT id, value FROM hotel_revisions
+		WHERE hotel_id = $1 AND field = $2 AND id < $3
+		ORDER BY id DESC LIMIT 1
+	`, r.HotelID, r.Field, r.ID).Scan(&previous.ID, &previous.Value)
+	if err != nil && err != sql.ErrNoRows {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+
+	var from, to string
+	if previous.Value != nil {
+		from = *previous.Value
+	}
+	if r.Value != nil {
+		to = *r.Value
+	}
+	data := gin.H{"revision": r, "diff": lineDiff(from, to)}
+	if previous.ID != 0 {
+		data["previous_id"] = previous.ID
+	}
+	c.JSON(http.StatusOK, Response{Success: true, Data: data, Count: 1})
+}
+
+// rollbackHotelRevision — HTTP-обработчик отката поля к значению ревизии.
+// Реагирует на POST /api/admin/hotels/:id/revisions/:rev/rollback; откат записывается новой ревизией.
+func rollbackHotelRevision(c *gin.Context) {
+	tx, err := db.BeginTx(c.Request.Context(), nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	r, ok := loadHotelRevision(c, tx)
+	if !ok {
+		return
+	}
+	changed, err := setHotelText(c, tx, r.HotelID, r.Field, r.Value)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	if changed {
+		cache.flush("hotels")
+	}
+	c.JSON(http.StatusOK, Response{
+		Success: true,
+		Data:    gin.H{"id": r.HotelID, "field": r.Field, "value": r.Value, "restored_from": r.ID, "changed": changed},
+		Count:   1,
+	})
+}
+
+// lineDiff строит построчный дифф from → to: строки с префиксами " " (без изменений),
+// "-" (удалена) и "+" (добавлена). Наибольшая общая подпоследовательность — O(n·m),
+// чего для описаний в пределах hotelTextFields достаточно.
+func lineDiff(from, to string) []string {
+	a, b := splitLines(from), splitLines(to)
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	diff := []string{}
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			diff = append(diff, " "+a[i])
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			diff = append(diff, "-"+a[i])
+			i++
+		default:
+			diff = append(diff, "+"+b[j])
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		diff = append(diff, "-"+a[i])
+	}
+	for ; j < len(b); j++ {
+		diff = append(diff, "+"+b[j])
+	}
+	return diff
+}
+
+// splitLines делит текст на строки; пустой текст — ни одной строки.
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
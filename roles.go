@@ -0,0 +1,214 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Роли пользователей.
+//
+// У каждого пользователя (см. auth.go) есть роль: user, manager или admin; роли
+// упорядочены, и старшая включает права младших. При регистрации выдаётся user,
+// повысить роль может только администратор сервиса через PUT /api/admin/users/:id/role.
+// Первого администратора заводит команда create-admin (см. runCreateAdmin).
+//
+// requireRole закрывает маршруты, которым нужна роль не ниже заданной: изменение
+// гостиниц в публичном API доступно только admin, чтение остаётся открытым.
+// Партнёр с API-ключом (см. quota.go) работает без учётной записи и действует с
+// ролью apiKeyRole: регистрировать заезд гостей он может, а менять каталог — нет.
+// Города через публичный API не меняются вовсе — только через /api/admin.
+
+// Роли пользователей в порядке старшинства.
+const (
+	roleUser    = "user"
+	roleManager = "manager"
+	roleAdmin   = "admin"
+)
+
+// roleRank — старшинство ролей; неизвестная роль не даёт прав сверх user.
+var roleRank = map[string]int{roleUser: 0, roleManager: 1, roleAdmin: 2}
+
+// apiKeyRole — роль, с которой действует партнёр по API-ключу. Ключ выдаётся
+// тенанту, а не сотруднику сервиса, поэтому роли admin он не получает.
+const apiKeyRole = roleManager
+
+// hasRole сообщает, не ниже ли роль have заданной.
+func hasRole(have, role string) bool {
+	return roleRank[have] >= roleRank[role]
+}
+
+// requireRole — middleware маршрутов, которым нужна роль не ниже role: у пользователя
+// или, для API-ключа партнёра, apiKeyRole. Ставится после quotaMiddleware и userMiddleware.
+func requireRole(role string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if u, ok := currentUser(c); ok {
+			if !hasRole(u.Role, role) {
+				c.AbortWithStatusJSON(http.StatusForbidden, Response{
+					Success: false,
+					Error:   "this action requires the " + role + " role",
+				})
+				return
+			}
+			c.Next()
+			return
+		}
+		if _, ok := c.Get("api_key"); ok {
+			if !hasRole(apiKeyRole, role) {
+				c.AbortWithStatusJSON(http.StatusForbidden, Response{
+					Success: false,
+					Error:   "this action requires the " + role + " role and is not available with an API key",
+					Hint:    "log in with POST /api/auth/login as a user with the " + role + " role",
+				})
+				return
+			}
+			c.Next()
+			return
+		}
+		c.AbortWithStatusJSON(http.StatusUnauthorized, Response{
+			Success: false,
+			Error:   "a Bearer token or " + apiKeyHeader + " header is required",
+			Hint:    "log in with POST /api/auth/login",
+		})
+	}
+}
+
+// getUsers — HTTP-обработчик списка пользователей для администратора.
+// Реагирует на GET /api/admin/users; фильтр ?role=, постранично с ?page=&per_page=.
+func getUsers(c *gin.Context) {
+	query := "SELECT id, email, name, role, created_at FROM users"
+	var args []interface{}
+	if role := c.Query("role"); role != "" {
+		if _, ok := roleRank[role]; !ok {
+			c.JSON(http.StatusBadRequest, Response{Success: false, Error: "role must be user, manager or admin"})
+			return
+		}
+		query += " WHERE role = $1"
+		args = append(args, role)
+	}
+	respondQueryPage(c, "user", query+" ORDER BY id", args, func(row interface{ Scan(...interface{}) error }) (User, error) {
+		var u User
+		err := row.Scan(&u.ID, &u.Email, &u.Name, &u.Role, &u.CreatedAt)
+		return u, err
+	})
+}
+
+// setUserRole — HTTP-обработчик смены роли пользователя.
+// Реагирует на PUT /api/admin/users/:id/role с телом {"role": "manager"}.
+func setUserRole(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, Response{Success: false, Error: "user id must be an integer"})
+		return
+	}
+	var body struct {
+		Role string `json:"role"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, Response{Success: false, Error: err.Error()})
+		return
+	}
+	if _, ok := roleRank[body.Role]; !ok {
+		c.JSON(http.StatusBadRequest, Response{Success: false, Error: "role must be user, manager or admin"})
+		return
+	}
+	var u User
+	err = db.QueryRowContext(c.Request.Context(), `
+		UPDATE users SET role = $2 WHERE id = $1
+		RETURNING id, email, name, role, created_at
+	`, id, body.Role).Scan(&u.ID, &u.Email, &u.Name, &u.Role, &u.CreatedAt)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, Response{Success: false, Error: "user not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, Response{Success: true, Data: u, Count: 1})
+}
+
+// createAdmin заводит учётную запись администратора. Если пользователь с таким email
+// уже есть, при promote ему назначается роль admin (пароль не меняется), иначе — ошибка.
+// created сообщает, была ли учётная запись создана.
+func createAdmin(ctx context.Context, email, name, password string, promote bool) (u User, created bool, err error) {
+	if email, err = normalizeEmail(email); err != nil {
+		return u, false, err
+	}
+	if name, err = validateNewUser(name, password); err != nil {
+		return u, false, err
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return u, false, err
+	}
+
+	err = db.QueryRowContext(ctx, `
+		INSERT INTO users (email, name, password_hash, role)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (email) DO NOTHING
+		RETURNING id, email, name, role, created_at
+	`, email, name, string(hash), roleAdmin).Scan(&u.ID, &u.Email, &u.Name, &u.Role, &u.CreatedAt)
+	if err == nil {
+		return u, true, nil
+	}
+	if err != sql.ErrNoRows {
+		return u, false, err
+	}
+	if !promote {
+		return u, false, fmt.Errorf("a user with email %s already exists; rerun with -promote to make them an admin", email)
+	}
+	err = db.QueryRowContext(ctx, `
+		UPDATE users SET role = $2 WHERE email = $1
+		RETURNING id, email, name, role, created_at
+	`, email, roleAdmin).Scan(&u.ID, &u.Email, &u.Name, &u.Role, &u.CreatedAt)
+	return u, false, err
+}
+
+// runCreateAdmin — команда create-admin: учётная запись администратора без ручного SQL.
+// Пароль читается из первой строки стандартного ввода, чтобы не попадать в историю
+// командной оболочки и список процессов:
+//
+//	echo "$ADMIN_PASSWORD" | WB create-admin -email ops@example.com
+func runCreateAdmin(args []string) error {
+	fs := flag.NewFlagSet("create-admin", flag.ExitOnError)
+	email := fs.String("email", "", "email of the admin account (required)")
+	name := fs.String("name", "Administrator", "display name")
+	promote := fs.Bool("promote", false, "if the email is already registered, give that user the admin role")
+	fs.Parse(args)
+	if *email == "" {
+		return fmt.Errorf("-email is required")
+	}
+
+	password, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && password == "" {
+		return fmt.Errorf("reading the password from stdin: %w", err)
+	}
+	password = strings.TrimRight(password, "\r\n")
+
+	if err := newApp(databaseComponents()...).start(context.Background()); err != nil {
+		return err
+	}
+	defer db.Close()
+
+	u, created, err := createAdmin(context.Background(), *email, *name, password, *promote)
+	if err != nil {
+		return err
+	}
+	if created {
+		log.Printf("Created admin user %d <%s>", u.ID, u.Email)
+	} else {
+		log.Printf("Gave the admin role to existing user %d <%s>", u.ID, u.Email)
+	}
+	return nil
+}
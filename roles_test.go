@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRequireRoleAPIKey(t *testing.T) {
+	router := gin.New()
+	asPartner := func(c *gin.Context) { c.Set("api_key", APIKey{Key: "partner", TenantID: 1}) }
+	ok := func(c *gin.Context) { c.Status(http.StatusNoContent) }
+	router.DELETE("/api/hotels/:id", asPartner, requireRole(roleAdmin), ok)
+	router.POST("/api/checkins", asPartner, requireRole(roleManager), ok)
+	router.PUT("/anonymous", requireRole(roleUser), ok)
+
+	for _, tc := range []struct {
+		method, path string
+		want         int
+	}{
+		{"DELETE", "/api/hotels/1", http.StatusForbidden},
+		{"POST", "/api/checkins", http.StatusNoContent},
+		{"PUT", "/anonymous", http.StatusUnauthorized},
+	} {
+		if w := serve(router, tc.method, tc.path, ""); w.Code != tc.want {
+			t.Errorf("%s %s: status %d, want %d", tc.method, tc.path, w.Code, tc.want)
+		}
+	}
+}
+
+func TestPartnerKeyCannotDeleteHotel(t *testing.T) {
+	testDB(t)
+	hotelID := testHotel(t, "Red Square Inn", testCity(t, "Moscow"), 10, 5000)
+	testAPIKey(t, "partner-key", "pro", 1000)
+	_, adminToken := testUser(t, "admin@example.com", roleAdmin)
+	_, userToken := testUser(t, "user@example.com", roleUser)
+	router := newPublicRouter()
+	path := "/api/hotels/" + strconv.Itoa(hotelID)
+
+	if w := serve(router, "DELETE", path, "", apiKeyHeader, "partner-key"); w.Code != http.StatusForbidden {
+		t.Fatalf("partner key: status %d, want 403: %s", w.Code, w.Body)
+	}
+	if w := serve(router, "DELETE", path, "", "Authorization", bearerPrefix+userToken); w.Code != http.StatusForbidden {
+		t.Fatalf("user token: status %d, want 403: %s", w.Code, w.Body)
+	}
+	var deleted bool
+	if err := db.QueryRow("SELECT deleted_at IS NOT NULL FROM hotels WHERE id = $1", hotelID).Scan(&deleted); err != nil {
+		t.Fatal(err)
+	}
+	if deleted {
+		t.Fatal("hotel was deleted by a caller without the admin role")
+	}
+	if w := serve(router, "DELETE", path, "", "Authorization", bearerPrefix+adminToken); w.Code != http.StatusOK {
+		t.Fatalf("admin token: status %d, want 200: %s", w.Code, w.Body)
+	}
+}
+
+func TestAdminUsersPage(t *testing.T) {
+	testDB(t)
+	t.Setenv("ADMIN_TOKEN", "admin-token")
+	for _, email := range []string{"a@example.com", "b@example.com", "c@example.com"} {
+		testUser(t, email, roleUser)
+	}
+	testUser(t, "boss@example.com", roleAdmin)
+
+	w := serve(newAdminRouter(), "GET", "/api/admin/users?role=user&page=2&per_page=2", "", "Authorization", bearerPrefix+"admin-token")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	var resp struct {
+		Data []User   `json:"data"`
+		Page PageInfo `json:"page"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Data) != 1 || resp.Data[0].Email != "c@example.com" {
+		t.Errorf("page 2: %+v", resp.Data)
+	}
+	if resp.Page.Total != 3 || resp.Page.Pages != 2 {
+		t.Errorf("page info: %+v", resp.Page)
+	}
+}
+
+func TestCreateAdmin(t *testing.T) {
+	testDB(t)
+	ctx := context.Background()
+	u, created, err := createAdmin(ctx, " Ops@Example.com ", "Ops", "correct horse", false)
+	if err != nil || !created {
+		t.Fatalf("created %v, err %v", created, err)
+	}
+	if u.Email != "ops@example.com" || u.Role != roleAdmin {
+		t.Errorf("admin: %+v", u)
+	}
+	w := serve(newPublicRouter(), "POST", "/api/auth/login", `{"email": "ops@example.com", "password": "correct horse"}`)
+	if w.Code != http.StatusOK {
+		t.Errorf("admin cannot log in: status %d: %s", w.Code, w.Body)
+	}
+
+	if _, _, err := createAdmin(ctx, "short@example.com", "Ops", "short", false); err == nil {
+		t.Error("a too short password was accepted")
+	}
+
+	// Зарегистрированного пользователя повышают только явно, пароль при этом не меняется.
+	existing, _ := testUser(t, "staff@example.com", roleUser)
+	if _, _, err := createAdmin(ctx, existing.Email, "Staff", "another password", false); err == nil || !strings.Contains(err.Error(), "-promote") {
+		t.Errorf("existing user without -promote: err = %v", err)
+	}
+	u, created, err = createAdmin(ctx, existing.Email, "Staff", "another password", true)
+	if err != nil || created || u.ID != existing.ID || u.Role != roleAdmin {
+		t.Errorf("promote: %+v, created %v, err %v", u, created, err)
+	}
+	w = serve(newPublicRouter(), "POST", "/api/auth/login", `{"email": "staff@example.com", "password": "correct horse"}`)
+	if w.Code != http.StatusOK {
+		t.Errorf("promoted user's password changed: status %d: %s", w.Code, w.Body)
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"log"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Строгий режим сканирования строк.
+//
+// Раньше строка, которую не удалось прочитать в структуру (NULL в NOT NULL-поле модели,
+// неожиданный тип), просто пропускалась с записью в лог — клиент получал неполный
+// список и не знал об этом. Теперь по умолчанию такая ошибка проваливает запрос
+// с 500: неполные данные хуже явной ошибки. Для маршрутов, где лучше отдать хоть
+// что-то, строгий режим отключается настройкой LENIENT_SCAN_ROUTES (список шаблонов
+// маршрутов gin, например /api/hotels). В обоих режимах ошибка учитывается в метрике
+// scan_errors (expvar, разбивка по сущностям) — это сигнал о нарушении целостности данных.
+
+// scanErrors — число ошибок сканирования по сущностям.
+var scanErrors = expvar.NewMap("scan_errors")
+
+// strictScan сообщает, действует ли для маршрута запроса строгий режим.
+func strictScan(c *gin.Context) bool {
+	for _, route := range settings().LenientScanRoutes {
+		if route == c.FullPath() {
+			return false
+		}
+	}
+	return true
+}
+
+// scanFailed обрабатывает ошибку сканирования строки сущности entity.
+// В строгом режиме возвращает ошибку, которую нужно вернуть вызывающему;
+// в мягком — пишет в лог и возвращает nil, после чего строку следует пропустить.
+func scanFailed(strict bool, entity string, err error) error {
+	scanErrors.Add(entity, 1)
+	if strict {
+		return fmt.Errorf("scanning %s: %w", entity, err)
+	}
+	log.Printf("Error scanning %s: %v", entity, err)
+	return nil
+}
+
+// jsonColumn читает nullable JSON-колонку в *T: NULL даёт nil.
+type jsonColumn[T any] struct {
+	dst **T
+}
+
+// Scan реализует sql.Scanner.
+func (col jsonColumn[T]) Scan(src interface{}) error {
+	var raw []byte
+	switch v := src.(type) {
+	case nil:
+		*col.dst = nil
+		return nil
+	case []byte:
+		raw = v
+	case string:
+		raw = []byte(v)
+	default:
+		return fmt.Errorf("cannot scan %T into %T", src, *col.dst)
+	}
+	v := new(T)
+	if err := json.Unmarshal(raw, v); err != nil {
+		return err
+	}
+	*col.dst = v
+	return nil
+}
+
+// rowIterationErrors — число ошибок, возникших при переборе строк уже после начала
+// чтения (обрыв соединения посреди результата и т. п.), по сущностям.
+var rowIterationErrors = expvar.NewMap("row_iteration_errors")
+
+// rowSet — список, прочитанный из БД. Partial=true означает, что часть строк потеряна
+// (пропущена в мягком режиме или чтение оборвалось) и клиенту стоит повторить запрос.
+type rowSet[T any] struct {
+	Items   []T
+	Partial bool
+}
+
+// isPartial реализует partialValue: неполные списки не кэшируются (см. cache.go).
+func (s rowSet[T]) isPartial() bool {
+	return s.Partial
+}
+
+// iterationFailed обрабатывает ошибку rows.Err() после цикла чтения сущности entity.
+// В строгом режиме возвращает ошибку; в мягком — пишет в лог и возвращает nil,
+// после чего уже прочитанные строки отдаются как неполный результат.
+func iterationFailed(strict bool, entity string, err error) error {
+	rowIterationErrors.Add(entity, 1)
+	if strict {
+		return fmt.Errorf("reading %s rows: %w", entity, err)
+	}
+	log.Printf("Error reading %s rows, returning partial result: %v", entity, err)
+	return nil
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Отложенная публикация и расписание цен.
+//
+// Чтобы запуск «в полночь» не требовал, чтобы кто-то нажал кнопку в полночь,
+// оба механизма вычисляются прямо в запросе, без фоновых задач:
+//
+//   - hotels.publish_at (NULL — без задержки): опубликованная гостиница попадает
+//     в публичный список только когда publish_at <= now();
+//   - hotel_prices(hotel_id, price, effective_from, created_at),
+//     PRIMARY KEY (hotel_id, effective_from): действует последняя цена, чей
+//     effective_from уже наступил; пока такой нет — hotels.price.
+//
+// Публичный список кэшируется, поэтому изменения становятся видны с задержкой
+// не больше TTL+Stale политики HotelsCache.
+
+// effectivePriceQuery — подзапрос действующей цены гостиницы h (для LEFT JOIN LATERAL).
+const effectivePriceQuery = `
+	SELECT hp.price::numeric AS price
+	FROM hotel_prices hp
+	WHERE hp.hotel_id = h.id AND hp.effective_from <= now()
+	ORDER BY hp.effective_from DESC
+	LIMIT 1
+`
+
+// ScheduledPrice — запись расписания цен.
+type ScheduledPrice struct {
+	Price         float64   `json:"price"`
+	EffectiveFrom time.Time `json:"effective_from"`
+	CreatedAt     time.Time `json:"created_at"`
+	Active        bool      `json:"active"`
+}
+
+// hotelIDParam разбирает :id и отвечает 400, если он не число.
+func hotelIDParam(c *gin.Context) (int, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, Response{Success: false, Error: "hotel id must be an integer"})
+		return 0, false
+	}
+	return id, true
+}
+
+// setPublishAt — HTTP-обработчик, задающий или снимающий отложенную публикацию.
+// Реагирует на PUT /api/admin/hotels/:id/publish-at с телом {"publish_at": "..."}
+// ({"publish_at": null} — публиковать сразу).
+func setPublishAt(c *gin.Context) {
+	id, ok := hotelIDParam(c)
+	if !ok {
+		return
+	}
+	var body struct {
+		PublishAt *time.Time `json:"publish_at"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, Response{Success: false, Error: err.Error()})
+		return
+	}
+
+	res, err := db.ExecContext(c.Request.Context(), "UPDATE hotels SET publish_at = $2 WHERE id = $1", id, body.PublishAt)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		c.JSON(http.StatusNotFound, Response{Success: false, Error: "hotel not found"})
+		return
+	}
+	cache.flush("hotels")
+
+	c.JSON(http.StatusOK, Response{
+		Success: true,
+		Data:    gin.H{"id": id, "publish_at": body.PublishAt},
+		Count:   1,
+	})
+}
+
+// getPriceSchedule — HTTP-обработчик, возвращающий расписание цен гостиницы.
+// Реагирует на GET /api/admin/hotels/:id/prices; active=true у действующей сейчас цены.
+func getPriceSchedule(c *gin.Context) {
+	id, ok := hotelIDParam(c)
+	if !ok {
+		return
+	}
+	rows, err := db.QueryContext(c.Request.Context(), `
+		SELECT price::numeric, effective_from, created_at
+		FROM hotel_prices
+		WHERE hotel_id = $1
+		ORDER BY effective_from
+	`, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	now := time.Now()
+	prices := []ScheduledPrice{}
+	for rows.Next() {
+		var p ScheduledPrice
+		if err := rows.Scan(&p.Price, &p.EffectiveFrom, &p.CreatedAt); err != nil {
+			log.Printf("Error scanning scheduled price: %v", err)
+			continue
+		}
+		prices = append(prices, p)
+	}
+	if err := rows.Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	// Действует последняя из уже наступивших цен.
+	for i := len(prices) - 1; i >= 0; i-- {
+		if !prices[i].EffectiveFrom.After(now) {
+			prices[i].Active = true
+			break
+		}
+	}
+
+	c.JSON(http.StatusOK, Response{
+		Success: true,
+		Data:    prices,
+		Count:   len(prices),
+	})
+}
+
+// schedulePrice — HTTP-обработчик, планирующий смену цены.
+// Реагирует на POST /api/admin/hotels/:id/prices с телом {"price": 120.5, "effective_from": "..."}.
+// Повторная запись с тем же effective_from заменяет цену.
+func schedulePrice(c *gin.Context) {
+	id, ok := hotelIDParam(c)
+	if !ok {
+		return
+	}
+	var body struct {
+		Price         *float64   `json:"price"`
+		EffectiveFrom *time.Time `json:"effective_from"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, Response{Success: false, Error: err.Error()})
+		return
+	}
+	if body.Price == nil || *body.Price < 0 {
+		c.JSON(http.StatusBadRequest, Response{Success: false, Error: "price is required and must not be negative"})
+		return
+	}
+	if body.EffectiveFrom == nil {
+		c.JSON(http.StatusBadRequest, Response{Success: false, Error: "effective_from is required"})
+		return
+	}
+
+	var p ScheduledPrice
+	err := db.QueryRowContext(c.Request.Context(), `
+		INSERT INTO hotel_prices (hotel_id, price, effective_from)
+		SELECT id, $2, $3 FROM hotels WHERE id = $1
+		ON CONFLICT (hotel_id, effective_from) DO UPDATE SET price = EXCLUDED.price, created_at = now()
+		RETURNING price::numeric, effective_from, created_at
+	`, id, *body.Price, *body.EffectiveFrom).Scan(&p.Price, &p.EffectiveFrom, &p.CreatedAt)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, Response{Success: false, Error: "hotel not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	// Новая цена действует, если она последняя из уже наступивших.
+	if err := db.QueryRowContext(c.Request.Context(), `
+		SELECT COALESCE($2 = (SELECT max(effective_from) FROM hotel_prices WHERE hotel_id = $1 AND effective_from <= now()), false)
+	`, id, p.EffectiveFrom).Scan(&p.Active); err != nil {
+		log.Printf("Error checking whether scheduled price is active: %v", err)
+	}
+	cache.flush("hotels")
+
+	c.JSON(http.StatusCreated, Response{
+		Success: true,
+		Data:    p,
+		Count:   1,
+	})
+}
@@ -0,0 +1,302 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// Проверка схемы БД при запуске.
+//
+// Код опирается на определённые таблицы, колонки и уникальные индексы (последние
+// нужны для ON CONFLICT). Если схему поменяли вручную или забыли применить изменение,
+// ошибка проявится только на запросе — невнятным "converting NULL to int" в логе
+// при сканировании или "there is no unique constraint" при записи. Поэтому serve
+// сверяет живую схему с expectedSchema до открытия сокетов и при расхождении не
+// стартует, перечисляя все найденные отличия.
+//
+// Типы сравниваются по семействам (colInt принимает integer, bigint и smallint и т. д.):
+// нам важно, во что Scan сможет прочитать значение, а не точный тип. Лишние колонки,
+// таблицы и индексы расхождением не считаются.
+
+// Семейства типов колонок.
+const (
+	colInt     = "int"
+	colText    = "text"
+	colNumeric = "numeric"
+	colBool    = "bool"
+	colTime    = "time"
+	colJSON    = "json"
+	colArray   = "array"
+)
+
+// typeFamilies — какие значения information_schema.columns.data_type входят в семейство.
+var typeFamilies = map[string][]string{
+	colInt:     {"integer", "bigint", "smallint"},
+	colText:    {"text", "character varying", "character"},
+	colNumeric: {"numeric", "money", "double precision", "real", "integer", "bigint"},
+	colBool:    {"boolean"},
+	colTime:    {"timestamp with time zone", "timestamp without time zone", "date"},
+	colJSON:    {"jsonb", "json"},
+	colArray:   {"ARRAY"},
+}
+
+// expectedColumn — колонка, которую читает или пишет код.
+type expectedColumn struct {
+	Name   string
+	Family string
+}
+
+// expectedTable — таблица с нужными коду колонками и уникальными индексами.
+type expectedTable struct {
+	Name    string
+	Columns []expectedColumn
+	Unique  [][]string
+}
+
+// expectedSchema — схема, которую ожидает код. При добавлении запросов к новым
+// колонкам или таблицам её нужно дополнять вместе с миграцией (см. migrate.go).
+var expectedSchema = []expectedTable{
+	{Name: "cities", Columns: []expectedColumn{
+		{"id", colInt}, {"name", colText}, {"slug", colText}, {"geoname_id", colInt}, {"country_code", colText},
+		{"latitude", colNumeric}, {"longitude", colNumeric}, {"population", colInt},
+	}, Unique: [][]string{{"geoname_id"}, {"slug"}}},
+	{Name: "city_aliases", Columns: []expectedColumn{
+		{"id", colInt}, {"city_id", colInt}, {"old_id", colInt}, {"old_name", colText}, {"created_at", colTime},
+	}},
+	{Name: "city_audit", Columns: []expectedColumn{
+		{"id", colInt}, {"action", colText}, {"city_id", colInt}, {"source_id", colInt}, {"old_name", colText},
+		{"new_name", colText}, {"hotels_moved", colInt}, {"request_id", colText}, {"created_at", colTime},
+	}},
+	{Name: "hotels", Columns: []expectedColumn{
+		{"id", colInt}, {"name", colText}, {"slug", colText}, {"city", colInt}, {"capacity", colInt}, {"price", colNumeric},
+		{"status", colText}, {"publish_at", colTime}, {"description", colText},
+		{"attributes", colJSON}, {"latitude", colNumeric}, {"longitude", colNumeric}, {"allowed_countries", colArray},
+		{"blocked_countries", colArray}, {"accessibility", colJSON}, {"extras", colJSON},
+		{"deleted_at", colTime},
+	}, Unique: [][]string{{"slug"}}},
+	{Name: "bookings", Columns: []expectedColumn{
+		{"id", colInt}, {"hotel_id", colInt}, {"tenant_id", colInt}, {"user_id", colInt}, {"guest_name", colText}, {"check_in", colTime},
+		{"check_out", colTime}, {"guests", colInt}, {"status", colText}, {"total", colNumeric}, {"created_at", colTime},
+		{"cancelled_at", colTime}, {"checked_in_at", colTime},
+	}},
+	{Name: "checkin_audit", Columns: []expectedColumn{
+		{"id", colInt}, {"booking_id", colInt}, {"hotel_id", colInt}, {"outcome", colText}, {"actor", colText},
+		{"request_id", colText}, {"created_at", colTime},
+	}},
+	{Name: "booking_shares", Columns: []expectedColumn{
+		{"token", colText}, {"booking_id", colInt}, {"permission", colText}, {"expires_at", colTime},
+		{"revoked", colBool}, {"created_at", colTime},
+	}},
+	{Name: "booking_guests", Columns: []expectedColumn{
+		{"id", colInt}, {"booking_id", colInt}, {"name", colText}, {"email", colText}, {"share_token", colText},
+		{"created_at", colTime},
+	}},
+	{Name: "users", Columns: []expectedColumn{
+		{"id", colInt}, {"email", colText}, {"name", colText}, {"password_hash", colText}, {"role", colText},
+		{"created_at", colTime},
+	}, Unique: [][]string{{"email"}}},
+	{Name: "refresh_tokens", Columns: []expectedColumn{
+		{"token_hash", colText}, {"user_id", colInt}, {"expires_at", colTime}, {"revoked_at", colTime},
+		{"created_at", colTime},
+	}},
+	{Name: "price_alerts", Columns: []expectedColumn{
+		{"id", colInt}, {"hotel_id", colInt}, {"session_id", colText}, {"check_in", colTime}, {"check_out", colTime},
+		{"threshold", colNumeric}, {"last_quote", colNumeric}, {"triggered_at", colTime}, {"notified_at", colTime},
+		{"created_at", colTime},
+	}},
+	{Name: "pois", Columns: []expectedColumn{
+		{"id", colInt}, {"city_id", colInt}, {"kind", colText}, {"name", colText}, {"latitude", colNumeric},
+		{"longitude", colNumeric}, {"created_at", colTime},
+	}},
+	{Name: "hotel_poi_distances", Columns: []expectedColumn{
+		{"hotel_id", colInt}, {"poi_id", colInt}, {"distance_m", colInt},
+	}, Unique: [][]string{{"hotel_id", "poi_id"}}},
+	{Name: "attribute_definitions", Columns: []expectedColumn{
+		{"key", colText}, {"tenant_id", colInt}, {"type", colText}, {"allowed_values", colArray}, {"label", colText},
+		{"created_at", colTime},
+	}, Unique: [][]string{{"key"}}},
+	{Name: "hotel_revisions", Columns: []expectedColumn{
+		{"id", colInt}, {"hotel_id", colInt}, {"field", colText}, {"value", colText}, {"request_id", colText},
+		{"created_at", colTime},
+	}},
+	{Name: "slug_history", Columns: []expectedColumn{
+		{"entity", colText}, {"slug", colText}, {"entity_id", colInt}, {"created_at", colTime},
+	}, Unique: [][]string{{"entity", "slug"}}},
+	{Name: "short_links", Columns: []expectedColumn{
+		{"code", colText}, {"entity", colText}, {"entity_id", colInt}, {"created_at", colTime},
+	}, Unique: [][]string{{"code"}}},
+	{Name: "hotel_prices", Columns: []expectedColumn{
+		{"hotel_id", colInt}, {"price", colNumeric}, {"effective_from", colTime}, {"created_at", colTime},
+	}, Unique: [][]string{{"hotel_id", "effective_from"}}},
+	{Name: "price_audit", Columns: []expectedColumn{
+		{"id", colInt}, {"hotel_id", colInt}, {"old_price", colNumeric}, {"new_price", colNumeric},
+		{"effective_from", colTime}, {"request_id", colText}, {"created_at", colTime},
+	}},
+	{Name: "tenants", Columns: []expectedColumn{
+		{"id", colInt}, {"name", colText}, {"plan", colText}, {"monthly_quota", colInt}, {"price_per_call", colNumeric},
+	}},
+	{Name: "api_keys", Columns: []expectedColumn{
+		{"key", colText}, {"tenant_id", colInt}, {"monthly_quota", colInt}, {"revoked", colBool},
+	}},
+	{Name: "quota_usage", Columns: []expectedColumn{
+		{"api_key", colText}, {"tenant_id", colInt}, {"period", colTime}, {"requests", colInt},
+	}, Unique: [][]string{{"api_key", "period"}}},
+	{Name: "tenant_quota_usage", Columns: []expectedColumn{
+		{"tenant_id", colInt}, {"period", colTime}, {"requests", colInt},
+	}, Unique: [][]string{{"tenant_id", "period"}}},
+	{Name: "usage_rollups", Columns: []expectedColumn{
+		{"api_key", colText}, {"tenant_id", colInt}, {"granularity", colText}, {"bucket", colTime},
+		{"requests", colInt}, {"bytes", colInt},
+	}, Unique: [][]string{{"api_key", "granularity", "bucket"}}},
+	{Name: "promotions", Columns: []expectedColumn{
+		{"id", colInt}, {"hotel_id", colInt}, {"city_id", colInt}, {"starts_at", colTime}, {"ends_at", colTime},
+		{"created_at", colTime},
+	}},
+	{Name: "promotion_stats", Columns: []expectedColumn{
+		{"promotion_id", colInt}, {"day", colTime}, {"impressions", colInt}, {"clicks", colInt},
+	}, Unique: [][]string{{"promotion_id", "day"}}},
+	{Name: "events", Columns: []expectedColumn{
+		{"id", colInt}, {"type", colText}, {"hotel_id", colInt}, {"city_id", colInt}, {"session_id", colText},
+		{"api_key", colText}, {"occurred_at", colTime}, {"received_at", colTime}, {"props", colJSON},
+	}},
+	{Name: "hotel_questions", Columns: []expectedColumn{
+		{"id", colInt}, {"hotel_id", colInt}, {"text", colText}, {"session_id", colText}, {"hidden", colBool},
+		{"helpful_votes", colInt}, {"answered_at", colTime}, {"asker_notified_at", colTime}, {"created_at", colTime},
+	}},
+	{Name: "hotel_answers", Columns: []expectedColumn{
+		{"id", colInt}, {"question_id", colInt}, {"text", colText}, {"helpful_votes", colInt}, {"created_at", colTime},
+	}},
+	{Name: "qa_votes", Columns: []expectedColumn{
+		{"entity", colText}, {"entity_id", colInt}, {"session_id", colText}, {"ip", colText}, {"value", colInt},
+		{"created_at", colTime},
+	}, Unique: [][]string{{"entity", "entity_id", "session_id"}}},
+	{Name: "blobs", Columns: []expectedColumn{
+		{"key", colText}, {"kind", colText}, {"content_type", colText}, {"size", colInt}, {"created_at", colTime},
+	}, Unique: [][]string{{"key"}}},
+	{Name: "partner_mappings", Columns: []expectedColumn{
+		{"tenant_id", colInt}, {"entity", colText}, {"external_id", colText}, {"internal_id", colInt},
+		{"created_at", colTime},
+	}, Unique: [][]string{{"tenant_id", "entity", "external_id"}, {"tenant_id", "entity", "internal_id"}}},
+	{Name: "widget_tokens", Columns: []expectedColumn{
+		{"token", colText}, {"tenant_id", colInt}, {"origins", colArray}, {"config", colJSON}, {"revoked", colBool},
+		{"created_at", colTime},
+	}, Unique: [][]string{{"token"}}},
+}
+
+// checkSchema сверяет схему public с expectedSchema и возвращает список расхождений.
+func checkSchema(ctx context.Context) ([]string, error) {
+	names := make([]string, len(expectedSchema))
+	for i, t := range expectedSchema {
+		names[i] = t.Name
+	}
+
+	// Живые колонки: table -> column -> data_type.
+	live := map[string]map[string]string{}
+	rows, err := db.QueryContext(ctx, `
+		SELECT table_name, column_name, data_type
+		FROM information_schema.columns
+		WHERE table_schema = 'public' AND table_name = ANY($1)
+	`, pq.Array(names))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var table, column, dataType string
+		if err := rows.Scan(&table, &column, &dataType); err != nil {
+			return nil, err
+		}
+		if live[table] == nil {
+			live[table] = map[string]string{}
+		}
+		live[table][column] = dataType
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Живые уникальные индексы (включая первичные ключи) в виде "table:col1,col2".
+	unique := map[string]bool{}
+	idxRows, err := db.QueryContext(ctx, `
+		SELECT t.relname, array_agg(a.attname::text ORDER BY k.ord)
+		FROM pg_index i
+		JOIN pg_class t ON t.oid = i.indrelid
+		JOIN pg_namespace n ON n.oid = t.relnamespace
+		CROSS JOIN LATERAL unnest(i.indkey) WITH ORDINALITY AS k(attnum, ord)
+		JOIN pg_attribute a ON a.attrelid = t.oid AND a.attnum = k.attnum
+		WHERE i.indisunique AND n.nspname = 'public' AND t.relname = ANY($1)
+		GROUP BY t.relname, i.indexrelid
+	`, pq.Array(names))
+	if err != nil {
+		return nil, err
+	}
+	defer idxRows.Close()
+	for idxRows.Next() {
+		var table string
+		var columns []string
+		if err := idxRows.Scan(&table, pq.Array(&columns)); err != nil {
+			return nil, err
+		}
+		unique[table+":"+strings.Join(columns, ",")] = true
+	}
+	if err := idxRows.Err(); err != nil {
+		return nil, err
+	}
+
+	var diff []string
+	for _, t := range expectedSchema {
+		columns, ok := live[t.Name]
+		if !ok {
+			diff = append(diff, fmt.Sprintf("missing table %s", t.Name))
+			continue
+		}
+		for _, col := range t.Columns {
+			dataType, ok := columns[col.Name]
+			if !ok {
+				diff = append(diff, fmt.Sprintf("missing column %s.%s (%s)", t.Name, col.Name, col.Family))
+				continue
+			}
+			if !inFamily(col.Family, dataType) {
+				diff = append(diff, fmt.Sprintf("column %s.%s has type %s, expected %s (%s)",
+					t.Name, col.Name, dataType, col.Family, strings.Join(typeFamilies[col.Family], ", ")))
+			}
+		}
+		for _, cols := range t.Unique {
+			if !unique[t.Name+":"+strings.Join(cols, ",")] {
+				diff = append(diff, fmt.Sprintf("missing unique index on %s (%s)", t.Name, strings.Join(cols, ", ")))
+			}
+		}
+	}
+	return diff, nil
+}
+
+// inFamily сообщает, входит ли тип колонки в семейство.
+func inFamily(family, dataType string) bool {
+	for _, t := range typeFamilies[family] {
+		if t == dataType {
+			return true
+		}
+	}
+	return false
+}
+
+// verifySchema запускает проверку и превращает найденные расхождения в одну ошибку.
+func verifySchema(ctx context.Context) error {
+	diff, err := checkSchema(ctx)
+	if err != nil {
+		return fmt.Errorf("schema check failed: %w", err)
+	}
+	if len(diff) > 0 {
+		for _, d := range diff {
+			log.Printf("Schema drift: %s", d)
+		}
+		return fmt.Errorf("database schema does not match the code (%d differences):\n  %s",
+			len(diff), strings.Join(diff, "\n  "))
+	}
+	log.Println("Database schema matches expectations")
+	return nil
+}
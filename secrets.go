@@ -0,0 +1,370 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql/driver"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Секреты (пароль БД и т.п.) берутся из внешнего хранилища, а не из файлов на диске.
+//
+// Провайдер выбирается переменной SECRETS_PROVIDER:
+//   - env   — переменные окружения (имя секрета в верхнем регистре: db_password → DB_PASSWORD);
+//     годится только для локальной разработки;
+//   - vault — HashiCorp Vault, KV-хранилище по пути VAULT_SECRET_PATH (VAULT_ADDR, VAULT_TOKEN);
+//   - aws   — AWS Secrets Manager, секрет AWS_SECRET_ID с JSON-объектом ключ→значение
+//     (AWS_REGION, AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY, AWS_SESSION_TOKEN).
+//
+// Значения кэшируются на SECRETS_REFRESH (по умолчанию 5m) и перечитываются лениво —
+// при первом обращении после истечения срока. Так ротированный пароль подхватывается
+// без перезапуска: новые соединения с БД открываются уже с ним (см. secretConnector).
+
+// errSecretNotFound — в хранилище нет секрета с таким именем.
+var errSecretNotFound = errors.New("secret not found")
+
+// secretsLimits — таймаут обращения к хранилищу секретов с учётом срока запроса (см. deadline.go).
+var secretsLimits = providerLimits{
+	max:   10 * time.Second,
+	floor: time.Second,
+	retry: retryPolicy{attempts: 3, base: 200 * time.Millisecond, max: 2 * time.Second},
+}
+
+// SecretsProvider — источник секретов.
+type SecretsProvider interface {
+	GetSecret(ctx context.Context, name string) (string, error)
+}
+
+// envSecrets читает секреты из переменных окружения.
+type envSecrets struct{}
+
+func (envSecrets) GetSecret(_ context.Context, name string) (string, error) {
+	if v := os.Getenv(strings.ToUpper(name)); v != "" {
+		return v, nil
+	}
+	return "", errSecretNotFound
+}
+
+// vaultSecrets читает секреты из HashiCorp Vault через HTTP API.
+// Поддерживаются оба формата KV: v2 ({"data":{"data":{...}}}) и v1 ({"data":{...}}).
+type vaultSecrets struct {
+	addr  string
+	token string
+	path  string
+}
+
+func (v vaultSecrets) GetSecret(ctx context.Context, name string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimRight(v.addr, "/")+"/v1/"+strings.TrimLeft(v.path, "/"), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-Vault-Token", v.token)
+
+	var body struct {
+		Data map[string]json.RawMessage `json:"data"`
+	}
+	if err := doSecretsRequest(req, &body); err != nil {
+		return "", fmt.Errorf("vault: %w", err)
+	}
+
+	values := body.Data
+	if nested, ok := body.Data["data"]; ok {
+		if err := json.Unmarshal(nested, &values); err != nil {
+			return "", fmt.Errorf("vault: %w", err)
+		}
+	}
+	return stringSecret(values, name)
+}
+
+// awsSecrets читает секреты из AWS Secrets Manager.
+// Запрос подписывается Signature Version 4 вручную, чтобы не тянуть AWS SDK ради одного вызова.
+type awsSecrets struct {
+	region       string
+	secretID     string
+	accessKey    string
+	secretKey    string
+	sessionToken string
+}
+
+func (a awsSecrets) GetSecret(ctx context.Context, name string) (string, error) {
+	payload, err := json.Marshal(map[string]string{"SecretId": a.secretID})
+	if err != nil {
+		return "", err
+	}
+	host := "secretsmanager." + a.region + ".amazonaws.com"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "https://"+host+"/", bytes.NewReader(payload))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "secretsmanager.GetSecretValue")
+	a.sign(req, host, payload, time.Now().UTC())
+	// GetSecretValue только читает, поэтому его можно повторять, хотя это POST.
+	req = markIdempotent(req)
+
+	var body struct {
+		SecretString string `json:"SecretString"`
+	}
+	if err := doSecretsRequest(req, &body); err != nil {
+		return "", fmt.Errorf("aws secrets manager: %w", err)
+	}
+
+	var values map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(body.SecretString), &values); err != nil {
+		return "", fmt.Errorf("aws secrets manager: secret %s is not a JSON object: %w", a.secretID, err)
+	}
+	return stringSecret(values, name)
+}
+
+// sign добавляет к запросу заголовки авторизации AWS Signature Version 4.
+func (a awsSecrets) sign(req *http.Request, host string, payload []byte, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+
+	headers := map[string]string{
+		"content-type": req.Header.Get("Content-Type"),
+		"host":         host,
+		"x-amz-date":   amzDate,
+		"x-amz-target": req.Header.Get("X-Amz-Target"),
+	}
+	names := []string{"content-type", "host", "x-amz-date"}
+	if a.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", a.sessionToken)
+		headers["x-amz-security-token"] = a.sessionToken
+		names = append(names, "x-amz-security-token")
+	}
+	names = append(names, "x-amz-target")
+
+	var canonicalHeaders strings.Builder
+	for _, n := range names {
+		canonicalHeaders.WriteString(n + ":" + headers[n] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method, "/", "", canonicalHeaders.String(), signedHeaders, sha256Hex(payload),
+	}, "\n")
+	scope := date + "/" + a.region + "/secretsmanager/aws4_request"
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256", amzDate, scope, sha256Hex([]byte(canonicalRequest)),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+a.secretKey), date)
+	key = hmacSHA256(key, a.region)
+	key = hmacSHA256(key, "secretsmanager")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		a.accessKey, scope, signedHeaders, signature))
+}
+
+func sha256Hex(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// doSecretsRequest выполняет запрос к хранилищу и декодирует JSON-ответ в out.
+func doSecretsRequest(req *http.Request, out interface{}) error {
+	resp, err := doProvider(outboundClient, "secrets", req, secretsLimits)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("unexpected status %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// stringSecret достаёт строковое значение из JSON-объекта с секретами.
+func stringSecret(values map[string]json.RawMessage, name string) (string, error) {
+	raw, ok := values[name]
+	if !ok {
+		return "", errSecretNotFound
+	}
+	var s string
+	if err := json.Unmarshal(raw, &s); err != nil {
+		return "", fmt.Errorf("secret %s is not a string", name)
+	}
+	return s, nil
+}
+
+// cachedSecret — значение секрета и время его получения.
+type cachedSecret struct {
+	value     string
+	fetchedAt time.Time
+}
+
+// cachedSecrets кэширует значения провайдера на ttl и обновляет их лениво.
+// Если хранилище недоступно, продолжаем отдавать последнее известное значение:
+// кратковременная недоступность Vault не должна ронять подключения к БД.
+type cachedSecrets struct {
+	provider SecretsProvider
+	ttl      time.Duration
+
+	mu     sync.Mutex
+	values map[string]cachedSecret
+}
+
+func (c *cachedSecrets) GetSecret(ctx context.Context, name string) (string, error) {
+	c.mu.Lock()
+	cached, ok := c.values[name]
+	c.mu.Unlock()
+	if ok && time.Since(cached.fetchedAt) < c.ttl {
+		return cached.value, nil
+	}
+
+	value, err := c.provider.GetSecret(ctx, name)
+	if err != nil {
+		if ok && !errors.Is(err, errSecretNotFound) {
+			log.Printf("Error refreshing secret %s, using cached value: %v", name, err)
+			return cached.value, nil
+		}
+		return "", err
+	}
+
+	c.mu.Lock()
+	c.values[name] = cachedSecret{value: value, fetchedAt: time.Now()}
+	c.mu.Unlock()
+	return value, nil
+}
+
+// secrets — провайдер секретов приложения; инициализируется в initSecrets.
+var secrets SecretsProvider
+
+// secretsRefresh — срок жизни закэшированного значения секрета.
+var secretsRefresh = 5 * time.Minute
+
+// initSecrets создаёт провайдер секретов по переменной SECRETS_PROVIDER.
+func initSecrets() error {
+	var p SecretsProvider
+	switch name := os.Getenv("SECRETS_PROVIDER"); name {
+	case "", "env":
+		p = envSecrets{}
+	case "vault":
+		v := vaultSecrets{addr: os.Getenv("VAULT_ADDR"), token: os.Getenv("VAULT_TOKEN"), path: os.Getenv("VAULT_SECRET_PATH")}
+		if v.addr == "" || v.token == "" || v.path == "" {
+			return errors.New("vault secrets provider requires VAULT_ADDR, VAULT_TOKEN and VAULT_SECRET_PATH")
+		}
+		p = v
+	case "aws":
+		a := awsSecrets{
+			region:       os.Getenv("AWS_REGION"),
+			secretID:     os.Getenv("AWS_SECRET_ID"),
+			accessKey:    os.Getenv("AWS_ACCESS_KEY_ID"),
+			secretKey:    os.Getenv("AWS_SECRET_ACCESS_KEY"),
+			sessionToken: os.Getenv("AWS_SESSION_TOKEN"),
+		}
+		if a.region == "" || a.secretID == "" || a.accessKey == "" || a.secretKey == "" {
+			return errors.New("aws secrets provider requires AWS_REGION, AWS_SECRET_ID, AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY")
+		}
+		p = a
+	default:
+		return fmt.Errorf("unknown SECRETS_PROVIDER %q", name)
+	}
+
+	if v := os.Getenv("SECRETS_REFRESH"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("invalid SECRETS_REFRESH: %w", err)
+		}
+		secretsRefresh = d
+	}
+
+	secrets = &cachedSecrets{
+		provider: p,
+		ttl:      secretsRefresh,
+		values:   map[string]cachedSecret{},
+	}
+	return nil
+}
+
+// secretConnector открывает соединения с PostgreSQL, подставляя актуальный пароль
+// из хранилища секретов при каждом новом подключении. Уже открытые соединения
+// продолжают работать после ротации: PostgreSQL не разрывает авторизованные сессии.
+type secretConnector struct {
+	// dsn — параметры подключения без пароля.
+	dsn string
+}
+
+func (sc secretConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	password, err := dbPassword(ctx)
+	if err != nil {
+		return nil, err
+	}
+	connector, err := pq.NewConnector(sc.dsn + " password=" + dsnValue(password))
+	if err != nil {
+		return nil, err
+	}
+	return connector.Connect(ctx)
+}
+
+func (sc secretConnector) Driver() driver.Driver {
+	return &pq.Driver{}
+}
+
+// dbPassword возвращает текущий пароль БД.
+// Для локальной разработки без настроенного хранилища используется прежний пароль по умолчанию.
+func dbPassword(ctx context.Context) (string, error) {
+	password, err := secrets.GetSecret(ctx, "db_password")
+	if errors.Is(err, errSecretNotFound) {
+		return "12345", nil
+	}
+	return password, err
+}
+
+// watchDBPasswordRotation раз в период обновления секретов проверяет пароль БД.
+// Если он сменился, простаивающие соединения закрываются, и пул переоткрывает их уже
+// с новым паролем; занятые соединения дорабатывают текущие запросы.
+// Запускается в отдельной горутине и работает до отмены ctx.
+func watchDBPasswordRotation(ctx context.Context) {
+	last, err := dbPassword(ctx)
+	if err != nil {
+		log.Printf("Error reading DB password: %v", err)
+	}
+
+	ticker := time.NewTicker(secretsRefresh)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		current, err := dbPassword(ctx)
+		if err != nil {
+			log.Printf("Error reading DB password: %v", err)
+			continue
+		}
+		if current == last {
+			continue
+		}
+		last = current
+		log.Println("DB password rotated, recycling idle connections")
+		db.SetMaxIdleConns(0)
+		db.SetMaxIdleConns(dbMaxIdleConns)
+	}
+}
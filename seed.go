@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+)
+
+// Демонстрационные данные.
+//
+// Команда seed загружает в БД небольшой набор городов и опубликованных гостиниц
+// из встроенного файла fixtures/demo.json, чтобы после WB migrate сразу получить
+// рабочий набор данных для разработки. Города проходят тот же путь, что и импорт
+// из GeoNames (см. upsertGeoName): уже заведённый город находится по geoname_id или
+// названию и не дублируется. Гостиница пропускается, если в её городе уже есть
+// гостиница с таким названием, поэтому команду можно запускать повторно.
+//
+//	WB seed [-file fixtures.json]
+
+//go:embed fixtures/demo.json
+var demoFixture []byte
+
+// seedFixture — содержимое файла с демонстрационными данными.
+type seedFixture struct {
+	Cities []struct {
+		GeoNameID   int64   `json:"geoname_id"`
+		Name        string  `json:"name"`
+		CountryCode string  `json:"country_code"`
+		Latitude    float64 `json:"latitude"`
+		Longitude   float64 `json:"longitude"`
+		Population  int64   `json:"population"`
+	} `json:"cities"`
+	Hotels []struct {
+		Name          string  `json:"name"`
+		CityGeoNameID int64   `json:"city_geoname_id"`
+		Capacity      int     `json:"capacity"`
+		Price         float64 `json:"price"`
+		Latitude      float64 `json:"latitude"`
+		Longitude     float64 `json:"longitude"`
+		Description   string  `json:"description"`
+	} `json:"hotels"`
+}
+
+// SeedResult — сколько записей добавила команда seed.
+type SeedResult struct {
+	CitiesInserted int `json:"cities_inserted"`
+	CitiesUpdated  int `json:"cities_updated"`
+	HotelsInserted int `json:"hotels_inserted"`
+	HotelsSkipped  int `json:"hotels_skipped"`
+}
+
+// seedDemoData загружает города и гостиницы из fixture.
+func seedDemoData(ctx context.Context, f seedFixture) (SeedResult, error) {
+	var res SeedResult
+	for _, c := range f.Cities {
+		inserted, err := upsertGeoName(ctx, geoName{
+			ID: c.GeoNameID, Name: c.Name, ASCIIName: c.Name, Country: c.CountryCode,
+			Latitude: c.Latitude, Longitude: c.Longitude, Population: c.Population,
+		})
+		if err != nil {
+			return res, fmt.Errorf("city %s: %w", c.Name, err)
+		}
+		if inserted {
+			res.CitiesInserted++
+		} else {
+			res.CitiesUpdated++
+		}
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return res, err
+	}
+	defer tx.Rollback()
+	for _, h := range f.Hotels {
+		var cityID int
+		var exists bool
+		err := tx.QueryRowContext(ctx, `
+			SELECT c.id, EXISTS (SELECT 1 FROM hotels WHERE city = c.id AND lower(name) = lower($2))
+			FROM cities c WHERE c.geoname_id = $1
+		`, h.CityGeoNameID, h.Name).Scan(&cityID, &exists)
+		if err != nil {
+			return res, fmt.Errorf("hotel %s: city %d: %w", h.Name, h.CityGeoNameID, err)
+		}
+		if exists {
+			res.HotelsSkipped++
+			continue
+		}
+		slug, err := uniqueSlug(ctx, tx, "hotel", slugify(h.Name), 0)
+		if err != nil {
+			return res, err
+		}
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO hotels (name, slug, city, capacity, price, status, latitude, longitude, description)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		`, h.Name, slug, cityID, h.Capacity, h.Price, hotelPublished, h.Latitude, h.Longitude, h.Description)
+		if err != nil {
+			return res, fmt.Errorf("hotel %s: %w", h.Name, err)
+		}
+		res.HotelsInserted++
+	}
+	return res, tx.Commit()
+}
+
+// runSeed — команда seed: загрузка демонстрационных данных.
+func runSeed(args []string) error {
+	fs := flag.NewFlagSet("seed", flag.ExitOnError)
+	file := fs.String("file", "", "fixture file in the format of fixtures/demo.json (default: the embedded demo data)")
+	fs.Parse(args)
+
+	raw := demoFixture
+	if *file != "" {
+		var err error
+		if raw, err = os.ReadFile(*file); err != nil {
+			return err
+		}
+	}
+	var f seedFixture
+	if err := json.Unmarshal(raw, &f); err != nil {
+		return fmt.Errorf("parsing fixture: %w", err)
+	}
+
+	if err := newApp(databaseComponents()...).start(context.Background()); err != nil {
+		return err
+	}
+	defer db.Close()
+
+	res, err := seedDemoData(context.Background(), f)
+	if err != nil {
+		return err
+	}
+	log.Printf("Seeded demo data: %d cities added, %d cities already present, %d hotels added, %d hotels already present",
+		res.CitiesInserted, res.CitiesUpdated, res.HotelsInserted, res.HotelsSkipped)
+	return nil
+}
@@ -0,0 +1,322 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Настройки, которые можно менять без перезапуска сервера.
+//
+// Значения читаются из переменных окружения; если задана переменная CONFIG_FILE,
+// то из указанного файла формата KEY=VALUE (те же имена, что и у переменных окружения),
+// причём файл имеет приоритет. Окружение процесса после запуска не меняется,
+// поэтому для «горячей» перенастройки правится именно файл, после чего
+// процессу посылается SIGHUP или вызывается POST /api/admin/reload.
+//
+// Новые настройки сначала полностью читаются и проверяются, и только затем
+// подменяются одним атомарным присваиванием: обработчики видят либо старый,
+// либо новый набор целиком. Если в файле ошибка, продолжают действовать старые.
+//
+// Лимиты партнёрских квот хранятся в БД (tenants, api_keys) и применяются
+// сразу, поэтому здесь их нет.
+
+// Settings — набор перенастраиваемых на лету параметров.
+type Settings struct {
+	// Политики кэширования полных списков городов и гостиниц (см. cache.go): весь список
+	// городов в GET /api/cities, лендинги городов, карта, виджет.
+	CitiesCache cachePolicy `json:"cities_cache"`
+	HotelsCache cachePolicy `json:"hotels_cache"`
+	// Политики кэширования страниц GET /api/hotels без фильтров и карточек GET /api/hotels/:id.
+	// Отфильтрованный список читается из БД (см. getAllHotels).
+	HotelListCache cachePolicy `json:"hotel_list_cache"`
+	HotelCache     cachePolicy `json:"hotel_cache"`
+	// Политика кэширования занятости гостиницы по ночам (см. availability.go); бронирования
+	// и отмены сбрасывают записи своей гостиницы сразу.
+	AvailabilityCache cachePolicy `json:"availability_cache"`
+	// Политика кэширования отчёта о воронке конверсии (см. funnel.go).
+	FunnelCache cachePolicy `json:"funnel_cache"`
+	// Политики кэширования прогноза погоды и афиши для страниц городов (см. enrichment.go).
+	WeatherCache    cachePolicy `json:"weather_cache"`
+	CityEventsCache cachePolicy `json:"city_events_cache"`
+	// Политика кэширования открытых данных и лимит запросов к ним в минуту с одного IP (см. opendata.go).
+	OpenDataCache cachePolicy `json:"open_data_cache"`
+	OpenDataRate  int         `json:"open_data_rate"`
+	// Ограничители размера списочных ответов (см. guard.go); 0 — без ограничения.
+	MaxListRows  int `json:"max_list_rows"`
+	MaxListBytes int `json:"max_list_bytes"`
+	// Срок обработки запроса публичного API; он ограничивает запросы к БД, и от него
+	// считаются таймауты внешних провайдеров (см. deadline.go); 0 — без срока.
+	RequestTimeout time.Duration `json:"request_timeout"`
+	// Разрешённые CORS-источники; "*" разрешает любой.
+	CORSOrigins []string `json:"cors_origins"`
+	// Маршруты, на которых ошибки сканирования строк не проваливают запрос (см. scan.go).
+	LenientScanRoutes []string `json:"lenient_scan_routes"`
+	// Период автоматической проверки восстановимости копий (см. drcheck.go); 0 — выключено.
+	DRCheckInterval time.Duration `json:"dr_check_interval"`
+	// Период очистки осиротевших объектов хранилища файлов; 0 — выключено (см. blobstore.go).
+	BlobCleanupInterval time.Duration `json:"blob_cleanup_interval"`
+	// Период проверки подписок на снижение цены (см. pricealerts.go); 0 — выключено.
+	PriceAlertInterval time.Duration `json:"price_alert_interval"`
+	// Срок жизни токена доступа пользователя (см. auth.go).
+	AuthTokenTTL time.Duration `json:"auth_token_ttl"`
+	// Срок жизни токена обновления (см. refresh.go).
+	RefreshTokenTTL time.Duration `json:"refresh_token_ttl"`
+	// Флаги функциональности: FEATURE_FLAGS=a,b,-c включает a и b и выключает c.
+	Features map[string]bool `json:"features"`
+}
+
+var currentSettings atomic.Pointer[Settings]
+
+// settings возвращает действующие настройки.
+func settings() *Settings {
+	return currentSettings.Load()
+}
+
+// featureEnabled сообщает, включён ли флаг функциональности.
+func featureEnabled(name string) bool {
+	return settings().Features[name]
+}
+
+// allowsOrigin сообщает, разрешён ли CORS-запрос с указанного источника.
+func (s *Settings) allowsOrigin(origin string) bool {
+	for _, o := range s.CORSOrigins {
+		if o == "*" || o == origin {
+			return true
+		}
+	}
+	return false
+}
+
+// settingsSource — источник значений: файл конфигурации поверх окружения.
+// Ошибки разбора накапливаются, чтобы сообщить обо всех сразу.
+type settingsSource struct {
+	file map[string]string
+	errs []string
+}
+
+func (s *settingsSource) lookup(name string) string {
+	if v, ok := s.file[name]; ok {
+		return v
+	}
+	return os.Getenv(name)
+}
+
+func (s *settingsSource) string(name, def string) string {
+	if v := strings.TrimSpace(s.lookup(name)); v != "" {
+		return v
+	}
+	return def
+}
+
+func (s *settingsSource) duration(name string, def time.Duration) time.Duration {
+	v := s.lookup(name)
+	if v == "" {
+		return def
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		s.errs = append(s.errs, fmt.Sprintf("%s: %v", name, err))
+		return def
+	}
+	return d
+}
+
+func (s *settingsSource) int(name string, def int) int {
+	v := s.lookup(name)
+	if v == "" {
+		return def
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		s.errs = append(s.errs, fmt.Sprintf("%s: %v", name, err))
+		return def
+	}
+	return n
+}
+
+func (s *settingsSource) list(name string, def []string) []string {
+	v := s.lookup(name)
+	if v == "" {
+		return def
+	}
+	var out []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+// readConfigFile разбирает файл формата KEY=VALUE. Пустые строки и строки с # пропускаются.
+func readConfigFile(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	values := map[string]string{}
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(text, "=")
+		if !ok {
+			return nil, fmt.Errorf("%s:%d: expected KEY=VALUE", path, line)
+		}
+		values[strings.TrimSpace(key)] = strings.Trim(strings.TrimSpace(value), `"`)
+	}
+	return values, scanner.Err()
+}
+
+// loadSettings читает и проверяет настройки, ничего не применяя.
+func loadSettings() (*Settings, error) {
+	src := &settingsSource{}
+	if path := os.Getenv("CONFIG_FILE"); path != "" {
+		values, err := readConfigFile(path)
+		if err != nil {
+			return nil, err
+		}
+		src.file = values
+	}
+
+	s := &Settings{
+		CitiesCache: cachePolicy{
+			TTL:   src.duration("CACHE_CITIES_TTL", 5*time.Minute),
+			Stale: src.duration("CACHE_CITIES_STALE", time.Hour),
+		},
+		HotelsCache: cachePolicy{
+			TTL:   src.duration("CACHE_HOTELS_TTL", 30*time.Second),
+			Stale: src.duration("CACHE_HOTELS_STALE", 5*time.Minute),
+		},
+		HotelListCache: cachePolicy{
+			TTL:   src.duration("CACHE_HOTEL_LIST_TTL", 30*time.Second),
+			Stale: src.duration("CACHE_HOTEL_LIST_STALE", 5*time.Minute),
+		},
+		HotelCache: cachePolicy{
+			TTL:   src.duration("CACHE_HOTEL_TTL", time.Minute),
+			Stale: src.duration("CACHE_HOTEL_STALE", 10*time.Minute),
+		},
+		AvailabilityCache: cachePolicy{
+			TTL:   src.duration("CACHE_AVAILABILITY_TTL", time.Minute),
+			Stale: src.duration("CACHE_AVAILABILITY_STALE", 0),
+		},
+		FunnelCache: cachePolicy{
+			TTL:   src.duration("CACHE_FUNNEL_TTL", 10*time.Minute),
+			Stale: src.duration("CACHE_FUNNEL_STALE", time.Hour),
+		},
+		WeatherCache: cachePolicy{
+			TTL:   src.duration("CACHE_WEATHER_TTL", 30*time.Minute),
+			Stale: src.duration("CACHE_WEATHER_STALE", 6*time.Hour),
+		},
+		CityEventsCache: cachePolicy{
+			TTL:   src.duration("CACHE_CITY_EVENTS_TTL", 6*time.Hour),
+			Stale: src.duration("CACHE_CITY_EVENTS_STALE", 24*time.Hour),
+		},
+		OpenDataCache: cachePolicy{
+			TTL:   src.duration("CACHE_OPEN_DATA_TTL", time.Hour),
+			Stale: src.duration("CACHE_OPEN_DATA_STALE", 24*time.Hour),
+		},
+		OpenDataRate:        src.int("OPEN_DATA_RATE", 60),
+		MaxListRows:         src.int("MAX_LIST_ROWS", 10000),
+		MaxListBytes:        src.int("MAX_LIST_BYTES", 10<<20),
+		RequestTimeout:      src.duration("REQUEST_TIMEOUT", 10*time.Second),
+		CORSOrigins:         src.list("CORS_ORIGINS", []string{"*"}),
+		LenientScanRoutes:   src.list("LENIENT_SCAN_ROUTES", nil),
+		DRCheckInterval:     src.duration("DR_CHECK_INTERVAL", 0),
+		BlobCleanupInterval: src.duration("BLOB_CLEANUP_INTERVAL", 24*time.Hour),
+		PriceAlertInterval:  src.duration("PRICE_ALERT_INTERVAL", time.Hour),
+		AuthTokenTTL:        src.duration("AUTH_TOKEN_TTL", 15*time.Minute),
+		RefreshTokenTTL:     src.duration("REFRESH_TOKEN_TTL", 30*24*time.Hour),
+		Features:            map[string]bool{},
+	}
+	for _, flag := range src.list("FEATURE_FLAGS", nil) {
+		if name, off := strings.CutPrefix(flag, "-"); off {
+			s.Features[name] = false
+		} else {
+			s.Features[flag] = true
+		}
+	}
+
+	if s.MaxListRows < 0 || s.MaxListBytes < 0 {
+		src.errs = append(src.errs, "MAX_LIST_ROWS and MAX_LIST_BYTES must not be negative")
+	}
+	if s.RequestTimeout < 0 {
+		src.errs = append(src.errs, "REQUEST_TIMEOUT must not be negative")
+	}
+	for _, o := range s.CORSOrigins {
+		if u, err := url.Parse(o); o != "*" && (err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.Path != "") {
+			src.errs = append(src.errs, fmt.Sprintf("CORS_ORIGINS: %q is not \"*\" or an origin like https://example.com", o))
+		}
+	}
+	if len(src.errs) > 0 {
+		return nil, fmt.Errorf("invalid settings: %s", strings.Join(src.errs, "; "))
+	}
+	return s, nil
+}
+
+// reloadSettings перечитывает настройки и атомарно применяет их.
+// При ошибке действующие настройки не меняются.
+func reloadSettings() (*Settings, error) {
+	s, err := loadSettings()
+	if err != nil {
+		return nil, err
+	}
+	currentSettings.Store(s)
+	return s, nil
+}
+
+// watchSettingsReload перечитывает настройки по сигналу SIGHUP до отмены ctx. Запускается в отдельной горутине.
+func watchSettingsReload(ctx context.Context) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+		}
+		if _, err := reloadSettings(); err != nil {
+			log.Printf("Settings reload failed, keeping previous settings: %v", err)
+			continue
+		}
+		log.Println("Settings reloaded")
+	}
+}
+
+// reloadSettingsHandler — HTTP-обработчик ручной перезагрузки настроек.
+// Реагирует на POST /api/admin/reload и возвращает применённые настройки.
+func reloadSettingsHandler(c *gin.Context) {
+	s, err := reloadSettings()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Error:   err.Error(),
+			Hint:    "previous settings are still in effect",
+		})
+		return
+	}
+	log.Println("Settings reloaded via admin API")
+	c.JSON(http.StatusOK, Response{
+		Success: true,
+		Data:    s,
+		Count:   1,
+	})
+}
@@ -0,0 +1,367 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Совместный доступ к бронированию.
+//
+// Владелец бронирования (пользователь или тенант, см. bookingOwnerOf) выпускает
+// ссылку со случайным токеном, чтобы попутчики без учётной записи могли посмотреть
+// бронирование, а при разрешении — вписать себя в список гостей. У ссылки есть
+// право (view — только просмотр, guests — ещё и добавление гостей) и срок действия;
+// владелец может отозвать её в любой момент. Гостей в списке вместе с тем, на кого
+// оформлено бронирование, не больше, чем bookings.guests:
+//
+//	booking_shares(token, booking_id, permission, expires_at, revoked, created_at)
+//	booking_guests(id, booking_id, name, email NULL, share_token NULL, created_at)
+
+// bookingShareTokenPrefix — префикс токенов совместного доступа, чтобы их нельзя было
+// спутать с API-ключами и виджет-токенами.
+const bookingShareTokenPrefix = "bs_"
+
+// Права ссылки совместного доступа.
+const (
+	sharePermissionView   = "view"
+	sharePermissionGuests = "guests"
+)
+
+// Срок действия ссылки: по умолчанию и наибольший.
+const (
+	defaultShareTTL = 7 * 24 * time.Hour
+	maxShareTTL     = 90 * 24 * time.Hour
+)
+
+// BookingShare — ссылка совместного доступа к бронированию.
+type BookingShare struct {
+	Token      string    `json:"token"`
+	BookingID  int       `json:"booking_id"`
+	Permission string    `json:"permission"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	Revoked    bool      `json:"revoked"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// BookingGuest — гость бронирования, вписанный попутчиком.
+type BookingGuest struct {
+	ID        int       `json:"id"`
+	Name      string    `json:"name"`
+	Email     *string   `json:"email,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// SharedBooking — бронирование, как его видит попутчик по ссылке.
+type SharedBooking struct {
+	Booking    Booking        `json:"booking"`
+	Permission string         `json:"permission"`
+	ExpiresAt  time.Time      `json:"expires_at"`
+	Guests     []BookingGuest `json:"guests"`
+}
+
+// ownedBooking загружает бронирование владельца запроса по :id. Чужое бронирование не находится (404).
+// При ошибке сам отвечает клиенту.
+func ownedBooking(c *gin.Context) (Booking, bool) {
+	id, ok := bookingIDParam(c)
+	if !ok {
+		return Booking{}, false
+	}
+	owner := bookingOwnerOf(c)
+	b, err := scanBooking(db.QueryRowContext(c.Request.Context(), bookingSelect+" WHERE id = $1 AND "+owner.column+" = $2", id, owner.id))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, Response{Success: false, Error: "booking not found"})
+		return Booking{}, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return Booking{}, false
+	}
+	return b, true
+}
+
+// loadBookingGuests возвращает гостей, вписанных в бронирование попутчиками.
+func loadBookingGuests(ctx context.Context, q interface {
+	QueryContext(context.Context, string, ...interface{}) (*sql.Rows, error)
+}, bookingID int) ([]BookingGuest, error) {
+	rows, err := q.QueryContext(ctx, "SELECT id, name, email, created_at FROM booking_guests WHERE booking_id = $1 ORDER BY id", bookingID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	guests := []BookingGuest{}
+	for rows.Next() {
+		var g BookingGuest
+		if err := rows.Scan(&g.ID, &g.Name, &g.Email, &g.CreatedAt); err != nil {
+			return nil, err
+		}
+		guests = append(guests, g)
+	}
+	return guests, rows.Err()
+}
+
+// createBookingShare — HTTP-обработчик выпуска ссылки совместного доступа.
+// Реагирует на POST /api/bookings/:id/shares с телом {"permission": "guests", "expires_in": "72h"};
+// по умолчанию право view и срок 7 дней.
+func createBookingShare(c *gin.Context) {
+	b, ok := ownedBooking(c)
+	if !ok {
+		return
+	}
+	var body struct {
+		Permission string `json:"permission"`
+		ExpiresIn  string `json:"expires_in"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, Response{Success: false, Error: err.Error()})
+		return
+	}
+	switch body.Permission {
+	case "":
+		body.Permission = sharePermissionView
+	case sharePermissionView, sharePermissionGuests:
+	default:
+		c.JSON(http.StatusBadRequest, Response{Success: false, Error: "permission must be view or guests"})
+		return
+	}
+	ttl := defaultShareTTL
+	if body.ExpiresIn != "" {
+		d, err := time.ParseDuration(body.ExpiresIn)
+		if err != nil || d <= 0 || d > maxShareTTL {
+			c.JSON(http.StatusBadRequest, Response{
+				Success: false,
+				Error:   fmt.Sprintf("expires_in must be a positive duration of at most %s", maxShareTTL),
+			})
+			return
+		}
+		ttl = d
+	}
+	if b.Status != bookingConfirmed {
+		c.JSON(http.StatusConflict, Response{Success: false, Error: fmt.Sprintf("booking is %s and cannot be shared", b.Status)})
+		return
+	}
+
+	raw := make([]byte, 16)
+	if _, err := rand.Read(raw); err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	s := BookingShare{Token: bookingShareTokenPrefix + hex.EncodeToString(raw), BookingID: b.ID, Permission: body.Permission}
+	err := db.QueryRowContext(c.Request.Context(), `
+		INSERT INTO booking_shares (token, booking_id, permission, expires_at)
+		VALUES ($1, $2, $3, now() + $4 * interval '1 second')
+		RETURNING expires_at, created_at
+	`, s.Token, s.BookingID, s.Permission, int64(ttl/time.Second)).Scan(&s.ExpiresAt, &s.CreatedAt)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	c.Header("Location", "/api/shared-bookings/"+s.Token)
+	c.JSON(http.StatusCreated, Response{Success: true, Data: s, Count: 1})
+}
+
+// getBookingShares — HTTP-обработчик списка ссылок бронирования, включая отозванные и истёкшие.
+// Реагирует на GET /api/bookings/:id/shares.
+func getBookingShares(c *gin.Context) {
+	b, ok := ownedBooking(c)
+	if !ok {
+		return
+	}
+	rows, err := db.QueryContext(c.Request.Context(), `
+		SELECT token, booking_id, permission, expires_at, revoked, created_at
+		FROM booking_shares WHERE booking_id = $1 ORDER BY created_at DESC
+	`, b.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	defer rows.Close()
+	shares := []BookingShare{}
+	for rows.Next() {
+		var s BookingShare
+		if err := rows.Scan(&s.Token, &s.BookingID, &s.Permission, &s.ExpiresAt, &s.Revoked, &s.CreatedAt); err != nil {
+			c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+			return
+		}
+		shares = append(shares, s)
+	}
+	if err := rows.Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, Response{Success: true, Data: shares, Count: len(shares)})
+}
+
+// revokeBookingShare — HTTP-обработчик отзыва ссылки.
+// Реагирует на DELETE /api/bookings/:id/shares/:token. Вписанные по ссылке гости остаются.
+func revokeBookingShare(c *gin.Context) {
+	b, ok := ownedBooking(c)
+	if !ok {
+		return
+	}
+	res, err := db.ExecContext(c.Request.Context(), "UPDATE booking_shares SET revoked = true WHERE token = $1 AND booking_id = $2", c.Param("token"), b.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		c.JSON(http.StatusNotFound, Response{Success: false, Error: "share not found"})
+		return
+	}
+	c.JSON(http.StatusOK, Response{Success: true, Data: gin.H{"token": c.Param("token"), "revoked": true}, Count: 1})
+}
+
+// getBookingGuests — HTTP-обработчик списка гостей, вписанных попутчиками.
+// Реагирует на GET /api/bookings/:id/guests.
+func getBookingGuests(c *gin.Context) {
+	b, ok := ownedBooking(c)
+	if !ok {
+		return
+	}
+	guests, err := loadBookingGuests(c.Request.Context(), db, b.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, Response{Success: true, Data: guests, Count: len(guests)})
+}
+
+// activeShare загружает действующую ссылку по :token. Неизвестная, отозванная и истёкшая
+// ссылки неразличимы (404). При ошибке сам отвечает клиенту.
+func activeShare(c *gin.Context) (BookingShare, bool) {
+	token := c.Param("token")
+	if !strings.HasPrefix(token, bookingShareTokenPrefix) {
+		c.JSON(http.StatusNotFound, Response{Success: false, Error: "share not found or expired"})
+		return BookingShare{}, false
+	}
+	var s BookingShare
+	err := db.QueryRowContext(c.Request.Context(), `
+		SELECT token, booking_id, permission, expires_at, revoked, created_at
+		FROM booking_shares WHERE token = $1 AND NOT revoked AND expires_at > now()
+	`, token).Scan(&s.Token, &s.BookingID, &s.Permission, &s.ExpiresAt, &s.Revoked, &s.CreatedAt)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, Response{Success: false, Error: "share not found or expired"})
+		return BookingShare{}, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return BookingShare{}, false
+	}
+	return s, true
+}
+
+// getSharedBooking — HTTP-обработчик просмотра бронирования по ссылке.
+// Реагирует на GET /api/shared-bookings/:token; учётная запись и API-ключ не нужны.
+func getSharedBooking(c *gin.Context) {
+	s, ok := activeShare(c)
+	if !ok {
+		return
+	}
+	b, err := scanBooking(db.QueryRowContext(c.Request.Context(), bookingSelect+" WHERE id = $1", s.BookingID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	guests, err := loadBookingGuests(c.Request.Context(), db, b.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	// Попутчику незачем знать, через какого партнёра и чью учётную запись оформлено бронирование.
+	b.TenantID, b.UserID = nil, nil
+	c.JSON(http.StatusOK, Response{
+		Success: true,
+		Data:    SharedBooking{Booking: b, Permission: s.Permission, ExpiresAt: s.ExpiresAt, Guests: guests},
+		Count:   1,
+	})
+}
+
+// addSharedBookingGuest — HTTP-обработчик добавления гостя по ссылке с правом guests.
+// Реагирует на POST /api/shared-bookings/:token/guests с телом {"name": "Anna Petrova", "email": "anna@example.com"}.
+func addSharedBookingGuest(c *gin.Context) {
+	s, ok := activeShare(c)
+	if !ok {
+		return
+	}
+	if s.Permission != sharePermissionGuests {
+		c.JSON(http.StatusForbidden, Response{Success: false, Error: "this link only allows viewing the booking"})
+		return
+	}
+	var body struct {
+		Name  string `json:"name"`
+		Email string `json:"email"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, Response{Success: false, Error: err.Error()})
+		return
+	}
+	g := BookingGuest{Name: strings.TrimSpace(body.Name)}
+	switch {
+	case g.Name == "":
+		c.JSON(http.StatusBadRequest, Response{Success: false, Error: "name is required"})
+		return
+	case len([]rune(g.Name)) > maxGuestNameLength:
+		c.JSON(http.StatusBadRequest, Response{Success: false, Error: fmt.Sprintf("name must be at most %d characters", maxGuestNameLength)})
+		return
+	}
+	if strings.TrimSpace(body.Email) != "" {
+		email, err := normalizeEmail(body.Email)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, Response{Success: false, Error: err.Error()})
+			return
+		}
+		g.Email = &email
+	}
+
+	tx, err := db.BeginTx(c.Request.Context(), nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	// Блокируем бронирование, чтобы параллельные попутчики не превысили число гостей.
+	b, err := scanBooking(tx.QueryRowContext(c.Request.Context(), bookingSelect+" WHERE id = $1 FOR UPDATE", s.BookingID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	if b.Status != bookingConfirmed {
+		c.JSON(http.StatusConflict, Response{Success: false, Error: fmt.Sprintf("booking is %s", b.Status)})
+		return
+	}
+	var named int
+	if err := tx.QueryRowContext(c.Request.Context(), "SELECT count(*) FROM booking_guests WHERE booking_id = $1", b.ID).Scan(&named); err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	// Гость, на которого оформлено бронирование, тоже занимает место.
+	if named+1 >= b.Guests {
+		c.JSON(http.StatusConflict, Response{
+			Success: false,
+			Error:   fmt.Sprintf("the booking is for %d guests and all of them are already named", b.Guests),
+		})
+		return
+	}
+	err = tx.QueryRowContext(c.Request.Context(), `
+		INSERT INTO booking_guests (booking_id, name, email, share_token)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at
+	`, b.ID, g.Name, g.Email, s.Token).Scan(&g.ID, &g.CreatedAt)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, Response{Success: true, Data: g, Count: 1})
+}
@@ -0,0 +1,412 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+// Человекочитаемые URL: slug для городов и гостиниц.
+//
+// slug генерируется из названия (кириллица транслитерируется) и хранится в
+// cities.slug / hotels.slug (уникальны среди непустых, NULL — ещё не присвоен).
+// Администратор может заменить его вручную. Старые значения не пропадают: они уходят в slug_history,
+// и запрос по старому slug получает 301 с адресом по новому, а не 404:
+//
+//	slug_history(entity, slug, entity_id, created_at), PRIMARY KEY (entity, slug)
+//
+// Присвоить slug всем записям, у которых его нет, можно фоновой задачей
+// POST /api/admin/slugs/backfill.
+
+// maxSlugLength — максимальная длина slug.
+const maxSlugLength = 100
+
+// slugRe — допустимый вид slug: латиница в нижнем регистре, цифры, одиночные дефисы.
+var slugRe = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+// slugEntities — сущности со slug и их таблицы. Имя таблицы подставляется в SQL,
+// поэтому берётся только отсюда.
+var slugEntities = map[string]string{
+	"city":  "cities",
+	"hotel": "hotels",
+}
+
+// translit — транслитерация русских букв для slug.
+var translit = map[rune]string{
+	'а': "a", 'б': "b", 'в': "v", 'г': "g", 'д': "d", 'е': "e", 'ё': "e", 'ж': "zh",
+	'з': "z", 'и': "i", 'й': "y", 'к': "k", 'л': "l", 'м': "m", 'н': "n", 'о': "o",
+	'п': "p", 'р': "r", 'с': "s", 'т': "t", 'у': "u", 'ф': "f", 'х': "kh", 'ц': "ts",
+	'ч': "ch", 'ш': "sh", 'щ': "shch", 'ъ': "", 'ы': "y", 'ь': "", 'э': "e", 'ю': "yu",
+	'я': "ya",
+}
+
+// slugify строит slug из названия: «Гранд Отель Европа» → "grand-otel-evropa".
+func slugify(name string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(name) {
+		switch {
+		case r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)):
+			b.WriteRune(r)
+			dash = false
+		case translit[r] != "":
+			b.WriteString(translit[r])
+			dash = false
+		case r == 'ъ' || r == 'ь':
+			// Знаки не дают звука и не разделяют слова.
+		default:
+			if !dash && b.Len() > 0 {
+				b.WriteByte('-')
+				dash = true
+			}
+		}
+	}
+	slug := strings.TrimSuffix(b.String(), "-")
+	if len(slug) > maxSlugLength {
+		slug = strings.TrimSuffix(slug[:maxSlugLength], "-")
+	}
+	return slug
+}
+
+// uniqueSlug подбирает свободный slug на основе base: base, base-2, base-3, ...
+// Занятым считается slug другой записи той же сущности (текущий или из истории).
+func uniqueSlug(ctx context.Context, tx *sql.Tx, entity, base string, id int) (string, error) {
+	if base == "" {
+		base = entity
+	}
+	for n := 1; ; n++ {
+		candidate := base
+		if n > 1 {
+			candidate = fmt.Sprintf("%s-%d", base, n)
+		}
+		var taken bool
+		err := tx.QueryRowContext(ctx, `
+			SELECT EXISTS (SELECT 1 FROM `+slugEntities[entity]+` WHERE slug = $1 AND id <> $2)
+			    OR EXISTS (SELECT 1 FROM slug_history WHERE entity = $3 AND slug = $1 AND entity_id <> $2)
+		`, candidate, id, entity).Scan(&taken)
+		if err != nil {
+			return "", err
+		}
+		if !taken {
+			return candidate, nil
+		}
+	}
+}
+
+// changeSlug присваивает записи новый slug, а прежний (если был) переносит в историю.
+func changeSlug(ctx context.Context, tx *sql.Tx, entity string, id int, slug string) error {
+	table := slugEntities[entity]
+	var old sql.NullString
+	if err := tx.QueryRowContext(ctx, "SELECT slug FROM "+table+" WHERE id = $1 FOR UPDATE", id).Scan(&old); err != nil {
+		return err
+	}
+	if old.Valid && old.String == slug {
+		return nil
+	}
+	for _, q := range []struct {
+		sql  string
+		args []interface{}
+	}{
+		// Новый владелец slug забирает его из истории (в том числе свой собственный при откате).
+		{"DELETE FROM slug_history WHERE entity = $1 AND slug = $2", []interface{}{entity, slug}},
+		{"UPDATE " + table + " SET slug = $2 WHERE id = $1", []interface{}{id, slug}},
+	} {
+		if _, err := tx.ExecContext(ctx, q.sql, q.args...); err != nil {
+			return err
+		}
+	}
+	if old.Valid {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO slug_history (entity, slug, entity_id) VALUES ($1, $2, $3)
+			ON CONFLICT (entity, slug) DO UPDATE SET entity_id = EXCLUDED.entity_id, created_at = now()
+		`, entity, old.String, id)
+		return err
+	}
+	return nil
+}
+
+// backfillSlugs присваивает slug всем городам и гостиницам, у которых его нет.
+// Число присвоенных по сущностям сообщается через progress.
+func backfillSlugs(progress func(interface{})) (interface{}, error) {
+	ctx := context.Background()
+	assigned := map[string]int{}
+	for entity, table := range slugEntities {
+		rows, err := db.QueryContext(ctx, "SELECT id, name FROM "+table+" WHERE slug IS NULL ORDER BY id")
+		if err != nil {
+			return nil, err
+		}
+		type pending struct {
+			id   int
+			name string
+		}
+		var todo []pending
+		for rows.Next() {
+			var p pending
+			if err := rows.Scan(&p.id, &p.name); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			todo = append(todo, p)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+
+		// По транзакции на запись: долгая задача не держит блокировки на всю таблицу.
+		for _, p := range todo {
+			if err := assignSlug(ctx, entity, p.id, slugify(p.name)); err != nil {
+				return assigned, fmt.Errorf("%s %d: %w", entity, p.id, err)
+			}
+			assigned[entity]++
+			if assigned[entity]%100 == 0 {
+				progress(copyCounts(assigned))
+			}
+		}
+	}
+	cache.flush("cities", "hotels")
+	return assigned, nil
+}
+
+// copyCounts копирует счётчики: в progress нельзя отдавать карту, которую задача продолжает менять.
+func copyCounts(m map[string]int) map[string]int {
+	out := make(map[string]int, len(m))
+	for k, v := range m {
+		out[k] = v
+	}
+	return out
+}
+
+// assignSlug присваивает записи свободный slug на основе base в отдельной транзакции.
+func assignSlug(ctx context.Context, entity string, id int, base string) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := assignSlugIn(ctx, tx, entity, id, base); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// slugAttempts — сколько раз assignSlugIn подбирает slug заново, если его заняли параллельно.
+const slugAttempts = 10
+
+// assignSlugIn подбирает свободный slug на основе base и присваивает его записи внутри tx.
+// Проверка в uniqueSlug и запись не атомарны: параллельная транзакция может занять тот же
+// slug, и запись упадёт на уникальном индексе. Тогда tx откатывается к точке сохранения
+// (остальное, что в ней сделано, сохраняется) и slug подбирается заново — уже с учётом
+// занятого.
+func assignSlugIn(ctx context.Context, tx *sql.Tx, entity string, id int, base string) (string, error) {
+	for attempt := 1; ; attempt++ {
+		if _, err := tx.ExecContext(ctx, "SAVEPOINT assign_slug"); err != nil {
+			return "", err
+		}
+		slug, err := uniqueSlug(ctx, tx, entity, base, id)
+		if err == nil {
+			err = changeSlug(ctx, tx, entity, id, slug)
+		}
+		if isUniqueViolation(err) && attempt < slugAttempts {
+			if _, err := tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT assign_slug"); err != nil {
+				return "", err
+			}
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		_, err = tx.ExecContext(ctx, "RELEASE SAVEPOINT assign_slug")
+		return slug, err
+	}
+}
+
+// isUniqueViolation сообщает, что запись нарушила уникальный индекс.
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
+
+// setSlug возвращает обработчик ручной смены slug для сущности entity.
+// Реагирует на PUT /api/admin/cities/:id/slug и PUT /api/admin/hotels/:id/slug
+// с телом {"slug": "grand-hotel"}; пустой slug — сгенерировать из названия.
+func setSlug(entity string) gin.HandlerFunc {
+	table := slugEntities[entity]
+	parseID := hotelIDParam
+	if entity == "city" {
+		parseID = cityIDParam
+	}
+	return func(c *gin.Context) {
+		id, ok := parseID(c)
+		if !ok {
+			return
+		}
+		var body struct {
+			Slug string `json:"slug"`
+		}
+		if err := c.ShouldBindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, Response{Success: false, Error: err.Error()})
+			return
+		}
+		if body.Slug != "" && (!slugRe.MatchString(body.Slug) || len(body.Slug) > maxSlugLength) {
+			c.JSON(http.StatusBadRequest, Response{
+				Success: false,
+				Error:   "invalid slug",
+				Hint:    fmt.Sprintf("use lowercase latin letters, digits and single dashes, at most %d characters", maxSlugLength),
+			})
+			return
+		}
+
+		tx, err := db.BeginTx(c.Request.Context(), nil)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+			return
+		}
+		defer tx.Rollback()
+
+		var name string
+		err = tx.QueryRowContext(c.Request.Context(), "SELECT name FROM "+table+" WHERE id = $1", id).Scan(&name)
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, Response{Success: false, Error: entity + " not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+			return
+		}
+
+		slug := body.Slug
+		if slug != "" {
+			var taken bool
+			err := tx.QueryRowContext(c.Request.Context(), "SELECT EXISTS (SELECT 1 FROM "+table+" WHERE slug = $1 AND id <> $2)", slug, id).Scan(&taken)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+				return
+			}
+			if taken {
+				c.JSON(http.StatusConflict, Response{Success: false, Error: "slug is already used by another " + entity})
+				return
+			}
+		}
+
+		if body.Slug == "" {
+			slug, err = assignSlugIn(c.Request.Context(), tx, entity, id, slugify(name))
+		} else {
+			err = changeSlug(c.Request.Context(), tx, entity, id, slug)
+		}
+		if isUniqueViolation(err) {
+			// Тот же slug только что занял параллельный запрос.
+			c.JSON(http.StatusConflict, Response{Success: false, Error: "slug is already used by another " + entity})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+			return
+		}
+		if err := tx.Commit(); err != nil {
+			c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+			return
+		}
+		cache.flush(table)
+
+		c.JSON(http.StatusOK, Response{
+			Success: true,
+			Data:    gin.H{"id": id, "slug": slug},
+			Count:   1,
+		})
+	}
+}
+
+// redirectToSlug отвечает 301 на запрос по устаревшему slug, если он есть в истории.
+// Возвращает false, если slug неизвестен и ответ ещё не отправлен.
+// path — шаблон адреса, в который подставляется актуальный slug.
+func redirectToSlug(c *gin.Context, entity, slug, path string) bool {
+	var id int
+	var current sql.NullString
+	err := db.QueryRowContext(c.Request.Context(), `
+		SELECT h.entity_id, e.slug
+		FROM slug_history h
+		JOIN `+slugEntities[entity]+` e ON e.id = h.entity_id
+		WHERE h.entity = $1 AND h.slug = $2
+	`, entity, slug).Scan(&id, &current)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Printf("Error looking up slug history: %v", err)
+		}
+		return false
+	}
+	if !current.Valid {
+		return false
+	}
+
+	location := fmt.Sprintf(path, current.String)
+	c.Header("Location", location)
+	c.JSON(http.StatusMovedPermanently, Response{
+		Success: false,
+		Error:   entity + " has moved",
+		Data:    gin.H{"type": entity, "id": id, "slug": current.String, "location": location},
+		Hint:    "the " + entity + " was renamed; use the new slug",
+	})
+	return true
+}
+
+// getHotelBySlug — HTTP-обработчик, возвращающий опубликованную гостиницу по slug.
+// Реагирует на GET /api/hotels/by-slug/:slug; по устаревшему slug отвечает 301.
+func getHotelBySlug(c *gin.Context) {
+	slug := c.Param("slug")
+	set, err := loadHotelCard(c.Request.Context(), strictScan(c), hotelSelect+" WHERE h.slug = $1 AND "+publishedHotel, slug)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	if len(set.Items) == 0 {
+		if !redirectToSlug(c, "hotel", slug, "/api/hotels/by-slug/%s") {
+			c.JSON(http.StatusNotFound, Response{Success: false, Error: "hotel not found"})
+		}
+		return
+	}
+	respondHotel(c, set.Items[0])
+}
+
+// getCityBySlug — HTTP-обработчик, возвращающий город по slug.
+// Реагирует на GET /api/cities/by-slug/:slug; по устаревшему slug отвечает 301.
+func getCityBySlug(c *gin.Context) {
+	slug := c.Param("slug")
+	var city City
+	err := db.QueryRowContext(c.Request.Context(), citySelect+" WHERE c.slug = $1", slug).Scan(cityFields(&city)...)
+	if err == sql.ErrNoRows {
+		if !redirectToSlug(c, "city", slug, "/api/cities/by-slug/%s") {
+			c.JSON(http.StatusNotFound, Response{Success: false, Error: "city not found"})
+		}
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, Response{
+		Success: true,
+		Data:    city,
+		Count:   1,
+	})
+}
+
+// startSlugBackfill — HTTP-обработчик, запускающий присвоение недостающих slug фоновой задачей.
+// Реагирует на POST /api/admin/slugs/backfill; отвечает 202 с описанием задачи.
+func startSlugBackfill(c *gin.Context) {
+	job := jobs.start("slug-backfill", backfillSlugs)
+	c.JSON(http.StatusAccepted, Response{
+		Success: true,
+		Data:    job,
+		Count:   1,
+	})
+}
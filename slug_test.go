@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/lib/pq"
+)
+
+func TestIsUniqueViolation(t *testing.T) {
+	for _, tc := range []struct {
+		err  error
+		want bool
+	}{
+		{nil, false},
+		{errors.New("duplicate key"), false},
+		{&pq.Error{Code: "23505"}, true},
+		{fmt.Errorf("hotel 3: %w", &pq.Error{Code: "23505"}), true},
+		{&pq.Error{Code: "23503"}, false},
+	} {
+		if got := isUniqueViolation(tc.err); got != tc.want {
+			t.Errorf("%v: got %v, want %v", tc.err, got, tc.want)
+		}
+	}
+}
+
+// Гостиницы с одинаковым названием, которым slug присваивают одновременно, получают разные slug.
+func TestAssignSlugConcurrent(t *testing.T) {
+	testDB(t)
+	moscow := testCity(t, "Moscow")
+	const n = 8
+	ids := make([]int, n)
+	for i := range ids {
+		ids[i] = testHotel(t, "Grand Hotel", moscow, 2, 3000)
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, n)
+	for i, id := range ids {
+		wg.Add(1)
+		go func(i, id int) {
+			defer wg.Done()
+			errs[i] = assignSlug(context.Background(), "hotel", id, "grand-hotel")
+		}(i, id)
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			t.Errorf("hotel %d: %v", ids[i], err)
+		}
+	}
+
+	var distinct, assigned int
+	if err := db.QueryRow("SELECT count(DISTINCT slug), count(slug) FROM hotels").Scan(&distinct, &assigned); err != nil {
+		t.Fatal(err)
+	}
+	if assigned != n || distinct != n {
+		t.Errorf("%d hotels got %d slugs, %d of them distinct", n, assigned, distinct)
+	}
+
+	// Занятый slug не записать и в обход uniqueSlug.
+	_, err := db.Exec("UPDATE hotels SET slug = (SELECT slug FROM hotels WHERE id = $2) WHERE id = $1", ids[0], ids[1])
+	if !isUniqueViolation(err) {
+		t.Errorf("duplicate slug: err = %v, want a unique violation", err)
+	}
+}
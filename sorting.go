@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Сортировка списка гостиниц: ?sort=price&order=desc.
+//
+// Сортировать можно только по колонкам из hotelSortKeys; неизвестная колонка или
+// порядок — 400. Сортирует база: в ORDER BY попадает выражение из hotelSortKeys,
+// а не значение из запроса, поэтому подставить в запрос свой SQL через ?sort= нельзя.
+// Строки сравниваются по правилам сортировки (collation) базы, как и везде в SQL.
+// Без ?sort= порядок прежний — по названию. Гостиницы без значения (например,
+// без цены) всегда идут в конце, при равных значениях — по названию, затем по id,
+// чтобы страницы (см. pagination.go) не перекрывались. Спонсорские позиции
+// (см. promotions.go) расставляются уже в отсортированном списке.
+
+// hotelSortKeys — колонки, по которым можно сортировать, и их выражения в запросах на hotelSelect.
+var hotelSortKeys = map[string]string{
+	"name":      "h.name",
+	"price":     hotelPriceColumn,
+	"capacity":  "h.capacity",
+	"city_name": "c.name",
+}
+
+// HotelSort — разобранные параметры сортировки; пустой Key — порядок по умолчанию.
+type HotelSort struct {
+	Key  string
+	Desc bool
+}
+
+// parseHotelSort разбирает ?sort= и ?order= и отвечает 400 на неизвестные значения.
+func parseHotelSort(c *gin.Context) (HotelSort, bool) {
+	s := HotelSort{Key: c.Query("sort")}
+	if s.Key != "" {
+		if _, ok := hotelSortKeys[s.Key]; !ok {
+			c.JSON(http.StatusBadRequest, Response{
+				Success: false,
+				Error:   fmt.Sprintf("unknown sort column %q", s.Key),
+				Hint:    "sort by one of: name, price, capacity, city_name",
+			})
+			return HotelSort{}, false
+		}
+	}
+	switch order := c.Query("order"); order {
+	case "", "asc":
+	case "desc":
+		s.Desc = true
+	default:
+		c.JSON(http.StatusBadRequest, Response{Success: false, Error: "order must be asc or desc"})
+		return HotelSort{}, false
+	}
+	// ?order=desc без ?sort= переворачивает порядок по умолчанию — по названию.
+	if s.Key == "" && s.Desc {
+		s.Key = "name"
+	}
+	return s, true
+}
+
+// orderBy возвращает предложение ORDER BY для запроса на hotelSelect.
+func (s HotelSort) orderBy() string {
+	expr, ok := hotelSortKeys[s.Key]
+	if !ok {
+		return " ORDER BY h.name, h.id"
+	}
+	dir := "ASC"
+	if s.Desc {
+		dir = "DESC"
+	}
+	return " ORDER BY " + expr + " " + dir + " NULLS LAST, h.name, h.id"
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseHotelSort(t *testing.T) {
+	for _, tc := range []struct {
+		query string
+		want  HotelSort
+	}{
+		{"", HotelSort{}},
+		{"sort=price", HotelSort{Key: "price"}},
+		{"sort=capacity&order=asc", HotelSort{Key: "capacity"}},
+		{"sort=city_name&order=desc", HotelSort{Key: "city_name", Desc: true}},
+		{"order=desc", HotelSort{Key: "name", Desc: true}},
+	} {
+		c, w := testContext("/api/hotels?" + tc.query)
+		got, ok := parseHotelSort(c)
+		if !ok {
+			t.Errorf("%q: rejected with %d: %s", tc.query, w.Code, w.Body)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("%q: got %+v, want %+v", tc.query, got, tc.want)
+		}
+	}
+
+	for _, query := range []string{
+		"sort=password_hash",
+		"sort=h.name",
+		"sort=name%3BDROP%20TABLE%20hotels",
+		"sort=Name",
+		"sort=price&order=random",
+		"order=DESC",
+	} {
+		c, w := testContext("/api/hotels?" + query)
+		if _, ok := parseHotelSort(c); ok {
+			t.Errorf("%q: accepted", query)
+		} else if w.Code != http.StatusBadRequest {
+			t.Errorf("%q: status %d, want 400", query, w.Code)
+		}
+	}
+}
+
+func TestHotelSortOrderBy(t *testing.T) {
+	for _, tc := range []struct {
+		sort HotelSort
+		want string
+	}{
+		{HotelSort{}, " ORDER BY h.name, h.id"},
+		{HotelSort{Key: "price"}, " ORDER BY " + hotelPriceColumn + " ASC NULLS LAST, h.name, h.id"},
+		{HotelSort{Key: "capacity", Desc: true}, " ORDER BY h.capacity DESC NULLS LAST, h.name, h.id"},
+		{HotelSort{Key: "city_name"}, " ORDER BY c.name ASC NULLS LAST, h.name, h.id"},
+		// Ключ не из белого списка в SQL не попадает ни при каких условиях.
+		{HotelSort{Key: "1; DROP TABLE hotels"}, " ORDER BY h.name, h.id"},
+	} {
+		got := tc.sort.orderBy()
+		if got != tc.want {
+			t.Errorf("%+v: got %q, want %q", tc.sort, got, tc.want)
+		}
+		if strings.Contains(got, "DROP") {
+			t.Errorf("%+v: request value leaked into SQL: %q", tc.sort, got)
+		}
+	}
+}
+
+func TestHotelListSorting(t *testing.T) {
+	testDB(t)
+	moscow, kazan := testCity(t, "Moscow"), testCity(t, "Kazan")
+	testHotel(t, "Arbat", moscow, 2, 3000)
+	testHotel(t, "Kremlin View", moscow, 4, 9000)
+	testHotel(t, "Volga", kazan, 6, 2500)
+	noPrice := testHotel(t, "Budget", kazan, 3, 0)
+	testExec(t, "UPDATE hotels SET price = NULL WHERE id = $1", noPrice)
+	router := newPublicRouter()
+
+	for _, tc := range []struct {
+		query string
+		want  []string
+	}{
+		{"", []string{"Arbat", "Budget", "Kremlin View", "Volga"}},
+		{"order=desc", []string{"Volga", "Kremlin View", "Budget", "Arbat"}},
+		{"sort=price", []string{"Volga", "Arbat", "Kremlin View", "Budget"}},
+		// Без цены — в конце и при обратном порядке.
+		{"sort=price&order=desc", []string{"Kremlin View", "Arbat", "Volga", "Budget"}},
+		{"sort=capacity&order=desc", []string{"Volga", "Kremlin View", "Budget", "Arbat"}},
+		// Равные города — по названию гостиницы.
+		{"sort=city_name", []string{"Budget", "Volga", "Arbat", "Kremlin View"}},
+		{"sort=price&max_price=5000", []string{"Volga", "Arbat"}},
+	} {
+		if got := testHotelNames(t, router, "/api/hotels?"+tc.query); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%q: got %v, want %v", tc.query, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// sqlWithoutContext — методы database/sql, у которых есть вариант с контекстом.
+// Вызов без контекста не прерывается ни отменой запроса, ни остановкой сервера.
+var sqlWithoutContext = map[string]string{
+	"Exec":     "ExecContext",
+	"Query":    "QueryContext",
+	"QueryRow": "QueryRowContext",
+	"Begin":    "BeginTx",
+	"Prepare":  "PrepareContext",
+	"Ping":     "PingContext",
+	"Stmt":     "StmtContext",
+}
+
+// Код пакета обращается к БД только методами с контекстом: c.Request.Context()
+// в обработчиках, контекст задачи или фонового цикла в остальном коде.
+func TestSQLCallsTakeContext(t *testing.T) {
+	paths, err := filepath.Glob("*.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fset := token.NewFileSet()
+	var files []*ast.File
+	for _, path := range paths {
+		if strings.HasSuffix(path, "_test.go") {
+			continue
+		}
+		f, err := parser.ParseFile(fset, path, nil, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, f)
+	}
+
+	// Сторонние пакеты importer.Default не находит: ошибки проверки типов пропускаем,
+	// типы database/sql при этом всё равно известны.
+	info := &types.Info{Selections: map[*ast.SelectorExpr]*types.Selection{}}
+	conf := types.Config{Importer: importer.Default(), Error: func(error) {}}
+	conf.Check("main", fset, files, info)
+
+	var sqlCalls int
+	var found []string
+	for sel, s := range info.Selections {
+		if s.Kind() != types.MethodVal || s.Obj().Pkg() == nil || s.Obj().Pkg().Path() != "database/sql" {
+			continue
+		}
+		sqlCalls++
+		if want, ok := sqlWithoutContext[s.Obj().Name()]; ok {
+			found = append(found, fset.Position(sel.Sel.Pos()).String()+": "+s.Obj().Name()+", use "+want)
+		}
+	}
+	if sqlCalls == 0 {
+		t.Fatal("no database/sql calls found, the type check did not resolve them")
+	}
+	sort.Strings(found)
+	for _, f := range found {
+		t.Error(f)
+	}
+}
@@ -0,0 +1,372 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Учёт использования партнёрского API для аналитики и выставления счетов.
+//
+// Писать в БД на каждый запрос дорого, поэтому счётчики сначала копятся в памяти
+// по часовым корзинам и раз в usageFlushInterval сбрасываются в таблицу
+// usage_rollups сразу в двух разрезах — по часам и по дням:
+//
+//	usage_rollups(api_key, tenant_id, granularity, bucket, requests, bytes),
+//	PRIMARY KEY (api_key, granularity, bucket)
+//
+// Цена одного вызова для счёта берётся из tenants.price_per_call.
+
+// usageFlushInterval — как часто накопленные счётчики записываются в БД.
+// При аварийном завершении процесса теряется не более этого интервала данных.
+const usageFlushInterval = time.Minute
+
+// usageFlushTimeout — сколько может длиться один сброс счётчиков, в том числе последний,
+// при остановке сервера, когда контекст фоновой задачи уже отменён.
+const usageFlushTimeout = 10 * time.Second
+
+// usageKey — ключ агрегации в памяти: API-ключ и час, к которому относится запрос.
+type usageKey struct {
+	APIKey   string
+	TenantID int
+	Hour     time.Time
+}
+
+// usageCounter — накопленные значения по одному usageKey.
+type usageCounter struct {
+	Requests int64
+	Bytes    int64
+}
+
+// UsageRow — строка агрегированной статистики в ответе GET /api/admin/usage.
+type UsageRow struct {
+	APIKey      string    `json:"api_key"`
+	TenantID    int       `json:"tenant_id"`
+	Granularity string    `json:"granularity"`
+	Bucket      time.Time `json:"bucket"`
+	Requests    int64     `json:"requests"`
+	Bytes       int64     `json:"bytes"`
+}
+
+// usageMeter — потокобезопасный накопитель счётчиков.
+type usageMeter struct {
+	mu       sync.Mutex
+	counters map[usageKey]*usageCounter
+}
+
+var meter = &usageMeter{counters: map[usageKey]*usageCounter{}}
+
+// add учитывает один запрос указанного ключа с ответом размером bytes.
+func (m *usageMeter) add(k APIKey, bytes int, at time.Time) {
+	key := usageKey{APIKey: k.Key, TenantID: k.TenantID, Hour: at.UTC().Truncate(time.Hour)}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	cnt, ok := m.counters[key]
+	if !ok {
+		cnt = &usageCounter{}
+		m.counters[key] = cnt
+	}
+	cnt.Requests++
+	if bytes > 0 {
+		cnt.Bytes += int64(bytes)
+	}
+}
+
+// flush записывает накопленные счётчики в usage_rollups.
+// Карта подменяется под мьютексом, а запись в БД идёт уже без блокировки,
+// чтобы не задерживать обработку запросов. Если запись не удалась,
+// счётчики возвращаются обратно и будут записаны при следующем сбросе.
+func (m *usageMeter) flush(ctx context.Context) {
+	m.mu.Lock()
+	pending := m.counters
+	m.counters = map[usageKey]*usageCounter{}
+	m.mu.Unlock()
+
+	for key, cnt := range pending {
+		if err := writeUsage(ctx, key, cnt); err != nil {
+			log.Printf("Error flushing usage for tenant %d: %v", key.TenantID, err)
+			m.mu.Lock()
+			if cur, ok := m.counters[key]; ok {
+				cur.Requests += cnt.Requests
+				cur.Bytes += cnt.Bytes
+			} else {
+				m.counters[key] = cnt
+			}
+			m.mu.Unlock()
+		}
+	}
+}
+
+// writeUsage добавляет счётчики в часовую и дневную корзины одной транзакцией,
+// чтобы два разреза не разъезжались между собой.
+func writeUsage(ctx context.Context, key usageKey, cnt *usageCounter) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	buckets := map[string]time.Time{
+		"hour": key.Hour,
+		"day":  key.Hour.Truncate(24 * time.Hour),
+	}
+	for granularity, bucket := range buckets {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO usage_rollups (api_key, tenant_id, granularity, bucket, requests, bytes)
+			VALUES ($1, $2, $3, $4, $5, $6)
+			ON CONFLICT (api_key, granularity, bucket) DO UPDATE
+				SET requests = usage_rollups.requests + EXCLUDED.requests,
+				    bytes = usage_rollups.bytes + EXCLUDED.bytes
+		`, key.APIKey, key.TenantID, granularity, bucket, cnt.Requests, cnt.Bytes)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// runUsageFlusher периодически сбрасывает счётчики в БД. Запускается в отдельной горутине.
+// При отмене ctx сбрасывает накопленное в последний раз, чтобы при остановке сервера
+// не потерять учёт последних запросов.
+func runUsageFlusher(ctx context.Context) {
+	ticker := time.NewTicker(usageFlushInterval)
+	defer ticker.Stop()
+	flush := func(ctx context.Context) {
+		ctx, cancel := context.WithTimeout(ctx, usageFlushTimeout)
+		defer cancel()
+		meter.flush(ctx)
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			flush(context.WithoutCancel(ctx))
+			return
+		case <-ticker.C:
+			flush(ctx)
+		}
+	}
+}
+
+// usageMiddleware учитывает запросы с API-ключом и объём отданных данных.
+// Должен стоять после quotaMiddleware: ключ берётся из контекста запроса.
+func usageMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		if v, ok := c.Get("api_key"); ok {
+			meter.add(v.(APIKey), c.Writer.Size(), time.Now())
+		}
+	}
+}
+
+// getUsage — HTTP-обработчик статистики использования API.
+// Реагирует на GET /api/admin/usage?tenant_id=&granularity=hour|day&from=&to=
+// Даты from/to передаются в формате RFC 3339 или YYYY-MM-DD; по умолчанию — последние 30 дней.
+func getUsage(c *gin.Context) {
+	strict := strictScan(c)
+	granularity := c.DefaultQuery("granularity", "day")
+	if granularity != "hour" && granularity != "day" {
+		c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Error:   "granularity must be 'hour' or 'day'",
+		})
+		return
+	}
+
+	now := time.Now().UTC()
+	from, err := parseTimeParam(c.Query("from"), now.AddDate(0, 0, -30))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, Response{Success: false, Error: "invalid from: " + err.Error()})
+		return
+	}
+	to, err := parseTimeParam(c.Query("to"), now)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, Response{Success: false, Error: "invalid to: " + err.Error()})
+		return
+	}
+
+	// tenant_id необязателен: 0 означает «все тенанты».
+	tenantID, err := strconv.Atoi(c.DefaultQuery("tenant_id", "0"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, Response{Success: false, Error: "tenant_id must be an integer"})
+		return
+	}
+
+	rows, err := db.QueryContext(c.Request.Context(), `
+		SELECT api_key, tenant_id, granularity, bucket, requests, bytes
+		FROM usage_rollups
+		WHERE granularity = $1 AND bucket >= $2 AND bucket < $3
+		  AND ($4 = 0 OR tenant_id = $4)
+		ORDER BY bucket, tenant_id, api_key
+	`, granularity, from, to, tenantID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+	defer rows.Close()
+
+	usage := []UsageRow{}
+	partial := false
+	for rows.Next() {
+		var u UsageRow
+		if err := rows.Scan(&u.APIKey, &u.TenantID, &u.Granularity, &u.Bucket, &u.Requests, &u.Bytes); err != nil {
+			if err := scanFailed(strict, "usage row", err); err != nil {
+				c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+				return
+			}
+			partial = true
+			continue
+		}
+		usage = append(usage, u)
+	}
+	if err := rows.Err(); err != nil {
+		if err := iterationFailed(strict, "usage row", err); err != nil {
+			c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+			return
+		}
+		partial = true
+	}
+
+	c.JSON(http.StatusOK, Response{
+		Success: true,
+		Data:    usage,
+		Count:   len(usage),
+		Partial: partial,
+	})
+}
+
+// usageInvoiceRow — строка выгрузки использования для счёта: один API-ключ за месяц.
+type usageInvoiceRow struct {
+	TenantID   int
+	TenantName string
+	Plan       string
+	APIKey     string
+	Requests   int64
+	Bytes      int64
+	// Цена и сумма — десятичные строки numeric из БД: через float64 копейки счёта поплыли бы.
+	PricePerCall string
+	Amount       string
+}
+
+// loadUsageInvoice читает использование по API-ключам за [start, end) для выгрузки.
+func loadUsageInvoice(ctx context.Context, strict bool, start, end time.Time) (rowSet[usageInvoiceRow], error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT t.id, t.name, t.plan, u.api_key, SUM(u.requests), SUM(u.bytes),
+		       t.price_per_call::text, round(SUM(u.requests) * t.price_per_call, 2)::text
+		FROM usage_rollups u
+		JOIN tenants t ON t.id = u.tenant_id
+		WHERE u.granularity = 'day' AND u.bucket >= $1 AND u.bucket < $2
+		GROUP BY t.id, t.name, t.plan, u.api_key, t.price_per_call
+		ORDER BY t.id, u.api_key
+	`, start, end)
+	if err != nil {
+		return rowSet[usageInvoiceRow]{}, err
+	}
+	defer rows.Close()
+
+	set := rowSet[usageInvoiceRow]{Items: []usageInvoiceRow{}}
+	for rows.Next() {
+		var r usageInvoiceRow
+		if err := rows.Scan(&r.TenantID, &r.TenantName, &r.Plan, &r.APIKey, &r.Requests, &r.Bytes, &r.PricePerCall, &r.Amount); err != nil {
+			if err := scanFailed(strict, "usage export row", err); err != nil {
+				return rowSet[usageInvoiceRow]{}, err
+			}
+			set.Partial = true
+			continue
+		}
+		set.Items = append(set.Items, r)
+	}
+	if err := rows.Err(); err != nil {
+		if err := iterationFailed(strict, "usage export row", err); err != nil {
+			return rowSet[usageInvoiceRow]{}, err
+		}
+		set.Partial = true
+	}
+	return set, nil
+}
+
+// usageTruncatedMarker — последняя строка неполной выгрузки: по такому файлу счёт выставлять нельзя.
+const usageTruncatedMarker = "# TRUNCATED: some usage rows could not be read, do not invoice from this file"
+
+// exportUsage — выгрузка использования за месяц в CSV для выставления счетов.
+// Реагирует на GET /api/admin/usage/export?month=YYYY-MM (по умолчанию — текущий месяц).
+// Одна строка — один API-ключ; amount = requests * price_per_call тенанта, округлённое
+// до копеек. Сумма считается в numeric на стороне БД, без двоичной плавающей точки.
+//
+// По счёту выставляются деньги, поэтому молча пропущенная строка недопустима. Выгрузка
+// сначала читается целиком (строк в ней — по числу ключей) и только потом пишется:
+// в строгом режиме ошибка чтения даёт 500 до того, как отправлены заголовки CSV.
+// В мягком (LENIENT_SCAN_ROUTES) неполный файл помечается заголовком X-Partial-Result
+// и последней строкой usageTruncatedMarker — заголовок теряется при сохранении файла.
+func exportUsage(c *gin.Context) {
+	start, _ := currentPeriod(time.Now())
+	if m := c.Query("month"); m != "" {
+		t, err := time.Parse("2006-01", m)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, Response{Success: false, Error: "month must be in YYYY-MM format"})
+			return
+		}
+		start = t
+	}
+	end := start.AddDate(0, 1, 0)
+
+	set, err := loadUsageInvoice(c.Request.Context(), strictScan(c), start, end)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=usage-%s.csv", start.Format("2006-01")))
+	if set.Partial {
+		c.Header("X-Partial-Result", "true")
+	}
+
+	w := csv.NewWriter(c.Writer)
+	w.Write([]string{"tenant_id", "tenant_name", "plan", "api_key", "requests", "bytes", "price_per_call", "amount"})
+	for _, r := range set.Items {
+		w.Write([]string{
+			strconv.Itoa(r.TenantID),
+			r.TenantName,
+			r.Plan,
+			r.APIKey,
+			strconv.FormatInt(r.Requests, 10),
+			strconv.FormatInt(r.Bytes, 10),
+			r.PricePerCall,
+			r.Amount,
+		})
+	}
+	if set.Partial {
+		w.Write([]string{usageTruncatedMarker})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		log.Printf("Error writing usage export: %v", err)
+	}
+}
+
+// parseTimeParam разбирает дату из query-параметра (RFC 3339 или YYYY-MM-DD).
+// Пустая строка — значение по умолчанию def.
+func parseTimeParam(s string, def time.Time) (time.Time, error) {
+	if s == "" {
+		return def, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	return time.Parse("2006-01-02", s)
+}
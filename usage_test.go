@@ -0,0 +1,117 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testLenientRoutes отключает строгий режим сканирования для маршрутов routes до конца теста.
+func testLenientRoutes(t *testing.T, routes string) {
+	t.Helper()
+	t.Setenv("LENIENT_SCAN_ROUTES", routes)
+	if _, err := reloadSettings(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if _, err := reloadSettings(); err != nil {
+			t.Error(err)
+		}
+	})
+}
+
+// testUsage записывает дневную корзину использования ключа key за день day.
+func testUsage(t *testing.T, key string, tenantID int, day time.Time, requests int64) {
+	t.Helper()
+	testExec(t, `INSERT INTO usage_rollups (api_key, tenant_id, granularity, bucket, requests, bytes)
+		VALUES ($1, $2, 'day', $3, $4, 0)`, key, tenantID, day, requests)
+}
+
+func TestExportUsage(t *testing.T) {
+	testDB(t)
+	t.Setenv("ADMIN_TOKEN", "admin-token")
+	month := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	tenant := testAPIKey(t, "key-a", "pro", 1000)
+	testExec(t, "UPDATE tenants SET price_per_call = 0.0150 WHERE id = $1", tenant)
+	testUsage(t, "key-a", tenant, month, 100)
+	testUsage(t, "key-a", tenant, month.AddDate(0, 0, 1), 34)
+
+	w := serve(newAdminRouter(), "GET", "/api/admin/usage/export?month=2024-03", "", "Authorization", bearerPrefix+"admin-token")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	want := "tenant_id,tenant_name,plan,api_key,requests,bytes,price_per_call,amount\n" +
+		"1,tenant key-a,pro,key-a,134,0,0.0150,2.01\n"
+	if got := w.Body.String(); got != want {
+		t.Errorf("CSV:\n%s\nwant\n%s", got, want)
+	}
+}
+
+// Сумма считается точно: в float64 0.1 * 3 даёт 0.30000000000000004, а большие счета теряют копейки.
+func TestExportUsageExactAmount(t *testing.T) {
+	testDB(t)
+	t.Setenv("ADMIN_TOKEN", "admin-token")
+	month := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	small := testAPIKey(t, "key-a", "pro", 1000)
+	testExec(t, "UPDATE tenants SET price_per_call = 0.1 WHERE id = $1", small)
+	testUsage(t, "key-a", small, month, 3)
+	// 0.0005 * 12350 = 6.175: половина копейки округляется вверх.
+	half := testAPIKey(t, "key-b", "pro", 1000)
+	testExec(t, "UPDATE tenants SET price_per_call = 0.0005 WHERE id = $1", half)
+	testUsage(t, "key-b", half, month, 12350)
+	huge := testAPIKey(t, "key-c", "pro", 1000)
+	testExec(t, "UPDATE tenants SET price_per_call = 0.0001 WHERE id = $1", huge)
+	testUsage(t, "key-c", huge, month, 90_071_992_547_409_930)
+
+	w := serve(newAdminRouter(), "GET", "/api/admin/usage/export?month=2024-03", "", "Authorization", bearerPrefix+"admin-token")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	for _, line := range []string{
+		",key-a,3,0,0.1000,0.30\n",
+		",key-b,12350,0,0.0005,6.18\n",
+		",key-c,90071992547409930,0,0.0001,9007199254740.99\n",
+	} {
+		if !strings.Contains(w.Body.String(), line) {
+			t.Errorf("CSV has no %q:\n%s", line, w.Body)
+		}
+	}
+}
+
+// Строку, которую не удалось прочитать, нельзя молча выбросить из счёта.
+func TestExportUsageScanFailure(t *testing.T) {
+	testDB(t)
+	t.Setenv("ADMIN_TOKEN", "admin-token")
+	month := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	good := testAPIKey(t, "key-a", "pro", 1000)
+	testUsage(t, "key-a", good, month, 10)
+	// Сумма за месяц не помещается в int64: строка не сканируется.
+	bad := testAPIKey(t, "key-b", "pro", 1000)
+	testUsage(t, "key-b", bad, month, 9_000_000_000_000_000_000)
+	testUsage(t, "key-b", bad, month.AddDate(0, 0, 1), 9_000_000_000_000_000_000)
+	const target = "/api/admin/usage/export?month=2024-03"
+
+	w := serve(newAdminRouter(), "GET", target, "", "Authorization", bearerPrefix+"admin-token")
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("strict: status %d, want 500: %s", w.Code, w.Body)
+	}
+	if strings.Contains(w.Body.String(), "tenant_id,") || strings.HasPrefix(w.Header().Get("Content-Type"), "text/csv") {
+		t.Errorf("strict: CSV was started before the failure: %s", w.Body)
+	}
+
+	testLenientRoutes(t, "/api/admin/usage/export")
+	w = serve(newAdminRouter(), "GET", target, "", "Authorization", bearerPrefix+"admin-token")
+	if w.Code != http.StatusOK {
+		t.Fatalf("lenient: status %d: %s", w.Code, w.Body)
+	}
+	if w.Header().Get("X-Partial-Result") != "true" {
+		t.Errorf("lenient: truncated CSV is not marked: %v", w.Header())
+	}
+	if !strings.Contains(w.Body.String(), "key-a") || strings.Contains(w.Body.String(), "key-b") {
+		t.Errorf("lenient: %s", w.Body)
+	}
+	if !strings.HasSuffix(w.Body.String(), usageTruncatedMarker+"\n") {
+		t.Errorf("lenient: truncated CSV has no trailer: %s", w.Body)
+	}
+}
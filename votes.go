@@ -0,0 +1,150 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Голосование за полезность вопросов и ответов (см. questions.go).
+//
+// Голос — +1 (up) или −1 (down); от одной сессии (session_id, учётных записей у
+// посетителей нет) на вопрос или ответ учитывается один голос, повторный заменяет
+// прежний. Сумма голосов денормализована в helpful_votes самого вопроса или ответа,
+// чтобы списки сортировались без агрегации:
+//
+//	qa_votes(entity, entity_id, session_id, ip, value, created_at), PRIMARY KEY (entity, entity_id, session_id)
+//
+// Защита от накруток: частота голосов с IP ограничена votesPerMinute, а с одного IP
+// за один вопрос или ответ принимается не больше votesPerIPPerEntity голосов — новые
+// session_id клиент может выдумывать сколько угодно, адрес сменить сложнее.
+
+// votesPerMinute — сколько голосов в минуту принимается с одного IP.
+const votesPerMinute = 30
+
+// votesPerIPPerEntity — сколько голосов (из разных сессий) за один объект принимается с одного IP.
+const votesPerIPPerEntity = 3
+
+var voteLimiter = newIPLimiter()
+
+// voteTables — таблицы, за строки которых можно голосовать.
+var voteTables = map[string]string{
+	"question": "hotel_questions",
+	"answer":   "hotel_answers",
+}
+
+// voteValues — допустимые голоса.
+var voteValues = map[string]int{"up": 1, "down": -1}
+
+// voteHandler возвращает обработчик голосования за объект вида entity.
+// Реагирует на POST /api/questions/:id/vote и POST /api/answers/:id/vote
+// с телом {"vote": "up", "session_id": "3f2a9c"}.
+func voteHandler(entity string) gin.HandlerFunc {
+	// Имя таблицы подставляется в SQL, поэтому допускаются только известные виды.
+	table, ok := voteTables[entity]
+	if !ok {
+		panic("unknown vote entity " + entity)
+	}
+	return func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, Response{Success: false, Error: entity + " id must be an integer"})
+			return
+		}
+		var body struct {
+			Vote      string `json:"vote"`
+			SessionID string `json:"session_id"`
+		}
+		if err := c.ShouldBindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, Response{Success: false, Error: err.Error()})
+			return
+		}
+		value, ok := voteValues[body.Vote]
+		if !ok {
+			c.JSON(http.StatusBadRequest, Response{Success: false, Error: `vote must be "up" or "down"`})
+			return
+		}
+		if body.SessionID == "" || len(body.SessionID) > 128 {
+			c.JSON(http.StatusBadRequest, Response{Success: false, Error: "session_id is required and must be at most 128 characters"})
+			return
+		}
+		ip := c.ClientIP()
+		if ok, reset := voteLimiter.allow(ip, votesPerMinute); !ok {
+			c.Header("Retry-After", strconv.Itoa(int(time.Until(reset).Seconds())+1))
+			c.JSON(http.StatusTooManyRequests, Response{Success: false, Error: "too many votes, try again later"})
+			return
+		}
+
+		tx, err := db.BeginTx(c.Request.Context(), nil)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+			return
+		}
+		defer tx.Rollback()
+
+		// Блокируем объект: параллельные голоса должны менять счётчик по очереди.
+		var exists bool
+		err = tx.QueryRowContext(c.Request.Context(), "SELECT true FROM "+table+" WHERE id = $1 FOR UPDATE", id).Scan(&exists)
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, Response{Success: false, Error: entity + " not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+			return
+		}
+
+		var previous int
+		err = tx.QueryRowContext(c.Request.Context(), `
+			SELECT value FROM qa_votes WHERE entity = $1 AND entity_id = $2 AND session_id = $3
+		`, entity, id, body.SessionID).Scan(&previous)
+		if err != nil && err != sql.ErrNoRows {
+			c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+			return
+		}
+		if err == sql.ErrNoRows {
+			// Новый голос: проверяем, не голосуют ли с этого адреса от имени многих сессий.
+			var fromIP int
+			if err := tx.QueryRowContext(c.Request.Context(), `
+				SELECT count(*) FROM qa_votes WHERE entity = $1 AND entity_id = $2 AND ip = $3
+			`, entity, id, ip).Scan(&fromIP); err != nil {
+				c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+				return
+			}
+			if fromIP >= votesPerIPPerEntity {
+				c.JSON(http.StatusTooManyRequests, Response{Success: false, Error: "too many votes for this " + entity + " from your network"})
+				return
+			}
+		}
+
+		if _, err := tx.ExecContext(c.Request.Context(), `
+			INSERT INTO qa_votes (entity, entity_id, session_id, ip, value)
+			VALUES ($1, $2, $3, $4, $5)
+			ON CONFLICT (entity, entity_id, session_id) DO UPDATE
+				SET value = EXCLUDED.value, ip = EXCLUDED.ip, created_at = now()
+		`, entity, id, body.SessionID, ip, value); err != nil {
+			c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+			return
+		}
+		var helpful int
+		if err := tx.QueryRowContext(c.Request.Context(),
+			"UPDATE "+table+" SET helpful_votes = helpful_votes + $2 WHERE id = $1 RETURNING helpful_votes",
+			id, value-previous,
+		).Scan(&helpful); err != nil {
+			c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+			return
+		}
+		if err := tx.Commit(); err != nil {
+			c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, Response{
+			Success: true,
+			Data:    gin.H{"id": id, "vote": body.Vote, "helpful_votes": helpful},
+			Count:   1,
+		})
+	}
+}
@@ -0,0 +1,391 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+// Встраиваемый виджет «гостиницы в городе» для сайтов партнёров.
+//
+// Виджет работает прямо в браузере посетителя партнёрского сайта, поэтому API-ключ
+// ему не подходит (его увидит любой). Вместо ключа партнёр получает виджет-токен,
+// привязанный к списку своих доменов: запрос с токеном принимается только с этих
+// источников (Origin, а если его нет — Referer). Общий CORS (CORS_ORIGINS) на /api/widget
+// не распространяется — разрешённые источники у каждого токена свои.
+//
+//	widget_tokens(token, tenant_id, origins text[], config jsonb, revoked, created_at)
+//
+// В origins — источники вида "https://example.com"; "https://*.example.com" разрешает
+// поддомены. config — произвольные настройки оформления (цвета, число карточек и т. п.),
+// которые виджет получает вместе с данными, чтобы не хранить их у себя.
+// Запросы виджета квоту тенанта не расходуют: их число зависит от посещаемости
+// партнёрского сайта, а не от партнёра.
+
+// widgetTokenPrefix — префикс виджет-токенов, чтобы их нельзя было спутать с API-ключами.
+const widgetTokenPrefix = "wt_"
+
+// widgetConfigLimit — максимальный размер настроек токена в байтах.
+const widgetConfigLimit = 4 << 10
+
+// Сколько гостиниц отдаёт виджет: по умолчанию и максимум.
+const (
+	widgetDefaultLimit = 10
+	widgetMaxLimit     = 50
+)
+
+// WidgetToken — виджет-токен партнёра.
+type WidgetToken struct {
+	Token     string          `json:"token"`
+	TenantID  int             `json:"tenant_id"`
+	Origins   []string        `json:"origins"`
+	Config    json.RawMessage `json:"config"`
+	Revoked   bool            `json:"revoked"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// WidgetHotel — компактная карточка гостиницы для виджета: только то, что он показывает.
+// Пустые поля не передаются, чтобы ответ оставался маленьким.
+type WidgetHotel struct {
+	ID    int      `json:"id"`
+	Name  string   `json:"n"`
+	Slug  string   `json:"s,omitempty"`
+	Price *float64 `json:"p,omitempty"`
+	Promo bool     `json:"ad,omitempty"`
+}
+
+// widgetTokenCacheKey — ключ токена в кэше; токен проверяется на каждый показ виджета.
+func widgetTokenCacheKey(token string) string {
+	return "widget-token:" + token
+}
+
+// lookupWidgetToken читает действующий токен. Возвращает sql.ErrNoRows, если токен
+// неизвестен или отозван.
+func lookupWidgetToken(ctx context.Context, token string) (WidgetToken, error) {
+	t := WidgetToken{Token: token}
+	var config []byte
+	err := db.QueryRowContext(ctx, `
+		SELECT tenant_id, origins, config, created_at
+		FROM widget_tokens
+		WHERE token = $1 AND NOT revoked
+	`, token).Scan(&t.TenantID, pq.Array(&t.Origins), &config, &t.CreatedAt)
+	t.Config = config
+	return t, err
+}
+
+// originAllowed сообщает, входит ли источник в список разрешённых токеном.
+func (t WidgetToken) originAllowed(origin string) bool {
+	u, err := url.Parse(origin)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	for _, allowed := range t.Origins {
+		a, err := url.Parse(allowed)
+		if err != nil || a.Scheme != u.Scheme {
+			continue
+		}
+		if a.Host == u.Host {
+			return true
+		}
+		if suffix := strings.TrimPrefix(a.Host, "*"); suffix != a.Host && strings.HasSuffix(u.Host, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// requestOrigin возвращает источник запроса: Origin, а без него — схему и хост из Referer.
+func requestOrigin(c *gin.Context) string {
+	if origin := c.GetHeader("Origin"); origin != "" {
+		return origin
+	}
+	if u, err := url.Parse(c.GetHeader("Referer")); err == nil && u.Host != "" {
+		return u.Scheme + "://" + u.Host
+	}
+	return ""
+}
+
+// skipForWidget пропускает маршруты виджета мимо общего middleware (CORS с CORS_ORIGINS):
+// для них источники проверяет widgetMiddleware по токену.
+func skipForWidget(next gin.HandlerFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if strings.HasPrefix(c.Request.URL.Path, "/api/widget/") {
+			c.Next()
+			return
+		}
+		next(c)
+	}
+}
+
+// widgetMiddleware проверяет виджет-токен (параметр ?token=) и источник запроса
+// и выставляет CORS-заголовки для этого источника. Токен передаётся в адресе, а не
+// в заголовке, чтобы GET-запрос виджета оставался простым и обходился без preflight.
+func widgetMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		reject := func(status int, msg string) {
+			c.AbortWithStatusJSON(status, Response{Success: false, Error: msg})
+		}
+
+		token := c.Query("token")
+		if !strings.HasPrefix(token, widgetTokenPrefix) {
+			reject(http.StatusUnauthorized, "widget token is required")
+			return
+		}
+		value, _, err := cache.get(c.Request.Context(), widgetTokenCacheKey(token), settings().HotelsCache, func(ctx context.Context) (interface{}, error) {
+			return lookupWidgetToken(ctx, token)
+		})
+		if err == sql.ErrNoRows {
+			reject(http.StatusUnauthorized, "invalid or revoked widget token")
+			return
+		}
+		if err != nil {
+			reject(http.StatusInternalServerError, err.Error())
+			return
+		}
+		t := value.(WidgetToken)
+
+		origin := requestOrigin(c)
+		if !t.originAllowed(origin) {
+			reject(http.StatusForbidden, "origin is not allowed for this widget token")
+			return
+		}
+		c.Header("Access-Control-Allow-Origin", origin)
+		c.Header("Vary", "Origin")
+		if c.Request.Method == http.MethodOptions {
+			c.Header("Access-Control-Allow-Methods", "GET, OPTIONS")
+			c.Header("Access-Control-Max-Age", "86400")
+			c.AbortWithStatus(http.StatusNoContent)
+			return
+		}
+		c.Set("widget_token", t)
+		c.Next()
+	}
+}
+
+// getWidgetHotels — HTTP-обработчик данных виджета.
+// Реагирует на GET /api/widget/hotels?token=...&city_id=1&limit=10
+// и отдаёт настройки токена и компактный список опубликованных гостиниц города.
+func getWidgetHotels(c *gin.Context) {
+	t := c.MustGet("widget_token").(WidgetToken)
+
+	cityID, err := strconv.Atoi(c.Query("city_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, Response{Success: false, Error: "city_id must be an integer"})
+		return
+	}
+	limit := widgetDefaultLimit
+	if v := c.Query("limit"); v != "" {
+		if limit, err = strconv.Atoi(v); err != nil || limit < 1 || limit > widgetMaxLimit {
+			c.JSON(http.StatusBadRequest, Response{
+				Success: false,
+				Error:   "limit must be between 1 and " + strconv.Itoa(widgetMaxLimit),
+			})
+			return
+		}
+	}
+
+	strict := strictScan(c)
+	hotels, status, err := cache.get(c.Request.Context(), "hotels", settings().HotelsCache, func(ctx context.Context) (interface{}, error) {
+		return loadHotels(ctx, strict)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	c.Header("X-Cache", status)
+
+	// Тот же порядок, что и в GET /api/hotels, включая спонсорские позиции.
+	list := hotels.(rowSet[Hotel]).Items
+	if promos, _, err := cache.get(c.Request.Context(), promotionsCacheKey, settings().HotelsCache, func(ctx context.Context) (interface{}, error) {
+		return loadActivePromotions(ctx, strict)
+	}); err == nil {
+		list = interleaveSponsored(list, scopePromotions(promos.([]Promotion), &cityID))
+	}
+	list = applyMarket(c, list)
+
+	items := make([]WidgetHotel, 0, limit)
+	for _, h := range list {
+		if h.CityID == nil || *h.CityID != cityID {
+			continue
+		}
+		w := WidgetHotel{ID: h.ID, Name: h.Name, Price: h.Price, Promo: h.IsSponsored}
+		if h.Slug != nil {
+			w.Slug = *h.Slug
+		}
+		items = append(items, w)
+		if len(items) == limit {
+			break
+		}
+	}
+
+	// Виджет показывается на каждой странице партнёра: даём браузеру и CDN кэшировать ответ.
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, Response{
+		Success: true,
+		Data:    gin.H{"config": t.Config, "hotels": items},
+		Count:   len(items),
+	})
+}
+
+// widgetTokenRequest — тело создания токена и изменения его настроек.
+type widgetTokenRequest struct {
+	TenantID int             `json:"tenant_id"`
+	Origins  []string        `json:"origins"`
+	Config   json.RawMessage `json:"config"`
+}
+
+// validate проверяет источники и настройки. Возвращает текст ошибки или пустую строку.
+func (r *widgetTokenRequest) validate() string {
+	if len(r.Origins) == 0 {
+		return "at least one origin is required"
+	}
+	for _, o := range r.Origins {
+		u, err := url.Parse(o)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.Path != "" {
+			return "origin " + strconv.Quote(o) + " must look like https://example.com or https://*.example.com"
+		}
+	}
+	if len(r.Config) == 0 {
+		r.Config = json.RawMessage("{}")
+	}
+	if len(r.Config) > widgetConfigLimit {
+		return "config must not exceed " + strconv.Itoa(widgetConfigLimit) + " bytes"
+	}
+	var obj map[string]interface{}
+	if err := json.Unmarshal(r.Config, &obj); err != nil {
+		return "config must be a JSON object"
+	}
+	return ""
+}
+
+// getWidgetTokens — HTTP-обработчик списка виджет-токенов.
+// Реагирует на GET /api/admin/widget-tokens?tenant_id=1 (без tenant_id — все токены).
+func getWidgetTokens(c *gin.Context) {
+	tenantID, _ := strconv.Atoi(c.Query("tenant_id"))
+	rows, err := db.QueryContext(c.Request.Context(), `
+		SELECT token, tenant_id, origins, config, revoked, created_at
+		FROM widget_tokens
+		WHERE $1 = 0 OR tenant_id = $1
+		ORDER BY created_at DESC
+	`, tenantID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	tokens := []WidgetToken{}
+	for rows.Next() {
+		var t WidgetToken
+		var config []byte
+		if err := rows.Scan(&t.Token, &t.TenantID, pq.Array(&t.Origins), &config, &t.Revoked, &t.CreatedAt); err != nil {
+			c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+			return
+		}
+		t.Config = config
+		tokens = append(tokens, t)
+	}
+	if err := rows.Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, Response{Success: true, Data: tokens, Count: len(tokens)})
+}
+
+// createWidgetToken — HTTP-обработчик выпуска виджет-токена.
+// Реагирует на POST /api/admin/widget-tokens с телом
+// {"tenant_id": 1, "origins": ["https://partner.example"], "config": {"theme": "dark"}}.
+func createWidgetToken(c *gin.Context) {
+	var body widgetTokenRequest
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, Response{Success: false, Error: err.Error()})
+		return
+	}
+	if msg := body.validate(); msg != "" {
+		c.JSON(http.StatusBadRequest, Response{Success: false, Error: msg})
+		return
+	}
+
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	t := WidgetToken{Token: widgetTokenPrefix + hex.EncodeToString(b), TenantID: body.TenantID, Origins: body.Origins, Config: body.Config}
+	err := db.QueryRowContext(c.Request.Context(), `
+		INSERT INTO widget_tokens (token, tenant_id, origins, config)
+		SELECT $1, id, $3, $4 FROM tenants WHERE id = $2
+		RETURNING created_at
+	`, t.Token, t.TenantID, pq.Array(t.Origins), []byte(t.Config)).Scan(&t.CreatedAt)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusBadRequest, Response{Success: false, Error: "tenant not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, Response{Success: true, Data: t, Count: 1})
+}
+
+// updateWidgetToken — HTTP-обработчик изменения источников и настроек токена.
+// Реагирует на PUT /api/admin/widget-tokens/:token с телом
+// {"origins": ["https://partner.example"], "config": {"theme": "light"}}.
+func updateWidgetToken(c *gin.Context) {
+	var body widgetTokenRequest
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, Response{Success: false, Error: err.Error()})
+		return
+	}
+	if msg := body.validate(); msg != "" {
+		c.JSON(http.StatusBadRequest, Response{Success: false, Error: msg})
+		return
+	}
+
+	token := c.Param("token")
+	res, err := db.ExecContext(c.Request.Context(), `
+		UPDATE widget_tokens SET origins = $2, config = $3 WHERE token = $1 AND NOT revoked
+	`, token, pq.Array(body.Origins), []byte(body.Config))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		c.JSON(http.StatusNotFound, Response{Success: false, Error: "widget token not found or revoked"})
+		return
+	}
+	// Новые источники и оформление должны действовать сразу.
+	cache.flush(widgetTokenCacheKey(token))
+	c.JSON(http.StatusOK, Response{
+		Success: true,
+		Data:    gin.H{"token": token, "origins": body.Origins, "config": body.Config},
+		Count:   1,
+	})
+}
+
+// revokeWidgetToken — HTTP-обработчик отзыва токена. Строка остаётся для истории.
+// Реагирует на DELETE /api/admin/widget-tokens/:token.
+func revokeWidgetToken(c *gin.Context) {
+	token := c.Param("token")
+	res, err := db.ExecContext(c.Request.Context(), "UPDATE widget_tokens SET revoked = true WHERE token = $1 AND NOT revoked", token)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		c.JSON(http.StatusNotFound, Response{Success: false, Error: "widget token not found or already revoked"})
+		return
+	}
+	cache.flush(widgetTokenCacheKey(token))
+	c.JSON(http.StatusOK, Response{Success: true})
+}